@@ -1,7 +1,7 @@
-# Creates, checks and packages EPUB3 books
+# Creates and checks EPUB3 books
 #
 Function Usage {
-  Write-Host "EPUBGen: Creates, checks and packages EPUB3 books"
+  Write-Host "EPUBGen: Creates and checks EPUB3 books"
   Write-Host "Usage:"
   Write-Host "  epg <bookname>"
 }
@@ -19,5 +19,5 @@ Write-Host "Generating $book..."
 if ($?) {
   Write-Host ""
   Write-Host "Checking $book..."
-  java -jar $epubcheck data\generated\$book --profile default -v 3.0 --mode exp -save
+  java -jar $epubcheck data\generated\$book.epub --profile default
 }
@@ -0,0 +1,54 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConformanceClaimOnCopyrightPage(t *testing.T) {
+	claim := func(metas ...string) func(string) string {
+		return func(source string) string {
+			return strings.Replace(source, `  <meta name="subject"`, strings.Join(metas, "\n")+"\n"+`  <meta name="subject"`, 1)
+		}
+	}
+	tests := []struct {
+		name    string
+		edit    func(string) string
+		want    []string
+		notWant []string
+	}{
+		{"no claim", nil, nil, []string{"This e-book meets", "conformance report"}},
+		{"claim", claim(`  <meta name="a11y-conformance" content="EPUB-A11Y-11_WCAG-21-AA"/>`),
+			[]string{`<p class="copy">This e-book meets EPUB Accessibility 1.1 - WCAG 2.1 Level AA.</p>`},
+			[]string{"certified by", "conformance report"}},
+		{"certified claim with a report", claim(
+			`  <meta name="a11y-conformance" content="EPUB-A11Y-11_WCAG-22-A"/>`,
+			`  <meta name="a11y-certifier" content="Accessible Books Ltd"/>`,
+			`  <meta name="a11y-report-url" content="https://example.com/reports/self-test"/>`),
+			[]string{
+				`This e-book meets EPUB Accessibility 1.1 - WCAG 2.2 Level A, as certified by Accessible Books Ltd.</p>`,
+				`<a href="https://example.com/reports/self-test">Accessibility conformance report</a>`,
+			}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", test.edit), io.Discard)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			page := readEpubFile(t, report.EpubFile, sectionFile(t, report, "copyright-page"))
+			for _, want := range test.want {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %s on the copyright page:\n%s", want, page)
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(page, notWant) {
+					t.Errorf("%s on the copyright page:\n%s", notWant, page)
+				}
+			}
+		})
+	}
+}
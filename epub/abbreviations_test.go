@@ -0,0 +1,95 @@
+package epub
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// abbreviationsYAML defines overlapping terms, a term with markup characters, and terms listed out of order.
+const abbreviationsYAML = `ZIP: Zone Improvement Plan
+HTML: HyperText Markup Language
+ML: Machine Learning
+api: application programming interface
+AT&T: American Telephone & Telegraph
+CSS: Cascading Style Sheets
+`
+
+// dtRegexp matches the terms of the list of abbreviations.
+var dtRegexp = regexp.MustCompile(`<dt><abbr title="[^"]*">([^<]*)</abbr></dt>`)
+
+// abbreviationsBook returns the example book with abbreviations.yaml and the edit of its source.
+func abbreviationsBook(t *testing.T, edit func(string) string) fstest.MapFS {
+	books := exampleBook(t, "example", edit)
+	books["example/abbreviations.yaml"] = &fstest.MapFile{Data: []byte(abbreviationsYAML)}
+	return books
+}
+
+func TestAbbreviations(t *testing.T) {
+	chapter1 := []string{
+		"<p>HTML is not ML, and XML, MLS and ML_x are neither.</p>",
+		`<p title="ML in an attribute">Again HTML and ML, <a href="https://example.com/ML">ML link</a>.</p>`,
+		"<h2>ML in a heading</h2>",
+		"<pre>",
+		"CSS in a listing",
+		"</pre>",
+		"<p><code>CSS</code> in code, then CSS and ml and AT&amp;T.</p>",
+	}
+	chapter2 := []string{"<p>ML again in another chapter, and ZIP.</p>"}
+	edit := func(source string) string {
+		source = insertBefore("<!--foreword-->", "<!--abbreviations-->")(source)
+		source = insertBefore("<!--chapter-->\n<h3>Chapter 2", chapter1...)(source)
+		return insertBefore("<!--part-->\n<h1>Part 2", chapter2...)(source)
+	}
+	report, err := testGenerator(t, abbreviationsBook(t, edit), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html := `<abbr title="HyperText Markup Language">HTML</abbr>`
+	ml := `<abbr title="Machine Learning">ML</abbr>`
+	css := `<abbr title="Cascading Style Sheets">CSS</abbr>`
+	att := `<abbr title="American Telephone &amp; Telegraph">AT&amp;T</abbr>`
+	for _, want := range []string{
+		"<p>" + html + " is not " + ml + ", and XML, MLS and ML_x are neither.</p>",
+		`<p title="ML in an attribute">Again HTML and ML, <a href="https://example.com/ML">ML link</a>.</p>`,
+		"<h2>ML in a heading</h2>",
+		"CSS in a listing",
+		"<p><code>CSS</code> in code, then " + css + " and ml and " + att + ".</p>",
+	} {
+		if page := readEpubFile(t, report.EpubFile, "OEBPS/Text/section004.xhtml"); !strings.Contains(page, want) {
+			t.Errorf("no %s in the first chapter:\n%s", want, page)
+		}
+	}
+	want := "<p>" + ml + " again in another chapter, and " + `<abbr title="Zone Improvement Plan">ZIP</abbr>` + ".</p>"
+	if page := readEpubFile(t, report.EpubFile, "OEBPS/Text/section005.xhtml"); !strings.Contains(page, want) {
+		t.Errorf("no %s in the second chapter:\n%s", want, page)
+	}
+
+	list := readEpubFile(t, report.EpubFile, "OEBPS/Text/abbreviations.xhtml")
+	terms := make([]string, 0)
+	for _, match := range dtRegexp.FindAllStringSubmatch(list, -1) {
+		terms = append(terms, match[1])
+	}
+	if got, want := strings.Join(terms, ", "), "api, AT&amp;T, CSS, HTML, ML, ZIP"; got != want {
+		t.Errorf("terms of the list = %s, want %s:\n%s", got, want, list)
+	}
+}
+
+func TestAbbreviationsInsensitive(t *testing.T) {
+	edit := func(source string) string {
+		source = withAttributes(`<meta name="abbreviation-case" content="insensitive"/>`)(source)
+		return insertBefore("<!--chapter-->\n<h3>Chapter 2", "<p>Html and ml, then API and HTML.</p>")(source)
+	}
+	report, err := testGenerator(t, abbreviationsBook(t, edit), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p><abbr title="HyperText Markup Language">Html</abbr> and <abbr title="Machine Learning">ml</abbr>, ` +
+		`then <abbr title="application programming interface">API</abbr> and HTML.</p>`
+	if page := readEpubFile(t, report.EpubFile, "OEBPS/Text/section004.xhtml"); !strings.Contains(page, want) {
+		t.Errorf("no %s in the chapter:\n%s", want, page)
+	}
+}
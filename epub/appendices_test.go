@@ -0,0 +1,148 @@
+package epub
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	navLinkRegexp    = regexp.MustCompile(`<a href="([^"]*)">(.*)</a>`)
+	ncxLabelRegexp   = regexp.MustCompile(`<text>(.*)</text>`)
+	ncxContentRegexp = regexp.MustCompile(`<content src="Text/([^"]*)"`)
+)
+
+// navOutline returns the entries of the TOC of nav.xhtml, one per line as "label href", indented by two
+// spaces for each level of nesting.
+func navOutline(nav string) string {
+	toc := nav[strings.Index(nav, `epub:type="toc" id="toc"`):]
+	toc = toc[:strings.Index(toc, "</nav>")]
+	var outline strings.Builder
+	depth := 0
+	for _, line := range strings.Split(toc, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "<ol>":
+			depth++
+		case line == "</ol>":
+			depth--
+		case navLinkRegexp.MatchString(line):
+			match := navLinkRegexp.FindStringSubmatch(line)
+			outline.WriteString(strings.Repeat("  ", depth-1) + match[2] + " " + match[1] + "\n")
+		}
+	}
+	return outline.String()
+}
+
+// ncxOutline returns the navPoints of toc.ncx like navOutline.
+func ncxOutline(ncx string) string {
+	var outline strings.Builder
+	depth := 0
+	label := ""
+	for _, line := range strings.Split(ncx, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "<navPoint "):
+			depth++
+		case line == "</navPoint>":
+			depth--
+		case ncxLabelRegexp.MatchString(line):
+			label = ncxLabelRegexp.FindStringSubmatch(line)[1]
+		case ncxContentRegexp.MatchString(line) && depth > 0:
+			href := ncxContentRegexp.FindStringSubmatch(line)[1]
+			outline.WriteString(strings.Repeat("  ", depth-1) + label + " " + href + "\n")
+		}
+	}
+	return outline.String()
+}
+
+// navBookOutline is the outline of the TOC of the example book in nav.xhtml up to its appendices, and
+// ncxBookOutline the same in toc.ncx, where the chapters follow their parts at the top level.
+const (
+	navBookOutline = `Cover Page cover.xhtml
+Title Page titlepage.xhtml
+Copyright copyright.xhtml
+Dedication section001.xhtml
+Foreword section002.xhtml
+Part 1 section003.xhtml
+  Chapter 1 section004.xhtml
+  Chapter 2 section005.xhtml
+Part 2 section006.xhtml
+  Chapter 3 section007.xhtml
+Afterword section008.xhtml
+`
+	ncxBookOutline = `Cover Page cover.xhtml
+Title Page titlepage.xhtml
+Copyright copyright.xhtml
+Dedication section001.xhtml
+Foreword section002.xhtml
+Part 1 section003.xhtml
+Chapter 1 section004.xhtml
+Chapter 2 section005.xhtml
+Part 2 section006.xhtml
+Chapter 3 section007.xhtml
+Afterword section008.xhtml
+`
+)
+
+func TestAppendixGroups(t *testing.T) {
+	appendices := []string{
+		"<!--appendix-->", "<h1>Maps</h1>", "<p>The maps.</p>",
+		"<!--appendix-->", `<h1 class="timeline">Timeline</h1>`, "<p>The dates.</p>",
+	}
+	wrapped := append(append([]string{"<!--appendices-->"}, appendices...), "<!--endappendices-->")
+	tests := []struct {
+		name     string
+		lines    []string
+		group    bool
+		letter   bool
+		outline  string
+		headings []string
+	}{
+		{"ungrouped", appendices, false, false, `Maps section009.xhtml
+Timeline section010.xhtml
+`, []string{"<h1>Maps</h1>", `<h1 class="timeline">Timeline</h1>`}},
+		{"ungrouped lettered", appendices, false, true, `Appendix A: Maps section009.xhtml
+Appendix B: Timeline section010.xhtml
+`, []string{"<h1>Appendix A: Maps</h1>", `<h1 class="timeline">Appendix B: Timeline</h1>`}},
+		{"grouped by the config", appendices, true, false, `Appendices section009.xhtml
+  Maps section009.xhtml
+  Timeline section010.xhtml
+`, []string{"<h1>Maps</h1>", `<h1 class="timeline">Timeline</h1>`}},
+		{"grouped lettered", appendices, true, true, `Appendices section009.xhtml
+  Appendix A: Maps section009.xhtml
+  Appendix B: Timeline section010.xhtml
+`, []string{"<h1>Appendix A: Maps</h1>", `<h1 class="timeline">Appendix B: Timeline</h1>`}},
+		{"grouped by the directives", wrapped, false, true, `Appendices section009.xhtml
+  Appendix A: Maps section009.xhtml
+  Appendix B: Timeline section010.xhtml
+`, []string{"<h1>Appendix A: Maps</h1>", `<h1 class="timeline">Appendix B: Timeline</h1>`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", insertBefore("<!--end-->", test.lines...)), io.Discard)
+			generator.Settings = DefaultSettings()
+			generator.Settings.GroupAppendices = test.group
+			generator.Settings.LetterAppendices = test.letter
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := navBookOutline + test.outline
+			if got := navOutline(readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")); got != want {
+				t.Errorf("nav.xhtml TOC:\n%s\nwant:\n%s", got, want)
+			}
+			want = ncxBookOutline + test.outline
+			if got := ncxOutline(readEpubFile(t, report.EpubFile, "OEBPS/toc.ncx")); got != want {
+				t.Errorf("toc.ncx navMap:\n%s\nwant:\n%s", got, want)
+			}
+			for i, id := range []string{"section009", "section010"} {
+				page := readEpubFile(t, report.EpubFile, "OEBPS/Text/"+id+".xhtml")
+				if !strings.Contains(page, test.headings[i]) {
+					t.Errorf("no heading %s in the appendix page:\n%s", test.headings[i], page)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package epub
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttributeOrderStable(t *testing.T) {
+	edit := withAttributes(
+		`<meta name="contributor.3" content="Ann Lee|ill"/>`,
+		`<meta name="zeta" content="last"/>`,
+		`<meta name="contributor.1" content="Jane Smith|trl|Smith, Jane"/>`,
+		`<meta name="alpha" content="first"/>`,
+		`<meta name="contributor.2" content="Bo Chen|edt"/>`,
+	)
+	modelFile := filepath.Join(t.TempDir(), "model.json") // the same in every run, since it is an input of the build
+	var firstModel, firstOPF string
+	for run := 0; run < 10; run++ {
+		generator := testGenerator(t, exampleBook(t, "example", edit), io.Discard)
+		generator.Settings = DefaultSettings()
+		generator.Settings.EmitModel = modelFile
+		report, err := generator.Generate("example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		model, err := os.ReadFile(modelFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+		if run == 0 {
+			firstModel, firstOPF = string(model), opf
+			smith, chen, lee := strings.Index(opf, "Jane Smith"), strings.Index(opf, "Bo Chen"), strings.Index(opf, "Ann Lee")
+			if smith == -1 || !(smith < chen && chen < lee) {
+				t.Errorf("the contributors are not in the order of their numbers:\n%s", opf)
+			}
+			continue
+		}
+		if string(model) != firstModel {
+			t.Fatalf("run %d: the model differs from the first run:\n%s\nthen:\n%s", run, firstModel, model)
+		}
+		if opf != firstOPF {
+			t.Fatalf("run %d: package.opf differs from the first run:\n%s\nthen:\n%s", run, firstOPF, opf)
+		}
+	}
+}
+
+func TestUnknownHeadingsReportedInOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(string) string
+		settings func(t *testing.T) *Settings
+		want     string
+	}{
+		{"attributes", withAttributes(
+			`<meta name="default-heading.zzz" content="Z"/>`,
+			`<meta name="default-heading.mmm" content="M"/>`,
+			`<meta name="default-heading.aaa" content="A"/>`,
+		), func(*testing.T) *Settings { return nil },
+			// The first in the source is reported, though it is the last by name.
+			"attribute 'default-heading.zzz' has unknown directive 'zzz'"},
+		{"config", nil, func(t *testing.T) *Settings {
+			return loadConfig(t, "default_headings:\n  zzz: Z\n  mmm: M\n  aaa: A\n")
+		}, "config parameter 'default_headings' has unknown directive 'aaa'"}, // the first by name
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for run := 0; run < 10; run++ {
+				generator := testGenerator(t, exampleBook(t, "example", test.edit), io.Discard)
+				if settings := test.settings(t); settings != nil {
+					generator.Settings = settings
+				}
+				_, err := generator.Generate("example")
+				if err == nil || !strings.Contains(err.Error(), test.want) {
+					t.Fatalf("run %d: Generate error = %v, want one containing %q", run, err, test.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1240 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 13-Apr-2022
+//
+// The steps of the generation of a book, moved from the main source file.
+
+package epub
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+	"github.com/roslamir/ep3gen/internal/fileutil"
+	"github.com/roslamir/ep3gen/internal/gen"
+)
+
+// errEndMissing is returned when the input ends in the sections, before the <!--end--> directive.
+var errEndMissing = errors.New("input file ended before the <!--end--> directive")
+
+// build generates the book named by the parameters of the context and fills in the report. Returns the
+// error which stopped the build. An interruptible build releases the lock of the book and exits on an
+// interrupt, which only suits the command line.
+func build(ctx *gen.Context, report *Report, interruptible bool) error {
+	parms := ctx.Parms()
+
+	// Loads the template files.
+	if err := ctx.LoadTemplates(); err != nil {
+		return err
+	}
+
+	// Check the book directory and the input source file.
+	sourceDirSpec := filepath.Join(parms.SourceDir, parms.BookName)
+	sourceFileSpec := filepath.Join(sourceDirSpec, "source.html")
+	if err := checkBookSource(parms.SourceDir, sourceDirSpec, sourceFileSpec); err != nil {
+		return err
+	}
+
+	// Lock the generated book directory against other builds of the same book until this one ends.
+	targetDirSpec := filepath.Join(parms.TargetDir, parms.BookName)
+	lock, err := ctx.AcquireLock(targetDirSpec, parms.Wait)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	if interruptible {
+		lock.ReleaseOnSignal()
+	}
+
+	// Skip the book if nothing affecting the output has changed since the last successful build.
+	stateFileSpec := gen.StateFileSpec(parms.TargetDir, parms.BookName)
+	epubFileSpec := gen.EpubFileSpec(parms.TargetDir, parms.BookName)
+	inputHash, err := ctx.InputHash(sourceDirSpec)
+	if err != nil {
+		return err
+	}
+	if !parms.Force && gen.IsUpToDate(stateFileSpec, epubFileSpec, inputHash) {
+		fmt.Fprintf(ctx.Output(), "%s: up to date (use -force to rebuild)\n", parms.BookName)
+		report.UpToDate = true
+		return nil
+	}
+
+	// A metadata-only build reuses the section files of the last build, provided nothing but the
+	// metadata attributes in <head> has changed.
+	sectionsHash, err := ctx.SectionsHash(sourceDirSpec, sourceFileSpec)
+	if err != nil {
+		return err
+	}
+	var prevCreated string
+	if parms.MetadataOnly {
+		if prevCreated, err = ctx.CheckSectionsUnchanged(stateFileSpec, targetDirSpec, sectionsHash); err != nil {
+			return err
+		}
+	} else {
+		prevCreated = ctx.PreviousCreated(targetDirSpec, epubFileSpec) // read before the directory is cleared
+	}
+
+	// Read in the whole input source file and store the lines in the string slice 'lines'.
+	buffer, err := ctx.NewInputBuffer(sourceFileSpec)
+	if err != nil {
+		return err
+	}
+	buffer.SetInputHash(inputHash)
+
+	// Remove all the children of the generated output directory except the lock file,
+	// unless the section files are reused.
+	if !parms.MetadataOnly {
+		if err = fileutil.ClearDir(targetDirSpec, gen.LockFileName); err != nil {
+			return err
+		}
+	}
+
+	// Initialize the gen package
+	ctx.Init(sourceDirSpec, targetDirSpec)
+	if parms.MetadataOnly {
+		ctx.ReuseSectionFiles()
+	}
+
+	//-----------------------------------------------------------------------------------
+	// Go through the source HTML lines and extract the metadata from the <head> section.
+	//-----------------------------------------------------------------------------------
+
+	// Skip over preliminary HTML lines until <head> is found
+	for {
+		if err = buffer.NextLineFor("<head>"); err != nil {
+			return err
+		}
+		if gen.IsStartTag(buffer.CurrLine, "head") {
+			break
+		}
+	}
+
+	// Extract all the meta data defined and store them into the 'attributes' map.
+	if err = buffer.LoadAttributes(); err != nil {
+		return err
+	}
+
+	// Let the metadata filters added by library users change the attributes before they are checked.
+	if err = buffer.ApplyMetadataFilters(); err != nil {
+		return err
+	}
+
+	//-----------------------------------------------------------------------------------
+	// Check for required attributes.
+	//-----------------------------------------------------------------------------------
+
+	var value string
+	if value = buffer.GetAttribute("version"); value != "" {
+		if value != "epub3" {
+			return errors.New("attribute 'version' with value 'epub3' required")
+		}
+	} else {
+		return errors.New("attribute 'version' required")
+	}
+	if value = buffer.GetAttribute("title"); value == "" {
+		return errors.New("attribute 'title' required")
+	}
+	if value = buffer.GetAttribute("title-sort"); value == "" {
+		return errors.New("attribute 'title-sort' required")
+	}
+	if value = buffer.GetAttribute("author"); value == "" {
+		return errors.New("attribute 'author' required")
+	}
+	if value = buffer.GetAttribute("author-sort"); value == "" {
+		return errors.New("attribute 'author-sort' required")
+	}
+	if value = buffer.GetAttribute("published"); value == "" {
+		return errors.New("attribute 'published' required")
+	}
+	if value = buffer.GetAttribute("publisher"); value == "" {
+		return errors.New("attribute 'publisher' required")
+	}
+	if value = buffer.GetAttribute("language"); value == "" {
+		return errors.New("attribute 'language' required")
+	}
+
+	// Check the optional series of the book.
+	if err = buffer.CheckSeries(); err != nil {
+		return err
+	}
+
+	// Read the contributors of the book with their roles.
+	if err = buffer.CheckContributors(); err != nil {
+		return err
+	}
+
+	// Derive the text direction from the language, unless overridden by the "direction" attribute.
+	if err = buffer.CheckDirection(); err != nil {
+		return err
+	}
+
+	// Check the optional justification and hyphenation of the text.
+	if err = buffer.CheckTextLayout(); err != nil {
+		return err
+	}
+
+	// Check the optional accessibility conformance claim.
+	if err = buffer.CheckConformanceClaim(); err != nil {
+		return err
+	}
+
+	// Check the optional schema.org accessibility metadata.
+	if err = buffer.CheckAccessibilityMetadata(); err != nil {
+		return err
+	}
+
+	// Check the overrides for the default section headings.
+	if err = buffer.CheckDefaultHeadings(); err != nil {
+		return err
+	}
+
+	// Load the optional abbreviations, expanded on their first use in each section.
+	if err = buffer.LoadAbbreviations(); err != nil {
+		return err
+	}
+
+	// Reserve the section IDs given with the id argument of the directives, before any section is generated.
+	if err = buffer.ReserveSectionIDs(); err != nil {
+		return err
+	}
+
+	// Check and extract the mandatory attribute "cover-image" which specifies the cover image file.
+	if err = buffer.CheckCoverImage(); err != nil {
+		return err
+	}
+
+	// Check and extract the optional attribute "images" which lists all the image files embedded in the book other than the cover image.
+	if err = buffer.CheckImageFiles(); err != nil {
+		return err
+	}
+
+	// Check and extract the optional attribute "media" which lists the audio and video files played in the book.
+	if err = buffer.CheckMediaFiles(); err != nil {
+		return err
+	}
+
+	// Register the files referenced from the stylesheet with url(), such as background ornaments.
+	if err = buffer.CheckStylesheetAssets(); err != nil {
+		return err
+	}
+
+	// The identifier of the e-book is the attribute "uuid", or else derived from the title and the author.
+	bookUUID, err := buffer.BookUUID()
+	if err != nil {
+		return err
+	}
+	ctx.SetBookUUID(bookUUID)
+
+	// If updating an existing e-book, use the previous "created" date from the package file of the last build,
+	// otherwise set the "created" attributes to the build timestamp.
+	// In either case, set the "modified" attributes to the build timestamp, which the attribute "modified"
+	// or the SOURCE_DATE_EPOCH environment variable pins for reproducible builds.
+	buildTime, err := buffer.BuildTime()
+	if err != nil {
+		return err
+	}
+	currTimeStamp := buildTime.Format(time.RFC3339)
+	if value := buffer.GetAttribute("created"); value == "" {
+		if prevCreated != "" {
+			buffer.SetAttribute("created", prevCreated)
+		} else {
+			buffer.SetAttribute("created", currTimeStamp)
+		}
+	}
+	buffer.SetAttribute("modified", currTimeStamp)
+
+	// Enable the optional audit for characters which may render as missing glyphs.
+	if parms.AuditGlyphs {
+		if err = buffer.StartGlyphAudit(parms.GlyphRanges); err != nil {
+			return err
+		}
+		buffer.RegisterFeature("glyph audit", true, "")
+	} else {
+		buffer.RegisterFeature("glyph audit", false, "not requested (-glyphs flag)")
+	}
+
+	// Enable the analysis of the constructs which degrade when converted for Kindle, if requested.
+	if parms.Target == "kindle" {
+		if err = buffer.StartKindleAudit(); err != nil {
+			return err
+		}
+		buffer.RegisterFeature("kindle analysis", true, "")
+	} else {
+		buffer.RegisterFeature("kindle analysis", false, "not requested (-target kindle)")
+	}
+
+	// Enable the scan of the inline style attributes left by word processors, and their removal.
+	if parms.Styles || parms.StripStyles {
+		buffer.StartInlineStyles(parms.StripStyles, parms.KeepStyles)
+	}
+	if parms.StripStyles {
+		buffer.RegisterFeature("inline style cleanup", true, "")
+	} else {
+		buffer.RegisterFeature("inline style cleanup", false, "not configured (strip_styles)")
+	}
+
+	// Enable the lint of the section content, except for the disabled rules, if requested.
+	if parms.Lint {
+		if err = buffer.StartLint(parms.LintDisable); err != nil {
+			return err
+		}
+	} else {
+		buffer.RegisterFeature("content lint", false, "not requested (-lint flag or lint)")
+	}
+
+	// Trace the phases of the parse and the directive dispatched on each line, if requested.
+	if parms.Trace {
+		buffer.StartTrace()
+	}
+
+	// Warn about chapter headings in the middle of a chapter, a sign of a missing <!--chapter--> directive.
+	if err = buffer.StartMergedChapterCheck(parms.ChapterHeadingPattern); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.Output(), "\nGenerating EPUB3 e-book \"%s\" from %s\n", buffer.GetAttribute("title"), parms.BookName)
+
+	// Skip over the lines until the tag <body> is found
+	for {
+		if err = buffer.NextLineFor("<body>"); err != nil {
+			return err
+		}
+		if gen.IsStartTag(buffer.CurrLine, "body") {
+			break
+		}
+	}
+	buffer.TracePhase("frontmatter")
+	if err = buffer.NextLine(); err != nil {
+		return err
+	} // should point to the first directive
+
+	// Read the CSS rules of the optional <!--styles--> block, linked from every page generated from here on.
+	if err = buffer.ReadStylesBlock(); err != nil {
+		return err
+	}
+
+	//=============================
+	// BOOK GENERATION STARTS HERE
+	//=============================
+	//------------------------------------------------------------------------
+	// STEP 1: Generate the cover page section with data from the attributes.
+	// Use the cover image file specified in the "cover-image" attribute.
+	//------------------------------------------------------------------------
+	if err = buffer.GenCoverSection(); err != nil {
+		return err
+	}
+
+	//------------------------------------------------------------------------------------------------
+	// Now, process the <body> section of the source HTML file. Lines containing HTML comments are
+	// taken as directives in building the e-book. The last directive should be <!--end-->. Eveything
+	// after it is ignored and it should be put just before the </body> tag.
+	//------------------------------------------------------------------------------------------------
+
+	//------------------------------------------------------------------------------------------------
+	// STEP 2: Generate the title page section.
+	//------------------------------------------------------------------------------------------------
+	if err = buffer.GenTitlePageSection(); err != nil {
+		return err
+	}
+
+	//------------------------------------------------------------------------------------------------
+	// STEP 3: Generate the copyright section.
+	// The next directive MUST be the "<!--copyright-->" section directive.
+	//------------------------------------------------------------------------------------------------
+	if err = buffer.GenCopyrightSection(currTimeStamp[:10]); err != nil {
+		return err
+	} // Just use the date portion: 2006-01-02
+
+	//------------------------------------------------------------------------------------------------
+	// STEP 4: Generate the optional frontmatter sections.
+	// The optional fontmatter directives are:
+	// 1. <!--bibliography-->
+	// 2. <!--acknowledgments-->
+	// 3. <!--dedication-->
+	// 4. <!--epigraph-->
+	// 5. <!--foreword-->
+	// 6. <!--introduction-->
+	// 7. <!--prologue-->
+	// 8. <!--preamble-->
+	// The first seven may only occur once but 'preamble' may occur multiple times as a generic
+	// frontmatter section not covered by the first seven.
+	// The generated pages <!--abbreviations-->, <!--halftitle-->, <!--loi-->, <!--quicknav--> and <!--warnings-->
+	// may each occur once
+	// and take no content lines.
+	// The first line after the directive must be the section heading formatted as one of the HTML
+	// tags: <h1> to <h6>.
+	// If no heading is applicable, use '<h1>&#160;</h1>' for the heading line.
+	// It must be followed by one or more formatted HTML lines making up the frontmatter section.
+	// Each directive must be followed by one of the <h1> to <h6> tags with the section heading.
+	// If no heading is needed, Use <h1>&#160;</h1> and the default heading will be used in the TOC.
+	//------------------------------------------------------------------------------------------------
+
+	var (
+		bibliographyGiven    bool
+		acknowledgmentsGiven bool
+		dedicationGiven      bool
+		epigraphGiven        bool
+		forewordGiven        bool
+		introductionGiven    bool
+		prefaceGiven         bool
+		prologueGiven        bool
+		halftitleGiven       bool
+		abbreviationsGiven   bool
+		warningsGiven        bool
+	)
+
+loop1:
+	for {
+		directive, err := buffer.Directive()
+		if err != nil {
+			return err
+		}
+		switch directive.Name {
+		case "bibliography":
+			// Generate bibliography section, if requested.
+			if bibliographyGiven {
+				return lineError(directive.Line, "directive <!--bibliography--> already specified")
+			}
+			bibliographyGiven = true
+			section, err := newSection(buffer, directive, epubtype.Bibliography)
+			if err != nil {
+				return err
+			}
+			buffer.SetPreview(section, directive)
+			if err = buffer.GenFrontMatterSection(section); err != nil {
+				return err
+			}
+
+		case "acknowledgments":
+			// Generate acknowledgments section, if requested.
+			if acknowledgmentsGiven {
+				return lineError(directive.Line, "directive <!--acknowledgments--> already specified")
+			}
+			acknowledgmentsGiven = true
+			section, err := newSection(buffer, directive, epubtype.Acknowledgments)
+			if err != nil {
+				return err
+			}
+			buffer.SetPreview(section, directive)
+			if err = buffer.GenFrontMatterSection(section); err != nil {
+				return err
+			}
+
+		case "dedication":
+			// Generate dedication section, if requested.
+			if dedicationGiven {
+				return lineError(directive.Line, "directive <!--dedication--> already specified")
+			}
+			dedicationGiven = true
+			section, err := newSection(buffer, directive, epubtype.Dedication)
+			if err != nil {
+				return err
+			}
+			buffer.SetPreview(section, directive)
+			if err = buffer.GenFrontMatterSection(section); err != nil {
+				return err
+			}
+
+		case "epigraph":
+			// Generate epigraph section, if requested.
+			if epigraphGiven {
+				return lineError(directive.Line, "directive <!--epigraph--> already specified")
+			}
+			epigraphGiven = true
+			section, err := newSection(buffer, directive, epubtype.Epigraph)
+			if err != nil {
+				return err
+			}
+			buffer.SetPreview(section, directive)
+			if err = buffer.GenEpigraphSection(section); err != nil {
+				return err
+			}
+
+		case "foreword":
+			// Generate foreword section, if requested.
+			if forewordGiven {
+				return lineError(directive.Line, "directive <!--foreword--> already specified")
+			}
+			forewordGiven = true
+			section, err := newSection(buffer, directive, epubtype.Foreword)
+			if err != nil {
+				return err
+			}
+			buffer.SetPreview(section, directive)
+			if err = buffer.GenFrontMatterSection(section); err != nil {
+				return err
+			}
+
+		case "introduction":
+			// Generate introduction section, if requested.
+			if introductionGiven {
+				return lineError(directive.Line, "directive <!--introduction--> already specified")
+			}
+			introductionGiven = true
+			section, err := newSection(buffer, directive, epubtype.Introduction)
+			if err != nil {
+				return err
+			}
+			buffer.SetPreview(section, directive)
+			if err = buffer.GenFrontMatterSection(section); err != nil {
+				return err
+			}
+
+		case "preface":
+			// Generate preface section, if requested.
+			if prefaceGiven {
+				return lineError(directive.Line, "directive <!--preface--> already specified")
+			}
+			prefaceGiven = true
+			section, err := newSection(buffer, directive, epubtype.Preface)
+			if err != nil {
+				return err
+			}
+			buffer.SetPreview(section, directive)
+			if err = buffer.GenFrontMatterSection(section); err != nil {
+				return err
+			}
+
+		case "prologue":
+			// Generate prologue section, if requested.
+			if prologueGiven {
+				return lineError(directive.Line, "directive <!--prologue--> already specified")
+			}
+			prologueGiven = true
+			section, err := newSection(buffer, directive, epubtype.Prologue)
+			if err != nil {
+				return err
+			}
+			buffer.SetPreview(section, directive)
+			if err = buffer.GenFrontMatterSection(section); err != nil {
+				return err
+			}
+
+		case "quicknav":
+			// Place the quick navigation page here; it is generated after all the other sections.
+			if err = buffer.AddQuickNavSection(); err != nil {
+				return err
+			}
+			buffer.TraceDirective(directive, "quick navigation page placed here")
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		case "halftitle":
+			// Generate the half-title page from the title attribute, if requested.
+			if halftitleGiven {
+				return lineError(directive.Line, "directive <!--halftitle--> already specified")
+			}
+			halftitleGiven = true
+			if err = buffer.GenHalfTitleSection(directive); err != nil {
+				return err
+			}
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		case "abbreviations":
+			// Generate the list of the abbreviations in abbreviations.yaml, if requested.
+			if abbreviationsGiven {
+				return lineError(directive.Line, "directive <!--abbreviations--> already specified")
+			}
+			abbreviationsGiven = true
+			if err = buffer.GenAbbreviationsSection(directive); err != nil {
+				return err
+			}
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		case "warnings":
+			// Generate the content warnings page from the content-warnings attribute, if requested.
+			if warningsGiven {
+				return lineError(directive.Line, "directive <!--warnings--> already specified")
+			}
+			warningsGiven = true
+			if err = buffer.GenContentWarningsSection(directive); err != nil {
+				return err
+			}
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		case "loi":
+			// Place the list of illustrations here; it is generated after all the other sections.
+			if err = buffer.AddLOISection(); err != nil {
+				return err
+			}
+			buffer.TraceDirective(directive, "list of illustrations placed here")
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		case "preamble":
+			// Generate generic preamble section, may occur multiple times.
+			section, err := newSection(buffer, directive, epubtype.Preamble)
+			if err != nil {
+				return err
+			}
+			buffer.SetPreview(section, directive)
+			if err = buffer.GenFrontMatterSection(section); err != nil {
+				return err
+			}
+
+		case "raw":
+			// Copy the hand-crafted XHTML page as it is, may occur multiple times.
+			if err = buffer.GenRawSection(directive, epubtype.FrontMatter); err != nil {
+				return err
+			}
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		case "tocentry", "image":
+			return lineError(directive.Line, "<!--%s--> is only allowed inside the body of a section", directive.Name)
+
+		case "footnote":
+			return lineError(directive.Line, "<!--footnote--> is only allowed inside the body of a section")
+
+		case "spoiler", "endspoiler":
+			return lineError(directive.Line, "<!--%s--> is only allowed inside the body of a section", directive.Name)
+
+		case "longdesc", "endlongdesc":
+			return lineError(directive.Line, "<!--%s--> is only allowed right after the image line of <!--figure-->", directive.Name)
+
+		case "sep":
+			return lineError(directive.Line, "<!--sep--> is only allowed inside <!--epigraph-->")
+
+		case "styles", "endstyles":
+			return lineError(directive.Line, "<!--%s--> is only allowed at the start of the body, before the title page and <!--copyright-->",
+				directive.Name)
+
+		default:
+			buffer.TracePhase("bodymatter")
+			break loop1
+		}
+	}
+
+	// With frontmatter: combined, the title page, copyright and frontmatter sections go into a single file.
+	if err = buffer.GenCombinedFrontMatter(); err != nil {
+		return err
+	}
+
+	// The quick navigation page goes right after the copyright page unless placed by the directive.
+	if parms.QuickNav {
+		buffer.InsertQuickNavSection()
+	}
+
+	//------------------------------------------------------------------------------------------------
+	// STEP 5: Generate the part and chapter (bodymatter) sections.
+	// An e-book may consist of zero or more parts and one or more chapters.
+	// We also check if the part or chapter is the first since we want to add that section to the
+	// Guides page for the book.
+	//------------------------------------------------------------------------------------------------
+
+	firstBodymatter := true
+
+loop2:
+	for {
+		directive, err := buffer.Directive()
+		if err != nil {
+			return err
+		}
+		switch directive.Name {
+		case "part":
+			// Generate part section, may occur zero or more times
+			section, err := newSection(buffer, directive, epubtype.Part)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBodyMatterSection(section); err != nil {
+				return err
+			}
+			if firstBodymatter {
+				firstBodymatter = false
+				buffer.AddGuide(section) // add to guides slice
+			}
+
+		case "chapter":
+			// Generate chapter section, may occur one or more times
+			section, err := newSection(buffer, directive, epubtype.Chapter)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBodyMatterSection(section); err != nil {
+				return err
+			}
+			if firstBodymatter {
+				firstBodymatter = false
+				buffer.AddGuide(section) // add to guides slice
+			}
+
+		case "raw":
+			// Copy the hand-crafted XHTML page as it is among the chapters, may occur multiple times.
+			if err = buffer.GenRawSection(directive, epubtype.Chapter); err != nil {
+				return err
+			}
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		default:
+			buffer.TracePhase("backmatter")
+			break loop2
+		}
+	}
+
+	// If the flag 'firstBodymatter' is still true, it means neither part nor chapter was given, and
+	// we treat this as an error condition, unless the input ended in the frontmatter.
+	if firstBodymatter {
+		if buffer.AtEOF() {
+			return errEndMissing
+		}
+		return errors.New("at least one <!--chapter--> directive must be specified")
+	}
+
+	// Re-order the parts and chapters by order.yaml in the book directory, if there is one.
+	if err = buffer.ReorderBodymatter(); err != nil {
+		return err
+	}
+
+	//------------------------------------------------------------------------------------------------
+	// STEP 6: Generate the optional backmatter sections.
+	// The optional backmatter directives are:
+	// 1. <!--acknowledgments-->
+	// 2. <!--bibliography-->
+	// 3. <!--afterword-->
+	// 4. <!--epilogue-->
+	// 5. <!--about-the-author-->
+	// 6. <!--also-by-->
+	// 7. <!--glossary-->
+	// 8. <!--colophon-->
+	// 9. <!--appendix-->
+	// The appendices may be wrapped in <!--appendices--> and <!--endappendices--> to group them under
+	// a single entry in the TOC.
+	// All but 'glossary' and 'appendix' may only occur once; 'appendix' may occur multiple times as a
+	// generic backmatter section not covered by the others. Acknowledgments and bibliography may be
+	// placed either in the frontmatter or in the backmatter, but not both.
+	// The first line after the directive must be the section heading formatted as one of the HTML
+	// tags: <h1> to <h6>.
+	// If no heading is applicable, use '<h1>&#160;</h1>' for the heading line.
+	// It must be followed by one or more formatted HTML lines making up the backmatter section.
+	//------------------------------------------------------------------------------------------------
+
+	var (
+		afterwordGiven    bool
+		epilogueGiven     bool
+		aboutAuthorGiven  bool
+		alsoByGiven       bool
+		colophonGiven     bool
+		firstBackmatter   bool = true
+		inAppendices      bool // between <!--appendices--> and <!--endappendices-->
+		appendicesGrouped int  // the number of appendices inside <!--appendices-->
+	)
+
+loop3:
+	for {
+		// Section readers stop at the end of the input, which is only legal after <!--end-->.
+		if buffer.AtEOF() {
+			return errEndMissing
+		}
+
+		directive, err := buffer.Directive()
+		if err != nil {
+			return err
+		}
+		if inAppendices && directive.Name != "appendix" && directive.Name != "endappendices" {
+			return lineError(directive.Line, "only <!--appendix--> sections are allowed inside <!--appendices-->, found %s",
+				buffer.CurrLine)
+		}
+		switch directive.Name {
+		case "acknowledgments":
+			// Generate acknowledgments section in the backmatter, if not already given in the frontmatter.
+			if acknowledgmentsGiven {
+				return lineError(directive.Line, "directive <!--acknowledgments--> already specified")
+			}
+			acknowledgmentsGiven = true
+			section, err := newSection(buffer, directive, epubtype.Acknowledgments)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBackMatterSection(section); err != nil {
+				return err
+			}
+			if firstBackmatter {
+				firstBackmatter = false
+				buffer.AddGuide(section)
+			}
+
+		case "bibliography":
+			// Generate bibliography section in the backmatter, if not already given in the frontmatter.
+			if bibliographyGiven {
+				return lineError(directive.Line, "directive <!--bibliography--> already specified")
+			}
+			bibliographyGiven = true
+			section, err := newSection(buffer, directive, epubtype.Bibliography)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBackMatterSection(section); err != nil {
+				return err
+			}
+			if firstBackmatter {
+				firstBackmatter = false
+				buffer.AddGuide(section)
+			}
+
+		case "afterword":
+			// Generate afterword section, if specified.
+			if afterwordGiven {
+				return lineError(directive.Line, "directive <!--afterword--> already specified")
+			}
+			afterwordGiven = true
+			section, err := newSection(buffer, directive, epubtype.Afterword)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBackMatterSection(section); err != nil {
+				return err
+			}
+			if firstBackmatter {
+				firstBackmatter = false
+				buffer.AddGuide(section)
+			}
+
+		case "epilogue":
+			// Generate epilogue section, if specified.
+			if epilogueGiven {
+				return lineError(directive.Line, "directive <!--epilogue--> already specified")
+			}
+			epilogueGiven = true
+			section, err := newSection(buffer, directive, epubtype.Epilogue)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBackMatterSection(section); err != nil {
+				return err
+			}
+			if firstBackmatter {
+				firstBackmatter = false
+				buffer.AddGuide(section)
+			}
+
+		case "about-the-author":
+			// Generate the about the author section, if specified.
+			if aboutAuthorGiven {
+				return lineError(directive.Line, "directive <!--about-the-author--> already specified")
+			}
+			aboutAuthorGiven = true
+			section, err := newSection(buffer, directive, epubtype.Appendix)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBackMatterSection(section); err != nil {
+				return err
+			}
+			if firstBackmatter {
+				firstBackmatter = false
+				buffer.AddGuide(section)
+			}
+
+		case "also-by":
+			// Generate the list of the other books of the author, if specified.
+			if alsoByGiven {
+				return lineError(directive.Line, "directive <!--also-by--> already specified")
+			}
+			alsoByGiven = true
+			section, err := newSection(buffer, directive, epubtype.Appendix)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBackMatterSection(section); err != nil {
+				return err
+			}
+			if firstBackmatter {
+				firstBackmatter = false
+				buffer.AddGuide(section)
+			}
+
+		case "glossary":
+			// Generate glossary section if specified, may occur multiple times.
+			section, err := newSection(buffer, directive, epubtype.Glossary)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBackMatterSection(section); err != nil {
+				return err
+			}
+			if firstBackmatter {
+				firstBackmatter = false
+				buffer.AddGuide(section)
+			}
+
+		case "colophon":
+			// Generate colophon section, if specified.
+			if colophonGiven {
+				return lineError(directive.Line, "directive <!--colophon--> already specified")
+			}
+			colophonGiven = true
+			section, err := newSection(buffer, directive, epubtype.Colophon)
+			if err != nil {
+				return err
+			}
+			if err = buffer.GenBackMatterSection(section); err != nil {
+				return err
+			}
+			if firstBackmatter {
+				firstBackmatter = false
+				buffer.AddGuide(section)
+			}
+
+		case "appendix":
+			// Generate appendix section if specified, may occur multiple times.
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+			heading, err := buffer.Heading(directive.Name)
+			if err != nil {
+				return err
+			}
+			if heading, err = buffer.AppendixHeading(heading); err != nil {
+				return err
+			}
+			section := buffer.NewSectionData(directive, epubtype.Appendix, heading)
+			buffer.AddSection(section)
+			buffer.TraceSection(directive, section)
+			if inAppendices || parms.GroupAppendices {
+				if _, found := directive.Args["parent"]; found {
+					return lineError(directive.Line, "the parent argument cannot be used on the appendices grouped under a single TOC entry")
+				}
+				if !buffer.InAppendixGroup() {
+					if err = buffer.StartAppendixGroup(directive); err != nil {
+						return err
+					}
+				}
+				buffer.AddToAppendixGroup(section)
+				appendicesGrouped++
+			}
+			if err = buffer.GenBackMatterSection(section); err != nil {
+				return err
+			}
+			if firstBackmatter {
+				firstBackmatter = false
+				buffer.AddGuide(section)
+			}
+
+		case "appendices":
+			// Start the appendices grouped under a single TOC entry, ended by <!--endappendices-->.
+			if err = buffer.StartAppendixGroup(directive); err != nil {
+				return err
+			}
+			inAppendices = true
+			appendicesGrouped = 0
+			buffer.TraceDirective(directive, "appendices group opened")
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		case "endappendices":
+			if !inAppendices {
+				return lineError(directive.Line, "<!--endappendices--> without <!--appendices-->")
+			}
+			if appendicesGrouped == 0 {
+				return lineError(directive.Line, "<!--appendices--> must contain at least one <!--appendix-->")
+			}
+			inAppendices = false
+			buffer.TraceDirective(directive, "appendices group closed")
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		case "raw":
+			// Copy the hand-crafted XHTML page as it is, may occur multiple times.
+			if err = buffer.GenRawSection(directive, epubtype.BackMatter); err != nil {
+				return err
+			}
+			if err = buffer.NextLine(); err != nil {
+				return err
+			}
+
+		case "end":
+			buffer.TraceFinish()
+			break loop3
+
+		case "tocentry", "image":
+			return lineError(directive.Line, "<!--%s--> is only allowed inside the body of a section", directive.Name)
+
+		case "footnote":
+			return lineError(directive.Line, "<!--footnote--> is only allowed inside the body of a section")
+
+		case "spoiler", "endspoiler":
+			return lineError(directive.Line, "<!--%s--> is only allowed inside the body of a section", directive.Name)
+
+		case "longdesc", "endlongdesc":
+			return lineError(directive.Line, "<!--%s--> is only allowed right after the image line of <!--figure-->", directive.Name)
+
+		case "sep":
+			return lineError(directive.Line, "<!--sep--> is only allowed inside <!--epigraph-->")
+
+		case "styles", "endstyles":
+			return lineError(directive.Line, "<!--%s--> is only allowed at the start of the body, before the title page and <!--copyright-->",
+				directive.Name)
+
+		default:
+			return lineError(directive.Line, "unknown directive %s", buffer.CurrLine)
+		}
+	}
+
+	//------------------------------------------------------------------------------------------------
+	// STEP 7: Generate the control files (nav.xhtml, toc.ncx and package.opf)
+	//------------------------------------------------------------------------------------------------
+
+	// Summarise the sections added, removed and renamed since the last build, for the editors.
+	buffer.CompareHeadings(stateFileSpec)
+
+	// Stop on a book with too few words, such as from a truncated source, and warn about a large drop.
+	if err = buffer.CheckWordCount(stateFileSpec); err != nil {
+		return err
+	}
+
+	// Generate the image descriptions section from the long descriptions of the figures, if requested
+	if err = buffer.GenDescriptionsSection(); err != nil {
+		return err
+	}
+
+	// Generate the notes section from the notes collected from all the sections
+	if err = buffer.GenNotesSection(); err != nil {
+		return err
+	}
+
+	// Generate the list of illustrations now that every image reference is known
+	if err = buffer.GenLOISection(); err != nil {
+		return err
+	}
+
+	// Generate the quick navigation page now that the final section file names are known
+	if err = buffer.GenQuickNavSection(); err != nil {
+		return err
+	}
+
+	// Check that the long descriptions linked from the figures resolve, now that all the section files are written
+	if err = buffer.CheckLongDescs(); err != nil {
+		return err
+	}
+
+	// A claim of accessibility conformance requires the book to pass the internal checks.
+	if err = buffer.CheckAccessibility(); err != nil {
+		return err
+	}
+
+	// Generate NAV (TOC) file (required for EPUB3)
+	if err = buffer.GenNAVFile(); err != nil {
+		return err
+	}
+
+	// Generate NCX file (for EPUB2 compatibility)
+	if err = buffer.GenNCXFile(); err != nil {
+		return err
+	}
+
+	// Generate the package (OPF) file
+	if err = buffer.GenOPFFile(); err != nil {
+		return err
+	}
+
+	// Generate the other renditions listed in the container, if any
+	if err = buffer.GenRenditions(); err != nil {
+		return err
+	}
+
+	//------------------------------------------------------------------------------------------------
+	// STEP 8: Copy the static (resource and image) files unchanged.
+	//------------------------------------------------------------------------------------------------
+
+	// Copy the control files, the stylesheet and the image files, or only the images and the files referenced
+	// from the stylesheet when reusing the other files of the last build
+	if !parms.MetadataOnly {
+		if err = buffer.CopyStaticFiles(); err != nil {
+			return err
+		}
+	} else if err = buffer.CopyAssets(); err != nil {
+		return err
+	}
+
+	// Check that all the files listed in the manifest are in place
+	if err = buffer.CheckManifestFiles(); err != nil {
+		return err
+	}
+
+	// Summarise the TOC and check that all its links resolve, if verbose.
+	if parms.Verbose {
+		if err = ctx.PrintNavTree(); err != nil {
+			return err
+		}
+		if err = ctx.CheckNavTargets(); err != nil {
+			return err
+		}
+	}
+
+	//------------------------------------------------------------------------------------------------
+	// STEP 9: Package the generated book directory into the .epub file.
+	//------------------------------------------------------------------------------------------------
+
+	// Refuse to package a draft with placeholder images, unless allowed.
+	if err = buffer.CheckPlaceholders(); err != nil {
+		return err
+	}
+
+	if err = ctx.PackageEpub(epubFileSpec, buildTime); err != nil {
+		return err
+	}
+	if err = ctx.WriteChecksums(); err != nil {
+		return err
+	}
+
+	// Remove the packaged files from the generated book directory, unless asked to keep them.
+	if !parms.KeepExploded {
+		if err = ctx.RemoveExploded(); err != nil {
+			return err
+		}
+	}
+
+	// Report the glyph audit results, if requested.
+	buffer.ReportGlyphs()
+
+	// Report the inline style attributes, if requested or removed.
+	buffer.ReportInlineStyles()
+
+	// Report the constructs which degrade when converted for Kindle, if requested.
+	buffer.ReportKindle()
+
+	// Warn about the findings of the content lint.
+	buffer.ReportLint()
+
+	// List the images replaced by placeholder images, if any.
+	buffer.ReportPlaceholders()
+
+	// Report the chapter pacing, if requested.
+	var pacing *gen.Pacing
+	if parms.Pacing {
+		chapterPacing := buffer.NewPacing(parms.PacingFactor)
+		ctx.PrintPacing(chapterPacing)
+		pacing = &chapterPacing
+		buffer.RegisterFeature("pacing report", true, "")
+	} else {
+		buffer.RegisterFeature("pacing report", false, "not requested (-pacing flag)")
+	}
+
+	// Export the parsed book model for other tools, if requested.
+	if parms.EmitModel != "" {
+		if err = ctx.WriteModel(buffer.NewModel(), parms.EmitModel); err != nil {
+			return err
+		}
+		buffer.RegisterFeature("model export", true, "")
+	} else {
+		buffer.RegisterFeature("model export", false, "not requested (-emit-model flag)")
+	}
+
+	// Write the JSON report, if requested.
+	if parms.WriteReport {
+		buffer.RegisterFeature("JSON report", true, "")
+		report := buffer.NewReport(parms.BookName, bookUUID)
+		report.Pacing = pacing
+		if err = ctx.WriteReport(report); err != nil {
+			return err
+		}
+	} else {
+		buffer.RegisterFeature("JSON report", false, "not requested (-report flag)")
+	}
+
+	// Keep the warnings of the build next to the .epub file for later triage.
+	if err = ctx.WriteWarnings(parms.BookName); err != nil {
+		return err
+	}
+
+	// Summarise which optional features ran and which were skipped.
+	buffer.PrintFeatures()
+
+	// Record the inputs of this successful build for the up-to-date check.
+	if err = gen.WriteState(stateFileSpec, inputHash, sectionsHash, buffer.GetAttribute("created"), buffer.GetAttribute("modified"),
+		buffer.WordCount(), buffer.SectionInventory()); err != nil {
+		return err
+	}
+
+	report.EpubFile = epubFileSpec
+	report.Model = buffer.NewModel()
+	report.Files = packagedFiles(ctx)
+
+	fmt.Fprintf(ctx.Output(), "\n%d lines processed\n", buffer.NumLines())
+	return nil
+}
+
+// checkBookSource checks that the book directory exists and contains a readable source.html file.
+// The messages name the absolute paths, and list the files present when source.html is missing so
+// that a misspelt name is easy to spot.
+func checkBookSource(sourceDir, sourceDirSpec, sourceFileSpec string) error {
+	absDirSpec, err := filepath.Abs(sourceDirSpec)
+	if err != nil {
+		absDirSpec = sourceDirSpec
+	}
+	info, err := os.Stat(sourceDirSpec)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("book directory %s not found (source_dir is %s)", absDirSpec, sourceDir)
+		}
+		return fmt.Errorf("cannot access book directory %s: %s", absDirSpec, err.Error())
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory; the book name must be a directory under %s", absDirSpec, sourceDir)
+	}
+
+	absFileSpec := filepath.Join(absDirSpec, filepath.Base(sourceFileSpec))
+	info, err = os.Stat(sourceFileSpec)
+	if os.IsNotExist(err) {
+		entries, _ := os.ReadDir(sourceDirSpec)
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("%s not found, the directory is empty", absFileSpec)
+		}
+		return fmt.Errorf("%s not found, the directory contains: %s", absFileSpec, strings.Join(names, ", "))
+	}
+	if err == nil && info.IsDir() {
+		return fmt.Errorf("%s is a directory, not a file", absFileSpec)
+	}
+	file, err := os.Open(sourceFileSpec)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %s", absFileSpec, err.Error())
+	}
+	file.Close()
+	return nil
+}
+
+// newSection moves past the directive to the heading line and adds the section with that heading, or with
+// the default heading of the directive if it is empty.
+func newSection(buffer *gen.InputBuffer, directive gen.Directive, epubType epubtype.Term) (gen.SectionData, error) {
+	if err := buffer.NextLine(); err != nil {
+		return gen.SectionData{}, err
+	}
+	heading, err := buffer.Heading(directive.Name)
+	if err != nil {
+		return gen.SectionData{}, err
+	}
+	if heading == "" {
+		heading = buffer.DefaultHeading(directive.Name)
+	}
+	section := buffer.NewSectionData(directive, epubType, heading)
+	buffer.AddSection(section)
+	buffer.TraceSection(directive, section)
+	return section, nil
+}
+
+// lineError returns the error for the given line of the source file, such as a misplaced directive.
+func lineError(line int, format string, args ...any) error {
+	return &gen.Error{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,67 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHeadingChanges(t *testing.T) {
+	var output bytes.Buffer
+	generator := testGenerator(t, exampleBook(t, "example", nil), &output)
+	generator.Settings = DefaultSettings()
+	generator.Settings.WriteReport = true
+	if _, err := generator.Generate("example"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(output.String(), "Heading changes") {
+		t.Errorf("heading changes reported without a previous build:\n%s", output.String())
+	}
+
+	// Rename the second chapter and drop the afterword.
+	edit := func(source string) string {
+		source = strings.Replace(source, "<h3>Chapter 2</h3>", "<h3>Chapter Two</h3>", 1)
+		return strings.Replace(source, "<!--afterword-->\n<h1>Afterword</h1>\n<p class=\"first\">If this page can be read, the installation works.</p>\n", "", 1)
+	}
+	generator.Source = exampleBook(t, "example", edit)
+	output.Reset()
+	if _, err := generator.Generate("example"); err != nil {
+		t.Fatal(err)
+	}
+	want := "Heading changes since the last build:\n" +
+		"  ~ section005 \"Chapter 2\" -> \"Chapter Two\" (100% similar)\n" +
+		"  - section008 \"Afterword\"\n"
+	if !strings.Contains(output.String(), want) {
+		t.Errorf("no summary %q in:\n%s", want, output.String())
+	}
+
+	content, err := os.ReadFile(filepath.Join(generator.Target, "example", "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		HeadingChanges []struct {
+			Kind, ID, OldID string
+		} `json:"headingChanges"`
+	}
+	if err = json.Unmarshal(content, &data); err != nil {
+		t.Fatal(err)
+	}
+	if changes := data.HeadingChanges; len(changes) != 2 || changes[0].Kind != "renamed" || changes[0].ID != "section005" ||
+		changes[1].Kind != "removed" || changes[1].OldID != "section008" {
+		t.Errorf("report heading changes %+v, want section005 renamed and section008 removed", changes)
+	}
+
+	// Building again without changes reports none.
+	output.Reset()
+	generator.Settings.Force = true
+	if _, err := generator.Generate("example"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "No heading changes since the last build") {
+		t.Errorf("no heading changes reported as none:\n%s", output.String())
+	}
+}
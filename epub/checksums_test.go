@@ -0,0 +1,103 @@
+package epub
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fileListing returns the listing of checksums.txt for the files of a report.
+func fileListing(files []FileEntry) string {
+	var listing strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&listing, "%s  %d  %s\n", file.SHA256, file.Size, file.Name)
+	}
+	return listing.String()
+}
+
+// sha256Content returns the SHA-256 checksum and the size of the content, as in checksums.txt.
+func sha256Content(content []byte) string {
+	sum := sha256.Sum256(content)
+	return fmt.Sprintf("%s  %d", hex.EncodeToString(sum[:]), len(content))
+}
+
+func TestChecksums(t *testing.T) {
+	var listings []string
+	for build := 0; build < 2; build++ {
+		generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+		generator.Settings = DefaultSettings()
+		generator.Settings.WriteReport = true
+		report, err := generator.Generate("example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookDir := filepath.Join(generator.Target, "example")
+		content, err := os.ReadFile(filepath.Join(bookDir, "checksums.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		listing := string(content)
+		listings = append(listings, listing)
+		if got := fileListing(report.Files); got != listing {
+			t.Errorf("build %d: the files of the report:\n%s\ndiffer from checksums.txt:\n%s", build+1, got, listing)
+		}
+
+		// Each line matches the entry written into the .epub file, in package order, then the .epub file.
+		archive, err := zip.OpenReader(report.EpubFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want strings.Builder
+		for _, file := range archive.File {
+			reader, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry, err := io.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintf(&want, "%s  %s\n", sha256Content(entry), file.Name)
+		}
+		archive.Close()
+		epub, err := os.ReadFile(report.EpubFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&want, "%s  %s\n", sha256Content(epub), filepath.Base(report.EpubFile))
+		if listing != want.String() {
+			t.Errorf("build %d: checksums.txt:\n%s\nwant:\n%s", build+1, listing, want.String())
+		}
+
+		// The report carries the same listing.
+		content, err = os.ReadFile(filepath.Join(bookDir, "report.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data struct {
+			Checksums []FileEntry `json:"checksums"`
+		}
+		if err = json.Unmarshal(content, &data); err != nil {
+			t.Fatal(err)
+		}
+		if got := fileListing(data.Checksums); got != listing {
+			t.Errorf("build %d: the checksums of report.json:\n%s\nwant:\n%s", build+1, got, listing)
+		}
+	}
+
+	// The example book is pinned, so two builds give the same listing, which is kept as a golden file.
+	if listings[0] != listings[1] {
+		t.Errorf("the listing changed between two builds:\n%s\nthen:\n%s", listings[0], listings[1])
+	}
+	if want := readGolden(t, "checksums.txt"); listings[0] != want {
+		t.Errorf("checksums.txt:\n%s\nwant:\n%s", listings[0], want)
+	}
+}
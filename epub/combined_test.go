@@ -0,0 +1,79 @@
+package epub
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	landmarkRegexp  = regexp.MustCompile(`<a epub:type="([^"]*)" href="([^"]*)">`)
+	textItemRegexp  = regexp.MustCompile(`<item id="([^"]*)" href="(Text/[^"]*)"`)
+	itemrefRegexp   = regexp.MustCompile(`<itemref idref="([^"]*)"`)
+	referenceRegexp = regexp.MustCompile(`<reference title="([^"]*)" type="([^"]*)" href="([^"]*)"`)
+)
+
+// packageOutline returns the links of the book to its sections, one per line: the TOC of nav.xhtml and toc.ncx
+// as navOutline and ncxOutline, the landmarks, the section items of the manifest, the spine and the guide.
+func packageOutline(t *testing.T, report Report) string {
+	t.Helper()
+	nav := readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")
+	opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+	var outline strings.Builder
+	outline.WriteString("nav.xhtml:\n" + navOutline(nav))
+	outline.WriteString("toc.ncx:\n" + ncxOutline(readEpubFile(t, report.EpubFile, "OEBPS/toc.ncx")))
+	outline.WriteString("landmarks:\n")
+	for _, match := range landmarkRegexp.FindAllStringSubmatch(nav[strings.Index(nav, `epub:type="landmarks"`):], -1) {
+		outline.WriteString(match[1] + " " + match[2] + "\n")
+	}
+	outline.WriteString("manifest:\n")
+	for _, match := range textItemRegexp.FindAllStringSubmatch(opf, -1) {
+		outline.WriteString(match[1] + " " + match[2] + "\n")
+	}
+	outline.WriteString("spine:\n")
+	for _, match := range itemrefRegexp.FindAllStringSubmatch(opf, -1) {
+		outline.WriteString(match[1] + "\n")
+	}
+	outline.WriteString("guide:\n")
+	for _, match := range referenceRegexp.FindAllStringSubmatch(opf, -1) {
+		outline.WriteString(match[2] + " " + match[3] + " " + match[1] + "\n")
+	}
+	return outline.String()
+}
+
+// readGolden returns the content of the golden file in testdata.
+func readGolden(t *testing.T, name string) string {
+	t.Helper()
+	golden, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(golden)
+}
+
+func TestFrontMatterModes(t *testing.T) {
+	for _, mode := range []string{"separate", "combined"} {
+		t.Run(mode, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+			generator.Settings = DefaultSettings()
+			generator.Settings.FrontMatter = mode
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := packageOutline(t, report), readGolden(t, "frontmatter-"+mode+".txt"); got != want {
+				t.Errorf("links to the sections:\n%s\nwant:\n%s", got, want)
+			}
+			if mode == "separate" {
+				return
+			}
+			page := withoutBlankLines(readEpubFile(t, report.EpubFile, "OEBPS/Text/frontmatter.xhtml")) + "\n"
+			if want := readGolden(t, "frontmatter-combined.xhtml"); page != want {
+				t.Errorf("frontmatter.xhtml:\n%s\nwant:\n%s", page, want)
+			}
+		})
+	}
+}
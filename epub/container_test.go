@@ -0,0 +1,53 @@
+package epub
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+)
+
+func TestContainerFile(t *testing.T) {
+	// container.xml is the file which was copied from data/etc before it was rendered, byte for byte.
+	golden := readGolden(t, "container.xml")
+	tests := []struct {
+		name      string
+		templates fs.FS
+		config    string
+		want      string
+	}{
+		{"container.goxml", nil, "", golden},
+		{"built-in template", templatesWithout(t, "container.goxml"), "", golden},
+		{"renditions", nil, `renditions:
+  - name: reflowable
+    label: Reflowable
+  - name: fixed
+    label: Fixed & large
+    layout: pre-paginated
+    viewport: 1200x1600
+`, `<?xml version="1.0" encoding="UTF-8"?>
+<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:rendition="http://www.idpf.org/2013/rendition" version="1.0">
+  <rootfiles>
+    <rootfile full-path="OEBPS/package.opf" media-type="application/oebps-package+xml" rendition:layout="reflowable" rendition:label="Reflowable" />
+    <rootfile full-path="OEBPS/fixed.opf" media-type="application/oebps-package+xml" rendition:layout="pre-paginated" rendition:label="Fixed &amp; large" />
+  </rootfiles>
+</container>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+			if test.templates != nil {
+				generator.Templates = test.templates
+			}
+			if test.config != "" {
+				generator.Settings = loadConfig(t, test.config)
+			}
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readEpubFile(t, report.EpubFile, "META-INF/container.xml"); got != test.want {
+				t.Errorf("container.xml:\n%q\nwant:\n%q", got, test.want)
+			}
+		})
+	}
+}
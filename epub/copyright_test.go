@@ -0,0 +1,284 @@
+package epub
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// withoutBlankLines returns the content without the lines holding only whitespace, which the templates
+// leave where an action outputs nothing.
+func withoutBlankLines(content string) string {
+	lines := make([]string, 0, strings.Count(content, "\n")+1)
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// templatesWithout returns the templates of the repository without the named ones, as in a custom templates
+// directory made for an older version.
+func templatesWithout(t *testing.T, names ...string) fstest.MapFS {
+	t.Helper()
+	templates := fstest.MapFS{}
+	dir := filepath.Join("..", "data", "templates")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		templates[entry.Name()] = &fstest.MapFile{Data: content}
+	}
+	for _, name := range names {
+		delete(templates, name)
+	}
+	return templates
+}
+
+func TestCopyrightTemplate(t *testing.T) {
+	golden, err := os.ReadFile(filepath.Join("testdata", "copyright.xhtml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		templates fs.FS
+	}{
+		{"copyright.gohtml", nil},
+		{"frontmatter.gohtml in its place", templatesWithout(t, "copyright.gohtml")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+			if test.templates != nil {
+				generator.Templates = test.templates
+			}
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			page := readEpubFile(t, report.EpubFile, "OEBPS/Text/copyright.xhtml")
+			if got, want := withoutBlankLines(page), withoutBlankLines(string(golden)); got != want {
+				t.Errorf("copyright.xhtml:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestCopyrightTemplateFields(t *testing.T) {
+	const structured = `<?xml version="1.0" encoding="utf-8" standalone="no"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{.Lang}}" xml:lang="{{.Lang}}">
+  <head>
+    <title>{{.Title}}</title>
+  </head>
+  <body>
+    <section id="{{.ID}}" epub:type="{{.EpubType}}">
+      <p class="publisher">{{.Publisher}}</p>
+      {{if .HasISBN}}<p class="isbn">ISBN {{.ISBN}}</p>{{end}}
+      <p class="rights">{{.Rights}}</p>
+      <p class="date">{{.Date}}</p>
+    </section>
+  </body>
+</html>`
+	tests := []struct {
+		name    string
+		metas   string
+		want    []string
+		warning string
+	}{
+		{"all the attributes", `<meta name="isbn" content="978-0-00-000000-2"/>
+  <meta name="rights" content="All rights reserved."/>`, []string{
+			`<p class="publisher">EPUBGen</p>`,
+			`<p class="isbn">ISBN 978-0-00-000000-2</p>`,
+			`<p class="rights">All rights reserved.</p>`,
+			`<p class="date">2024-01-01</p>`,
+		}, ""},
+		{"no rights", `<meta name="isbn" content="978-0-00-000000-2"/>`, []string{
+			`<p class="isbn">ISBN 978-0-00-000000-2</p>`,
+		}, "template copyright.gohtml renders the attributes rights, which are not set"},
+		{"no ISBN", `<meta name="rights" content="All rights reserved."/>`, []string{
+			`<p class="rights">All rights reserved.</p>`,
+		}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			books := exampleBook(t, "example", insertBefore(`  <meta name="language"`, "  "+test.metas))
+			generator := testGenerator(t, books, io.Discard)
+			templates := templatesWithout(t)
+			templates["copyright.gohtml"] = &fstest.MapFile{Data: []byte(structured)}
+			generator.Templates = templates
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			page := readEpubFile(t, report.EpubFile, "OEBPS/Text/copyright.xhtml")
+			for _, want := range test.want {
+				if !strings.Contains(page, want) {
+					t.Errorf("no %s in copyright.xhtml:\n%s", want, page)
+				}
+			}
+			if !strings.Contains(test.metas, `"isbn"`) && strings.Contains(page, `class="isbn"`) {
+				t.Errorf("the ISBN was rendered without the attribute:\n%s", page)
+			}
+			warning := ""
+			for _, text := range readWarnings(t, report) {
+				if strings.Contains(text, "template copyright.gohtml renders") {
+					warning = text
+				}
+			}
+			if !strings.Contains(warning, test.warning) || (test.warning == "") != (warning == "") {
+				t.Errorf("warning %q, want %q", warning, test.warning)
+			}
+		})
+	}
+}
+
+func TestCopyrightRequirements(t *testing.T) {
+	// The attributes shown without a guard, so that each one which is not set leaves a dangling label. The
+	// publisher is a required attribute, so it is always set.
+	const unguarded = `<?xml version="1.0" encoding="utf-8" standalone="no"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{.Lang}}" xml:lang="{{.Lang}}">
+  <head>
+    <title>{{.Title}}</title>
+  </head>
+  <body>
+    <section id="{{.ID}}" epub:type="{{.EpubType}}">
+      <p>Publisher: {{.Publisher}}</p>
+      <p>ISBN: {{.ISBN}}</p>
+      <p>{{.Rights}}</p>
+    </section>
+  </body>
+</html>`
+	metas := map[string]string{
+		"isbn":   `<meta name="isbn" content="978-0-00-000000-2"/>`,
+		"rights": `<meta name="rights" content="All rights reserved."/>`,
+	}
+	order := []string{"isbn", "rights"}
+	copyrightBook := func(set map[string]bool) fstest.MapFS {
+		return exampleBook(t, "example", func(source string) string {
+			for _, name := range order {
+				if set[name] {
+					source = insertBefore(`  <meta name="language"`, "  "+metas[name])(source)
+				}
+			}
+			return source
+		})
+	}
+	withTemplate := func(generator *Generator) *Generator {
+		templates := templatesWithout(t)
+		templates["copyright.gohtml"] = &fstest.MapFile{Data: []byte(unguarded)}
+		generator.Templates = templates
+		return generator
+	}
+
+	// Every combination of the attributes set and not set.
+	for combination := 0; combination < 1<<len(order); combination++ {
+		set := make(map[string]bool)
+		missing := make([]string, 0, len(order))
+		for i, name := range order {
+			if combination&(1<<i) != 0 {
+				set[name] = true
+			} else {
+				missing = append(missing, name)
+			}
+		}
+		name := "missing " + strings.Join(missing, ", ")
+		if len(missing) == 0 {
+			name = "all set"
+		}
+		t.Run(name, func(t *testing.T) {
+			report, err := withTemplate(testGenerator(t, copyrightBook(set), io.Discard)).Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var warnings []string
+			for _, text := range readWarnings(t, report) {
+				if strings.Contains(text, "template copyright.gohtml renders") {
+					warnings = append(warnings, text)
+				}
+			}
+			want := "template copyright.gohtml renders the attributes " + strings.Join(missing, ", ") + ", which are not set"
+			switch {
+			case len(missing) == 0 && len(warnings) > 0:
+				t.Errorf("warnings %q, want none", warnings)
+			case len(missing) > 0 && (len(warnings) != 1 || !strings.Contains(warnings[0], want)):
+				t.Errorf("warnings %q, want the single warning %q", warnings, want)
+			}
+
+			// With -strict, the same attributes stop the build.
+			generator := withTemplate(testGenerator(t, copyrightBook(set), io.Discard))
+			generator.Settings = DefaultSettings()
+			generator.Settings.Strict = true
+			_, err = generator.Generate("example")
+			switch {
+			case len(missing) == 0 && err != nil:
+				t.Errorf("strict Generate error = %v, want none", err)
+			case len(missing) > 0 && (err == nil || !strings.Contains(err.Error(), want)):
+				t.Errorf("strict Generate error = %v, want %q", err, want)
+			}
+		})
+	}
+
+	// The lines alone are rendered by frontmatter.gohtml without copyright.gohtml, so nothing is checked.
+	t.Run("raw lines", func(t *testing.T) {
+		generator := testGenerator(t, copyrightBook(nil), io.Discard)
+		generator.Templates = templatesWithout(t, "copyright.gohtml")
+		generator.Settings = DefaultSettings()
+		generator.Settings.Strict = true
+		report, err := generator.Generate("example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, text := range readWarnings(t, report) {
+			if strings.Contains(text, "template copyright.gohtml renders") {
+				t.Errorf("the raw lines were checked: %s", text)
+			}
+		}
+	})
+}
+
+func TestCopyrightBodyDirectives(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"figure", []string{`<!--figure-->`, `figure.png A red rectangle`}},
+		{"tocentry", []string{`<!--tocentry-->`, `<h2>Notice</h2>`}},
+		{"image", []string{`<!--image file="figure.png" alt="A red rectangle"-->`}},
+		{"footnote", []string{`<!--footnote id="n1"-->`, `<p>A note.</p>`}},
+		{"spoiler", []string{`<!--spoiler-->`, `<p>Hidden.</p>`, `<!--endspoiler-->`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			books := exampleBook(t, "example", insertBefore("<!--dedication-->", test.lines...))
+			_, err := testGenerator(t, books, io.Discard).Generate("example")
+			if want := "<!--" + test.name + "--> is not allowed on the copyright page"; err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("error %v, want %q", err, want)
+			}
+		})
+	}
+
+	t.Run("inline SVG", func(t *testing.T) {
+		svg := `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10"/></svg>`
+		books := exampleBook(t, "example", insertBefore("<!--dedication-->", svg))
+		report, err := testGenerator(t, books, io.Discard).Generate("example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page := readEpubFile(t, report.EpubFile, "OEBPS/Text/copyright.xhtml"); !strings.Contains(page, "<rect") {
+			t.Errorf("copyright.xhtml has no inline SVG:\n%s", page)
+		}
+	})
+}
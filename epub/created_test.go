@@ -0,0 +1,66 @@
+package epub
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// builtOn returns an edit of source.html without the created attribute and with the modified attribute set to
+// the date, as a book built on that date whose author never maintains the creation date.
+func builtOn(date string) func(string) string {
+	return func(source string) string {
+		source = strings.Replace(source, `  <meta name="created" content="2024-01-01T00:00:00Z"/>`+"\n", "", 1)
+		return strings.Replace(source, `<meta name="modified" content="2024-01-01T00:00:00Z"/>`,
+			`<meta name="modified" content="`+date+`"/>`, 1)
+	}
+}
+
+func TestPreviousCreated(t *testing.T) {
+	const first, second = "2023-06-15T08:30:00Z", "2024-03-01T12:00:00Z"
+	tests := []struct {
+		name         string
+		keepExploded bool
+		corrupt      bool
+		want         string
+	}{
+		{"from the .epub file", false, false, first},
+		{"from the exploded book before the .epub file", true, true, first},
+		{"from an unreadable .epub file", false, true, second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", builtOn(first)), io.Discard)
+			generator.Settings = DefaultSettings()
+			generator.Settings.KeepExploded = test.keepExploded
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf"); !strings.Contains(opf, "<dc:date>"+first+"</dc:date>") {
+				t.Fatalf("the first build was not created on %s:\n%s", first, opf)
+			}
+			if test.corrupt {
+				if err = os.WriteFile(report.EpubFile, []byte("not a zip file"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			generator.Source = exampleBook(t, "example", builtOn(second))
+			report, err = generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+			for _, want := range []string{
+				"<dc:date>" + test.want + "</dc:date>",
+				`<meta property="dcterms:modified">` + second + "</meta>",
+			} {
+				if !strings.Contains(opf, want) {
+					t.Errorf("no %s in the rebuilt package file:\n%s", want, opf)
+				}
+			}
+		})
+	}
+}
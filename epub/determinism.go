@@ -0,0 +1,157 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 23-Jan-2024
+//
+// The check that generating the same book twice gives the same files, for reproducible builds.
+
+package epub
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roslamir/ep3gen/internal/gen"
+)
+
+// hexdumpLines is the number of lines of 16 bytes shown from each file at the first difference.
+const hexdumpLines = 4
+
+// VerifyDeterminism generates the book twice in a row, each time into a new temporary directory, and compares
+// all the files of the two expanded books and the two .epub files byte by byte, as the same source must always
+// give the same e-book. The build timestamp is pinned for both generations as SOURCE_DATE_EPOCH does, unless
+// the settings already pin it. The bookkeeping files, such as the warnings file, are not compared. The first
+// file which differs is named in the returned error, and the region of the first difference in both files is
+// written to out as a hex dump. Both temporary directories are removed at the end.
+func (g *Generator) VerifyDeterminism(bookName string, out io.Writer) error {
+	settings := g.settings()
+	if settings.MetadataOnly {
+		return fmt.Errorf("-verify-determinism cannot be used with -metadata-only")
+	}
+	tempDir, err := os.MkdirTemp("", "ep3gen-determinism-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	if settings.SourceDateEpoch == "" {
+		settings.SourceDateEpoch = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	settings.KeepExploded = true
+
+	targets := []string{filepath.Join(tempDir, "first"), filepath.Join(tempDir, "second")}
+	for i, target := range targets {
+		fmt.Fprintf(out, "Determinism check: generation %d of 2 into %s\n", i+1, target)
+		generator := *g
+		generator.Target = target
+		generator.Settings = settings
+		if _, err = generator.Generate(bookName); err != nil {
+			return err
+		}
+	}
+
+	first, second := filepath.Join(targets[0], bookName), filepath.Join(targets[1], bookName)
+	if err = compareTrees(first, second, out); err != nil {
+		return err
+	}
+	if err = compareFiles(gen.EpubFileSpec(targets[0], bookName), gen.EpubFileSpec(targets[1], bookName), bookName+".epub", out); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Determinism check: both generations are identical")
+	return nil
+}
+
+// compareTrees compares the files of the book in the directory first with those in the directory second, in
+// the lexical order of their paths, and returns an error for the first one which differs or is in only one of
+// them.
+func compareTrees(first, second string, out io.Writer) error {
+	firstFiles, err := bookFiles(first)
+	if err != nil {
+		return err
+	}
+	secondFiles, err := bookFiles(second)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(firstFiles) || i < len(secondFiles); i++ {
+		switch {
+		case i == len(secondFiles) || (i < len(firstFiles) && firstFiles[i] < secondFiles[i]):
+			return fmt.Errorf("generation is not deterministic: %s is only written by the first generation", firstFiles[i])
+		case i == len(firstFiles) || secondFiles[i] < firstFiles[i]:
+			return fmt.Errorf("generation is not deterministic: %s is only written by the second generation", secondFiles[i])
+		}
+		rel := firstFiles[i]
+		if err = compareFiles(filepath.Join(first, rel), filepath.Join(second, rel), rel, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bookFiles returns the paths of the files of the expanded book in the directory, relative to it and in lexical
+// order, without the bookkeeping files.
+func bookFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(fileSpec string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || gen.IsBookkeepingFile(fileSpec) {
+			return err
+		}
+		rel, err := filepath.Rel(dir, fileSpec)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	return files, err
+}
+
+// compareFiles compares the two generations of the named file, and returns an error naming the file and the
+// offset of the first difference, after writing the hex dump of the region to out.
+func compareFiles(firstSpec, secondSpec, name string, out io.Writer) error {
+	first, err := os.ReadFile(firstSpec)
+	if err != nil {
+		return err
+	}
+	second, err := os.ReadFile(secondSpec)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(first, second) {
+		return nil
+	}
+	offset := 0
+	for offset < len(first) && offset < len(second) && first[offset] == second[offset] {
+		offset++
+	}
+	start := offset &^ 15
+	fmt.Fprintf(out, "First difference in %s at byte %d (sizes %d and %d):\n", name, offset, len(first), len(second))
+	fmt.Fprintf(out, "first generation:\n%s", hexdump(first, start))
+	fmt.Fprintf(out, "second generation:\n%s", hexdump(second, start))
+	return fmt.Errorf("generation is not deterministic: %s differs at byte %d", name, offset)
+}
+
+// hexdump returns hexdumpLines lines of 16 bytes of the content from the offset, each with the offset, the
+// bytes in hexadecimal and the printable ASCII characters.
+func hexdump(content []byte, offset int) string {
+	var sb strings.Builder
+	for line := 0; line < hexdumpLines && offset < len(content); line++ {
+		end := offset + 16
+		if end > len(content) {
+			end = len(content)
+		}
+		chunk := content[offset:end]
+		ascii := make([]byte, len(chunk))
+		for i, c := range chunk {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			ascii[i] = c
+		}
+		fmt.Fprintf(&sb, "  %08x  %-47s  |%s|\n", offset, fmt.Sprintf("% x", chunk), ascii)
+		offset = end
+	}
+	return sb.String()
+}
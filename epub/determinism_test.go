@@ -0,0 +1,49 @@
+package epub
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDeterminism(t *testing.T) {
+	tests := []struct {
+		dir  string
+		book string
+	}{
+		{filepath.Join("..", "data", "selftest"), SelfTestBook},
+		{filepath.Join("..", "data", "source"), "rls-treasure-island"},
+	}
+	for _, test := range tests {
+		t.Run(test.book, func(t *testing.T) {
+			var output bytes.Buffer
+			generator := testGenerator(t, nil, &output)
+			generator.Source = os.DirFS(test.dir)
+			if err := generator.VerifyDeterminism(test.book, &output); err != nil {
+				t.Fatalf("%v\n%s", err, output.String())
+			}
+			if !strings.Contains(output.String(), "both generations are identical") {
+				t.Errorf("the check did not compare the generations:\n%s", output.String())
+			}
+		})
+	}
+}
+
+func TestVerifyDeterminismReportsDifference(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	for i, content := range []string{"same start, then A", "same start, then B"} {
+		if err := os.WriteFile(filepath.Join(dirs[i], "chapter.xhtml"), []byte(content), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var output bytes.Buffer
+	err := compareTrees(dirs[0], dirs[1], &output)
+	if err == nil || !strings.Contains(err.Error(), "chapter.xhtml differs at byte 17") {
+		t.Errorf("compareTrees error = %v, want the difference in chapter.xhtml at byte 17", err)
+	}
+	if !strings.Contains(output.String(), "20 41") || !strings.Contains(output.String(), "20 42") {
+		t.Errorf("no hex dump of the differing region:\n%s", output.String())
+	}
+}
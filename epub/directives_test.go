@@ -0,0 +1,101 @@
+package epub
+
+import (
+	"archive/zip"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	// commentDirectiveRegexp matches a directive line written as a comment.
+	commentDirectiveRegexp = regexp.MustCompile(`^<!--(\S.*)-->$`)
+
+	// provenanceRegexp matches the hash of the source file in package.opf.
+	provenanceRegexp = regexp.MustCompile(`<meta property="dcterms:provenance">sha256:[0-9a-f]*</meta>`)
+)
+
+// asProcessingInstructions returns an edit of source.html rewriting the directive lines for which convert
+// returns true, given their index, as <?ep3 ...?> processing instructions.
+func asProcessingInstructions(convert func(i int) bool) func(string) string {
+	return func(source string) string {
+		lines := strings.Split(withTocEntries(source), "\n")
+		directive := 0
+		for i, line := range lines {
+			if match := commentDirectiveRegexp.FindStringSubmatch(line); match != nil {
+				if convert(directive) {
+					lines[i] = "<?ep3 " + match[1] + "?>"
+				}
+				directive++
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+}
+
+// readEpubFiles returns the content of each file in the e-book, with the hash of the source file left out.
+func readEpubFiles(t *testing.T, epubFile string) map[string]string {
+	t.Helper()
+	archive, err := zip.OpenReader(epubFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		files[file.Name] = provenanceRegexp.ReplaceAllString(readEpubFile(t, epubFile, file.Name), "")
+	}
+	return files
+}
+
+func TestProcessingInstructionDirectives(t *testing.T) {
+	comments := testGenerator(t, exampleBook(t, "example", withTocEntries), io.Discard)
+	report, err := comments.Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := readEpubFiles(t, report.EpubFile)
+
+	tests := []struct {
+		name    string
+		convert func(i int) bool
+	}{
+		{"processing instructions", func(int) bool { return true }},
+		{"mixed", func(i int) bool { return i%2 == 1 }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			books := exampleBook(t, "example", asProcessingInstructions(test.convert))
+			if source := string(books["example/source.html"].Data); !strings.Contains(source, "<?ep3 ") {
+				t.Fatalf("no directive was rewritten:\n%s", source)
+			}
+			generator := testGenerator(t, books, io.Discard)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := readEpubFiles(t, report.EpubFile)
+			if len(got) != len(want) {
+				t.Errorf("%d files in the e-book, want %d", len(got), len(want))
+			}
+			for name, content := range want {
+				if got[name] != content {
+					t.Errorf("%s differs from the one of the comment directives:\n%s\nwant:\n%s", name, got[name], content)
+				}
+			}
+		})
+	}
+}
+
+func TestEmptyCommentLines(t *testing.T) {
+	edit := insertBefore("<!--part-->\n<h1>Part 2", "<!-->", "<!--->", "<!---->", `<p>After the comments.</p>`)
+	report, err := testGenerator(t, exampleBook(t, "example", edit), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := readEpubFile(t, report.EpubFile, "OEBPS/Text/section005.xhtml")
+	if body := page[strings.Index(page, "<body>"):]; !strings.Contains(body, "<p>After the comments.</p>") || strings.Contains(body, "<!--") {
+		t.Errorf("the empty comments were not dropped alone:\n%s", page)
+	}
+}
@@ -0,0 +1,43 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// truncatedAfter returns an edit of source.html dropping the lines after the first line containing the text.
+func truncatedAfter(text string) func(string) string {
+	return func(source string) string {
+		end := strings.Index(source, text)
+		return source[:end+strings.Index(source[end:], "\n")+1]
+	}
+}
+
+func TestGenerateTruncatedSource(t *testing.T) {
+	tests := []struct {
+		phase string
+		after string
+		want  string
+	}{
+		{"before the head", "<html", "unexpected end of input file while looking for <head>"},
+		{"in the head", `<meta name="language"`, "unexpected end of input file while looking for </head>"},
+		{"before the body", "</head>", "unexpected end of input file while looking for <body>"},
+		{"at the start of the body", "<body>", "unexpected end of input file"},
+		{"after a directive", "<!--dedication-->", "unexpected end of input file"},
+		{"in the copyright page", "<p class=\"copy\">Generated", "input file ended before the <!--end--> directive"},
+		{"in the frontmatter", "<h1>Foreword</h1>", "input file ended before the <!--end--> directive"},
+		{"after a part", "<h1>Part 1</h1>", "input file ended before the <!--end--> directive"},
+		{"in a chapter", "<h3>Chapter 3</h3>", "input file ended before the <!--end--> directive"},
+		{"in the backmatter", "<h1>Afterword</h1>", "input file ended before the <!--end--> directive"},
+	}
+	for _, test := range tests {
+		t.Run(test.phase, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", truncatedAfter(test.after)), io.Discard)
+			_, err := generator.Generate("example")
+			if err == nil || !strings.HasSuffix(err.Error(), test.want) {
+				t.Errorf("Generate error = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
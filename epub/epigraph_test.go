@@ -0,0 +1,78 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// insertBefore returns an edit of source.html inserting the lines before the first line starting with marker.
+func insertBefore(marker string, lines ...string) func(string) string {
+	return func(source string) string {
+		return strings.Replace(source, "\n"+marker, "\n"+strings.Join(lines, "\n")+"\n"+marker, 1)
+	}
+}
+
+func TestEpigraphQuotes(t *testing.T) {
+	image := `<p class="center"><img src="figure.png" alt="A small square"/></p>`
+	tests := []struct {
+		name         string
+		lines        []string
+		quotes       int
+		attributions []string
+	}{
+		{"one quote", []string{
+			"<p>All the world's a stage.</p>",
+			"<p>— Shakespeare, <i>As You Like It</i></p>",
+		}, 1, []string{"Shakespeare, <i>As You Like It</i>"}},
+		{"two quotes", []string{
+			"<p>All the world's a stage.</p>",
+			"<p>— Shakespeare</p>",
+			"<!--sep-->",
+			image,
+			"<p>A picture is worth a thousand words.</p>",
+		}, 2, []string{"Shakespeare"}},
+		{"three quotes", []string{
+			"<!--sep-->", // a separator before the first quotation is ignored
+			"<p>First.</p>",
+			"<p>&mdash; One</p>",
+			"<!--sep-->",
+			"<p>Second.</p>",
+			image,
+			"<p>— Two</p>",
+			"<!--sep-->",
+			"<!--sep-->", // as are two in a row
+			"<p>Third.</p>",
+			"<p>— Three</p>",
+		}, 3, []string{"One", "Two", "Three"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := append([]string{"<!--epigraph-->", "<h1>Epigraph</h1>"}, test.lines...)
+			generator := testGenerator(t, exampleBook(t, "example", insertBefore("<!--foreword-->", lines...)), io.Discard)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			page := readEpubFile(t, report.EpubFile, sectionFile(t, report, "epigraph"))
+
+			if quotes := strings.Count(page, `<blockquote class="epigraph">`); quotes != test.quotes {
+				t.Errorf("%d quotes, want %d:\n%s", quotes, test.quotes, page)
+			}
+			for _, attribution := range test.attributions {
+				if !strings.Contains(page, `<p class="attribution">— <cite>`+attribution+`</cite></p>`) {
+					t.Errorf("no attribution %q:\n%s", attribution, page)
+				}
+			}
+			if strings.Contains(page, "<p>—") || strings.Contains(page, "<p>&mdash;") {
+				t.Errorf("an attribution was left in the lines of its quotation:\n%s", page)
+			}
+			if strings.Contains(strings.Join(test.lines, "\n"), "<img") {
+				// The quotes are built from the processed lines, with the image path and size rewritten.
+				if !strings.Contains(page, `src="../Images/figure.png"`) || !strings.Contains(page, `width="`) {
+					t.Errorf("the image of the quote was not processed:\n%s", page)
+				}
+			}
+		})
+	}
+}
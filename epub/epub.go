@@ -0,0 +1,216 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 07-Jan-2024
+//
+// The Generator type, for generating books from other programs.
+
+// Package epub generates EPUB3 e-books from their source.html files, as the epubgen command does, for programs
+// which would rather call the generator than run the command. The settings of the config file and of the
+// flags of the command are given by the Settings of the Generator.
+package epub
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/roslamir/ep3gen/internal/gen"
+	"github.com/roslamir/ep3gen/internal/parm"
+	"github.com/roslamir/ep3gen/model"
+)
+
+// Generator generates books from the book directories of a source tree. The source, the templates and the
+// resources may be given as file systems, such as an embed.FS or a fstest.MapFS, which are copied into a
+// temporary directory for the generation. Those left nil, and an empty Target, are taken from the Settings.
+// A Generator may run several generations at the same time, each with its own copy of the Settings.
+type Generator struct {
+	Source    fs.FS  // the book directories, each holding a source.html file and its images
+	Target    string // the directory the generated books are written to
+	Templates fs.FS  // the template files, such as those in data/templates
+	Resources fs.FS  // the stylesheet and the other resource files, such as those in data/etc
+
+	// Settings are those of the config file and of the flags, see LoadSettings. They are not changed by the
+	// generations. Nil uses DefaultSettings, which name no directories.
+	Settings *Settings
+
+	// SectionFilters transform the XHTML of each generated section file, in order, before it is written, and
+	// MetadataFilters change the metadata attributes of the source file before they are checked. See
+	// SectionFilter and MetadataFilter for what they may do. They apply to every generation of the generator.
+	SectionFilters  []SectionFilter
+	MetadataFilters []MetadataFilter
+
+	// Output receives the progress of the generations, such as the files generated and the warnings. Nil
+	// prints to the standard output.
+	Output io.Writer
+
+	// Interruptible releases the lock of the book and exits the program on an interrupt, for the command line.
+	Interruptible bool
+}
+
+// Report describes a generated book.
+type Report struct {
+	Book     string      // the name of the book
+	UpToDate bool        // the book had not changed since the last build and was not generated again
+	EpubFile string      // the path of the .epub file
+	Model    model.Book  // the sections and the images of the book, as written by -emit-model
+	Files    []FileEntry // the files in the .epub file in package order, then the .epub file itself
+}
+
+// FileEntry is a file in the .epub file, or the .epub file itself, with its size and SHA-256 checksum.
+type FileEntry struct {
+	Name   string
+	Size   int64
+	SHA256 string
+}
+
+// Settings are the settings of a generation: those of the config file and of the flags of the command.
+type Settings = parm.Parms
+
+// DefaultSettings returns the settings used without a config file and without flags.
+func DefaultSettings() *Settings {
+	return parm.Defaults()
+}
+
+// LoadSettings returns the default settings with those of the config file, such as ./config.yaml.
+func LoadSettings(configFile string) (*Settings, error) {
+	settings := parm.Defaults()
+	if err := settings.LoadConfigFile(configFile); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// Generate generates the book in the named book directory of the source into the target directory, and
+// returns its report. Returns the error which stopped the generation, such as an *Error for a problem in
+// the source file. Generations may run at the same time from several goroutines; one of the same book into
+// the same target directory as another fails, or waits for the other to finish with the Wait setting.
+func (g *Generator) Generate(bookName string) (report Report, err error) {
+	if !fs.ValidPath(bookName) || bookName == "." {
+		return report, fmt.Errorf("invalid book name '%s'", bookName)
+	}
+	parms := g.settings()
+	parms.BookName = bookName
+	if g.Target != "" {
+		parms.TargetDir = g.Target
+	}
+	if g.Source != nil || g.Templates != nil || g.Resources != nil {
+		var tempDir string
+		if tempDir, err = os.MkdirTemp("", "ep3gen-"); err != nil {
+			return report, err
+		}
+		defer os.RemoveAll(tempDir)
+		trees := []struct {
+			fsys    fs.FS
+			root    string // the tree copied, under the directory of the setting
+			setting *string
+			dir     string
+		}{
+			{g.Source, bookName, &parms.SourceDir, filepath.Join(tempDir, "source")},
+			{g.Templates, ".", &parms.TemplatesDir, filepath.Join(tempDir, "templates")},
+			{g.Resources, ".", &parms.ResourceDir, filepath.Join(tempDir, "resources")},
+		}
+		for _, tree := range trees {
+			if tree.fsys == nil {
+				continue
+			}
+			if err = copyFS(tree.fsys, tree.root, filepath.Join(tree.dir, tree.root)); err != nil {
+				return report, err
+			}
+			*tree.setting = tree.dir
+		}
+	}
+	switch {
+	case parms.SourceDir == "":
+		return report, errors.New("no source directory: set the Source of the generator")
+	case parms.TargetDir == "":
+		return report, errors.New("no target directory: set the Target of the generator")
+	case parms.TemplatesDir == "":
+		return report, errors.New("no templates directory: set the Templates of the generator")
+	case parms.ResourceDir == "":
+		return report, errors.New("no resource directory: set the Resources of the generator")
+	}
+
+	ctx := gen.NewContext(parms, g.output())
+	for _, filter := range g.SectionFilters {
+		ctx.AddSectionFilter(filter)
+	}
+	for _, filter := range g.MetadataFilters {
+		ctx.AddMetadataFilter(filter)
+	}
+	report.Book = bookName
+	err = build(ctx, &report, g.Interruptible)
+	return report, err
+}
+
+// settings returns a copy of the settings of the generator, for a generation to change.
+func (g *Generator) settings() *Settings {
+	if g.Settings == nil {
+		return DefaultSettings()
+	}
+	return g.Settings.Clone()
+}
+
+// output returns where the progress of the generations is printed.
+func (g *Generator) output() io.Writer {
+	if g.Output == nil {
+		return os.Stdout
+	}
+	return g.Output
+}
+
+// Section is a section of the book, as given to the section filters.
+type Section = gen.SectionData
+
+// SectionFilter transforms the XHTML of a generated section file. It must return well-formed XHTML, and
+// returning an error aborts the generation, see gen.SectionFilter.
+type SectionFilter = gen.SectionFilter
+
+// MetadataFilter changes the metadata attributes read from the <meta> tags of the source file. Returning an
+// error aborts the generation, see gen.MetadataFilter.
+type MetadataFilter = gen.MetadataFilter
+
+// Error is the error for a problem in the source file, with the line it was found on, if known.
+type Error = gen.Error
+
+// packagedFiles returns the files in the .epub file written by the generation, then the .epub file.
+func packagedFiles(ctx *gen.Context) []FileEntry {
+	checksums := ctx.PackageChecksums()
+	files := make([]FileEntry, len(checksums))
+	for i, checksum := range checksums {
+		files[i] = FileEntry{Name: checksum.Name, Size: checksum.Size, SHA256: checksum.SHA256}
+	}
+	return files
+}
+
+// copyFS copies the tree under root in the file system into the directory dir, which is created.
+func copyFS(fsys fs.FS, root, dir string) error {
+	return fs.WalkDir(fsys, root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0770)
+		}
+		source, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		file, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(file, source); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	})
+}
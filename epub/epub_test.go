@@ -0,0 +1,163 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/roslamir/ep3gen/model"
+)
+
+// exampleBook returns the example book of the self-test as the named book directory of a file system, with
+// the edit applied to its source.html.
+func exampleBook(t *testing.T, name string, edit func(source string) string) fstest.MapFS {
+	t.Helper()
+	books := fstest.MapFS{}
+	for _, file := range []string{"source.html", "cover.jpeg", "figure.png"} {
+		content, err := os.ReadFile(filepath.Join("..", "data", "selftest", SelfTestBook, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file == "source.html" && edit != nil {
+			content = []byte(edit(string(content)))
+		}
+		books[path.Join(name, file)] = &fstest.MapFile{Data: content}
+	}
+	return books
+}
+
+// testGenerator returns a generator of the books with the templates and the resources of the repository,
+// writing into a new temporary directory.
+func testGenerator(t *testing.T, books fstest.MapFS, output io.Writer) *Generator {
+	t.Helper()
+	return &Generator{
+		Source:    books,
+		Target:    t.TempDir(),
+		Templates: os.DirFS(filepath.Join("..", "data", "templates")),
+		Resources: os.DirFS(filepath.Join("..", "data", "etc")),
+		Output:    output,
+	}
+}
+
+// readWarnings returns the warnings written next to the .epub file of the book.
+func readWarnings(t *testing.T, report Report) []string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(report.EpubFile), report.Book, "warnings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		Warnings []string `json:"warnings"`
+	}
+	if err = json.Unmarshal(content, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.Warnings
+}
+
+// sectionOfKind returns the first section of the kind in the model of the book.
+func sectionOfKind(report Report, kind string) model.Section {
+	for _, section := range report.Model.Sections {
+		if section.Kind == kind {
+			return section
+		}
+	}
+	return model.Section{}
+}
+
+func TestGenerateMapFS(t *testing.T) {
+	var output bytes.Buffer
+	generator := testGenerator(t, exampleBook(t, "example", nil), &output)
+	report, err := generator.Generate("example")
+	if err != nil {
+		t.Fatalf("Generate: %v\n%s", err, output.String())
+	}
+	if report.UpToDate || report.Book != "example" {
+		t.Errorf("report = %+v, want a generated book named example", report)
+	}
+	if report.EpubFile != filepath.Join(generator.Target, "example.epub") {
+		t.Errorf("EpubFile = %s, want example.epub in %s", report.EpubFile, generator.Target)
+	}
+	if _, err = os.Stat(report.EpubFile); err != nil {
+		t.Error(err)
+	}
+	if err = checkSelfTestModel(report); err != nil {
+		t.Error(err)
+	}
+	if err = checkSelfTestPackage(report); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(output.String(), "lines processed") {
+		t.Errorf("the progress was not printed to the Output of the generator:\n%s", output.String())
+	}
+
+	// Nothing changed, so the second generation is skipped.
+	if report, err = generator.Generate("example"); err != nil || !report.UpToDate {
+		t.Errorf("second Generate = %+v, %v, want up to date", report.UpToDate, err)
+	}
+}
+
+func TestGenerateInvalidBookName(t *testing.T) {
+	generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+	for _, name := range []string{"", ".", "../example", "/example"} {
+		if _, err := generator.Generate(name); err == nil {
+			t.Errorf("Generate(%q) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestGenerateConcurrently(t *testing.T) {
+	// The first book warns about a deprecated attribute and uses its own settings; the second must see neither.
+	deprecated := func(source string) string {
+		return strings.Replace(source, `<meta name="author-sort"`, `<meta name="author2" content="Jane Smith"/>
+  <meta name="author-sort"`, 1)
+	}
+	books := exampleBook(t, "first", deprecated)
+	for name, file := range exampleBook(t, "second", nil) {
+		books[name] = file
+	}
+	first, second := DefaultSettings(), DefaultSettings()
+	first.SectionIDs = "slug"
+
+	generators := []*Generator{testGenerator(t, books, io.Discard), testGenerator(t, books, io.Discard)}
+	generators[0].Settings, generators[1].Settings = first, second
+	reports := make([]Report, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, name := range []string{"first", "second"} {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			reports[i], errs[i] = generators[i].Generate(name)
+		}(i, name)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("generation %d: %v", i+1, err)
+		}
+	}
+
+	if warnings := readWarnings(t, reports[0]); len(warnings) != 1 || !strings.Contains(warnings[0], "author2") {
+		t.Errorf("warnings of the first book = %q, want the one about author2", warnings)
+	}
+	if warnings := readWarnings(t, reports[1]); len(warnings) != 0 {
+		t.Errorf("warnings of the second book = %q, want none", warnings)
+	}
+	if id := sectionOfKind(reports[0], "foreword").ID; strings.HasPrefix(id, "section") {
+		t.Errorf("the foreword of the first book is %s, want a slug", id)
+	}
+	if id := sectionOfKind(reports[1], "foreword").ID; !strings.HasPrefix(id, "section") {
+		t.Errorf("the foreword of the second book is %s, want a numbered section", id)
+	}
+	if first.BookName != "" || first.TargetDir != "" || second.SourceDir != "" {
+		t.Errorf("the settings of the generators were changed by the generations")
+	}
+}
@@ -0,0 +1,148 @@
+package epub
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// headingRegexp matches a heading element of a section file with its content.
+var headingRegexp = regexp.MustCompile(`(?s)(<h[1-6][^>]*>)(.*?)(</h[1-6]>)`)
+
+// uppercaseHeadings is a section filter writing the headings in upper case.
+func uppercaseHeadings(section Section, body []byte) ([]byte, error) {
+	return headingRegexp.ReplaceAllFunc(body, func(heading []byte) []byte {
+		parts := headingRegexp.FindSubmatch(heading)
+		return []byte(string(parts[1]) + strings.ToUpper(string(parts[2])) + string(parts[3]))
+	}), nil
+}
+
+// readEpubFile returns the content of the named file in the .epub file.
+func readEpubFile(t *testing.T, epubFile, name string) string {
+	t.Helper()
+	archive, err := zip.OpenReader(epubFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	for _, file := range archive.File {
+		if file.Name == name {
+			reader, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(content)
+		}
+	}
+	t.Fatalf("%s has no file %s", epubFile, name)
+	return ""
+}
+
+// sectionFile returns the name in the .epub file of the file of the first section of the kind.
+func sectionFile(t *testing.T, report Report, kind string) string {
+	t.Helper()
+	section := sectionOfKind(report, kind)
+	if section.ID == "" {
+		t.Fatalf("the book has no section of the kind %s", kind)
+	}
+	return "OEBPS/Text/" + section.ID + ".xhtml"
+}
+
+func TestSectionFilterUppercasesHeadings(t *testing.T) {
+	var filtered []string
+	generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+	generator.SectionFilters = []SectionFilter{
+		func(section Section, body []byte) ([]byte, error) {
+			filtered = append(filtered, section.ID)
+			return body, nil
+		},
+		uppercaseHeadings,
+	}
+	report, err := generator.Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chapter := readEpubFile(t, report.EpubFile, sectionFile(t, report, "chapter"))
+	if !strings.Contains(chapter, "THE FIRST PAGE") || strings.Contains(chapter, "The First Page</h") {
+		t.Errorf("the chapter heading was not upper-cased:\n%s", chapter)
+	}
+	if !strings.Contains(chapter, "The templates were found") {
+		t.Errorf("the chapter text was changed:\n%s", chapter)
+	}
+	if nav := readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml"); strings.Contains(nav, "THE FIRST PAGE") {
+		t.Errorf("nav.xhtml was filtered:\n%s", nav)
+	}
+	for _, id := range filtered {
+		if id == "nav" || id == "toc" {
+			t.Errorf("the control file %s was filtered", id)
+		}
+	}
+	if len(filtered) == 0 {
+		t.Errorf("the first filter was not called")
+	}
+}
+
+func TestSectionFilterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter SectionFilter
+		want   string
+	}{
+		{"error", func(section Section, body []byte) ([]byte, error) {
+			return nil, errors.New("no typography rules")
+		}, "section filter 0 failed on"},
+		{"malformed", func(section Section, body []byte) ([]byte, error) {
+			return []byte(strings.Replace(string(body), "</body>", "", 1)), nil
+		}, "is not well-formed after the section filters"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+			generator.SectionFilters = []SectionFilter{test.filter}
+			_, err := generator.Generate("example")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Generate error = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestMetadataFilter(t *testing.T) {
+	generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+	generator.MetadataFilters = []MetadataFilter{
+		func(attributes map[string]string) error {
+			attributes["title"] = strings.ToUpper(attributes["title"])
+			delete(attributes, "subject")
+			return nil
+		},
+	}
+	report, err := generator.Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+	if !strings.Contains(opf, "THE SELF-TEST EXAMPLE</dc:title>") {
+		t.Errorf("the title was not changed by the filter:\n%s", opf)
+	}
+	if strings.Contains(opf, "<dc:subject>Reference") {
+		t.Errorf("the subject removed by the filter was written:\n%s", opf)
+	}
+
+	generator = testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+	generator.MetadataFilters = []MetadataFilter{
+		func(attributes map[string]string) error { return nil },
+		func(attributes map[string]string) error { return errors.New("no title") },
+	}
+	if _, err = generator.Generate("example"); err == nil || !strings.Contains(err.Error(), "metadata filter 1 failed: no title") {
+		t.Errorf("Generate error = %v, want the failure of metadata filter 1", err)
+	}
+}
@@ -0,0 +1,37 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestInlineFormula(t *testing.T) {
+	formula := func(caption string) func(string) string {
+		return insertBefore("<!--part-->\n<h1>Part 2", "<!--figure inline-->", strings.TrimSpace("figure.png "+caption))
+	}
+	generator := testGenerator(t, exampleBook(t, "example", formula("E equals m c squared")), io.Discard)
+	report, err := generator.Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := readEpubFile(t, report.EpubFile, "OEBPS/Text/section005.xhtml")
+	// figure.png is 320 by 200 pixels.
+	want := `<img class="inline-formula" src="../Images/figure.png" alt="E equals m c squared" width="320" height="200" />`
+	if !strings.Contains(page, want) {
+		t.Errorf("no %s in the chapter:\n%s", want, page)
+	}
+	if strings.Contains(page, "<figure") || strings.Contains(page, "<figcaption") {
+		t.Errorf("the inline formula was wrapped in a figure:\n%s", page)
+	}
+
+	// A book claiming accessibility conformance needs the spoken formula.
+	claim := func(source string) string {
+		return formula("")(strings.Replace(source, `  <meta name="subject"`,
+			`  <meta name="a11y-conformance" content="EPUB-A11Y-11_WCAG-21-AA"/>`+"\n"+`  <meta name="subject"`, 1))
+	}
+	_, err = testGenerator(t, exampleBook(t, "example", claim), io.Discard).Generate("example")
+	if err == nil || !strings.Contains(err.Error(), "section section005 has a formula image without the spoken formula as alt text") {
+		t.Errorf("Generate error = %v, want the formula image without alt text reported", err)
+	}
+}
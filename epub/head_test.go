@@ -0,0 +1,53 @@
+package epub
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withHead returns an edit of source.html replacing its lines up to and including the <body> start tag by
+// the head of the fixture file in testdata.
+func withHead(t *testing.T, fixture string) func(string) string {
+	t.Helper()
+	head, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(source string) string {
+		return string(head) + source[strings.Index(source, "<body>\n")+len("<body>\n"):]
+	}
+}
+
+func TestGenerateExportedHeads(t *testing.T) {
+	for _, fixture := range []string{"calibre-head.html", "word-head.html"} {
+		t.Run(fixture, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", withHead(t, fixture)), io.Discard)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			attributes := report.Model.Attributes
+			for name, want := range map[string]string{
+				"title":       "The Self-Test Example",
+				"title-sort":  "Self-Test Example, The",
+				"images":      "figure.png",
+				"subject":     "Reference",
+				"description": "A small book built by epubgen selftest to check an installation.",
+			} {
+				if attributes[name] != want {
+					t.Errorf("attribute %s = %q, want %q", name, attributes[name], want)
+				}
+			}
+			if _, found := attributes["Generator"]; found {
+				t.Errorf("the unquoted <meta name=Generator> of the export became an attribute")
+			}
+			if copyright := sectionOfKind(report, "copyright-page"); len(copyright.Lines) == 0 ||
+				!strings.Contains(copyright.Lines[0], "THE SELF-TEST EXAMPLE") {
+				t.Errorf("the body does not start after the <body> start tag: %q", copyright.Lines)
+			}
+		})
+	}
+}
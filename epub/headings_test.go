@@ -0,0 +1,190 @@
+package epub
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// emptyDedication is the edit of source.html giving the dedication the empty heading.
+func emptyDedication(source string) string {
+	return strings.Replace(source, "<h1>Dedication</h1>", "<h1>&#160;</h1>", 1)
+}
+
+// withAttributes returns an edit of source.html adding the <meta> lines of the attributes after the language.
+func withAttributes(metas ...string) func(string) string {
+	return func(source string) string {
+		for _, meta := range metas {
+			source = strings.Replace(source, `  <meta name="language"`, "  "+meta+"\n  <meta name=\"language\"", 1)
+		}
+		return source
+	}
+}
+
+// loadConfig returns the settings of a config file with the content, and the directories the config file
+// requires, which the Generator of the test replaces.
+func loadConfig(t *testing.T, content string) *Settings {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	content = "source_dir: .\ntarget_dir: .\nresource_dir: .\ntemplates_dir: .\n" + content
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := LoadSettings(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return settings
+}
+
+func TestDefaultHeadings(t *testing.T) {
+	const config = "default_headings:\n  dedication: For the Reader\n"
+	const attribute = `<meta name="default-heading.dedication" content="To You"/>`
+	tests := []struct {
+		name     string
+		config   string
+		language string
+		metas    []string
+		want     string
+	}{
+		{"built-in", "", "en", nil, "Dedication"},
+		{"config file", config, "en", nil, "For the Reader"},
+		{"book attribute", "", "en", []string{attribute}, "To You"},
+		{"book attribute over the config file", config, "en", []string{attribute}, "To You"},
+		// There is no table of translated headings: the language only changes a heading through an override.
+		{"another language", "", "fr", nil, "Dedication"},
+		{"another language with the config file", config, "fr", nil, "For the Reader"},
+		{"another language with the book attribute", config, "fr", []string{attribute}, "To You"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			edit := func(source string) string {
+				source = strings.Replace(emptyDedication(source), `<meta name="language" content="en"/>`,
+					`<meta name="language" content="`+test.language+`"/>`, 1)
+				return withAttributes(test.metas...)(source)
+			}
+			generator := testGenerator(t, exampleBook(t, "example", edit), io.Discard)
+			generator.Settings = loadConfig(t, test.config)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sectionOfKind(report, "dedication").Heading; got != test.want {
+				t.Errorf("dedication heading = %q, want %q", got, test.want)
+			}
+			nav := readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")
+			if !strings.Contains(nav, `<a href="section001.xhtml">`+test.want+`</a>`) {
+				t.Errorf("no TOC entry %q in nav.xhtml:\n%s", test.want, nav)
+			}
+		})
+	}
+}
+
+func TestDefaultHeadingsUnknownDirective(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		metas  []string
+		want   string
+	}{
+		{"config file", "default_headings:\n  dedicaton: For the Reader\n", nil,
+			"config parameter 'default_headings' has unknown directive 'dedicaton'"},
+		{"book attribute", "", []string{`<meta name="default-heading.chapter" content="Chapter"/>`},
+			"attribute 'default-heading.chapter' has unknown directive 'chapter'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", withAttributes(test.metas...)), io.Discard)
+			generator.Settings = loadConfig(t, test.config)
+			_, err := generator.Generate("example")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Generate error = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestMissingHeading(t *testing.T) {
+	noChapterHeading := func(source string) string {
+		return strings.Replace(source, "<h3>Chapter 2</h3>\n<h2>The Second Page</h2>\n", "", 1)
+	}
+	markerForHeading := func(source string) string {
+		return strings.Replace(source, "<h3>Chapter 2</h3>\n<h2>The Second Page</h2>\n", "<!--tocentry \"The Letter\"-->\n", 1)
+	}
+	noPartHeading := func(source string) string {
+		return strings.Replace(source, "<h1>Part 2</h1>\n<h2>The End</h2>\n", "<p>The second part.</p>\n", 1)
+	}
+	tests := []struct {
+		name    string
+		edit    func(string) string
+		want    string // the error, or the warning under -permissive
+		heading string // the heading synthesised under -permissive
+		file    string // the file of the section without a heading
+		body    string // the line found in place of the heading, kept as the first line of the body
+	}{
+		{"paragraph", noChapterHeading, "source.html line 44: paragraph text found where a heading was expected — " +
+			"did you forget the heading line? (after <!--chapter-->)", "Chapter 2", "section005.xhtml",
+			`<p class="first">The second chapter closes the first part.</p>`},
+		{"directive", markerForHeading, "source.html line 44: directive <!--tocentry--> found where a chapter heading " +
+			"(<h1> to <h6>) was expected", "Chapter 2", "section005.xhtml", `<a id="section005-toc1"></a>`},
+		{"part", noPartHeading, "source.html line 48: paragraph text found where a heading was expected",
+			"Part 2", "section006.xhtml", "<p>The second part.</p>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := testGenerator(t, exampleBook(t, "example", test.edit), io.Discard).Generate("example")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Generate error = %v, want one containing %q", err, test.want)
+			}
+
+			generator := testGenerator(t, exampleBook(t, "example", test.edit), io.Discard)
+			generator.Settings = DefaultSettings()
+			generator.Settings.Permissive = true
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			warned := false
+			for _, warning := range readWarnings(t, report) {
+				warned = warned || strings.Contains(warning, `using the heading "`+test.heading+`"`)
+			}
+			if !warned {
+				t.Errorf("warnings = %q, want the heading %s synthesised", readWarnings(t, report), test.heading)
+			}
+			if nav := navOutline(readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")); !strings.Contains(nav, test.heading+" "+test.file+"\n") {
+				t.Errorf("no entry %s in the TOC:\n%s", test.heading, nav)
+			}
+			page := readEpubFile(t, report.EpubFile, "OEBPS/Text/"+test.file)
+			if !strings.Contains(page, test.heading+"</h1>") {
+				t.Errorf("no heading %s in %s:\n%s", test.heading, test.file, page)
+			}
+			if !strings.Contains(page, test.heading+"</h1>\n      "+test.body) {
+				t.Errorf("%s is not the first line of the body of %s:\n%s", test.body, test.file, page)
+			}
+		})
+	}
+}
+
+func TestHeadingMarkup(t *testing.T) {
+	heading := "<h4>The <i>Silmarillion</i> &amp; <b>Co</b><br />Again</h4>"
+	edit := func(source string) string {
+		return strings.Replace(source, "<h3>Chapter 2</h3>", heading, 1)
+	}
+	report, err := testGenerator(t, exampleBook(t, "example", edit), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The TOC gets the plain text, and the page the heading as it is written.
+	want := "The Silmarillion &amp; Co Again section005.xhtml\n"
+	if nav := navOutline(readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")); !strings.Contains(nav, "  "+want) {
+		t.Errorf("no entry %q in nav.xhtml:\n%s", want, nav)
+	}
+	if ncx := ncxOutline(readEpubFile(t, report.EpubFile, "OEBPS/toc.ncx")); !strings.Contains(ncx, "\n"+want) {
+		t.Errorf("no entry %q in toc.ncx:\n%s", want, ncx)
+	}
+	if page := readEpubFile(t, report.EpubFile, "OEBPS/Text/section005.xhtml"); !strings.Contains(page, "\n      "+heading+"\n") {
+		t.Errorf("the heading %s is not on the page:\n%s", heading, page)
+	}
+}
@@ -0,0 +1,121 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// withMedia returns an edit of source.html declaring the media files and inserting the lines at the end of
+// the first chapter.
+func withMedia(media string, lines ...string) func(string) string {
+	insert := insertBefore("<!--chapter-->\n<h3>Chapter 2", lines...)
+	return func(source string) string {
+		if media != "" {
+			source = strings.Replace(source, `<meta name="images" content="figure.png"/>`,
+				`<meta name="images" content="figure.png"/>
+  <meta name="media" content="`+media+`"/>`, 1)
+		}
+		return insert(source)
+	}
+}
+
+// mediaBook returns the example book with the edit, and an audio file in its Media folder and a video file
+// next to source.html.
+func mediaBook(t *testing.T, edit func(string) string) fstest.MapFS {
+	books := exampleBook(t, "example", edit)
+	books["example/Media/theme.mp3"] = &fstest.MapFile{Data: []byte("ID3 theme")}
+	books["example/clip.mp4"] = &fstest.MapFile{Data: []byte("mp4 clip")}
+	return books
+}
+
+func TestRewriteAssetRefs(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{"bare names", []string{
+			`<p><img src="figure.png" alt="A red rectangle"/></p>`,
+			`<audio src="theme.mp3" controls="controls"></audio>`,
+			`<video controls="controls"><source src='clip.mp4' type="video/mp4"/></video>`,
+			`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10">`,
+			`<image xlink:href="figure.png" width="10" height="10"/>`,
+			`</svg>`,
+		}, []string{
+			`src="../Images/figure.png" alt="A red rectangle"`,
+			`<audio src="../Media/theme.mp3"`,
+			`<source src='../Media/clip.mp4'`,
+			`<image xlink:href="../Images/figure.png"`,
+		}},
+		{"paths in the book directory", []string{
+			`<audio src="Media/theme.mp3" controls="controls"></audio>`,
+		}, []string{
+			`<audio src="../Media/theme.mp3"`,
+		}},
+		{"already correct", []string{
+			`<p><img src="../Images/figure.png" alt="A red rectangle"/></p>`,
+			`<audio src="../Media/theme.mp3" controls="controls"></audio>`,
+			`<video src="https://example.com/clip.mp4" controls="controls"></video>`,
+		}, []string{
+			`src="../Images/figure.png" alt="A red rectangle"`,
+			`<audio src="../Media/theme.mp3"`,
+			`<video src="https://example.com/clip.mp4"`,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, mediaBook(t, withMedia("theme.mp3,clip.mp4", test.lines...)), io.Discard)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			chapter := readEpubFile(t, report.EpubFile, sectionFile(t, report, "chapter"))
+			for _, want := range test.want {
+				if !strings.Contains(chapter, want) {
+					t.Errorf("no %s in the chapter:\n%s", want, chapter)
+				}
+			}
+			opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+			for _, item := range []string{
+				`<item id="media-theme.mp3" href="Media/theme.mp3" media-type="audio/mpeg" />`,
+				`<item id="media-clip.mp4" href="Media/clip.mp4" media-type="video/mp4" />`,
+			} {
+				if !strings.Contains(opf, item) {
+					t.Errorf("no %s in the manifest:\n%s", item, opf)
+				}
+			}
+			if audio := readEpubFile(t, report.EpubFile, "OEBPS/Media/theme.mp3"); audio != "ID3 theme" {
+				t.Errorf("OEBPS/Media/theme.mp3 = %q, want the file of the book", audio)
+			}
+		})
+	}
+}
+
+func TestRewriteAssetRefsMissing(t *testing.T) {
+	tests := []struct {
+		name  string
+		media string
+		line  string
+		want  string
+	}{
+		{"undeclared audio", "", `<audio src="theme.mp3" controls="controls"></audio>`,
+			"refers to file theme.mp3 which is not packaged (add it to the 'images' or the 'media' attribute)"},
+		{"undeclared image", "", `<p><img src="map.png" alt="Map"/></p>`,
+			"refers to file map.png which is not packaged"},
+		{"missing media file", "missing.mp3", `<audio src="missing.mp3" controls="controls"></audio>`,
+			"media file missing.mp3 not found"},
+		{"not a media file", "notes.txt", `<audio src="notes.txt" controls="controls"></audio>`,
+			"notes.txt in attribute 'media' is not an MP3, MP4, Ogg or WebM file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, mediaBook(t, withMedia(test.media, test.line)), io.Discard)
+			_, err := generator.Generate("example")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Generate error = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
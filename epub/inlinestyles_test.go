@@ -0,0 +1,72 @@
+package epub
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdataLines returns the lines of the fixture file in testdata.
+func testdataLines(t *testing.T, fixture string) []string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestInlineStyles(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(settings *Settings)
+		want   string // the golden of the body lines from word-body.html, "" if left unchanged
+		report []string
+	}{
+		{"report", func(settings *Settings) { settings.Styles = true }, "", []string{
+			"Inline styles: 5 style attribute(s) in 1 section(s)\n" +
+				"  section004 \"Chapter 1\": 5 (font-family 3, text-align 2, font-size 1)\n",
+		}},
+		{"strip keeping text-align", func(settings *Settings) {
+			settings.StripStyles = true
+			settings.KeepStyles = "text-align"
+		}, "word-body-stripped.html", []string{
+			"  section004 \"Chapter 1\": 5 (font-family 3, text-align 2, font-size 1)\n" +
+				"  Removed 3 style attribute(s), kept 2 with the properties in 'keep_styles'\n",
+		}},
+		{"strip all", func(settings *Settings) { settings.StripStyles = true }, "word-body-stripped-all.html", []string{
+			"  Removed 5 style attribute(s), kept 0 with the properties in 'keep_styles'\n",
+		}},
+	}
+	fixture := testdataLines(t, "word-body.html")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			generator := testGenerator(t, exampleBook(t, "example", insertBefore("<!--chapter-->\n<h3>Chapter 2", fixture...)), &output)
+			generator.Settings = DefaultSettings()
+			test.change(generator.Settings)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.report {
+				if !strings.Contains(output.String(), want) {
+					t.Errorf("no %q in the output:\n%s", want, output.String())
+				}
+			}
+
+			page := readEpubFile(t, report.EpubFile, "OEBPS/Text/section004.xhtml")
+			want := fixture
+			if test.want != "" {
+				want = testdataLines(t, test.want)
+			}
+			for _, line := range want {
+				if !strings.Contains(page, "\n      "+line+"\n") {
+					t.Errorf("no line %s in the chapter:\n%s", line, page)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package epub
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateWindowsSource(t *testing.T) {
+	report, err := testGenerator(t, exampleBook(t, "example", nil), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := readEpubFiles(t, report.EpubFile)
+
+	// The example book as saved by an editor on Windows: with a byte order mark and CRLF line ends.
+	windows := func(source string) string {
+		return "\uFEFF" + strings.ReplaceAll(source, "\n", "\r\n")
+	}
+	report, err = testGenerator(t, exampleBook(t, "example", windows), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readEpubFiles(t, report.EpubFile)
+	if !reflect.DeepEqual(got, want) {
+		for name, content := range want {
+			if got[name] != content {
+				t.Errorf("%s differs from the LF original:\n%s\nwant:\n%s", name, got[name], content)
+			}
+		}
+		t.Errorf("files %d, want %d", len(got), len(want))
+	}
+}
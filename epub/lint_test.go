@@ -0,0 +1,79 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestContentLint(t *testing.T) {
+	pitfalls := insertBefore("<!--part-->\n<h1>Part 2", `<p>&#160;</p>`, `<p id="the end">One<br/><br/>Two</p>`)
+	tests := []struct {
+		disabled string
+		want     []string
+	}{
+		{"", []string{
+			"EP3L001 empty paragraph at line 47 in section005 (Chapter 2): empty paragraphs used for spacing collapse on some readers; use a CSS margin instead",
+			"EP3L002 consecutive <br/> at line 48 in section005 (Chapter 2): ",
+			"EP3L006 invalid id at line 48 in section005 (Chapter 2): ",
+		}},
+		{"EP3L001,ep3l006", []string{
+			"EP3L002 consecutive <br/> at line 48 in section005 (Chapter 2): ",
+		}},
+	}
+	for _, test := range tests {
+		generator := testGenerator(t, exampleBook(t, "example", pitfalls), io.Discard)
+		generator.Settings = DefaultSettings()
+		generator.Settings.Lint = true
+		generator.Settings.LintDisable = test.disabled
+		report, err := generator.Generate("example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var findings []string
+		for _, warning := range readWarnings(t, report) {
+			if strings.HasPrefix(warning, "EP3L") {
+				findings = append(findings, warning)
+			}
+		}
+		if len(findings) != len(test.want) {
+			t.Errorf("disabled %q: findings %q, want %d", test.disabled, findings, len(test.want))
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.HasPrefix(findings[i], want) {
+				t.Errorf("disabled %q: finding %q, want %q", test.disabled, findings[i], want)
+			}
+		}
+	}
+
+	// The lint is opt-in: a build without it has none of the findings.
+	report, err := testGenerator(t, exampleBook(t, "example", pitfalls), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, warning := range readWarnings(t, report) {
+		if strings.HasPrefix(warning, "EP3L") {
+			t.Errorf("finding without the lint: %s", warning)
+		}
+	}
+
+	// The example book itself is clean.
+	generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+	generator.Settings = DefaultSettings()
+	generator.Settings.Lint = true
+	if report, err = generator.Generate("example"); err != nil {
+		t.Fatal(err)
+	}
+	if warnings := readWarnings(t, report); len(warnings) > 0 {
+		t.Errorf("warnings in the example book: %q", warnings)
+	}
+
+	generator = testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+	generator.Settings = DefaultSettings()
+	generator.Settings.Lint = true
+	generator.Settings.LintDisable = "EP3L042"
+	if _, err = generator.Generate("example"); err == nil || !strings.Contains(err.Error(), "unknown lint rule 'EP3L042' to disable") {
+		t.Errorf("Generate error = %v, want the unknown rule reported", err)
+	}
+}
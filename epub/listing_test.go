@@ -0,0 +1,42 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPreformattedListing(t *testing.T) {
+	listing := testdataLines(t, "listing.html")
+	edit := func(source string) string {
+		source = insertBefore("<!--chapter-->\n<h3>Chapter 2", listing...)(source)
+		// The directives and headings are recognised with the whitespace around them.
+		return strings.Replace(source, "<!--chapter-->\n<h3>Chapter 2</h3>", "  <!--chapter-->\t\n\t<h3>Chapter 2</h3>  ", 1)
+	}
+	report, err := testGenerator(t, exampleBook(t, "example", edit), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := readEpubFile(t, report.EpubFile, "OEBPS/Text/section004.xhtml")
+	joined := strings.Join(listing, "\n")
+	pre := joined[strings.Index(joined, "<pre>") : strings.Index(joined, "</pre>")+len("</pre>")]
+	if !strings.Contains(page, pre) {
+		t.Errorf("the listing was not kept byte for byte:\n%q\nin the chapter:\n%s", pre, page)
+	}
+	if !strings.Contains(page, "\n          <p>An indented paragraph.</p>\n") {
+		t.Errorf("the indentation of the paragraph was not kept:\n%s", page)
+	}
+	if !strings.Contains(navOutline(readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")), "  Chapter 2 section005.xhtml\n") {
+		t.Errorf("the indented chapter directive was not recognised")
+	}
+
+	// The Windows line ends are dropped, and only them.
+	crlf := func(source string) string { return strings.ReplaceAll(edit(source), "\n", "\r\n") }
+	report, err = testGenerator(t, exampleBook(t, "example", crlf), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readEpubFile(t, report.EpubFile, "OEBPS/Text/section004.xhtml"); got != page {
+		t.Errorf("the chapter of the source with Windows line ends differs:\n%s\nwant:\n%s", got, page)
+	}
+}
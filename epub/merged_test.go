@@ -0,0 +1,38 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMergedChapterCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string // the headings warned about
+	}{
+		{"merged chapters", []string{"<h2>XIV</h2>", "<p>A chapter whose directive was forgotten.</p>",
+			"<h2>Chapter 15</h2>", "<p>And another one.</p>"}, []string{"<h2>XIV</h2>", "<h2>Chapter 15</h2>"}},
+		{"decorative headings", []string{"<h2>Civil</h2>", "<p>A subheading spelt with Roman digits.</p>",
+			"<h2><i>Interlude</i></h2>", "<h2>Mild</h2>"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", insertBefore("<!--chapter-->\n<h3>Chapter 2", test.lines...)), io.Discard)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			warnings := readWarnings(t, report)
+			if len(warnings) != len(test.want) {
+				t.Fatalf("warnings = %q, want one about each of %q", warnings, test.want)
+			}
+			for i, heading := range test.want {
+				if !strings.Contains(warnings[i], heading+" inside") || !strings.Contains(warnings[i], "<!--chapter--> directive missing") {
+					t.Errorf("warning %q, want one about %s", warnings[i], heading)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/roslamir/ep3gen/model"
+)
+
+// modelOutline returns the outline of the section tree of the model in the form of navOutline, with the
+// headings of the sections.
+func modelOutline(book *model.Book, nodes []model.Node, depth int) string {
+	var outline strings.Builder
+	for _, node := range nodes {
+		section := book.Section(node.ID)
+		if section == nil {
+			outline.WriteString(strings.Repeat("  ", depth) + "missing section " + node.ID + "\n")
+			continue
+		}
+		outline.WriteString(strings.Repeat("  ", depth) + section.Heading + " " + node.ID + ".xhtml\n")
+		outline.WriteString(modelOutline(book, node.Children, depth+1))
+	}
+	return outline.String()
+}
+
+func TestEmitModelRoundTrip(t *testing.T) {
+	generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+	generator.Settings = DefaultSettings()
+	generator.Settings.EmitModel = filepath.Join(t.TempDir(), "model.json")
+	report, err := generator.Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, err := model.ReadFile(generator.Settings.EmitModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*book, report.Model) {
+		t.Errorf("the emitted model differs from the model of the report")
+	}
+
+	// The TOC regenerated from the model is the one of nav.xhtml.
+	nav := navOutline(readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml"))
+	if got := modelOutline(book, book.Structure, 0); got != nav {
+		t.Errorf("the section tree of the model:\n%s\nwant the TOC of nav.xhtml:\n%s", got, nav)
+	}
+	for _, id := range book.Guides {
+		if book.Section(id) == nil {
+			t.Errorf("landmark %s is not a section of the model", id)
+		}
+	}
+	chapter := book.Section("section004")
+	if chapter == nil || chapter.Kind != "chapter" || len(chapter.Lines) == 0 {
+		t.Fatalf("section004 = %+v, want the first chapter with its lines", chapter)
+	}
+	if len(book.Images) != 1 || book.Images[0].FileName != "figure.png" || book.CoverImage.FileName != "cover.jpeg" {
+		t.Errorf("images = %+v and cover %+v, want figure.png and cover.jpeg", book.Images, book.CoverImage)
+	}
+
+	// Encoding the model again gives a model read back the same.
+	var encoded bytes.Buffer
+	if err = json.NewEncoder(&encoded).Encode(book); err != nil {
+		t.Fatal(err)
+	}
+	again, err := model.Read(&encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, book) {
+		t.Errorf("the model changed through encoding and reading it again")
+	}
+}
@@ -0,0 +1,72 @@
+package epub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVerboseNavTree(t *testing.T) {
+	var output bytes.Buffer
+	generator := testGenerator(t, exampleBook(t, "example", withTocEntries), &output)
+	generator.Settings = DefaultSettings()
+	generator.Settings.Verbose = true
+	if _, err := generator.Generate("example"); err != nil {
+		t.Fatal(err)
+	}
+	want := `
+Table of contents:
+  Cover Page -> Text/cover.xhtml
+  Title Page -> Text/titlepage.xhtml
+  Copyright -> Text/copyright.xhtml
+  Dedication -> Text/section001.xhtml
+  Foreword -> Text/section002.xhtml
+  Part 1 -> Text/section003.xhtml
+    Map of the Part -> Text/section003.xhtml#section003-toc1
+    Chapter 1 -> Text/section004.xhtml
+      The Letter -> Text/section004.xhtml#section004-toc1
+      The Letter -> Text/section004.xhtml#section004-toc2
+    Chapter 2 -> Text/section005.xhtml
+  Part 2 -> Text/section006.xhtml
+    Chapter 3 -> Text/section007.xhtml
+  Afterword -> Text/section008.xhtml
+`
+	if !strings.Contains(output.String(), want) {
+		t.Errorf("no TOC tree in the output:\n%s", output.String())
+	}
+}
+
+func TestVerboseNavTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		old, new string
+		want     string
+	}{
+		{"broken anchor", "nav.gohtml", `<a href="{{.Href}}">{{.Label}}</a>`, `<a href="{{.Href}}-x">{{.Label}}</a>`,
+			`nav.xhtml links to Text/section003.xhtml#section003-toc1-x but Text/section003.xhtml has no element with id "section003-toc1-x"`},
+		{"missing file", "ncx.goxml", `<content src="{{$.TextDir}}/{{.Href}}" />`, `<content src="{{$.TextDir}}/old-{{.Href}}" />`,
+			"toc.ncx links to Text/old-cover.xhtml which does not exist"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			templates := templatesWithout(t)
+			template := string(templates[test.template].Data)
+			if !strings.Contains(template, test.old) {
+				t.Fatalf("no %s in %s", test.old, test.template)
+			}
+			templates[test.template] = &fstest.MapFile{Data: []byte(strings.ReplaceAll(template, test.old, test.new))}
+
+			var output bytes.Buffer
+			generator := testGenerator(t, exampleBook(t, "example", withTocEntries), &output)
+			generator.Templates = templates
+			generator.Settings = DefaultSettings()
+			generator.Settings.Verbose = true
+			_, err := generator.Generate("example")
+			if err == nil || !strings.Contains(err.Error(), "unresolved TOC links:\n  "+test.want) {
+				t.Errorf("Generate error = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package epub
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// imageItemRegexp matches the manifest items of the PNG images.
+var imageItemRegexp = regexp.MustCompile(`<item id="[^"]*" href="Images/[^"]*" media-type="image/png" />`)
+
+func TestManifestImageOrder(t *testing.T) {
+	names := []string{"zebra.png", "figure.png", "map.png", "apple.png", "tree.png", "coast.png", "inn.png", "ship.png"}
+	declare := func(source string) string {
+		return strings.Replace(source, `<meta name="images" content="figure.png"/>`,
+			`<meta name="images" content="`+strings.Join(names, ",")+`"/>`, 1)
+	}
+	var first string
+	for build := 0; build < 2; build++ {
+		books := exampleBook(t, "example", declare)
+		for _, name := range names {
+			books["example/"+name] = &fstest.MapFile{Data: books["example/figure.png"].Data}
+		}
+		report, err := testGenerator(t, books, io.Discard).Generate("example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := imageItemRegexp.FindAllString(readEpubFile(t, report.EpubFile, "OEBPS/package.opf"), -1)
+		if !sort.StringsAreSorted(items) || len(items) != len(names) {
+			t.Errorf("build %d: image items %q, want the %d images sorted by file name", build+1, items, len(names))
+		}
+		if build == 0 {
+			first = strings.Join(items, "\n")
+		} else if got := strings.Join(items, "\n"); got != first {
+			t.Errorf("the image items changed between two builds:\n%s\nthen:\n%s", first, got)
+		}
+	}
+}
+
+func TestImageExtensions(t *testing.T) {
+	rename := func(source string) string {
+		source = strings.Replace(source, `content="cover.jpeg"`, `content="my.cover.v2.JPG"`, 1)
+		source = strings.Replace(source, `content="figure.png"`, `content="Figure.v1.PNG"`, 1)
+		return strings.Replace(source, "\nfigure.png ", "\nFigure.v1.PNG ", 1)
+	}
+	books := exampleBook(t, "example", rename)
+	books["example/my.cover.v2.JPG"] = books["example/cover.jpeg"]
+	books["example/Figure.v1.PNG"] = books["example/figure.png"]
+	delete(books, "example/cover.jpeg")
+	delete(books, "example/figure.png")
+	report, err := testGenerator(t, books, io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+	for _, want := range []string{
+		`href="Images/my.cover.v2.JPG" media-type="image/jpeg"`,
+		`href="Images/Figure.v1.PNG" media-type="image/png"`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("no %s in the manifest:\n%s", want, opf)
+		}
+	}
+	if strings.Contains(opf, `media-type="image/image/`) {
+		t.Errorf("the media type of an image was prefixed twice:\n%s", opf)
+	}
+	if chapter := readEpubFile(t, report.EpubFile, sectionFile(t, report, "chapter")); !strings.Contains(chapter, `src="../Images/Figure.v1.PNG"`) {
+		t.Errorf("the figure was not linked:\n%s", chapter)
+	}
+}
@@ -0,0 +1,72 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// withoutParts drops the two parts of the example book, leaving its three chapters.
+func withoutParts(source string) string {
+	source = strings.Replace(source, "<!--part-->\n<h1>Part 1</h1>\n<h2>The Beginning</h2>\n", "", 1)
+	return strings.Replace(source, "<!--part-->\n<h1>Part 2</h1>\n<h2>The End</h2>\n", "", 1)
+}
+
+// orderedBook returns the book with the edit and the order.yaml file.
+func orderedBook(t *testing.T, edit func(string) string, order string) fstest.MapFS {
+	books := exampleBook(t, "example", edit)
+	books["example/order.yaml"] = &fstest.MapFile{Data: []byte(order)}
+	return books
+}
+
+func TestReorderBodymatter(t *testing.T) {
+	// The chapters by heading and by ID, the last one first.
+	books := orderedBook(t, withoutParts, "- Chapter 3\n- section003\n- Chapter 2\n")
+	report, err := testGenerator(t, books, io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := packageOutline(t, report), readGolden(t, "order.txt"); got != want {
+		t.Errorf("links to the sections:\n%s\nwant:\n%s", got, want)
+	}
+	// The section files keep their content, only their places change.
+	if page := readEpubFile(t, report.EpubFile, "OEBPS/Text/section005.xhtml"); !strings.Contains(page, "Chapter 3") {
+		t.Errorf("section005 is not the third chapter:\n%s", page)
+	}
+}
+
+func TestReorderBodymatterErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(string) string
+		order string
+		want  string
+	}{
+		{"missing", withoutParts, "- Chapter 3\n- Chapter 1\n",
+			"order.yaml does not list the bodymatter sections section004 (Chapter 2)"},
+		{"listed twice", withoutParts, "- Chapter 3\n- Chapter 1\n- section005\n- Chapter 2\n",
+			"order.yaml line 3: section005 (Chapter 3) is already listed on line 1"},
+		{"unknown", withoutParts, "- Chapter 3\n- Chapter 4\n",
+			"order.yaml line 2: there is no part or chapter with the ID or heading 'Chapter 4'"},
+		{"frontmatter", withoutParts, "- Foreword\n",
+			"order.yaml line 1: there is no part or chapter with the ID or heading 'Foreword'"},
+		{"ambiguous", func(source string) string {
+			return strings.Replace(withoutParts(source), "<h3>Chapter 3</h3>", "<h3>Chapter 1</h3>", 1)
+		}, "- Chapter 1\n", "order.yaml line 1: the heading 'Chapter 1' is that of both section003 and section005; use the ID instead"},
+		{"not a list", withoutParts, "chapters: 3\n",
+			"order.yaml must be a list of the part and chapter sections by ID or heading"},
+		{"empty entry", withoutParts, "- Chapter 3\n- [Chapter 1]\n",
+			"order.yaml line 2: each entry must be the ID or the heading of a section"},
+		{"chapter before the parts", nil, "- Chapter 1\n- Part 1\n- Chapter 2\n- Part 2\n- Chapter 3\n",
+			"order.yaml line 1: the book has parts, so the first section must be a part, not section004 (Chapter 1)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := testGenerator(t, orderedBook(t, test.edit, test.order), io.Discard).Generate("example")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Generate error = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package epub
+
+import (
+	"archive/zip"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPackageEntryDates(t *testing.T) {
+	report, err := testGenerator(t, exampleBook(t, "example", nil), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.OpenReader(report.EpubFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	want := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC) // the modified attribute of the example book
+	for i, file := range archive.File {
+		if i == 0 && (file.Name != "mimetype" || file.Method != zip.Store || len(file.Extra) > 0) {
+			t.Errorf("first entry %s, method %d, extra %v, want the stored mimetype without an extra field",
+				file.Name, file.Method, file.Extra)
+		}
+		if !file.Modified.Equal(want) {
+			t.Errorf("%s dated %v, want %v", file.Name, file.Modified, want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGenerateRejectsBackslashes(t *testing.T) {
+	tests := []struct {
+		template string
+		old, new string
+		want     string
+	}{
+		{"opf.goxml", `href="{{$.ImagesDir}}/{{.FileName}}"`, `href="{{$.ImagesDir}}\{{.FileName}}"`,
+			`package.opf contains href="Images\cover.jpeg" with a backslash`},
+		{"ncx.goxml", `<content src="{{$.TextDir}}/{{.Href}}" />`, `<content src="{{$.TextDir}}\{{.Href}}" />`,
+			`toc.ncx contains src="Text\cover.xhtml" with a backslash`},
+		{"container.goxml", `full-path="{{.FullPath}}"`, `full-path="OEBPS\package.opf"`,
+			`container.xml contains full-path="OEBPS\package.opf" with a backslash`},
+	}
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			templates := templatesWithout(t)
+			content := string(templates[test.template].Data)
+			if !strings.Contains(content, test.old) {
+				t.Fatalf("no %s in %s", test.old, test.template)
+			}
+			templates[test.template] = &fstest.MapFile{Data: []byte(strings.Replace(content, test.old, test.new, 1))}
+			generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+			generator.Templates = templates
+			_, err := generator.Generate("example")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Generate error = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	missingFigure := func() *Generator {
+		books := exampleBook(t, "example", nil)
+		delete(books, "example/figure.png")
+		return testGenerator(t, books, &bytes.Buffer{})
+	}
+
+	// Without -placeholders, the missing image stops the build and points to the flag.
+	_, err := missingFigure().Generate("example")
+	if err == nil || !strings.Contains(err.Error(), "image file figure.png not found") ||
+		!strings.Contains(err.Error(), "use -placeholders") {
+		t.Errorf("Generate error = %v, want the missing figure.png reported with a hint of -placeholders", err)
+	}
+
+	// With -placeholders alone, the draft is generated but not packaged.
+	generator := missingFigure()
+	generator.Settings = DefaultSettings()
+	generator.Settings.Placeholders = true
+	_, err = generator.Generate("example")
+	if err == nil || !strings.Contains(err.Error(), "not packaging the e-book, since 1 image(s) are placeholders: figure.png") {
+		t.Errorf("Generate error = %v, want the packaging refused for the placeholder", err)
+	}
+	if _, err := os.Stat(filepath.Join(generator.Target, "example", "OEBPS", "Images", "figure.png")); err != nil {
+		t.Errorf("the generated book directory was not left for review: %v", err)
+	}
+
+	// With -allow-placeholders too, the draft is packaged and the placeholder listed.
+	var output bytes.Buffer
+	generator = missingFigure()
+	generator.Output = &output
+	generator.Settings = DefaultSettings()
+	generator.Settings.Placeholders = true
+	generator.Settings.AllowPlaceholders = true
+	generator.Settings.WriteReport = true
+	report, err := generator.Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, format, err := image.DecodeConfig(strings.NewReader(readEpubFile(t, report.EpubFile, "OEBPS/Images/figure.png")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" || config.Width != 600 || config.Height != 400 {
+		t.Errorf("placeholder is a %dx%d %s image, want a 600x400 png", config.Width, config.Height, format)
+	}
+	if !strings.Contains(output.String(), "* DRAFT: 1 image(s) replaced by a placeholder image:\n*   figure.png\n") {
+		t.Errorf("the placeholder was not listed in the summary:\n%s", output.String())
+	}
+	content, err := os.ReadFile(filepath.Join(generator.Target, "example", "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		Placeholders []string `json:"placeholders"`
+	}
+	if err = json.Unmarshal(content, &data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Placeholders) != 1 || data.Placeholders[0] != "figure.png" {
+		t.Errorf("report placeholders = %q, want [figure.png]", data.Placeholders)
+	}
+
+	// The cover image is never replaced.
+	books := exampleBook(t, "example", nil)
+	delete(books, "example/cover.jpeg")
+	generator = testGenerator(t, books, &bytes.Buffer{})
+	generator.Settings = DefaultSettings()
+	generator.Settings.Placeholders = true
+	generator.Settings.AllowPlaceholders = true
+	if _, err = generator.Generate("example"); err == nil || !strings.Contains(err.Error(), "cover.jpeg") {
+		t.Errorf("Generate error = %v, want the missing cover image reported", err)
+	}
+}
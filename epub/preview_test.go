@@ -0,0 +1,59 @@
+package epub
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// guideRegexp matches the guide of package.opf.
+var guideRegexp = regexp.MustCompile(`(?s)<guide>\s*(<reference [^>]*>)`)
+
+func TestStartOfReading(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives map[string]string
+		start      string
+	}{
+		{"without arguments", nil, "section001.xhtml"},
+		{"dedication skipped", map[string]string{
+			"<!--dedication-->": `<!--dedication preview="skip"-->`,
+		}, "section002.xhtml"},
+		{"frontmatter skipped", map[string]string{
+			"<!--dedication-->": `<!--dedication preview="skip"-->`,
+			"<!--foreword-->":   `<!--foreword preview="skip"-->`,
+		}, "section003.xhtml"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			edit := func(source string) string {
+				for directive, replacement := range test.directives {
+					source = strings.Replace(source, directive, replacement, 1)
+				}
+				return source
+			}
+			generator := testGenerator(t, exampleBook(t, "example", edit), io.Discard)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nav := readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")
+			if landmark := `<a epub:type="bodymatter" href="` + test.start + `">Start</a>`; !strings.Contains(nav, landmark) {
+				t.Errorf("no landmark %s in nav.xhtml:\n%s", landmark, nav)
+			}
+			opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+			want := `<reference title="Start" type="text" href="Text/` + test.start + `" />`
+			if match := guideRegexp.FindStringSubmatch(opf); match == nil || match[1] != want {
+				t.Errorf("the guide does not start with %s:\n%s", want, opf)
+			}
+			if meta := `<meta property="ibooks:reader-start-page">Text/` + test.start + `</meta>`; !strings.Contains(opf, meta) {
+				t.Errorf("no %s in package.opf:\n%s", meta, opf)
+			}
+			if !strings.Contains(opf, `prefix="ibooks: http://vocabulary.itunes.apple.com/rdf/ibooks/vocabulary-extensions-1.0/"`) {
+				t.Errorf("the ibooks prefix is not declared in package.opf")
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 20-Jan-2024
+//
+// The self-test of an installation, building an example book end to end.
+
+package epub
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+	"github.com/roslamir/ep3gen/internal/gen"
+)
+
+// SelfTestBook is the name of the book directory of the example book built by SelfTest.
+const SelfTestBook = "example"
+
+// selfTestKinds are the kinds of sections the example book must have, so that the self-test goes through the
+// frontmatter, the parts, the chapters and the backmatter.
+var selfTestKinds = []epubtype.Term{epubtype.CopyrightPage, epubtype.Foreword, epubtype.Part, epubtype.Chapter, epubtype.Afterword}
+
+// selfTestPhase is a phase of SelfTest, run in order until one fails.
+type selfTestPhase struct {
+	name string
+	run  func() error
+}
+
+// SelfTest checks that the installation works by building the example book in the SelfTestBook directory of
+// the file system, such as the one embedded in the epubgen command, with the templates and the resources of
+// the settings of the generator. The book is copied into a temporary directory, built and packaged there with
+// the usual checks of a build, and the temporary directory is removed at the end. The result of each phase is
+// printed to out. Returns the error of the first phase which failed, naming the phase.
+func (g *Generator) SelfTest(example fs.FS, out io.Writer) (err error) {
+	settings := g.settings()
+	var tempDir string
+	var report Report
+	phases := []selfTestPhase{
+		{"temporary directory", func() error {
+			dir, err := os.MkdirTemp("", "ep3gen-selftest-")
+			if err != nil {
+				return err
+			}
+			tempDir = dir
+			settings.SourceDir = filepath.Join(tempDir, "source")
+			settings.TargetDir = filepath.Join(tempDir, "generated")
+			return copyFS(example, SelfTestBook, filepath.Join(settings.SourceDir, SelfTestBook))
+		}},
+		{"templates", func() error {
+			settings.BookName = SelfTestBook
+			return gen.NewContext(settings.Clone(), g.output()).LoadTemplates()
+		}},
+		{"resources", func() error {
+			for _, name := range []string{"mimetype", "stylesheet.css"} {
+				if _, err := os.Stat(filepath.Join(settings.ResourceDir, name)); err != nil {
+					return fmt.Errorf("resource file %s not found: %s", name, err)
+				}
+			}
+			return nil
+		}},
+		{"build", func() (err error) {
+			generator := Generator{Settings: settings, Output: g.Output}
+			report, err = generator.Generate(SelfTestBook)
+			return err
+		}},
+		{"model", func() error {
+			return checkSelfTestModel(report)
+		}},
+		{"package", func() error {
+			return checkSelfTestPackage(report)
+		}},
+	}
+
+	for _, phase := range phases {
+		if err = phase.run(); err != nil {
+			fmt.Fprintf(out, "selftest: FAIL %s: %s\n", phase.name, err)
+			err = fmt.Errorf("selftest failed in phase '%s': %w", phase.name, err)
+			break
+		}
+		fmt.Fprintf(out, "selftest: PASS %s\n", phase.name)
+	}
+
+	if tempDir != "" {
+		if cleanupErr := os.RemoveAll(tempDir); cleanupErr != nil {
+			fmt.Fprintf(out, "selftest: FAIL cleanup: %s\n", cleanupErr)
+			if err == nil {
+				err = fmt.Errorf("selftest failed in phase 'cleanup': %w", cleanupErr)
+			}
+		} else {
+			fmt.Fprintf(out, "selftest: PASS cleanup\n")
+		}
+	}
+	if err == nil {
+		fmt.Fprintln(out, "selftest: all phases passed")
+	}
+	return err
+}
+
+// checkSelfTestModel checks that the build of the example book went through all the selfTestKinds of sections
+// and packaged its image.
+func checkSelfTestModel(report Report) error {
+	if report.UpToDate {
+		return errors.New("the example book was not built")
+	}
+	kinds := make(map[epubtype.Term]bool)
+	for _, section := range report.Model.Sections {
+		kinds[epubtype.Term(section.Kind)] = true
+	}
+	for _, kind := range selfTestKinds {
+		if !kinds[kind] {
+			return fmt.Errorf("the example book has no section of the kind '%s'", kind)
+		}
+	}
+	if report.Model.CoverImage.FileName == "" || len(report.Model.Images) == 0 {
+		return errors.New("the images of the example book were not packaged")
+	}
+	return nil
+}
+
+// checkSelfTestPackage checks that the .epub file of the example book can be read back as a ZIP file, starting
+// with the uncompressed mimetype file, and holds all the files of the package.
+func checkSelfTestPackage(report Report) error {
+	archive, err := zip.OpenReader(report.EpubFile)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %s", report.EpubFile, err)
+	}
+	defer archive.Close()
+	if len(archive.File) == 0 || archive.File[0].Name != "mimetype" || archive.File[0].Method != zip.Store {
+		return fmt.Errorf("%s does not start with the uncompressed mimetype file", report.EpubFile)
+	}
+	entries := make(map[string]bool, len(archive.File))
+	for _, file := range archive.File {
+		entries[file.Name] = true
+	}
+	for _, file := range report.Files {
+		if !entries[file.Name] && !strings.HasSuffix(file.Name, ".epub") {
+			return fmt.Errorf("%s is missing the file %s", report.EpubFile, file.Name)
+		}
+	}
+	return nil
+}
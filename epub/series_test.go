@@ -0,0 +1,47 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSeriesCollection(t *testing.T) {
+	tests := []struct {
+		name  string
+		metas []string
+		want  []string
+	}{
+		{"no series", nil, nil},
+		{"series", []string{`<meta name="series" content="Examples"/>`}, []string{
+			`<meta property="belongs-to-collection" id="series-collection">Examples</meta>`,
+			`<meta refines="#series-collection" property="collection-type">series</meta>`,
+		}},
+		{"series and index", []string{`<meta name="series" content="Examples"/>`, `<meta name="series-index" content="2.5"/>`}, []string{
+			`<meta property="belongs-to-collection" id="series-collection">Examples</meta>`,
+			`<meta refines="#series-collection" property="group-position">2.5</meta>`,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := testGenerator(t, exampleBook(t, "example", withAttributes(test.metas...)), io.Discard).Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+			for _, want := range test.want {
+				if !strings.Contains(opf, want) {
+					t.Errorf("package.opf has no %s", want)
+				}
+			}
+			// The position in the series is only given by the collection, never by the title.
+			positions := strings.Count(opf, `property="group-position"`)
+			if want := strings.Count(strings.Join(test.want, "\n"), `property="group-position"`); positions != want {
+				t.Errorf("package.opf has %d group-position, want %d", positions, want)
+			}
+			if strings.Contains(opf, `<meta refines="#pub-title" property="group-position">`) {
+				t.Errorf("package.opf gives the group-position of the title")
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTocEntryAnchors(t *testing.T) {
+	entries := insertBefore("<!--chapter-->\n<h3>Chapter 2", `<!--tocentry "The Letter"-->`, "<p>A letter.</p>",
+		`<!--tocentry "The Letter"-->`, "<p>Another letter.</p>", `<!--tocentry "Notes"-->`, "<p>Some notes.</p>",
+		`<!--chapter id="the-letter"-->`, "<h1>A Letter</h1>", "<p>The chapter written against its explicit id.</p>")
+	tests := []struct {
+		name       string
+		sectionIDs string
+		want       func(chapterID string) []string
+	}{
+		{"numbered", "", func(chapterID string) []string {
+			return []string{chapterID + "-toc1", chapterID + "-toc2", chapterID + "-toc3"}
+		}},
+		{"slug", "slug", func(string) []string {
+			// The explicit id of the chapter and the ID of the generated notes win over the anchors.
+			return []string{"the-letter-2", "the-letter-3", "notes-2"}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", entries), io.Discard)
+			generator.Settings = DefaultSettings()
+			generator.Settings.SectionIDs = test.sectionIDs
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			chapter := sectionOfKind(report, "chapter")
+			page := readEpubFile(t, report.EpubFile, sectionFile(t, report, "chapter"))
+			nav := readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")
+			for _, anchor := range test.want(chapter.ID) {
+				if !strings.Contains(page, `<a id="`+anchor+`"></a>`) {
+					t.Errorf("no anchor %s in the chapter:\n%s", anchor, page)
+				}
+				if !strings.Contains(nav, chapter.ID+".xhtml#"+anchor+`"`) {
+					t.Errorf("no link to the anchor %s in nav.xhtml:\n%s", anchor, nav)
+				}
+			}
+			if readEpubFile(t, report.EpubFile, "OEBPS/Text/the-letter.xhtml") == "" {
+				t.Errorf("the chapter with the explicit id is empty")
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// answersPage is a hand-crafted page for the <!--raw--> directive.
+const answersPage = `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>Answers</title></head>
+<body><p>The answer is 42.</p></body>
+</html>
+`
+
+// withSpineProperties returns an edit of source.html giving the second chapter the spine properties.
+func withSpineProperties(properties string) func(string) string {
+	return func(source string) string {
+		return strings.Replace(source, "<!--chapter-->\n<h3>Chapter 2", `<!--chapter spine-properties="`+properties+`"-->`+"\n<h3>Chapter 2", 1)
+	}
+}
+
+func TestSpineProperties(t *testing.T) {
+	edit := func(source string) string {
+		source = withSpineProperties(" exclude-from-search   rendition:layout-pre-paginated ")(source)
+		return strings.Replace(source, "<!--afterword-->",
+			`<!--raw answers.xhtml toc="Answers" spine-properties="exclude-from-search"-->`+"\n<!--afterword-->", 1)
+	}
+	books := exampleBook(t, "example", edit)
+	books["example/answers.xhtml"] = &fstest.MapFile{Data: []byte(answersPage)}
+	report, err := testGenerator(t, books, io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+	for _, want := range []string{
+		`<itemref idref="section004" />`,
+		`<itemref idref="section005" properties="exclude-from-search rendition:layout-pre-paginated" />`,
+		`<itemref idref="answers" properties="exclude-from-search" />`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("no %s in the spine:\n%s", want, opf)
+		}
+	}
+
+	// The sections of a combined frontmatter share the properties of their file.
+	edit = func(source string) string {
+		source = strings.Replace(source, "<!--dedication-->", `<!--dedication spine-properties="page-spread-right"-->`, 1)
+		return strings.Replace(source, "<!--foreword-->", `<!--foreword spine-properties="exclude-from-search page-spread-right"-->`, 1)
+	}
+	generator := testGenerator(t, exampleBook(t, "example", edit), io.Discard)
+	generator.Settings = DefaultSettings()
+	generator.Settings.FrontMatter = "combined"
+	if report, err = generator.Generate("example"); err != nil {
+		t.Fatal(err)
+	}
+	opf = readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+	if want := `<itemref idref="frontmatter" properties="page-spread-right exclude-from-search" />`; !strings.Contains(opf, want) {
+		t.Errorf("no %s in the spine:\n%s", want, opf)
+	}
+}
+
+func TestUnknownSpineProperties(t *testing.T) {
+	tests := []struct {
+		properties string
+		allow      bool
+		want       string
+	}{
+		{"page-spread-right hide-from-search", false,
+			"line 43: argument 'spine-properties' of directive <!--chapter-->: unknown spine property 'hide-from-search'; use -allow-unknown-properties to accept it"},
+		{"page-spread-right hide-from-search", true, ""},
+		{"acme:night-mode", true, ""},
+		{"page-spread-right page/spread", true, "expects spine properties such as page-spread-left, got 'page/spread'"},
+		{"  ", false, "expects spine properties such as page-spread-left, got '  '"},
+	}
+	for _, test := range tests {
+		generator := testGenerator(t, exampleBook(t, "example", withSpineProperties(test.properties)), io.Discard)
+		generator.Settings = DefaultSettings()
+		generator.Settings.AllowUnknownProperties = test.allow
+		report, err := generator.Generate("example")
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%q allowed %t: Generate error = %v", test.properties, test.allow, err)
+		case test.want == "":
+			want := `<itemref idref="section005" properties="` + strings.Join(strings.Fields(test.properties), " ") + `" />`
+			if opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf"); !strings.Contains(opf, want) {
+				t.Errorf("no %s in the spine:\n%s", want, opf)
+			}
+		case err == nil || !strings.Contains(err.Error(), test.want):
+			t.Errorf("%q allowed %t: Generate error = %v, want %q", test.properties, test.allow, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTemplateStamp(t *testing.T) {
+	unpinned := func(source string) string {
+		return strings.Replace(source, `  <meta name="modified" content="2024-01-01T00:00:00Z"/>`+"\n", "", 1)
+	}
+	tests := []struct {
+		name            string
+		edit            func(string) string
+		sourceDateEpoch string
+		stamped         bool
+	}{
+		{"current time", unpinned, "", true},
+		{"modified attribute", nil, "", false},
+		{"SOURCE_DATE_EPOCH", unpinned, "1700000000", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", test.edit), io.Discard)
+			generator.Settings = DefaultSettings()
+			generator.Settings.SourceDateEpoch = test.sourceDateEpoch
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			chapter := readEpubFile(t, report.EpubFile, sectionFile(t, report, "chapter"))
+			stamp := "?>\n<!-- ep3gen: bodymatter.gohtml (templates_dir) -->\n"
+			if stamped := strings.Contains(chapter, stamp); stamped != test.stamped {
+				t.Errorf("chapter stamped = %t, want %t:\n%s", stamped, test.stamped, chapter)
+			}
+			if nav := readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml"); strings.Contains(nav, "<!-- ep3gen:") != test.stamped {
+				t.Errorf("nav.xhtml stamped = %t, want %t", !test.stamped, test.stamped)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package epub
+
+import (
+	"io"
+	"testing"
+)
+
+func TestGenerateRebuildsOnImageChange(t *testing.T) {
+	books := exampleBook(t, "example", nil)
+	generator := testGenerator(t, books, io.Discard)
+	if _, err := generator.Generate("example"); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := generator.Generate("example"); err != nil || !report.UpToDate {
+		t.Fatalf("second Generate = %v, %v, want up to date", report.UpToDate, err)
+	}
+
+	// Flip one byte of the CRC at the end of the image, which keeps its pixel size.
+	figure := append([]byte(nil), books["example/figure.png"].Data...)
+	figure[len(figure)-1] ^= 0xff
+	books["example/figure.png"].Data = figure
+	report, err := generator.Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.UpToDate {
+		t.Errorf("the book was not rebuilt after a byte of its image changed")
+	}
+	if got := readEpubFile(t, report.EpubFile, "OEBPS/Images/figure.png"); got != string(figure) {
+		t.Errorf("the changed image was not packaged")
+	}
+}
+
+func TestGenerateRebuildsOnSettingChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(settings *Settings)
+	}{
+		{"exploded", func(settings *Settings) { settings.KeepExploded = true }},
+		{"allow-placeholders", func(settings *Settings) { settings.AllowPlaceholders = true }},
+		{"allow-unknown-properties", func(settings *Settings) { settings.AllowUnknownProperties = true }},
+		{"lint", func(settings *Settings) { settings.Lint = true }},
+		{"disable", func(settings *Settings) { settings.LintDisable = "EP3L001" }},
+		{"SOURCE_DATE_EPOCH", func(settings *Settings) { settings.SourceDateEpoch = "1700000000" }},
+		{"setting in code", func(settings *Settings) { settings.SectionIDs = "slug" }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+			generator.Settings = DefaultSettings()
+			generator.Settings.SourceDateEpoch = ""
+			if _, err := generator.Generate("example"); err != nil {
+				t.Fatal(err)
+			}
+			test.change(generator.Settings)
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.UpToDate {
+				t.Errorf("the book was not rebuilt after %s changed", test.name)
+			}
+			if report, err = generator.Generate("example"); err != nil || !report.UpToDate {
+				t.Errorf("third Generate = %v, %v, want up to date", report.UpToDate, err)
+			}
+		})
+	}
+}
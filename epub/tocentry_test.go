@@ -0,0 +1,130 @@
+package epub
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// withTocEntries is an edit of source.html placing a <!--tocentry--> marker in the body of Part 1, and two
+// with the same label in the body of Chapter 1.
+func withTocEntries(source string) string {
+	source = insertBefore("<!--chapter-->\n<h3>Chapter 1",
+		"<p>The part opens.</p>", `<!--tocentry "Map of the Part"-->`, "<p>A map.</p>")(source)
+	return insertBefore("<!--chapter-->\n<h3>Chapter 2",
+		`<!--tocentry "The Letter"-->`, "<p>A letter.</p>", `<!--tocentry "The Letter"-->`, "<p>Another.</p>")(source)
+}
+
+// The parts and chapters are listed flat in toc.ncx, with the entries of the markers nested under each.
+const (
+	navTocEntriesOutline = `Cover Page cover.xhtml
+Title Page titlepage.xhtml
+Copyright copyright.xhtml
+Dedication section001.xhtml
+Foreword section002.xhtml
+Part 1 section003.xhtml
+  Map of the Part section003.xhtml#section003-toc1
+  Chapter 1 section004.xhtml
+    The Letter section004.xhtml#section004-toc1
+    The Letter section004.xhtml#section004-toc2
+  Chapter 2 section005.xhtml
+Part 2 section006.xhtml
+  Chapter 3 section007.xhtml
+Afterword section008.xhtml
+`
+	ncxTocEntriesOutline = `Cover Page cover.xhtml
+Title Page titlepage.xhtml
+Copyright copyright.xhtml
+Dedication section001.xhtml
+Foreword section002.xhtml
+Part 1 section003.xhtml
+  Map of the Part section003.xhtml#section003-toc1
+Chapter 1 section004.xhtml
+  The Letter section004.xhtml#section004-toc1
+  The Letter section004.xhtml#section004-toc2
+Chapter 2 section005.xhtml
+Part 2 section006.xhtml
+Chapter 3 section007.xhtml
+Afterword section008.xhtml
+`
+)
+
+func TestTocEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		slugs   bool
+		anchors map[string][]string // the anchors expected in the part and chapter pages
+		nav     string
+		ncx     string
+	}{
+		{"numbered", false, map[string][]string{
+			"section003.xhtml": {"section003-toc1"},
+			"section004.xhtml": {"section004-toc1", "section004-toc2"},
+		}, navTocEntriesOutline, ncxTocEntriesOutline},
+		{"slugs", true, map[string][]string{
+			"part-1.xhtml":    {"map-of-the-part"},
+			"chapter-1.xhtml": {"the-letter", "the-letter-2"},
+		}, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := testGenerator(t, exampleBook(t, "example", withTocEntries), io.Discard)
+			if test.slugs {
+				generator.Settings = DefaultSettings()
+				generator.Settings.SectionIDs = "slug"
+			}
+			report, err := generator.Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for fileName, anchors := range test.anchors {
+				page := readEpubFile(t, report.EpubFile, "OEBPS/Text/"+fileName)
+				for _, anchor := range anchors {
+					if !strings.Contains(page, `<a id="`+anchor+`"></a>`) {
+						t.Errorf("no anchor %s in %s:\n%s", anchor, fileName, page)
+					}
+				}
+				if strings.Contains(page, "<!--tocentry") {
+					t.Errorf("a marker was left in %s:\n%s", fileName, page)
+				}
+			}
+			if test.nav == "" {
+				return
+			}
+			if got := navOutline(readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")); got != test.nav {
+				t.Errorf("nav.xhtml outline:\n%s\nwant:\n%s", got, test.nav)
+			}
+			ncx := readEpubFile(t, report.EpubFile, "OEBPS/toc.ncx")
+			if got := ncxOutline(ncx); got != test.ncx {
+				t.Errorf("toc.ncx outline:\n%s\nwant:\n%s", got, test.ncx)
+			}
+			if !strings.Contains(ncx, `<meta name="dtb:depth" content="2" />`) {
+				t.Errorf("toc.ncx does not count the level of the entries in dtb:depth:\n%s", ncx)
+			}
+		})
+	}
+}
+
+func TestTocEntryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(string) string
+		want string
+	}{
+		{"no label", insertBefore("<!--chapter-->\n<h3>Chapter 2", "<!--tocentry-->"),
+			"<!--tocentry--> requires a quoted label"},
+		{"before the copyright page", insertBefore("<!--copyright-->", `<!--tocentry "Early"-->`),
+			"<!--tocentry--> is only allowed inside the body of a section"},
+		{"inside the appendices", insertBefore("<!--end-->",
+			"<!--appendices-->", `<!--tocentry "Loose"-->`, "<!--endappendices-->"),
+			"only <!--appendix--> sections are allowed inside <!--appendices-->"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := testGenerator(t, exampleBook(t, "example", test.edit), io.Discard).Generate("example")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Generate error = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
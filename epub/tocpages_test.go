@@ -0,0 +1,71 @@
+package epub
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// tocTargets returns the sorted targets of the lines of a TOC outline, whatever their nesting.
+func tocTargets(outline string) []string {
+	targets := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(outline), "\n") {
+		fields := strings.Fields(line)
+		targets = append(targets, fields[len(fields)-1])
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+func TestTOCOptionalPages(t *testing.T) {
+	report, err := testGenerator(t, exampleBook(t, "example", nil), io.Discard).Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outline := packageOutline(t, report)
+	wantSpine := outline[strings.Index(outline, "landmarks:"):]
+
+	pages := []struct{ attribute, file string }{
+		{"toc-cover", "cover.xhtml"},
+		{"toc-titlepage", "titlepage.xhtml"},
+		{"toc-copyright", "copyright.xhtml"},
+	}
+	for combination := 0; combination < 1<<len(pages); combination++ {
+		metas := make([]string, 0, len(pages))
+		listed := make(map[string]bool)
+		for i, page := range pages {
+			value := combination&(1<<i) == 0
+			listed[page.file] = value
+			metas = append(metas, fmt.Sprintf(`<meta name="%s" content="%t"/>`, page.attribute, value))
+		}
+		t.Run(strings.Join(metas, " "), func(t *testing.T) {
+			report, err := testGenerator(t, exampleBook(t, "example", withAttributes(metas...)), io.Discard).Generate("example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			nav := tocTargets(navOutline(readEpubFile(t, report.EpubFile, "OEBPS/Text/nav.xhtml")))
+			ncx := tocTargets(ncxOutline(readEpubFile(t, report.EpubFile, "OEBPS/toc.ncx")))
+			if strings.Join(nav, " ") != strings.Join(ncx, " ") {
+				t.Errorf("nav.xhtml lists %q, toc.ncx lists %q", nav, ncx)
+			}
+			for _, page := range pages {
+				i := sort.SearchStrings(nav, page.file)
+				if found := i < len(nav) && nav[i] == page.file; found != listed[page.file] {
+					t.Errorf("%s in the TOC: %t, want %t", page.file, found, listed[page.file])
+				}
+			}
+			// The spine and the landmarks never change.
+			outline := packageOutline(t, report)
+			if got := outline[strings.Index(outline, "landmarks:"):]; got != wantSpine {
+				t.Errorf("landmarks, manifest, spine and guide:\n%s\nwant:\n%s", got, wantSpine)
+			}
+		})
+	}
+
+	_, err = testGenerator(t, exampleBook(t, "example", withAttributes(`<meta name="toc-cover" content="maybe"/>`)), io.Discard).Generate("example")
+	if err == nil || !strings.Contains(err.Error(), "attribute 'toc-cover' must be 'true' or 'false', got 'maybe'") {
+		t.Errorf("Generate error = %v, want the value of toc-cover rejected", err)
+	}
+}
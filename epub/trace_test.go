@@ -0,0 +1,32 @@
+package epub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// traceLines returns the lines of the trace in the output of a build.
+func traceLines(output string) string {
+	var trace strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "trace: ") {
+			trace.WriteString(line + "\n")
+		}
+	}
+	return trace.String()
+}
+
+func TestTrace(t *testing.T) {
+	edit := insertBefore("<!--end-->", "<!--appendix-->", "<h1>Maps</h1>", "<p>The maps.</p>")
+	var output bytes.Buffer
+	generator := testGenerator(t, exampleBook(t, "example", edit), &output)
+	generator.Settings = DefaultSettings()
+	generator.Settings.Trace = true
+	if _, err := generator.Generate("example"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := traceLines(output.String()), readGolden(t, "trace.txt"); got != want {
+		t.Errorf("trace:\n%s\nwant:\n%s", got, want)
+	}
+}
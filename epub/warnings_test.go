@@ -0,0 +1,73 @@
+package epub
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildFileNames are the diagnostic and bookkeeping files of a build, which are never packaged.
+var buildFileNames = []string{
+	"build.log", "warnings.json", "report.json", "sourcemap.json", ".ep3gen-state.yaml", "checksums.txt",
+	"failed.json", ".ep3gen.lock", ".ep3gen.lock.stale", "example.state.json", "section004.xhtml.data.json",
+	"other.lock",
+}
+
+func TestBuildFilesNeverPackaged(t *testing.T) {
+	generator := testGenerator(t, exampleBook(t, "example", nil), io.Discard)
+	generator.Settings = DefaultSettings()
+	generator.Settings.KeepExploded = true
+	generator.Settings.WriteReport = true
+	if _, err := generator.Generate("example"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plant each build file in the exploded book, then package it again.
+	bookDir := filepath.Join(generator.Target, "example")
+	planted := make(map[string]bool)
+	for _, dir := range []string{"OEBPS", "OEBPS/Text", "OEBPS/Images", "META-INF"} {
+		for _, name := range buildFileNames {
+			if err := os.WriteFile(filepath.Join(bookDir, filepath.FromSlash(dir), name), []byte("planted"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			planted[path.Join(dir, name)] = true
+		}
+	}
+	generator.Settings.MetadataOnly = true
+	generator.Settings.Force = true
+	report, err := generator.Generate("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range readEpubFiles(t, report.EpubFile) {
+		if strings.Contains(entry, "planted") {
+			t.Errorf("a planted file was packaged:\n%s", entry)
+		}
+	}
+	for name := range readEpubFiles(t, report.EpubFile) {
+		if planted[name] {
+			t.Errorf("%s was packaged", name)
+		}
+	}
+	opf := readEpubFile(t, report.EpubFile, "OEBPS/package.opf")
+	for _, name := range buildFileNames {
+		if strings.Contains(opf, name) {
+			t.Errorf("%s is in the manifest:\n%s", name, opf)
+		}
+	}
+
+	// Each of them is warned about in the warnings file next to the .epub file.
+	warnings := strings.Join(readWarnings(t, report), "\n")
+	for name := range planted {
+		if want := name + " is a build file and is left out of the package"; !strings.Contains(warnings, want) {
+			t.Errorf("no warning %q in:\n%s", want, warnings)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(bookDir, "warnings.json")); err != nil {
+		t.Errorf("no warnings.json in the generated book directory: %v", err)
+	}
+}
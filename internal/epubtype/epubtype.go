@@ -0,0 +1,279 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 10-Jan-2024
+//
+// The terms of the EPUB 3 Structural Semantics Vocabulary used as epub:type values.
+
+// Package epubtype defines the terms of the EPUB 3 Structural Semantics Vocabulary 1.1
+// (https://www.w3.org/TR/epub-ssv-11/), with the area of the book each one belongs to, its matching DPUB-ARIA
+// role and the key of its default heading, so that the generator has a single list to check and map them.
+package epubtype
+
+import "sort"
+
+// Term is a term of the structural semantics vocabulary, as written in an epub:type attribute.
+type Term string
+
+// The terms used by the generator.
+const (
+	Cover           Term = "cover"
+	FrontMatter     Term = "frontmatter"
+	BodyMatter      Term = "bodymatter"
+	BackMatter      Term = "backmatter"
+	Part            Term = "part"
+	Chapter         Term = "chapter"
+	TitlePage       Term = "titlepage"
+	HalfTitle       Term = "halftitle"
+	CopyrightPage   Term = "copyright-page"
+	Acknowledgments Term = "acknowledgments"
+	Dedication      Term = "dedication"
+	Epigraph        Term = "epigraph"
+	Foreword        Term = "foreword"
+	Introduction    Term = "introduction"
+	Preamble        Term = "preamble"
+	Preface         Term = "preface"
+	Prologue        Term = "prologue"
+	Afterword       Term = "afterword"
+	Epilogue        Term = "epilogue"
+	Appendix        Term = "appendix"
+	Bibliography    Term = "bibliography"
+	Colophon        Term = "colophon"
+	Glossary        Term = "glossary"
+	LOI             Term = "loi"
+	TOC             Term = "toc"
+	Landmarks       Term = "landmarks"
+	Endnotes        Term = "endnotes"
+	Endnote         Term = "endnote"
+	Noteref         Term = "noteref"
+)
+
+// Area is the part of the book a term belongs to.
+type Area int
+
+const (
+	AnyArea     Area = iota // anywhere in the book, such as the terms for notes, titles and lists
+	FrontArea               // the frontmatter, before the first part or chapter
+	BodyArea                // the bodymatter, the parts and chapters
+	BackArea                // the backmatter, after the last chapter
+	PackageArea             // the navigation document, never a section of the book
+)
+
+var areaNames = [...]string{"any", "frontmatter", "bodymatter", "backmatter", "package"}
+
+// String returns the name of the area.
+func (a Area) String() string {
+	return areaNames[a]
+}
+
+// termInfo holds what is known about a term.
+type termInfo struct {
+	area       Area
+	role       string // the matching DPUB-ARIA role, "" if none
+	headingKey string // the key of the default heading of the section, as in default_headings, "" if none
+}
+
+// vocabulary lists all the terms of the vocabulary which are not deprecated.
+var vocabulary = map[Term]termInfo{
+	// Document partitions
+	Cover:       {FrontArea, "doc-cover", ""},
+	FrontMatter: {FrontArea, "", ""},
+	BodyMatter:  {BodyArea, "", ""},
+	BackMatter:  {BackArea, "", ""},
+
+	// Document divisions
+	"volume":   {BodyArea, "", ""},
+	Part:       {BodyArea, "doc-part", ""},
+	Chapter:    {BodyArea, "doc-chapter", ""},
+	"division": {BodyArea, "", ""},
+
+	// Document sections and components
+	"abstract":   {FrontArea, "doc-abstract", ""},
+	Foreword:     {FrontArea, "doc-foreword", "foreword"},
+	Preface:      {FrontArea, "doc-preface", "preface"},
+	Prologue:     {FrontArea, "doc-prologue", "prologue"},
+	Introduction: {FrontArea, "doc-introduction", "introduction"},
+	Preamble:     {FrontArea, "", "preamble"},
+	"conclusion": {BackArea, "doc-conclusion", ""},
+	Epilogue:     {BackArea, "doc-epilogue", "epilogue"},
+	Afterword:    {BackArea, "doc-afterword", "afterword"},
+	Epigraph:     {AnyArea, "doc-epigraph", "epigraph"},
+
+	// Document navigation
+	TOC:         {PackageArea, "doc-toc", ""},
+	"toc-brief": {FrontArea, "", ""},
+	Landmarks:   {PackageArea, "", ""},
+	"loa":       {AnyArea, "", ""},
+	LOI:         {AnyArea, "", "loi"},
+	"lot":       {AnyArea, "", ""},
+	"lov":       {AnyArea, "", ""},
+
+	// Reference sections
+	Appendix:   {BackArea, "doc-appendix", "appendix"},
+	Colophon:   {AnyArea, "doc-colophon", "colophon"},
+	"credits":  {AnyArea, "doc-credits", ""},
+	"keywords": {AnyArea, "", ""},
+
+	// Indexes
+	"index":                 {BackArea, "doc-index", ""},
+	"index-headnotes":       {AnyArea, "", ""},
+	"index-legend":          {AnyArea, "", ""},
+	"index-group":           {AnyArea, "", ""},
+	"index-entry-list":      {AnyArea, "", ""},
+	"index-entry":           {AnyArea, "", ""},
+	"index-term":            {AnyArea, "", ""},
+	"index-editor-note":     {AnyArea, "", ""},
+	"index-locator":         {AnyArea, "", ""},
+	"index-locator-list":    {AnyArea, "", ""},
+	"index-locator-range":   {AnyArea, "", ""},
+	"index-xref-preferred":  {AnyArea, "", ""},
+	"index-xref-related":    {AnyArea, "", ""},
+	"index-term-category":   {AnyArea, "", ""},
+	"index-term-categories": {AnyArea, "", ""},
+
+	// Glossaries
+	Glossary:    {AnyArea, "doc-glossary", "glossary"},
+	"glossterm": {AnyArea, "", ""},
+	"glossdef":  {AnyArea, "", ""},
+
+	// Bibliographies
+	Bibliography:  {AnyArea, "doc-bibliography", "bibliography"},
+	"biblioentry": {AnyArea, "", ""},
+
+	// Preliminary sections and components
+	TitlePage:          {FrontArea, "", ""},
+	"halftitlepage":    {FrontArea, "", ""},
+	CopyrightPage:      {FrontArea, "", ""},
+	"seriespage":       {FrontArea, "", ""},
+	Acknowledgments:    {AnyArea, "doc-acknowledgments", "acknowledgments"},
+	"imprint":          {AnyArea, "", ""},
+	"imprimatur":       {AnyArea, "", ""},
+	"contributors":     {AnyArea, "", ""},
+	"other-credits":    {AnyArea, "", ""},
+	"errata":           {AnyArea, "doc-errata", ""},
+	Dedication:         {FrontArea, "doc-dedication", "dedication"},
+	"revision-history": {AnyArea, "", ""},
+
+	// Complementary content
+	"case-study": {AnyArea, "", ""},
+	"notice":     {AnyArea, "doc-notice", ""},
+	"pullquote":  {AnyArea, "doc-pullquote", ""},
+	"tip":        {AnyArea, "doc-tip", ""},
+
+	// Titles and headings
+	HalfTitle:    {FrontArea, "", "halftitle"},
+	"fulltitle":  {AnyArea, "", ""},
+	"covertitle": {AnyArea, "", ""},
+	"title":      {AnyArea, "", ""},
+	"subtitle":   {AnyArea, "doc-subtitle", ""},
+	"label":      {AnyArea, "", ""},
+	"ordinal":    {AnyArea, "", ""},
+	"bridgehead": {AnyArea, "", ""},
+
+	// Educational content
+	"learning-objective":        {AnyArea, "", ""},
+	"learning-objectives":       {AnyArea, "", ""},
+	"learning-outcome":          {AnyArea, "", ""},
+	"learning-outcomes":         {AnyArea, "", ""},
+	"learning-resource":         {AnyArea, "", ""},
+	"learning-resources":        {AnyArea, "", ""},
+	"learning-standard":         {AnyArea, "", ""},
+	"learning-standards":        {AnyArea, "", ""},
+	"answer":                    {AnyArea, "", ""},
+	"answers":                   {AnyArea, "", ""},
+	"assessment":                {AnyArea, "", ""},
+	"assessments":               {AnyArea, "", ""},
+	"feedback":                  {AnyArea, "", ""},
+	"fill-in-the-blank-problem": {AnyArea, "", ""},
+	"general-problem":           {AnyArea, "", ""},
+	"qna":                       {AnyArea, "doc-qna", ""},
+	"match-problem":             {AnyArea, "", ""},
+	"multiple-choice-problem":   {AnyArea, "", ""},
+	"practice":                  {AnyArea, "", ""},
+	"question":                  {AnyArea, "", ""},
+	"practices":                 {AnyArea, "", ""},
+	"true-false-problem":        {AnyArea, "", ""},
+
+	// Comics
+	"panel":       {AnyArea, "", ""},
+	"panel-group": {AnyArea, "", ""},
+	"balloon":     {AnyArea, "", ""},
+	"text-area":   {AnyArea, "", ""},
+	"sound-area":  {AnyArea, "", ""},
+
+	// Notes and annotations
+	"footnote":  {AnyArea, "doc-footnote", ""},
+	Endnote:     {AnyArea, "", ""},
+	"footnotes": {AnyArea, "", ""},
+	Endnotes:    {AnyArea, "doc-endnotes", "footnote"},
+
+	// References
+	"biblioref": {AnyArea, "doc-biblioref", ""},
+	"glossref":  {AnyArea, "doc-glossref", ""},
+	Noteref:     {AnyArea, "doc-noteref", ""},
+	"backlink":  {AnyArea, "doc-backlink", ""},
+
+	// Document text
+	"credit":              {AnyArea, "doc-credit", ""},
+	"keyword":             {AnyArea, "", ""},
+	"topic-sentence":      {AnyArea, "", ""},
+	"concluding-sentence": {AnyArea, "", ""},
+	"pagebreak":           {AnyArea, "doc-pagebreak", ""},
+	"page-list":           {PackageArea, "doc-pagelist", ""},
+
+	// Tables, lists, figures and asides
+	"table":      {AnyArea, "", ""},
+	"table-row":  {AnyArea, "", ""},
+	"table-cell": {AnyArea, "", ""},
+	"list":       {AnyArea, "", ""},
+	"list-item":  {AnyArea, "", ""},
+	"figure":     {AnyArea, "", ""},
+	"aside":      {AnyArea, "", ""},
+}
+
+// Parse returns the term with the given name, and false if it is not a term of the vocabulary.
+func Parse(name string) (Term, bool) {
+	_, known := vocabulary[Term(name)]
+	return Term(name), known
+}
+
+// Known returns true if the term is in the vocabulary.
+func (t Term) Known() bool {
+	_, known := vocabulary[t]
+	return known
+}
+
+// Area returns the part of the book the term belongs to, AnyArea for an unknown term.
+func (t Term) Area() Area {
+	return vocabulary[t].area
+}
+
+// Role returns the DPUB-ARIA role matching the term, or "" if there is none.
+func (t Term) Role() string {
+	return vocabulary[t].role
+}
+
+// HeadingKey returns the key of the default heading of a section of this type, as in the config parameter
+// default_headings, or "" if there is none.
+func (t Term) HeadingKey() string {
+	return vocabulary[t].headingKey
+}
+
+// Terms returns all the terms of the vocabulary, sorted.
+func Terms() []Term {
+	terms := make([]Term, 0, len(vocabulary))
+	for term := range vocabulary {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool { return terms[i] < terms[j] })
+	return terms
+}
+
+// TermsIn returns the terms of the vocabulary for the given area, sorted.
+func TermsIn(area Area) []Term {
+	terms := make([]Term, 0)
+	for _, term := range Terms() {
+		if term.Area() == area {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
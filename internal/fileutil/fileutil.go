@@ -14,66 +14,102 @@ import (
 )
 
 // DeleteDir removes the specified directory and all children if it exists.
-func DeleteDir(dirspec string) {
-	if err := os.RemoveAll(dirspec); err != nil {
-		panic(err)
+func DeleteDir(dirspec string) error {
+	return os.RemoveAll(dirspec)
+}
+
+// ClearDir removes all the children of the specified directory except the one with the given name.
+// Does nothing if the directory does not exist.
+func ClearDir(dirspec, keep string) error {
+	entries, err := os.ReadDir(dirspec)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() != keep {
+			if err = DeleteDir(filepath.Join(dirspec, entry.Name())); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
 }
 
 // OpenFile opens input file for reading given the file spec.
-func OpenFile(fileSpec string) *os.File {
-	var err error
-	var file *os.File
-	if file, err = os.Open(fileSpec); err != nil {
-		panic(err)
-	}
-	return file
+func OpenFile(fileSpec string) (*os.File, error) {
+	return os.Open(fileSpec)
 }
 
 // CreateFile creates output file given the file spec.
 // Also creates any parent directory along the path if necessary.
-func CreateFile(filespec string) *os.File {
-	var err error
-	if err = os.MkdirAll(filepath.Dir(filespec), 0770); err != nil {
-		panic(err)
-	}
-	var file *os.File
-	if file, err = os.Create(filespec); err != nil {
-		panic(err)
+func CreateFile(filespec string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(filespec), 0770); err != nil {
+		return nil, err
 	}
-	return file
+	return os.Create(filespec)
 }
 
-// ReadLines reads in the input source file line by line and store in an array of lines.
-// Input: string representing the file spec.
-// Output: []string - array of strings containing the lines from the file (each line stripped off '\n')
-func ReadLines(sourcefilespec string) []string {
+// byteOrderMark is the UTF-8 encoded byte order mark which editors on Windows write at the start of a file.
+const byteOrderMark = "\uFEFF"
+
+// ReadFileLines reads in the input source file line by line, see ReadLines.
+func ReadFileLines(sourcefilespec string) ([]string, error) {
 	// Open source file for reading
-	infile := OpenFile(sourcefilespec)
+	infile, err := OpenFile(sourcefilespec)
+	if err != nil {
+		return nil, err
+	}
 	defer infile.Close()
+	return ReadLines(infile)
+}
 
-	scanner := bufio.NewScanner(infile)
+// ReadLines reads in the input source line by line and store in an array of lines.
+// Input: the reader of the source, such as an open file.
+// Output: []string - array of strings containing the lines from the file (each line stripped off '\n' or "\r\n",
+// the other whitespace is kept, and the first line stripped off the UTF-8 byte order mark if present)
+func ReadLines(reader io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(reader)
 	scanner.Split(bufio.ScanLines)
 	lines := make([]string, 0, 1024)
 	for scanner.Scan() {
-		lines = append(lines, strings.TrimSpace(scanner.Text()))
+		line := scanner.Text() // without the trailing '\r' of the Windows line ends, dropped by ScanLines
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, byteOrderMark)
+		}
+		lines = append(lines, line)
 	}
 
-	return lines
+	return lines, scanner.Err()
 }
 
 // CopyFile copies the source file to the target file, overwriting if needed.
-func CopyFile(sourcefilespec, targetfilespec string) {
+func CopyFile(sourcefilespec, targetfilespec string) error {
 	// Open source file for reading
-	infile := OpenFile(sourcefilespec)
+	infile, err := OpenFile(sourcefilespec)
+	if err != nil {
+		return err
+	}
 	defer infile.Close()
 
+	return WriteFile(targetfilespec, infile)
+}
+
+// WriteFile writes the content of the reader to the target file, overwriting if needed.
+// Also creates any parent directory along the path if necessary.
+func WriteFile(targetfilespec string, reader io.Reader) error {
 	// Create output file for writing
-	outfile := CreateFile(targetfilespec)
-	defer outfile.Close()
+	outfile, err := CreateFile(targetfilespec)
+	if err != nil {
+		return err
+	}
 
-	// Copy the source file to the target file
-	if _, err := io.Copy(outfile, infile); err != nil {
-		panic(err)
+	// Copy the content to the target file
+	if _, err = io.Copy(outfile, reader); err != nil {
+		outfile.Close()
+		return err
 	}
+	return outfile.Close()
 }
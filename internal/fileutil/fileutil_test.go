@@ -0,0 +1,48 @@
+package fileutil
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadFileLines(t *testing.T) {
+	want, err := ReadFileLines(filepath.Join("testdata", "lf.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want[0] != "<html>" || want[6] != "  <p>Indented line</p>" {
+		t.Fatalf("lf.html lines = %q", want)
+	}
+	// The same file saved on Windows, with a byte order mark and CRLF line ends.
+	got, err := ReadFileLines(filepath.Join("testdata", "crlf-bom.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("crlf-bom.html lines = %q, want %q", got, want)
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"no final line end", "<html>\r\n</html>\r", []string{"<html>", "</html>"}},
+		{"byte order mark alone", "\uFEFF\n<html>", []string{"", "<html>"}},
+		{"byte order mark on a later line", "<p>\n\uFEFF</p>\n", []string{"<p>", "\uFEFF</p>"}},
+		{"carriage return inside a line", "<p>a\rb</p>\r\n", []string{"<p>a\rb</p>"}},
+	}
+	for _, test := range tests {
+		got, err := ReadLines(strings.NewReader(test.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: lines = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
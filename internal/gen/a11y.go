@@ -0,0 +1,272 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 10-Nov-2023
+//
+// Accessibility conformance claim and the checks backing it.
+
+package gen
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// a11yConformance maps the accepted conformance tokens to the EPUB Accessibility 1.1 conformance statement.
+var a11yConformance = map[string]string{
+	"EPUB-A11Y-11_WCAG-20-A":  "EPUB Accessibility 1.1 - WCAG 2.0 Level A",
+	"EPUB-A11Y-11_WCAG-20-AA": "EPUB Accessibility 1.1 - WCAG 2.0 Level AA",
+	"EPUB-A11Y-11_WCAG-21-A":  "EPUB Accessibility 1.1 - WCAG 2.1 Level A",
+	"EPUB-A11Y-11_WCAG-21-AA": "EPUB Accessibility 1.1 - WCAG 2.1 Level AA",
+	"EPUB-A11Y-11_WCAG-22-A":  "EPUB Accessibility 1.1 - WCAG 2.2 Level A",
+	"EPUB-A11Y-11_WCAG-22-AA": "EPUB Accessibility 1.1 - WCAG 2.2 Level AA",
+}
+
+// a11yConformanceLinks maps the conformance level to the EPUB Accessibility 1.0 conformance URL,
+// still expected by older checkers and vendors.
+var a11yConformanceLinks = map[string]string{
+	"A":  "http://www.idpf.org/epub/a11y/accessibility-20170105.html#wcag-a",
+	"AA": "http://www.idpf.org/epub/a11y/accessibility-20170105.html#wcag-aa",
+}
+
+// imgTagRegexp matches an <img> element.
+var imgTagRegexp = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+
+// altAttrRegexp matches the alt attribute inside an element.
+var altAttrRegexp = regexp.MustCompile(`(?i)\salt\s*=`)
+
+// conformanceData holds the accessibility conformance claim emitted in the package file and stated on the
+// copyright page, which is the technical colophon of the book.
+type conformanceData struct {
+	Statement string // the EPUB Accessibility 1.1 conformance statement
+	Link      string // the EPUB Accessibility 1.0 conformance URL
+	Certifier string // the optional party certifying the claim
+	ReportURL string // the optional URL of the conformance report
+}
+
+// CheckConformanceClaim validates the optional accessibility attributes "a11y-conformance",
+// "a11y-certifier" and "a11y-report-url".
+func (b *InputBuffer) CheckConformanceClaim() (err error) {
+	defer catch(&err)
+	token, claimed := b.attributes.lookup("a11y-conformance")
+	if !claimed {
+		for _, name := range []string{"a11y-certifier", "a11y-report-url"} {
+			if _, exists := b.attributes.lookup(name); exists {
+				fail("attribute '%s' requires the attribute 'a11y-conformance'", name)
+			}
+		}
+		return
+	}
+
+	statement, known := a11yConformance[token]
+	if !known {
+		tokens := make([]string, 0, len(a11yConformance))
+		for known := range a11yConformance {
+			tokens = append(tokens, known)
+		}
+		sort.Strings(tokens)
+		fail("attribute 'a11y-conformance' must be one of %s, got '%s'", strings.Join(tokens, ", "), token)
+	}
+	level := token[strings.LastIndex(token, "-")+1:]
+	b.conformance = &conformanceData{
+		Statement: statement,
+		Link:      a11yConformanceLinks[level],
+		Certifier: b.attributes.get("a11y-certifier"),
+		ReportURL: b.attributes.get("a11y-report-url"),
+	}
+
+	if reportURL := b.conformance.ReportURL; reportURL != "" {
+		if b.conformance.Certifier == "" {
+			fail("attribute 'a11y-report-url' requires the attribute 'a11y-certifier'")
+		}
+		if parsed, err := url.Parse(reportURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fail("attribute 'a11y-report-url' must be an http or https URL, got '%s'", reportURL)
+		}
+	}
+	return nil
+}
+
+// CheckAccessibility fails the build when the book claims accessibility conformance but has images
+// without alt text, sections with an empty TOC label or collapsed blocks with an empty summary, so that the
+// claim is not false.
+// Must be called after all the sections have been generated.
+func (b *InputBuffer) CheckAccessibility() (err error) {
+	defer catch(&err)
+	if b.conformance == nil {
+		b.RegisterFeature("accessibility checks", false, "no 'a11y-conformance' attribute")
+		return
+	}
+
+	problems := make([]string, 0)
+	for _, section := range b.sections {
+		if strings.TrimSpace(section.Heading) == "" {
+			problems = append(problems, fmt.Sprintf("section %s (%s) has an empty TOC label", section.ID, section.EpubType))
+		}
+		for _, line := range b.bodies[section.ID] {
+			for _, tag := range imgTagRegexp.FindAllString(line, -1) {
+				if !altAttrRegexp.MatchString(tag) {
+					problems = append(problems, fmt.Sprintf("section %s has an image without alt text: %s", section.ID, tag))
+				} else if inlineFormulaRegexp.MatchString(tag) && emptyAltRegexp.MatchString(tag) {
+					problems = append(problems, fmt.Sprintf("section %s has a formula image without the spoken formula as alt text: %s", section.ID, tag))
+				}
+			}
+		}
+		if count := untitledSVGs(b.bodies[section.ID]); count > 0 {
+			problems = append(problems, fmt.Sprintf("section %s has %d inline SVG drawing(s) without a <title>", section.ID, count))
+		}
+		if count := emptySummaries(b.bodies[section.ID]); count > 0 {
+			problems = append(problems, fmt.Sprintf("section %s has %d <summary> element(s) without text", section.ID, count))
+		}
+	}
+	if len(problems) > 0 {
+		fail("the book claims '%s' but fails the accessibility checks:\n  %s",
+			b.conformance.Statement, strings.Join(problems, "\n  "))
+	}
+	b.RegisterFeature("accessibility checks", true, "")
+	return nil
+}
+
+// accessModes are the values of schema:accessMode, which are also those of the sets of schema:accessModeSufficient.
+var accessModes = map[string]bool{
+	"auditory": true, "chartOnVisual": true, "chemOnVisual": true, "colorDependent": true, "diagramOnTactile": true,
+	"diagramOnVisual": true, "mathOnVisual": true, "musicOnVisual": true, "tactile": true, "textOnVisual": true,
+	"textual": true, "visual": true,
+}
+
+// accessibilityFeatures are the values of schema:accessibilityFeature.
+var accessibilityFeatures = map[string]bool{
+	"alternativeText": true, "annotations": true, "ARIA": true, "audioDescription": true, "bookmarks": true,
+	"braille": true, "captions": true, "ChemML": true, "closedCaptions": true, "describedMath": true,
+	"displayTransformability": true, "fullRubyAnnotations": true, "highContrastAudio": true,
+	"highContrastDisplay": true, "horizontalWriting": true, "index": true, "largePrint": true, "latex": true,
+	"longDescription": true, "MathML": true, "none": true, "openCaptions": true, "pageBreakMarkers": true,
+	"pageNavigation": true, "printPageNumbers": true, "readingOrder": true, "rubyAnnotations": true,
+	"signLanguage": true, "structuralNavigation": true, "synchronizedAudioText": true, "tableOfContents": true,
+	"tactileGraphic": true, "tactileObject": true, "timingControl": true, "transcript": true, "ttsMarkup": true,
+	"unlocked": true, "verticalWriting": true, "withAdditionalWordSegmentation": true,
+	"withoutAdditionalWordSegmentation": true,
+}
+
+// defaultAccessibilityFeatures are the accessibility features of every generated book, whose navigation document
+// lists the headings of all the sections in the reading order of the spine.
+var defaultAccessibilityFeatures = []string{"tableOfContents", "readingOrder", "structuralNavigation"}
+
+// a11yMetadata holds the schema.org accessibility metadata given by the attributes, see CheckAccessibilityMetadata.
+type a11yMetadata struct {
+	defaults   bool     // the attribute "a11y" is "default", so the properties not given are derived from the book
+	modes      []string // schema:accessMode
+	sufficient []string // schema:accessModeSufficient, each a comma-separated set of modes such as "textual,visual"
+	features   []string // schema:accessibilityFeature
+	summary    string   // schema:accessibilitySummary
+}
+
+// a11yProperty is a schema.org accessibility property of the package file, such as accessMode with the value textual.
+type a11yProperty struct {
+	Property string
+	Value    string
+}
+
+// CheckAccessibilityMetadata reads the optional schema.org accessibility metadata: the attributes
+// "a11y-access-modes", "a11y-access-modes-sufficient", "a11y-features" and "a11y-summary", and "a11y", whose
+// value "default" derives those not given from the book, see accessibilityProperties. The values which are not
+// in the schema.org vocabulary are warned about, but still written to the package file.
+func (b *InputBuffer) CheckAccessibilityMetadata() (err error) {
+	defer catch(&err)
+	value, defaults := b.attributes.lookup("a11y")
+	if defaults && value != "default" {
+		fail("attribute 'a11y' must be 'default', got '%s'", value)
+	}
+	meta := a11yMetadata{
+		defaults: defaults,
+		modes:    b.a11yTokens("a11y-access-modes", b.attributes.get("a11y-access-modes"), accessModes),
+		features: b.a11yTokens("a11y-features", b.attributes.get("a11y-features"), accessibilityFeatures),
+		summary:  strings.TrimSpace(b.attributes.get("a11y-summary")),
+	}
+	for _, set := range strings.Split(b.attributes.get("a11y-access-modes-sufficient"), ";") {
+		if modes := b.a11yTokens("a11y-access-modes-sufficient", set, accessModes); modes != nil {
+			meta.sufficient = append(meta.sufficient, strings.Join(modes, ","))
+		}
+	}
+	if defaults || meta.modes != nil || meta.sufficient != nil || meta.features != nil || meta.summary != "" {
+		b.a11y = &meta
+	}
+	return nil
+}
+
+// a11yTokens returns the comma-separated values of the attribute, warning about those not in the vocabulary.
+// Returns nil if there is none.
+func (c *Context) a11yTokens(name, value string, vocabulary map[string]bool) []string {
+	var tokens []string
+	for _, token := range strings.Split(value, ",") {
+		if token = strings.TrimSpace(token); token == "" {
+			continue
+		}
+		if !vocabulary[token] {
+			hint := ""
+			for known := range vocabulary {
+				if strings.EqualFold(known, token) {
+					hint = fmt.Sprintf(" (did you mean '%s'?)", known)
+				}
+			}
+			c.warn("attribute '%s' has the value '%s', which is not in the schema.org accessibility vocabulary%s", name, token, hint)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// accessibilityProperties returns the schema.org accessibility properties of the package file, in the order
+// accessMode, accessModeSufficient, accessibilityFeature and accessibilitySummary. With the attribute "a11y" set
+// to "default", the properties not given are derived from the book: the book is textual, and visual if it has
+// images, which are also sufficient to read it unless it makes no conformance claim ensuring their alt text; its
+// features are the defaultAccessibilityFeatures, with alternativeText under such a claim. Must be called after
+// all the sections have been generated, so that all the images are known.
+func (b *InputBuffer) accessibilityProperties() []a11yProperty {
+	if b.a11y == nil {
+		return nil
+	}
+	modes, sufficient, features, summary := b.a11y.modes, b.a11y.sufficient, b.a11y.features, b.a11y.summary
+	if b.a11y.defaults {
+		hasImages := b.hasCoverImage() || len(b.images) > 0
+		if modes == nil {
+			modes = []string{"textual"}
+			if hasImages {
+				modes = append(modes, "visual")
+			}
+		}
+		if sufficient == nil {
+			sufficient = []string{"textual"}
+			if hasImages && b.conformance == nil {
+				sufficient = []string{"textual,visual"}
+			}
+		}
+		if features == nil {
+			features = append([]string{}, defaultAccessibilityFeatures...)
+			if hasImages && b.conformance != nil {
+				features = append(features, "alternativeText")
+			}
+		}
+		if summary == "" {
+			summary = "This publication has a table of contents, structural navigation and a logical reading order."
+			if b.conformance != nil {
+				summary += " It meets " + b.conformance.Statement + "."
+			}
+		}
+	}
+
+	properties := make([]a11yProperty, 0, len(modes)+len(sufficient)+len(features)+1)
+	for _, mode := range modes {
+		properties = append(properties, a11yProperty{Property: "accessMode", Value: mode})
+	}
+	for _, set := range sufficient {
+		properties = append(properties, a11yProperty{Property: "accessModeSufficient", Value: set})
+	}
+	for _, feature := range features {
+		properties = append(properties, a11yProperty{Property: "accessibilityFeature", Value: feature})
+	}
+	if summary != "" {
+		properties = append(properties, a11yProperty{Property: "accessibilitySummary", Value: summary})
+	}
+	return properties
+}
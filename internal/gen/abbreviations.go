@@ -0,0 +1,281 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 20-Dec-2023
+//
+// Abbreviations defined in abbreviations.yaml, expanded on their first use in each section.
+
+package gen
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+const (
+	abbreviationsFile      = "abbreviations.yaml"
+	abbreviationsSectionID = "abbreviations"
+)
+
+var (
+	// abbrSkipElements are the elements whose content is never expanded: the headings, code, existing
+	// abbreviations, and content which is not text.
+	abbrSkipElements = map[string]bool{
+		"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"code": true, "pre": true, "kbd": true, "samp": true, "var": true,
+		"abbr": true, "script": true, "style": true, "svg": true, "math": true,
+	}
+
+	// abbrTagRegexp matches a tag and captures the slash of an end tag, the element name and the slash
+	// of an empty element.
+	abbrTagRegexp = regexp.MustCompile(`^<(/?)([A-Za-z][A-Za-z0-9:-]*)[^>]*?(/?)>`)
+
+	// textEscaper escapes a term as it is written in the text of the source file.
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// abbreviation is a term with its expansion.
+type abbreviation struct {
+	Term      string
+	Expansion string
+}
+
+// abbreviations holds the abbreviations of the book and the expression matching any of them.
+type abbreviations struct {
+	list      []abbreviation    // in the order of abbreviations.yaml
+	expansion map[string]string // the expansion of each term, by the term as written in the text
+	pattern   *regexp.Regexp    // matches any term, the longer ones first
+	ignore    bool              // the terms match regardless of case
+}
+
+type abbreviationsTemplateData struct {
+	pageSetup
+	Title         string
+	ID            string
+	EpubType      epubtype.Term
+	Heading       string
+	Abbreviations []abbreviation
+}
+
+// LoadAbbreviations reads the abbreviations from abbreviations.yaml in the book directory, if there is one.
+// The file maps each term to its expansion, e.g. "HTML: HyperText Markup Language". The terms match with
+// their case unless the book sets the attribute "abbreviation-case" to "insensitive".
+func (b *InputBuffer) LoadAbbreviations() (err error) {
+	defer catch(&err)
+	content, err := fs.ReadFile(b.sourceFS, abbreviationsFile)
+	if os.IsNotExist(err) {
+		b.RegisterFeature("abbreviations", false, "no "+abbreviationsFile+" in the book directory")
+		return nil
+	}
+	check(err)
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		fail("error parsing %s: %s", abbreviationsFile, err.Error())
+	}
+	if len(root.Content) == 0 {
+		fail("%s has no abbreviations", abbreviationsFile)
+	}
+	mapping := root.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		fail("%s must map each term to its expansion, such as 'HTML: HyperText Markup Language'", abbreviationsFile)
+	}
+
+	abbrevs := &abbreviations{expansion: make(map[string]string)}
+	switch value := b.attributes.get("abbreviation-case"); {
+	case value == "" || strings.EqualFold(value, "sensitive"):
+	case strings.EqualFold(value, "insensitive"):
+		abbrevs.ignore = true
+	default:
+		fail("attribute 'abbreviation-case' must be 'sensitive' or 'insensitive', got '%s'", value)
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		term, expansion := strings.TrimSpace(key.Value), strings.TrimSpace(value.Value)
+		switch {
+		case key.Kind != yaml.ScalarNode || term == "":
+			fail("%s line %d: the term must be a non-empty string", abbreviationsFile, key.Line)
+		case value.Kind != yaml.ScalarNode || expansion == "":
+			fail("%s line %d: the expansion of %s must be a non-empty string", abbreviationsFile, value.Line, term)
+		}
+		written := abbrevs.key(textEscaper.Replace(term))
+		if _, exists := abbrevs.expansion[written]; exists {
+			fail("%s line %d: the term %s is defined more than once", abbreviationsFile, key.Line, term)
+		}
+		abbrevs.expansion[written] = expansion
+		abbrevs.list = append(abbrevs.list, abbreviation{Term: term, Expansion: expansion})
+	}
+
+	// The longer terms come first in the alternation, so that "ML Ops" is matched before "ML".
+	terms := make([]string, 0, len(abbrevs.list))
+	for _, abbrev := range abbrevs.list {
+		terms = append(terms, regexp.QuoteMeta(textEscaper.Replace(abbrev.Term)))
+	}
+	sort.SliceStable(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	flags := ""
+	if abbrevs.ignore {
+		flags = "(?i)"
+	}
+	abbrevs.pattern = regexp.MustCompile(flags + "(?:" + strings.Join(terms, "|") + ")")
+	b.abbrevs = abbrevs
+	b.RegisterFeature("abbreviations", true, "")
+	return nil
+}
+
+// key returns the key of the term as written in the text for the expansion map.
+func (a *abbreviations) key(written string) string {
+	if a.ignore {
+		return strings.ToLower(written)
+	}
+	return written
+}
+
+// expand wraps the first use of each term in the section lines in an <abbr> element with the expansion as
+// its title. Only whole words in the text count: the tags, the attribute values and the content of the
+// headings, code and the other abbrSkipElements are left alone.
+func (a *abbreviations) expand(lines []string) {
+	expanded := make(map[string]bool, len(a.list))
+	skipDepth := 0 // the number of open abbrSkipElements, which may span lines such as <pre>
+	for i, line := range lines {
+		if !strings.Contains(line, "<") && skipDepth > 0 {
+			continue
+		}
+		var sb strings.Builder
+		rest := line
+		for rest != "" {
+			start := strings.IndexByte(rest, '<')
+			if start == -1 {
+				start = len(rest)
+			}
+			if skipDepth == 0 {
+				sb.WriteString(a.expandText(rest[:start], expanded))
+			} else {
+				sb.WriteString(rest[:start])
+			}
+			rest = rest[start:]
+			if rest == "" {
+				break
+			}
+			end := strings.IndexByte(rest, '>')
+			if end == -1 {
+				end = len(rest) - 1 // a tag continued on the next line; left as is
+			}
+			tag := rest[:end+1]
+			if match := abbrTagRegexp.FindStringSubmatch(tag); match != nil && abbrSkipElements[strings.ToLower(match[2])] {
+				switch {
+				case match[3] == "/": // an empty element
+				case match[1] == "/" && skipDepth > 0:
+					skipDepth--
+				case match[1] == "":
+					skipDepth++
+				}
+			}
+			sb.WriteString(tag)
+			rest = rest[end+1:]
+		}
+		lines[i] = sb.String()
+	}
+}
+
+// expandText wraps the first use of each term in the text, outside any tag, which were not already expanded.
+func (a *abbreviations) expandText(text string, expanded map[string]bool) string {
+	if text == "" {
+		return text
+	}
+	var sb strings.Builder
+	offset := 0
+	for offset < len(text) {
+		loc := a.pattern.FindStringIndex(text[offset:])
+		if loc == nil {
+			break
+		}
+		start, end := offset+loc[0], offset+loc[1]
+		key := a.key(text[start:end])
+		if !isWordBoundary(text, start, end) || expanded[key] {
+			_, size := utf8.DecodeRuneInString(text[start:])
+			sb.WriteString(text[offset : start+size])
+			offset = start + size
+			continue
+		}
+		expanded[key] = true
+		sb.WriteString(text[offset:start])
+		sb.WriteString(`<abbr title="` + html.EscapeString(a.expansion[key]) + `">` + text[start:end] + `</abbr>`)
+		offset = end
+	}
+	sb.WriteString(text[offset:])
+	return sb.String()
+}
+
+// isWordBoundary returns true if the match between start and end is a whole word: not preceded nor followed
+// by a letter, a digit or an underscore, so that "ML" does not match inside "HTML".
+func isWordBoundary(text string, start, end int) bool {
+	isWordRune := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWordRune(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWordRune(after) {
+		return false
+	}
+	return true
+}
+
+// GenAbbreviationsSection generates the list of abbreviations for the <!--abbreviations--> directive, with all
+// the terms of abbreviations.yaml sorted regardless of case. The directive takes no content lines.
+func (b *InputBuffer) GenAbbreviationsSection(directive Directive) (err error) {
+	defer catch(&err)
+	if b.abbrevs == nil {
+		failAt(directive.Line, "directive <!--abbreviations--> requires %s in the book directory", abbreviationsFile)
+	}
+	if !b.hasTemplate(abbreviationsTemplate) {
+		fail("template %s not found in templates_dir", abbreviationsTemplate)
+	}
+	section := SectionData{
+		ID:       abbreviationsSectionID,
+		EpubType: epubtype.Glossary,
+		Heading:  b.DefaultHeading("abbreviations"),
+	}
+	b.combineFrontMatter(&section)
+	b.sections = append(b.sections, section)
+	b.TraceSection(directive, section)
+
+	fileName := section.ID + ".xhtml"
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
+
+	outfile := b.createSectionFile(section)
+	defer outfile.Close()
+
+	// The templates do not escape, so the terms and expansions are escaped here.
+	list := make([]abbreviation, 0, len(b.abbrevs.list))
+	for _, abbrev := range b.abbrevs.list {
+		list = append(list, abbreviation{Term: html.EscapeString(abbrev.Term), Expansion: html.EscapeString(abbrev.Expansion)})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if lower, other := strings.ToLower(list[i].Term), strings.ToLower(list[j].Term); lower != other {
+			return lower < other
+		}
+		return list[i].Term < list[j].Term
+	})
+
+	// Struct to pass to the template
+	data := abbreviationsTemplateData{
+		pageSetup:     b.page,
+		Title:         b.attributes.get("title"),
+		ID:            section.ID,
+		EpubType:      section.EpubType,
+		Heading:       section.Heading,
+		Abbreviations: list,
+	}
+	b.render(outfile, fileName, abbreviationsTemplate, data)
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
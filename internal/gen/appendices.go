@@ -0,0 +1,168 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 20-Nov-2023
+//
+// Grouping of sections under a single TOC entry and the lettering of the appendices.
+
+package gen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tocGroup is a synthetic TOC entry with no content file of its own, nesting the sections listed in it.
+type tocGroup struct {
+	Heading string   // the label of the group entry
+	IDs     []string // the IDs of the grouped sections, in book order
+}
+
+// StartAppendixGroup starts the group of the appendices, either for the <!--appendices--> directive or
+// for the first appendix when the config switch 'group_appendices' is set. Returns an error if the book already
+// has one, as there is a single "Appendices" entry in the TOC.
+func (b *InputBuffer) StartAppendixGroup(directive Directive) (err error) {
+	defer catch(&err)
+	if b.appendices != nil {
+		failAt(directive.Line, "the appendices can only be grouped once")
+	}
+	b.appendices = &tocGroup{Heading: b.DefaultHeading("appendices")}
+	b.tocGroups = append(b.tocGroups, b.appendices)
+	return nil
+}
+
+// InAppendixGroup reports whether the appendix group has been started.
+func (b *InputBuffer) InAppendixGroup() bool {
+	return b.appendices != nil
+}
+
+// AddToAppendixGroup nests the given appendix section under the appendix group in the TOC.
+func (b *InputBuffer) AddToAppendixGroup(section SectionData) {
+	b.appendices.IDs = append(b.appendices.IDs, section.ID)
+}
+
+// AppendixHeading returns the heading of the next appendix. With the config switch 'letter_appendices'
+// the appendices are lettered in order, e.g. "Appendix A: Maps", or "Appendix A" for an empty heading, and
+// the heading line of the appendix, the current line, gets the same prefix for its page.
+func (b *InputBuffer) AppendixHeading(heading string) (string, error) {
+	b.appendixCount++
+	if !b.parms.LetterAppendices {
+		if heading == "" {
+			return b.DefaultHeading("appendix"), nil
+		}
+		return heading, nil
+	}
+	if b.appendixCount > 26 {
+		return "", &Error{Line: b.LineNo(), Msg: "more than 26 appendices cannot be lettered (set 'letter_appendices' to false)"}
+	}
+	prefix := fmt.Sprintf("%s %c", b.DefaultHeading("appendix"), 'A'+b.appendixCount-1)
+	b.CurrLine = prefixHeadingLine(b.CurrLine, prefix, heading == "")
+	if heading == "" {
+		return prefix, nil
+	}
+	return prefix + ": " + heading, nil
+}
+
+// prefixHeadingLine returns the heading line with the prefix before its content, keeping the tags and their
+// attributes, as in <h1 class="appendix">Appendix A: <i>Maps</i></h1>. The content of an empty heading,
+// such as &#160;, is replaced by the prefix. A line which is not a complete heading element is returned as it is.
+func prefixHeadingLine(line, prefix string, empty bool) string {
+	line = strings.TrimSpace(line)
+	match := headingRegexp.FindStringSubmatchIndex(line)
+	if match == nil {
+		return line
+	}
+	start, end := match[4], match[5]
+	if empty {
+		return line[:start] + prefix + line[end:]
+	}
+	return line[:start] + prefix + ": " + line[start:]
+}
+
+// groupSections returns a copy of the sections for the TOC, with the sections of each group replaced by a
+// single entry in the position of the first one. The group entry links to the first section of the group
+// and holds the grouped sections as its children.
+func (b *InputBuffer) groupSections(sections []SectionData) []SectionData {
+	if len(b.tocGroups) == 0 {
+		return sections
+	}
+	groupOf := make(map[string]*tocGroup)
+	for _, group := range b.tocGroups {
+		for _, id := range group.IDs {
+			groupOf[id] = group
+		}
+	}
+	byID := make(map[string]SectionData)
+	for _, section := range sections {
+		byID[section.ID] = section
+	}
+
+	grouped := make([]SectionData, 0, len(sections))
+	for _, section := range sections {
+		group := groupOf[section.ID]
+		if group == nil {
+			grouped = append(grouped, section)
+			continue
+		}
+		if group.IDs[0] != section.ID {
+			continue // already nested under the group entry
+		}
+		children := make([]SectionData, len(group.IDs))
+		for i, id := range group.IDs {
+			children[i] = byID[id]
+		}
+		grouped = append(grouped, SectionData{
+			ID:       section.ID,
+			EpubType: section.EpubType,
+			Heading:  group.Heading,
+			Children: children,
+		})
+	}
+	return grouped
+}
+
+// nestUnderParents returns a copy of the sections for the TOC, with each run of consecutive sections given the
+// same parent argument, such as maps and a timeline with parent="Front Material", replaced by a single entry
+// labelled with the parent. The entry is a label with no page of its own, holding the sections as its
+// children; toc.ncx, where every entry must link, links it to the first of them. The sections with no
+// parent, or with another one, stay at the top level.
+func nestUnderParents(sections []SectionData) []SectionData {
+	nested := make([]SectionData, 0, len(sections))
+	for start := 0; start < len(sections); {
+		parent := sections[start].Parent
+		end := start + 1
+		for parent != "" && end < len(sections) && sections[end].Parent == parent {
+			end++
+		}
+		if parent == "" {
+			nested = append(nested, sections[start])
+		} else {
+			first := sections[start]
+			nested = append(nested, SectionData{
+				ID:       first.ID,
+				EpubType: first.EpubType,
+				Heading:  parent,
+				Children: append([]SectionData{}, sections[start:end]...),
+				File:     first.File,
+				Unlinked: true,
+			})
+		}
+		start = end
+	}
+	return nested
+}
+
+// tocDepth returns the number of levels of the TOC made of the given sections.
+func tocDepth(sections []SectionData) int {
+	depth := 0
+	for _, section := range sections {
+		sectionDepth := 1
+		if len(section.Children) > 0 {
+			sectionDepth += tocDepth(section.Children)
+		} else if len(section.Entries) > 0 {
+			sectionDepth++
+		}
+		if sectionDepth > depth {
+			depth = sectionDepth
+		}
+	}
+	return depth
+}
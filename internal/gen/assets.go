@@ -0,0 +1,94 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 18-Jan-2024
+//
+// The asset files, such as the images and the fonts, each section depends on.
+
+package gen
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// stylesNode is the node of the asset dependencies holding the files referenced from the stylesheet, which
+// every section depends on.
+const stylesNode = "styles"
+
+// AssetDependency lists the asset files a section, or the stylesheet, refers to, relative to the package
+// directory, such as Images/map.png.
+type AssetDependency struct {
+	Node   string   `json:"node"` // the section ID, or "styles" for the stylesheet
+	Assets []string `json:"assets"`
+}
+
+// recordAssets records the asset files referred to by the src attributes and the SVG <image> links of the
+// section lines, once their references are rewritten to the package, see rewriteAssetRefs. URLs, data URIs,
+// fragments and the links to other pages are not assets.
+func (b *InputBuffer) recordAssets(section SectionData, lines []string) {
+	for _, line := range lines {
+		if !strings.Contains(line, "src=") && !strings.Contains(line, "href=") {
+			continue
+		}
+		for _, attrRegexp := range []*regexp.Regexp{srcAttrRegexp, hrefAttrRegexp} {
+			for _, match := range attrRegexp.FindAllStringSubmatch(line, -1) {
+				value := match[2][1 : len(match[2])-1]
+				if value == "" || strings.ContainsAny(value, ":#") || strings.HasSuffix(value, ".xhtml") {
+					continue
+				}
+				if href := path.Join(b.layout.TextDir, value); !strings.HasPrefix(href, "../") {
+					b.addAssetRef(section.ID, href)
+				}
+			}
+		}
+	}
+}
+
+// addAssetRef records that the section with the ID refers to the asset file, given relative to the package
+// directory. Each file is recorded once per section.
+func (b *InputBuffer) addAssetRef(sectionID, href string) {
+	for i := len(b.sections) - 1; i >= 0; i-- {
+		if section := &b.sections[i]; section.ID == sectionID {
+			for _, asset := range section.Assets {
+				if asset == href {
+					return
+				}
+			}
+			section.Assets = append(section.Assets, href)
+			return
+		}
+	}
+}
+
+// addStyleAsset records that the stylesheet refers to the asset file, given relative to the package directory.
+func (b *InputBuffer) addStyleAsset(href string) {
+	for _, asset := range b.styleAssets {
+		if asset == href {
+			return
+		}
+	}
+	b.styleAssets = append(b.styleAssets, href)
+}
+
+// AssetDependencies returns the asset files each section refers to, in spine order, followed by those the
+// stylesheet refers to under the node "styles". The sections without assets are left out.
+func (b *InputBuffer) AssetDependencies() []AssetDependency {
+	dependencies := make([]AssetDependency, 0, len(b.sections)+1)
+	for _, section := range b.sections {
+		if len(section.Assets) > 0 {
+			dependencies = append(dependencies, AssetDependency{Node: section.ID, Assets: sortedAssets(section.Assets)})
+		}
+	}
+	if len(b.styleAssets) > 0 {
+		dependencies = append(dependencies, AssetDependency{Node: stylesNode, Assets: sortedAssets(b.styleAssets)})
+	}
+	return dependencies
+}
+
+// sortedAssets returns a sorted copy of the asset files.
+func sortedAssets(assets []string) []string {
+	sorted := append([]string(nil), assets...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 19-Dec-2023
+//
+// The metadata attributes, kept in a stable order.
+
+package gen
+
+import (
+	"sort"
+)
+
+// attributeStore holds the metadata attributes with their names in the order they were first set, so that
+// iterating over them gives the same output on every run. The map is used for the lookups.
+type attributeStore struct {
+	names  []string
+	values map[string]string
+}
+
+// newAttributeStore returns an empty attribute store.
+func newAttributeStore() *attributeStore {
+	return &attributeStore{names: make([]string, 0, 20), values: make(map[string]string)}
+}
+
+// get returns the value of the attribute, or "" if it is not set.
+func (s *attributeStore) get(name string) string {
+	return s.values[name]
+}
+
+// lookup returns the value of the attribute and whether it is set.
+func (s *attributeStore) lookup(name string) (string, bool) {
+	value, exists := s.values[name]
+	return value, exists
+}
+
+// set sets the attribute, adding its name at the end if it is new.
+func (s *attributeStore) set(name, value string) {
+	if _, exists := s.values[name]; !exists {
+		s.names = append(s.names, name)
+	}
+	s.values[name] = value
+}
+
+// sync brings the names in line with the map after it was changed directly, as by the metadata filters.
+// The names of the removed attributes are dropped and those of the added ones appended in sorted order.
+func (s *attributeStore) sync() {
+	known := make(map[string]bool, len(s.names))
+	names := s.names[:0]
+	for _, name := range s.names {
+		if _, exists := s.values[name]; exists {
+			names = append(names, name)
+			known[name] = true
+		}
+	}
+	added := make([]string, 0)
+	for name := range s.values {
+		if !known[name] {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	s.names = append(names, added...)
+}
@@ -0,0 +1,49 @@
+package gen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAttributeStore(t *testing.T) {
+	s := newAttributeStore()
+	for _, name := range []string{"title", "author", "language", "cover-image"} {
+		s.set(name, name+" value")
+	}
+	s.set("author", "Another")
+	if want := []string{"title", "author", "language", "cover-image"}; !reflect.DeepEqual(s.names, want) {
+		t.Errorf("names = %q, want %q, with a name set again kept in place", s.names, want)
+	}
+	if value, exists := s.lookup("author"); !exists || value != "Another" {
+		t.Errorf("lookup(author) = %q, %v, want the value set last", value, exists)
+	}
+
+	// The metadata filters change the map directly.
+	delete(s.values, "language")
+	s.values["zebra"] = "z"
+	s.values["apple"] = "a"
+	s.sync()
+	if want := []string{"title", "author", "cover-image", "apple", "zebra"}; !reflect.DeepEqual(s.names, want) {
+		t.Errorf("names after sync = %q, want %q", s.names, want)
+	}
+}
+
+func TestLoadAttributesOrder(t *testing.T) {
+	names := []string{"title", "zeta", "author", "contributor.2", "alpha", "contributor.1", "modified", "beta"}
+	lines := []string{"<html>", "<head>"}
+	for _, name := range names {
+		lines = append(lines, `<meta name="`+name+`" content="x"/>`)
+	}
+	lines = append(lines, "</head>", "<body>")
+	for run := 0; run < 20; run++ {
+		b := testBuffer(t, lines...)
+		if err := b.LoadAttributes(); err != nil {
+			t.Fatal(err)
+		}
+		b.SetAttribute("added", "y")
+		b.SetAttribute("title", "z")
+		if got, want := b.AttributeNames(), append(append([]string(nil), names...), "added"); !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: AttributeNames = %q, want the order of the <meta> tags then the added one %q", run, got, want)
+		}
+	}
+}
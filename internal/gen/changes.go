@@ -0,0 +1,222 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 30-Dec-2023
+//
+// Comparison of the section headings with those of the last build, for the editors.
+
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	shingleWords     = 3   // the number of consecutive words in a shingle
+	sketchSize       = 64  // the number of the smallest shingle hashes kept for each section
+	renameSimilarity = 0.3 // the least similarity of the bodies for a section with a new heading to count as renamed
+)
+
+// SectionRecord is the inventory of a section kept in the state file: its heading, and a sketch of its body
+// for recognising it under another heading, see bodySketch.
+type SectionRecord struct {
+	ID      string   `json:"id"`
+	Heading string   `json:"heading"`
+	Sketch  []uint32 `json:"sketch"`
+}
+
+// HeadingChange is a section added, removed or renamed since the last build. For a renamed section, the old
+// ID and heading are given as well as the similarity of the bodies, from 0 to 1.
+type HeadingChange struct {
+	Kind       string  `json:"kind"` // "added", "removed" or "renamed"
+	ID         string  `json:"id"`
+	Heading    string  `json:"heading"`
+	OldID      string  `json:"oldId,omitempty"`
+	OldHeading string  `json:"oldHeading,omitempty"`
+	Similarity float64 `json:"similarity,omitempty"`
+}
+
+// SectionInventory returns the records of the sections read from the source file, in spine order, for the
+// state file. The generated sections, such as the cover and the notes, have no body and are left out.
+func (b *InputBuffer) SectionInventory() []SectionRecord {
+	records := make([]SectionRecord, 0, len(b.sections))
+	for _, section := range b.sections {
+		lines, read := b.bodies[section.ID]
+		if !read {
+			continue
+		}
+		records = append(records, SectionRecord{ID: section.ID, Heading: section.Heading, Sketch: bodySketch(lines)})
+	}
+	return records
+}
+
+// CompareHeadings compares the sections read so far with the inventory recorded in the state file by the last
+// build, and prints the sections added, removed and renamed. Must be called once all the sections are read.
+// The changes are kept for the report.
+func (b *InputBuffer) CompareHeadings(stateFileSpec string) {
+	var state buildState
+	content, err := os.ReadFile(stateFileSpec)
+	if err == nil {
+		err = json.Unmarshal(content, &state)
+	}
+	if err != nil || state.Sections == nil {
+		b.RegisterFeature("heading changes", false, "no section inventory from a previous build")
+		return
+	}
+	b.headingChanges = compareSections(state.Sections, b.SectionInventory())
+	b.RegisterFeature("heading changes", true, "")
+
+	if len(b.headingChanges) == 0 {
+		fmt.Fprintln(b.out, "No heading changes since the last build")
+		return
+	}
+	fmt.Fprintln(b.out, "Heading changes since the last build:")
+	for _, change := range b.headingChanges {
+		switch change.Kind {
+		case "added":
+			fmt.Fprintf(b.out, "  + %s %q\n", change.ID, change.Heading)
+		case "removed":
+			fmt.Fprintf(b.out, "  - %s %q\n", change.OldID, change.OldHeading)
+		default:
+			fmt.Fprintf(b.out, "  ~ %s %q -> %q (%.0f%% similar)\n", change.ID, change.OldHeading, change.Heading, change.Similarity*100)
+		}
+	}
+}
+
+// compareSections returns the changes from the sections before to those after. The sections keeping their
+// heading are paired first, in order, whatever their IDs. Of the others, the most similar pairs of bodies with a
+// similarity of at least renameSimilarity are renamed sections; a split or merged chapter thus shows as a
+// renamed one and an added or removed one. The rest are added or removed. The changes are in the new spine
+// order, the removed sections last.
+func compareSections(before, after []SectionRecord) []HeadingChange {
+	oldPaired := make([]bool, len(before))
+	newPaired := make([]bool, len(after))
+	for i, section := range after {
+		for j, prev := range before {
+			if !oldPaired[j] && prev.Heading == section.Heading {
+				oldPaired[j], newPaired[i] = true, true
+				break
+			}
+		}
+	}
+
+	type candidate struct {
+		newIndex, oldIndex int
+		similarity         float64
+	}
+	candidates := make([]candidate, 0)
+	for i, section := range after {
+		for j, prev := range before {
+			if newPaired[i] || oldPaired[j] {
+				continue
+			}
+			if similarity := sketchSimilarity(prev.Sketch, section.Sketch); similarity >= renameSimilarity {
+				candidates = append(candidates, candidate{i, j, similarity})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].similarity > candidates[j].similarity })
+	renamedFrom := make(map[int]candidate)
+	for _, c := range candidates {
+		if !newPaired[c.newIndex] && !oldPaired[c.oldIndex] {
+			newPaired[c.newIndex], oldPaired[c.oldIndex] = true, true
+			renamedFrom[c.newIndex] = c
+		}
+	}
+
+	changes := make([]HeadingChange, 0)
+	for i, section := range after {
+		if c, renamed := renamedFrom[i]; renamed {
+			changes = append(changes, HeadingChange{Kind: "renamed", ID: section.ID, Heading: section.Heading,
+				OldID: before[c.oldIndex].ID, OldHeading: before[c.oldIndex].Heading, Similarity: c.similarity})
+		} else if !newPaired[i] {
+			changes = append(changes, HeadingChange{Kind: "added", ID: section.ID, Heading: section.Heading})
+		}
+	}
+	for j, prev := range before {
+		if !oldPaired[j] {
+			changes = append(changes, HeadingChange{Kind: "removed", OldID: prev.ID, OldHeading: prev.Heading})
+		}
+	}
+	return changes
+}
+
+// bodySketch returns the sketch of the body lines of a section: the sketchSize smallest distinct hashes of its
+// shingles, the runs of shingleWords consecutive words of the text in lower case, in ascending order. The
+// heading lines are left out, and a body shorter than a shingle is a single shingle.
+func bodySketch(lines []string) []uint32 {
+	words := make([]string, 0, 1000)
+	for _, line := range lines {
+		if isHeadingLine(strings.TrimSpace(line)) {
+			continue // a renamed section keeps the sketch of its body
+		}
+		for _, word := range strings.Fields(strings.ToLower(html.UnescapeString(stripTags(line)))) {
+			word = strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+			if word != "" {
+				words = append(words, word)
+			}
+		}
+	}
+	if len(words) == 0 {
+		return []uint32{}
+	}
+
+	seen := make(map[uint32]bool)
+	hashes := make([]uint32, 0, len(words))
+	for start := 0; start == 0 || start+shingleWords <= len(words); start++ {
+		end := start + shingleWords
+		if end > len(words) {
+			end = len(words)
+		}
+		hash := fnv.New32a()
+		hash.Write([]byte(strings.Join(words[start:end], " ")))
+		if sum := hash.Sum32(); !seen[sum] {
+			seen[sum] = true
+			hashes = append(hashes, sum)
+		}
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	if len(hashes) > sketchSize {
+		hashes = hashes[:sketchSize]
+	}
+	return hashes
+}
+
+// sketchSimilarity estimates the Jaccard similarity of the shingles of two bodies from their sketches: the
+// share of the smallest hashes of both sketches together which are in both.
+func sketchSimilarity(a, b []uint32) float64 {
+	inA := make(map[uint32]bool, len(a))
+	for _, hash := range a {
+		inA[hash] = true
+	}
+	inB := make(map[uint32]bool, len(b))
+	for _, hash := range b {
+		inB[hash] = true
+	}
+	union := make([]uint32, 0, len(a)+len(b))
+	union = append(union, a...)
+	for _, hash := range b {
+		if !inA[hash] {
+			union = append(union, hash)
+		}
+	}
+	if len(union) == 0 {
+		return 0
+	}
+	sort.Slice(union, func(i, j int) bool { return union[i] < union[j] })
+	if len(union) > sketchSize {
+		union = union[:sketchSize]
+	}
+	both := 0
+	for _, hash := range union {
+		if inA[hash] && inB[hash] {
+			both++
+		}
+	}
+	return float64(both) / float64(len(union))
+}
@@ -0,0 +1,134 @@
+package gen
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// chapterWords returns the paragraphs of n distinct words of the chapter, ten to a paragraph, from the first.
+func chapterWords(chapter string, first, n int) []string {
+	lines := make([]string, 0, n/10+1)
+	words := make([]string, 0, 10)
+	for i := first; i < first+n; i++ {
+		words = append(words, fmt.Sprintf("%s%d", chapter, i))
+		if len(words) == 10 || i == first+n-1 {
+			lines = append(lines, "<p>"+strings.Join(words, " ")+"</p>")
+			words = words[:0]
+		}
+	}
+	return lines
+}
+
+// record returns the inventory record of a section with the heading and the body lines.
+func record(id, heading string, lines ...[]string) SectionRecord {
+	body := []string{"<h1>" + heading + "</h1>"}
+	for _, part := range lines {
+		body = append(body, part...)
+	}
+	return SectionRecord{ID: id, Heading: heading, Sketch: bodySketch(body)}
+}
+
+// changeKinds returns the changes as "kind old -> new" lines.
+func changeKinds(changes []HeadingChange) string {
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		lines = append(lines, fmt.Sprintf("%s %s -> %s", change.Kind, change.OldID, change.ID))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCompareSections(t *testing.T) {
+	storm := chapterWords("storm", 0, 400)
+	calm := chapterWords("calm", 0, 300)
+	tests := []struct {
+		name   string
+		before []SectionRecord
+		after  []SectionRecord
+		want   string
+	}{
+		{"unchanged",
+			[]SectionRecord{record("c1", "The Storm", storm), record("c2", "The Calm", calm)},
+			[]SectionRecord{record("c1", "The Storm", storm), record("c2", "The Calm", calm)},
+			""},
+		{"renamed",
+			[]SectionRecord{record("c1", "The Storm", storm), record("c2", "The Calm", calm)},
+			[]SectionRecord{record("c1", "The Tempest", storm), record("c2", "The Calm", calm)},
+			"renamed c1 -> c1"},
+		{"renamed and moved",
+			[]SectionRecord{record("c1", "The Storm", storm), record("c2", "The Calm", calm)},
+			[]SectionRecord{record("c1", "The Calm", calm), record("c2", "The Tempest", storm)},
+			"renamed c1 -> c2"},
+		{"renamed and edited",
+			[]SectionRecord{record("c1", "The Storm", storm)},
+			[]SectionRecord{record("c1", "The Tempest", storm[:30], chapterWords("rewrite", 0, 100))},
+			"renamed c1 -> c1"},
+		{"rewritten",
+			[]SectionRecord{record("c1", "The Storm", storm)},
+			[]SectionRecord{record("c1", "The Tempest", chapterWords("rewrite", 0, 400))},
+			"added  -> c1\nremoved c1 -> "},
+		// The larger part of a split chapter keeps its identity.
+		{"split",
+			[]SectionRecord{record("c1", "The Storm", storm), record("c2", "The Calm", calm)},
+			[]SectionRecord{record("c1", "The Storm Rises", storm[:30]), record("c2", "The Storm Breaks", storm[30:]),
+				record("c3", "The Calm", calm)},
+			"renamed c1 -> c1\nadded  -> c2"},
+		{"merged",
+			[]SectionRecord{record("c1", "The Storm", storm), record("c2", "The Calm", calm)},
+			[]SectionRecord{record("c1", "Storm and Calm", storm, calm)},
+			"renamed c1 -> c1\nremoved c2 -> "},
+		{"added and removed",
+			[]SectionRecord{record("c1", "The Storm", storm)},
+			[]SectionRecord{record("c1", "The Storm", storm), record("c2", "The Calm", calm)},
+			"added  -> c2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := changeKinds(compareSections(test.before, test.after)); got != test.want {
+				t.Errorf("changes:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBodySketch(t *testing.T) {
+	plain := bodySketch([]string{"<p>the wind rose over the sea</p>"})
+	for _, lines := range [][]string{
+		{"<h2>A New Heading</h2>", "<p>the wind rose over the sea</p>"},
+		{"<p>The <em>wind</em> rose</p>", "<p>over the sea.</p>"},
+		{"<p>THE WIND&#160;ROSE OVER THE SEA!</p>"},
+	} {
+		if got := bodySketch(lines); sketchSimilarity(got, plain) != 1 {
+			t.Errorf("bodySketch(%q) = %v, want %v", lines, got, plain)
+		}
+	}
+	if got := bodySketch([]string{"<p>wind</p>"}); len(got) != 1 {
+		t.Errorf("sketch of a single word %v, want a single shingle", got)
+	}
+	if got := bodySketch([]string{"<h1>Only a Heading</h1>", "<p>&#160;</p>"}); len(got) != 0 {
+		t.Errorf("sketch of an empty body %v, want none", got)
+	}
+	if got := bodySketch(chapterWords("storm", 0, 400)); len(got) != sketchSize {
+		t.Errorf("sketch of a long body has %d hashes, want %d", len(got), sketchSize)
+	}
+}
+
+func TestSketchSimilarity(t *testing.T) {
+	storm := bodySketch(chapterWords("storm", 0, 400))
+	tests := []struct {
+		name     string
+		a, b     []uint32
+		min, max float64
+	}{
+		{"identical", storm, storm, 1, 1},
+		{"disjoint", storm, bodySketch(chapterWords("calm", 0, 400)), 0, 0},
+		{"half", storm, bodySketch(chapterWords("storm", 0, 200)), 0.3, 0.7},
+		{"empty", []uint32{}, []uint32{}, 0, 0},
+		{"one empty", storm, []uint32{}, 0, 0},
+	}
+	for _, test := range tests {
+		if got := sketchSimilarity(test.a, test.b); got < test.min || got > test.max {
+			t.Errorf("%s: similarity %.2f, want from %.2f to %.2f", test.name, got, test.min, test.max)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 06-Jan-2024
+//
+// Sizes and SHA-256 checksums of the files packaged into the .epub file, for verifying uploads.
+
+package gen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumsFileName is the name of the checksums file written into the generated book directory.
+const checksumsFileName = "checksums.txt"
+
+// FileChecksum is the size and the SHA-256 checksum of a file in the .epub file, or of the .epub file itself.
+type FileChecksum struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// PackageChecksums returns the checksums of the files in the .epub file written by PackageEpub, then that of
+// the .epub file itself.
+func (c *Context) PackageChecksums() []FileChecksum {
+	return c.packageChecksums
+}
+
+// checksumWriter counts and hashes the bytes written through it.
+type checksumWriter struct {
+	size int64
+	sum  interface {
+		io.Writer
+		Sum([]byte) []byte
+	}
+}
+
+func newChecksumWriter() *checksumWriter {
+	return &checksumWriter{sum: sha256.New()}
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	w.size += int64(len(p))
+	return w.sum.Write(p)
+}
+
+// checksum returns the checksum of the bytes written so far under the given name.
+func (w *checksumWriter) checksum(name string) FileChecksum {
+	return FileChecksum{Name: name, Size: w.size, SHA256: hex.EncodeToString(w.sum.Sum(nil))}
+}
+
+// fileChecksum returns the checksum of the file under the given name.
+func fileChecksum(name, fileSpec string) FileChecksum {
+	file, err := os.Open(fileSpec)
+	check(err)
+	defer file.Close()
+	writer := newChecksumWriter()
+	_, err = io.Copy(writer, file)
+	check(err)
+	return writer.checksum(name)
+}
+
+// WriteChecksums writes the checksums of the files in the .epub file and of the .epub file itself into the
+// generated book directory, one file per line with its checksum, its size in bytes and its name. Must be
+// called after PackageEpub.
+func (c *Context) WriteChecksums() (err error) {
+	defer catch(&err)
+	fileName := checksumsFileName
+	fmt.Fprintf(c.out, "Generating file %s (CHECKSUMS) ... ", fileName)
+
+	var listing strings.Builder
+	for _, checksum := range c.packageChecksums {
+		fmt.Fprintf(&listing, "%s  %d  %s\n", checksum.SHA256, checksum.Size, checksum.Name)
+	}
+	check(os.WriteFile(filepath.Join(c.targetDirSpec, fileName), []byte(listing.String()), 0660))
+
+	fmt.Fprintln(c.out, "done")
+	return nil
+}
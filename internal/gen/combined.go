@@ -0,0 +1,157 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 06-Dec-2023
+//
+// The frontmatter sections rendered into a single file.
+
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+const (
+	combinedFrontMatterID   = "frontmatter"
+	combinedFrontMatterFile = combinedFrontMatterID + ".xhtml"
+)
+
+// combineFrontMatter places the frontmatter section in the combined frontmatter file when the config
+// parameter 'frontmatter' is "combined". The entries of the section already added to the sections and
+// the guides are updated too, so that the TOC and the guides link into the combined file.
+func (b *InputBuffer) combineFrontMatter(section *SectionData) {
+	if b.parms.FrontMatter != "combined" {
+		return
+	}
+	section.File = combinedFrontMatterFile
+	for i := range b.sections {
+		if b.sections[i].ID == section.ID {
+			b.sections[i].File = section.File
+		}
+	}
+	for i := range b.guides {
+		if b.guides[i].ID == section.ID {
+			b.guides[i].File = section.File
+		}
+	}
+}
+
+// combinedPart collects the rendered page of a section placed in the combined frontmatter file.
+// On Close, the page is kept for GenCombinedFrontMatter.
+type combinedPart struct {
+	bytes.Buffer
+	b        *InputBuffer
+	fileName string // the name the section file would have, for the messages
+}
+
+// Close keeps the rendered page.
+func (p *combinedPart) Close() error {
+	p.b.combined = append(p.b.combined, renderedPage{FileName: p.fileName, Content: p.String()})
+	return nil
+}
+
+// renderedPage is a rendered section page placed in the combined frontmatter file.
+type renderedPage struct {
+	FileName string
+	Content  string
+}
+
+// bodyContent returns the content between the <body> and </body> tags of the page.
+func bodyContent(page string) (string, error) {
+	start := strings.Index(page, "<body")
+	if start == -1 {
+		return "", errors.New("the page has no <body> element")
+	}
+	end := tagEnd(page, start)
+	last := strings.LastIndex(page, "</body>")
+	if end == -1 || last < end {
+		return "", errors.New("the page has no <body> element")
+	}
+	return strings.TrimSpace(page[end+1 : last]), nil
+}
+
+type combinedTemplateData struct {
+	pageSetup
+	Title    string
+	ID       string
+	EpubType epubtype.Term
+	Sections []string
+}
+
+// GenCombinedFrontMatter generates the combined frontmatter file holding the <section> elements of the
+// frontmatter sections in order. Does nothing unless the config parameter 'frontmatter' is "combined".
+// Must be called after the frontmatter sections are generated.
+func (b *InputBuffer) GenCombinedFrontMatter() (err error) {
+	defer catch(&err)
+	if len(b.combined) == 0 {
+		return nil
+	}
+	if !b.hasTemplate(combinedTemplate) {
+		fail("template %s not found in templates_dir", combinedTemplate)
+	}
+	section := combinedSection()
+	bodies := make([]string, 0, len(b.combined))
+	for _, page := range b.combined {
+		body, err := bodyContent(page.Content)
+		if err != nil {
+			fail("cannot combine %s into %s: %s", page.FileName, combinedFrontMatterFile, err.Error())
+		}
+		bodies = append(bodies, body)
+	}
+
+	fileName := section.FileName()
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
+
+	outfile := b.createSectionFile(section)
+	defer outfile.Close()
+
+	// Struct to pass to the template
+	data := combinedTemplateData{
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+		Sections:  bodies,
+	}
+	b.render(outfile, fileName, combinedTemplate, data)
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
+
+// combinedSection returns the manifest entry of the combined frontmatter file.
+func combinedSection() SectionData {
+	return SectionData{
+		ID:       combinedFrontMatterID,
+		EpubType: epubtype.FrontMatter,
+		Heading:  "Front Matter",
+	}
+}
+
+// manifestSections returns the sections which are listed in the manifest and the spine. The sections
+// placed in the combined frontmatter file are replaced by a single entry for that file, at the position
+// of the first of them, with the manifest properties of all of them.
+func (b *InputBuffer) manifestSections() []SectionData {
+	sections := make([]SectionData, 0, len(b.sections))
+	combinedIndex := -1
+	for _, section := range b.sections {
+		if section.File == "" {
+			sections = append(sections, section)
+			continue
+		}
+		if combinedIndex == -1 {
+			combinedIndex = len(sections)
+			sections = append(sections, combinedSection())
+		}
+		for _, property := range strings.Fields(section.Properties) {
+			sections[combinedIndex].Properties = withProperty(sections[combinedIndex].Properties, property)
+		}
+		for _, property := range strings.Fields(section.SpineProperties) {
+			sections[combinedIndex].SpineProperties = withProperty(sections[combinedIndex].SpineProperties, property)
+		}
+	}
+	return sections
+}
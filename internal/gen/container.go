@@ -0,0 +1,99 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 12-Dec-2023
+//
+// Generation of META-INF/container.xml from a template.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path"
+	"path/filepath"
+	"text/template"
+
+	"github.com/roslamir/ep3gen/internal/fileutil"
+)
+
+// defaultContainerTemplate is used when the templates directory has no container.goxml. With the default
+// layout it produces the same container.xml as the static file which was copied before.
+const defaultContainerTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container"{{if .HasRenditions}} xmlns:rendition="http://www.idpf.org/2013/rendition"{{end}} version="1.0">
+  <rootfiles>
+{{range .Rootfiles}}    <rootfile full-path="{{.FullPath}}" media-type="{{.MediaType}}"{{with .Layout}} rendition:layout="{{.}}"{{end}}{{with .Label}} rendition:label="{{.}}"{{end}} />
+{{end}}  </rootfiles>
+</container>`
+
+// rootfileData is a rendition of the book listed in container.xml. The first one is the default rendition.
+type rootfileData struct {
+	FullPath  string // the path of the package file from the root of the container
+	MediaType string
+	Layout    string // the rendition:layout selection attribute, only set when the book has several renditions
+	Label     string // the rendition:label of the rendition, only set when the book has several renditions
+}
+
+type containerTemplateData struct {
+	packageLayout
+	Rootfiles     []rootfileData
+	HasRenditions bool // the book has several renditions, so the rendition namespace is declared
+}
+
+// containerRootfiles returns the renditions of the book in the container: the default one, then those listed
+// after it by the renditions config key, see GenRenditions.
+func (c *Context) containerRootfiles() []rootfileData {
+	rootfiles := []rootfileData{
+		{FullPath: path.Join(c.layout.PackageDir, "package.opf"), MediaType: "application/oebps-package+xml"},
+	}
+	for i, rendition := range c.parms.Renditions {
+		if i > 0 {
+			rootfiles = append(rootfiles, rootfileData{
+				FullPath:  path.Join(c.layout.PackageDir, rendition.Name+".opf"),
+				MediaType: "application/oebps-package+xml",
+			})
+		}
+		rootfiles[i].Layout = rendition.Layout
+		rootfiles[i].Label = html.EscapeString(rendition.Label)
+	}
+	return rootfiles
+}
+
+// genContainerFile generates META-INF/container.xml pointing to the package file in the configured package
+// directory, from container.goxml in the templates directory or from the built-in default template.
+// The output is not stamped with the template name, so that the default file stays unchanged.
+func (b *InputBuffer) genContainerFile() {
+	const fileName = "container.xml"
+	fmt.Fprintf(b.out, "Generating file %s (CONTAINER) ... ", fileName)
+	containerTmpl, source := b.tmpl, b.tmplSources[containerTemplate]
+	if !b.hasTemplate(containerTemplate) {
+		var err error
+		containerTmpl, err = template.New(containerTemplate).Funcs(templateFuncs).Parse(defaultContainerTemplate)
+		check(err)
+		source = "built-in"
+	}
+
+	data := containerTemplateData{
+		packageLayout: b.layout,
+		Rootfiles:     b.containerRootfiles(),
+		HasRenditions: len(b.parms.Renditions) > 0,
+	}
+	var buf bytes.Buffer
+	check(containerTmpl.ExecuteTemplate(&buf, containerTemplate, data))
+	checkHrefSeparators(fileName, buf.Bytes())
+
+	outfile, err := fileutil.CreateFile(filepath.Join(b.targetDirSpec, "META-INF", fileName))
+	check(err)
+	defer outfile.Close()
+	_, err = outfile.Write(buf.Bytes())
+	check(err)
+	b.rendered = append(b.rendered, RenderRecord{
+		File:     fileName,
+		Template: containerTemplate,
+		Source:   source,
+	})
+
+	if b.parms.Verbose {
+		fmt.Fprintf(b.out, "[%s from %s] ", containerTemplate, source)
+	}
+	fmt.Fprintln(b.out, "done")
+}
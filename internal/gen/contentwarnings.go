@@ -0,0 +1,119 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 14-Jan-2024
+//
+// The content warnings page and the spoiler blocks collapsed behind a label.
+
+package gen
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+const (
+	contentWarningsSectionID = "content-warnings"
+
+	// spoilerClass is the class of the <details> element of a spoiler block, for the reading systems which show
+	// the element open with its summary as a plain paragraph.
+	spoilerClass = "spoiler"
+)
+
+// summaryRegexp matches a <summary> element with its content.
+var summaryRegexp = regexp.MustCompile(`(?is)<summary\b[^>]*>(.*?)</summary>`)
+
+type contentWarningsTemplateData struct {
+	pageSetup
+	Title    string
+	ID       string
+	EpubType epubtype.Term
+	Heading  string
+	Warnings []string
+}
+
+// GenContentWarningsSection generates the content warnings page for the <!--warnings--> directive, listing the
+// comma-separated warnings of the content-warnings attribute in order. The directive takes no content lines.
+func (b *InputBuffer) GenContentWarningsSection(directive Directive) (err error) {
+	defer catch(&err)
+	warnings := make([]string, 0, 10)
+	for _, warning := range strings.Split(b.attributes.get("content-warnings"), ",") {
+		if warning = strings.TrimSpace(warning); warning != "" {
+			warnings = append(warnings, warning) // already escaped in the source, like the other attributes
+		}
+	}
+	if len(warnings) == 0 {
+		failAt(directive.Line, "directive <!--warnings--> requires the attribute 'content-warnings'")
+	}
+	if !b.hasTemplate(warningsTemplate) {
+		fail("template %s not found in templates_dir", warningsTemplate)
+	}
+	section := SectionData{
+		ID:       contentWarningsSectionID,
+		EpubType: epubtype.FrontMatter,
+		Heading:  b.DefaultHeading("warnings"),
+	}
+	b.combineFrontMatter(&section)
+	b.sections = append(b.sections, section)
+	b.TraceSection(directive, section)
+
+	fileName := section.ID + ".xhtml"
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
+
+	outfile := b.createSectionFile(section)
+	defer outfile.Close()
+
+	// Struct to pass to the template
+	data := contentWarningsTemplateData{
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+		Heading:   section.Heading,
+		Warnings:  warnings,
+	}
+	b.render(outfile, fileName, warningsTemplate, data)
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
+
+// genSpoiler replaces the <!--spoiler "Label"--> and <!--endspoiler--> markers on the current line by the start
+// and the end of a <details> element, so that the lines in between are collapsed behind the label.
+// Returns the HTML line.
+func (b *InputBuffer) genSpoiler(directive Directive) string {
+	switch {
+	case directive.Name == "endspoiler" && b.spoiler == nil:
+		failAt(directive.Line, "<!--endspoiler--> without <!--spoiler-->")
+	case directive.Name == "endspoiler":
+		b.spoiler = nil
+		return `</details>`
+	case b.spoiler != nil:
+		failAt(directive.Line, "<!--spoiler--> cannot be nested in the one on line %d", b.spoiler.Line)
+	case directive.Label == "":
+		failAt(directive.Line, "<!--spoiler--> requires a quoted label, e.g. <!--spoiler \"Ending discussion\"-->")
+	}
+	b.spoiler = &directive
+	return `<details class="` + spoilerClass + `"><summary>` + html.EscapeString(directive.Label) + `</summary>`
+}
+
+// checkSpoilerClosed fails if the section just read ends inside a spoiler block.
+func (b *InputBuffer) checkSpoilerClosed() {
+	if b.spoiler != nil {
+		failAt(b.spoiler.Line, "<!--spoiler--> is not closed by <!--endspoiler--> before the end of the section")
+	}
+}
+
+// emptySummaries returns the number of <summary> elements without text in the body lines, such as those of the
+// spoiler blocks, which leave the reader nothing to announce for the collapsed content.
+func emptySummaries(lines []string) int {
+	count := 0
+	for _, match := range summaryRegexp.FindAllStringSubmatch(strings.Join(lines, "\n"), -1) {
+		if strings.TrimSpace(html.UnescapeString(markupRegexp.ReplaceAllString(match[1], ""))) == "" {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 22-Jan-2024
+//
+// The state of the build of a book, so that a program may generate several books at the same time.
+
+package gen
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/roslamir/ep3gen/internal/parm"
+)
+
+// Context holds the parameters and the state of the build of one book: the templates, the directories written
+// to, the filters, and the warnings and checksums gathered along the way. Each build has its own, shared by
+// its InputBuffer, so that builds running at the same time do not see each other.
+type Context struct {
+	parms    *parm.Parms
+	out      io.Writer // where the progress of the build is printed
+	bookUUID string    // the identifier of the e-book, set from the source once it is read
+
+	tmpl                  *template.Template
+	tmplSources           map[string]string // maps each template name to the file it was loaded from
+	tmplOverrides         map[string]bool   // the names of the templates loaded from the book directory
+	copyrightTemplateName string            // the template of the copyright section, see LoadTemplates
+
+	sourceDirSpec  string        // the full path for the source directory
+	sourceFS       fs.FS         // the files of the book directory, such as the images, see SetSourceFS
+	targetDirSpec  string        // the full path for the output directory
+	packageDirSpec string        // the full path for the package directory, OEBPS by default
+	textDirSpec    string        // the full path for the directory of the section files, OEBPS/Text by default
+	layout         packageLayout // the package layout of the book, set by Init
+
+	reuseSections bool // set by a metadata-only build, which keeps the existing section files
+
+	sectionFilters  []SectionFilter
+	metadataFilters []MetadataFilter
+
+	warnings         []string       // the warnings printed so far in this build, in order
+	packageChecksums []FileChecksum // see PackageChecksums
+}
+
+// NewContext returns the context of a build with the given parameters, which the build may change and must
+// not be shared with another build. The progress of the build is printed to out.
+func NewContext(parms *parm.Parms, out io.Writer) *Context {
+	return &Context{
+		parms:                 parms,
+		out:                   out,
+		copyrightTemplateName: copyrightTemplate,
+		layout:                currentLayout(parms),
+	}
+}
+
+// Parms returns the parameters of the build.
+func (c *Context) Parms() *parm.Parms {
+	return c.parms
+}
+
+// Output returns where the progress of the build is printed.
+func (c *Context) Output() io.Writer {
+	return c.out
+}
+
+// SetBookUUID sets the identifier of the e-book, written into the package file and the report.
+func (c *Context) SetBookUUID(uuid string) {
+	c.bookUUID = uuid
+}
+
+// Init creates the EPUB directory tree.
+func (c *Context) Init(sourceDir, targetDir string) {
+	c.sourceDirSpec = sourceDir
+	c.sourceFS = os.DirFS(sourceDir)
+	c.targetDirSpec = targetDir
+	c.layout = currentLayout(c.parms)
+	c.packageDirSpec = filepath.Join(c.targetDirSpec, c.layout.PackageDir)
+	c.textDirSpec = filepath.Join(c.packageDirSpec, c.layout.TextDir)
+}
+
+// SetSourceFS makes the files of the book directory, such as the images, abbreviations.yaml and order.yaml, be
+// read from the file system instead of the source directory given to Init. Must be called after Init.
+func (c *Context) SetSourceFS(fsys fs.FS) {
+	c.sourceFS = fsys
+}
+
+// ReuseSectionFiles makes the section generators parse the sections without writing their files, so that
+// a metadata-only build only regenerates the NAV, NCX and package files.
+func (c *Context) ReuseSectionFiles() {
+	c.reuseSections = true
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 21-Jan-2024
+//
+// The contributors of the book with their MARC relator roles, from the contributor.N attributes.
+
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// contributorAttrPrefix is the prefix of the attributes naming the contributors of the book, numbered from 1,
+// e.g. <meta name="contributor.1" content="Jane Smith|trl|Smith, Jane"/>.
+const contributorAttrPrefix = "contributor."
+
+// relatorCodeRegexp matches a MARC relator code, such as trl.
+var relatorCodeRegexp = regexp.MustCompile(`^[a-z]{3}$`)
+
+// relatorCredits maps the MARC relator codes known to EPUBGen to the credit shown before the name on the
+// default title page, such as "Translated by". The authors have no credit, as they are listed under the author.
+var relatorCredits = map[string]string{
+	"abr": "Abridged by", "adp": "Adapted by", "aft": "Afterword by", "ann": "Annotated by", "arr": "Arranged by",
+	"art": "Art by", "aui": "Introduction by", "aut": "", "bkp": "Produced by", "cmm": "Commentary by",
+	"com": "Compiled by", "cov": "Cover design by", "cre": "", "ctb": "With contributions by", "ctg": "Maps by",
+	"dsr": "Designed by", "edt": "Edited by", "ill": "Illustrated by", "nrt": "Narrated by", "pht": "Photographs by",
+	"trc": "Transcribed by", "trl": "Translated by", "wac": "Commentary by", "wat": "Additional text by",
+	"wfw": "Foreword by", "win": "Introduction by", "wpr": "Preface by", "wst": "Supplementary text by",
+}
+
+// creatorRoles are the roles of primary responsibility for the book, written as dc:creator rather than
+// dc:contributor.
+var creatorRoles = map[string]bool{"aut": true, "cre": true}
+
+// Contributor is a person or an organisation credited in the package file with a MARC relator role.
+type Contributor struct {
+	ID      string // the ID of its dc:creator or dc:contributor element, refined by its role and sort name
+	Name    string
+	Role    string // the MARC relator code, such as aut or trl
+	Sort    string // the name as sorted, such as "Smith, Jane", written as file-as if given
+	Creator bool   // written as dc:creator, for the creatorRoles
+	Credit  string // the credit on the default title page, such as "Translated by Jane Smith", empty for an author
+}
+
+// CheckContributors reads the contributors of the book: the author, with the author-sort attribute, then the
+// deprecated attributes author2 and author3 as further authors, then the contributor.N attributes in the order
+// of N. The value of contributor.N is the name, the MARC relator code of the role and the name as sorted,
+// separated by |, such as "Jane Smith|trl|Smith, Jane"; the role defaults to ctb and the sort name may be
+// left out. A role which is not in relatorCredits is warned about, and is not credited on the title page.
+func (b *InputBuffer) CheckContributors() (err error) {
+	defer catch(&err)
+	b.contributors = []Contributor{{ID: "author", Name: b.attributes.get("author"), Role: "aut",
+		Sort: b.attributes.get("author-sort"), Creator: true}}
+	for _, name := range []string{"author2", "author3"} {
+		if value, exists := b.attributes.lookup(name); exists {
+			b.warn("attribute '%s' is deprecated, use '%sN' with the role aut instead, such as \"%s|aut\"",
+				name, contributorAttrPrefix, value)
+			if value = strings.TrimSpace(value); value != "" {
+				b.contributors = append(b.contributors, Contributor{ID: name, Name: value, Role: "aut", Creator: true})
+			}
+		}
+	}
+
+	numbers := make([]int, 0)
+	for _, name := range b.attributes.names {
+		if !strings.HasPrefix(name, contributorAttrPrefix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(name, contributorAttrPrefix))
+		if err != nil || n < 1 || strconv.Itoa(n) != strings.TrimPrefix(name, contributorAttrPrefix) {
+			fail("attribute '%s' must be numbered from 1, such as '%s1'", name, contributorAttrPrefix)
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	for _, n := range numbers {
+		b.contributors = append(b.contributors, b.parseContributor(n, b.attributes.get(contributorAttrPrefix+strconv.Itoa(n))))
+	}
+	return nil
+}
+
+// parseContributor returns the contributor given by the value of the attribute contributor.N.
+func (b *InputBuffer) parseContributor(n int, value string) Contributor {
+	name := contributorAttrPrefix + strconv.Itoa(n)
+	fields := strings.Split(value, "|")
+	if len(fields) > 3 {
+		fail("attribute '%s' must be the name, the role and the sort name separated by |, got '%s'", name, value)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	for len(fields) < 3 {
+		fields = append(fields, "")
+	}
+	c := Contributor{ID: fmt.Sprintf("contributor-%d", n), Name: fields[0], Role: fields[1], Sort: fields[2]}
+	if c.Name == "" {
+		fail("attribute '%s' has no name", name)
+	}
+	if c.Role == "" {
+		c.Role = "ctb"
+	}
+	if !relatorCodeRegexp.MatchString(c.Role) {
+		fail("attribute '%s' must have a MARC relator code of three lower case letters as its role, such as trl, got '%s'",
+			name, c.Role)
+	}
+	credit, known := relatorCredits[c.Role]
+	if !known {
+		b.warn("attribute '%s' has the role '%s', which is not a MARC relator code known to epubgen; it is not credited on the title page",
+			name, c.Role)
+	}
+	c.Creator = creatorRoles[c.Role]
+	if credit != "" {
+		c.Credit = credit + " " + c.Name
+	}
+	return c
+}
+
+// coAuthors returns the contributors other than the author written as dc:creator, listed under the author on
+// the default title page.
+func (b *InputBuffer) coAuthors() []Contributor {
+	authors := make([]Contributor, 0)
+	for _, c := range b.contributors[1:] {
+		if c.Creator {
+			authors = append(authors, c)
+		}
+	}
+	return authors
+}
+
+// credits returns the contributors credited on the default title page for their role, such as the translator.
+func (b *InputBuffer) credits() []Contributor {
+	credits := make([]Contributor, 0)
+	for _, c := range b.contributors[1:] {
+		if !c.Creator && c.Credit != "" {
+			credits = append(credits, c)
+		}
+	}
+	return credits
+}
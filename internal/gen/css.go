@@ -0,0 +1,148 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 04-Nov-2023
+//
+// Discovery of the asset files referenced from the stylesheet.
+
+package gen
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// stylesheetFile is the name of the stylesheet, in resource_dir or in the book directory, and in the package.
+const stylesheetFile = "stylesheet.css"
+
+// cssURLRegexp matches url(...) with a double-quoted, single-quoted or unquoted value.
+var cssURLRegexp = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+
+// resourceMediaTypes maps the file extensions of the assets which may be referenced from the stylesheet
+// to their media types.
+var resourceMediaTypes = map[string]string{
+	".png":   "image/png",
+	".jpeg":  "image/jpeg",
+	".jpg":   "image/jpeg",
+	".gif":   "image/gif",
+	".svg":   "image/svg+xml",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+// ResourceData holds a packaged file other than the sections and the declared images.
+type ResourceData struct {
+	ID         string // manifest item id
+	Href       string // path relative to the package directory, always with forward slashes
+	MediaType  string // the full media type
+	sourceSpec string // the file to copy into the package
+	source     string // the path of the file in the book directory instead, for an audio or video file
+}
+
+// CheckStylesheetAssets scans the stylesheet for url() references and registers the referenced files
+// so they are copied and added to the manifest. Each file must exist in the book's source directory or
+// in the resource directory. Remote URLs are rejected.
+func (b *InputBuffer) CheckStylesheetAssets() (err error) {
+	defer catch(&err)
+	content, fileSpec, err := b.readStylesheet()
+	check(err)
+	if fileSpec != filepath.Join(b.parms.ResourceDir, stylesheetFile) {
+		fmt.Fprintf(b.out, "Using %s from %s\n", stylesheetFile, b.sourceDirSpec)
+	}
+
+	for _, match := range cssURLRegexp.FindAllStringSubmatch(string(content), -1) {
+		ref := match[1] + match[2] + match[3] // only one of them is non-empty
+		switch {
+		case ref == "" || strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "#"):
+			continue
+		case strings.Contains(ref, "://") || strings.HasPrefix(ref, "//"):
+			fail("stylesheet.css refers to the remote resource %s which is not supported", ref)
+		}
+
+		href := path.Join(b.layout.StylesDir, ref) // relative to the stylesheet in the package
+		if strings.HasPrefix(href, "../") {
+			fail("stylesheet.css refers to %s which is outside the package", ref)
+		}
+		b.addStyleAsset(href)
+		fileName := path.Base(href)
+		if href == b.layout.imagesHref(fileName) && b.isPackagedImage(fileName) {
+			continue // already packaged as a declared image
+		}
+		if b.hasResource(href) {
+			continue
+		}
+
+		mediaType, known := resourceMediaTypes[strings.ToLower(path.Ext(fileName))]
+		if !known {
+			fail("stylesheet.css refers to %s which is not a supported image or font file", ref)
+		}
+		sourceSpec := b.findResourceFile(fileName)
+		if sourceSpec == "" {
+			fail("file %s referred to by stylesheet.css not found in %s or %s",
+				fileName, b.sourceDirSpec, b.parms.ResourceDir)
+		}
+		b.resources = append(b.resources, ResourceData{
+			ID:         "res-" + fileName,
+			Href:       href,
+			MediaType:  mediaType,
+			sourceSpec: sourceSpec,
+		})
+	}
+	return nil
+}
+
+// hasResource returns true if a resource with the given href is already registered.
+func (b *InputBuffer) hasResource(href string) bool {
+	for _, resource := range b.resources {
+		if resource.Href == href {
+			return true
+		}
+	}
+	return false
+}
+
+// dropResource removes the resource with the given href, if any, for a file which is packaged otherwise.
+func (b *InputBuffer) dropResource(href string) {
+	for i, resource := range b.resources {
+		if resource.Href == href {
+			b.resources = append(b.resources[:i], b.resources[i+1:]...)
+			return
+		}
+	}
+}
+
+// bookHasStylesheet returns true if the book directory has a stylesheet of its own, which replaces the one in
+// resource_dir for this book.
+func (c *Context) bookHasStylesheet() bool {
+	info, err := fs.Stat(c.sourceFS, stylesheetFile)
+	return err == nil && !info.IsDir()
+}
+
+// readStylesheet returns the content of the stylesheet of the book, from the book directory if it has one or
+// else from resource_dir, and the file it was read from.
+func (c *Context) readStylesheet() ([]byte, string, error) {
+	if c.bookHasStylesheet() {
+		content, err := fs.ReadFile(c.sourceFS, stylesheetFile)
+		return content, filepath.Join(c.sourceDirSpec, stylesheetFile), err
+	}
+	fileSpec := filepath.Join(c.parms.ResourceDir, stylesheetFile)
+	content, err := os.ReadFile(fileSpec)
+	return content, fileSpec, err
+}
+
+// findResourceFile looks for the file in the book's source directory and then in the resource directory.
+// Returns the file spec or "" if not found.
+func (c *Context) findResourceFile(fileName string) string {
+	for _, dir := range []string{c.sourceDirSpec, c.parms.ResourceDir} {
+		fileSpec := filepath.Join(dir, fileName)
+		if info, err := os.Stat(fileSpec); err == nil && !info.IsDir() {
+			return fileSpec
+		}
+	}
+	return ""
+}
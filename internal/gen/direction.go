@@ -0,0 +1,140 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 05-Nov-2023
+//
+// Text direction, writing mode and text layout of the generated pages.
+
+package gen
+
+import (
+	"sort"
+	"strings"
+)
+
+// rtlLanguages lists the primary language subtags written right-to-left.
+var rtlLanguages = map[string]bool{
+	"ar":  true, // Arabic
+	"arc": true, // Aramaic
+	"ckb": true, // Central Kurdish
+	"dv":  true, // Dhivehi
+	"fa":  true, // Persian
+	"he":  true, // Hebrew
+	"ps":  true, // Pashto
+	"sd":  true, // Sindhi
+	"ug":  true, // Uyghur
+	"ur":  true, // Urdu
+	"yi":  true, // Yiddish
+}
+
+// pageSetup holds the attributes common to the <html> and <body> elements of every generated page.
+// It is embedded in the data passed to the page templates.
+type pageSetup struct {
+	packageLayout
+	Lang            string // the book language
+	Dir             string // the text direction, "ltr" or "rtl"
+	Vertical        bool   // vertical writing, the <body> element gets the class "vertical"
+	BodyClasses     string // the space-separated classes of the <body> element, such as "vertical hyphenate"
+	ExtraStylesheet string // the stylesheet of the <!--styles--> block, linked after stylesheet.css, "" if none
+}
+
+// CheckDirection determines the text direction from the language attribute, or from the optional
+// "direction" attribute which overrides it, and checks the optional "vertical" attribute.
+// Must be called after the language attribute has been checked.
+func (b *InputBuffer) CheckDirection() (err error) {
+	defer catch(&err)
+	primary, _, _ := strings.Cut(strings.ToLower(b.attributes.get("language")), "-")
+	b.page = pageSetup{packageLayout: b.layout, Lang: b.attributes.get("language"), Dir: "ltr"}
+	if rtlLanguages[primary] {
+		b.page.Dir = "rtl"
+	}
+
+	if direction, exists := b.attributes.lookup("direction"); exists {
+		if direction != "ltr" && direction != "rtl" {
+			fail("attribute 'direction' must be 'ltr' or 'rtl', got '%s'", direction)
+		}
+		b.page.Dir = direction
+	}
+
+	if vertical, exists := b.attributes.lookup("vertical"); exists {
+		value, ok := parseBool(vertical)
+		if !ok {
+			fail("attribute 'vertical' must be 'true' or 'false', got '%s'", vertical)
+		}
+		b.page.Vertical = value
+	}
+	if b.page.Vertical {
+		b.page.addBodyClass("vertical")
+	}
+	return nil
+}
+
+// textLayoutClasses maps the text layout attributes to the <body> class of each of their values, matched by
+// the rules of the default stylesheet.
+var textLayoutClasses = map[string]map[string]string{
+	"text-align":  {"justify": "text-justify", "left": "text-left"},
+	"hyphenation": {"auto": "hyphenate", "none": "no-hyphenate"},
+}
+
+// CheckTextLayout checks the optional attributes "text-align", "justify" or "left", and "hyphenation", "auto"
+// or "none", which give the <body> element of every generated page a class from textLayoutClasses, so that the
+// justification and the hyphenation of the book can be set without a stylesheet of its own. Without them, the
+// reading system and the stylesheet decide. Warns about the page templates which do not write the classes with
+// {{.BodyClasses}}. Must be called after CheckDirection.
+func (b *InputBuffer) CheckTextLayout() (err error) {
+	defer catch(&err)
+	set := false
+	for _, name := range []string{"text-align", "hyphenation"} {
+		value, exists := b.attributes.lookup(name)
+		if !exists {
+			continue
+		}
+		class, known := textLayoutClasses[name][value]
+		if !known {
+			values := make([]string, 0, 2)
+			for known := range textLayoutClasses[name] {
+				values = append(values, "'"+known+"'")
+			}
+			sort.Strings(values)
+			fail("attribute '%s' must be %s, got '%s'", name, strings.Join(values, " or "), value)
+		}
+		b.page.addBodyClass(class)
+		set = true
+	}
+	if set {
+		b.checkBodyClasses()
+	}
+	return nil
+}
+
+// addBodyClass adds the class to those of the <body> element of every generated page.
+func (p *pageSetup) addBodyClass(class string) {
+	if p.BodyClasses != "" {
+		p.BodyClasses += " "
+	}
+	p.BodyClasses += class
+}
+
+// checkBodyClasses warns about the page templates which do not write {{.BodyClasses}}, such as those of an
+// older custom templates directory, as their pages would miss the text layout of the book.
+func (c *Context) checkBodyClasses() {
+	names := make([]string, 0, len(c.tmplSources))
+	for name := range c.tmplSources {
+		if strings.HasSuffix(name, ".gohtml") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !c.templateFields(name)["BodyClasses"] {
+			c.warn("template %s does not write the classes of the <body> element with {{.BodyClasses}}", name)
+		}
+	}
+}
+
+// PageProgression returns the page progression direction of the spine: right-to-left for right-to-left
+// text and for vertical writing, which is read in columns from right to left.
+func (b *InputBuffer) PageProgression() string {
+	if b.page.Dir == "rtl" || b.page.Vertical {
+		return "rtl"
+	}
+	return "ltr"
+}
@@ -0,0 +1,448 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 14-Oct-2023
+//
+// Directive parsing and the registry of known directives with their argument schemas.
+
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+	"github.com/roslamir/ep3gen/internal/textutil"
+)
+
+// ArgType is the type of a directive argument value.
+type ArgType int
+
+const (
+	ArgString     ArgType = iota // any string
+	ArgBool                      // true/false, yes/no, or the bare argument name meaning true
+	ArgEnum                      // one of the values listed in the schema
+	ArgDate                      // a date in the format 2006-01-02
+	ArgIdentifier                // a valid XML identifier, usable as an element or file id
+	ArgProperties                // a space-separated list of spine itemref properties, see spineProperties
+	ArgEpubType                  // a term of the structural semantics vocabulary, see epubtype
+)
+
+var argTypeNames = [...]string{"string", "bool", "enum", "date", "identifier", "properties", "epub-type"}
+
+// String returns the name of the argument type as shown in the directive reference.
+func (t ArgType) String() string {
+	return argTypeNames[t]
+}
+
+// ArgSpec describes a single argument accepted by a directive.
+type ArgSpec struct {
+	Name     string
+	Type     ArgType
+	Required bool
+	Values   []string // the allowed values for ArgEnum
+	Help     string
+}
+
+// directiveSpec describes a directive and the arguments it accepts.
+type directiveSpec struct {
+	Name  string
+	Help  string
+	Args  []ArgSpec
+	Label bool // accepts a single quoted label, e.g. <!--name "Some Label"-->
+	File  bool // takes a file name as its first argument, e.g. <!--name page.xhtml-->
+}
+
+// sectionArgs are the arguments accepted by the directives starting a section with a heading.
+var sectionArgs = []ArgSpec{
+	{Name: "id", Type: ArgIdentifier, Help: "the section ID, also naming its file, instead of the generated one"},
+	{Name: "toc", Type: ArgString, Help: "the label of the section in the TOC, instead of its heading"},
+	{Name: "spine-properties", Type: ArgProperties, Help: "the properties of the section in the spine, such as page-spread-left"},
+}
+
+// frontmatterArgs are the arguments accepted by the frontmatter directives.
+var frontmatterArgs = append([]ArgSpec{
+	{Name: "preview", Type: ArgEnum, Values: []string{"skip"}, Help: "keep the section out of the start of the retail preview"},
+}, sectionArgs...)
+
+// parentArg is the argument of the generic sections nesting them under a label in the TOC, see nestUnderParents.
+var parentArg = ArgSpec{Name: "parent", Type: ArgString, Help: "the label of a TOC entry, with no page, nesting the consecutive sections with the same parent"}
+
+// directiveRegistry lists all the known directives in the order they may appear in the source.
+var directiveRegistry = []directiveSpec{
+	{Name: "styles", Help: "at the start of the body, starts the CSS rules of the book, written to book-extra.css"},
+	{Name: "endstyles", Help: "ends the CSS rules started by <!--styles-->"},
+	{Name: "titlepage", Help: "custom title page, required when the 'titlepage' attribute is 'custom'"},
+	{Name: "copyright", Help: "the mandatory copyright section"},
+	{Name: "bibliography", Help: "frontmatter or backmatter, at most once", Args: frontmatterArgs},
+	{Name: "acknowledgments", Help: "frontmatter or backmatter, at most once", Args: frontmatterArgs},
+	{Name: "dedication", Help: "frontmatter, at most once", Args: frontmatterArgs},
+	{Name: "epigraph", Help: "frontmatter, at most once", Args: frontmatterArgs},
+	{Name: "foreword", Help: "frontmatter, at most once", Args: frontmatterArgs},
+	{Name: "introduction", Help: "frontmatter, at most once", Args: frontmatterArgs},
+	{Name: "preface", Help: "frontmatter, at most once", Args: frontmatterArgs},
+	{Name: "prologue", Help: "frontmatter, at most once", Args: frontmatterArgs},
+	{Name: "preamble", Help: "generic frontmatter section, may occur multiple times", Args: append([]ArgSpec{parentArg}, frontmatterArgs...)},
+	{Name: "quicknav", Help: "places the generated quick navigation page, takes no content"},
+	{Name: "halftitle", Help: "frontmatter half-title page with the title attribute, at most once, takes no content"},
+	{Name: "loi", Help: "places the generated list of illustrations, at most once, takes no content"},
+	{Name: "abbreviations", Help: "frontmatter list of the terms in abbreviations.yaml, at most once, takes no content"},
+	{Name: "warnings", Help: "frontmatter page listing the content-warnings attribute, at most once, takes no content"},
+	{Name: "part", Help: "part heading grouping the chapters that follow", Args: sectionArgs},
+	{Name: "chapter", Help: "chapter, at least one is required", Args: sectionArgs},
+	{Name: "afterword", Help: "backmatter, at most once", Args: sectionArgs},
+	{Name: "epilogue", Help: "backmatter, at most once", Args: sectionArgs},
+	{Name: "appendix", Help: "generic backmatter section, may occur multiple times", Args: append([]ArgSpec{parentArg}, sectionArgs...)},
+	{Name: "about-the-author", Help: "backmatter, at most once", Args: sectionArgs},
+	{Name: "also-by", Help: "backmatter listing the other books of the author, at most once", Args: sectionArgs},
+	{Name: "glossary", Help: "backmatter, may occur multiple times", Args: sectionArgs},
+	{Name: "colophon", Help: "backmatter, at most once", Args: sectionArgs},
+	{Name: "appendices", Help: "starts the appendices grouped under a single TOC entry"},
+	{Name: "endappendices", Help: "ends the appendices started by <!--appendices-->"},
+	{Name: "figure", Help: "inline figure; the next line holds the image file name and the caption", Args: []ArgSpec{
+		{Name: "inline", Type: ArgBool, Help: "set the image inline with the text, e.g. a formula, with the caption as its alt text"},
+		{Name: "longdesc", Type: ArgString, Help: "link to the long description of the image written elsewhere in the book, e.g. describes.xhtml#fig3"},
+	}},
+	{Name: "image", Help: "inline marker inside a section body placing a figure with a caption", Args: []ArgSpec{
+		{Name: "file", Type: ArgString, Required: true, Help: "the image file name, packaged even if not in the images attribute"},
+		{Name: "caption", Type: ArgString, Help: "the caption of the figure, also used by the list of illustrations"},
+		{Name: "alt", Type: ArgString, Help: "the alt text of the image, empty for a decorative image"},
+	}},
+	{Name: "longdesc", Help: "right after the image line of <!--figure-->, starts the long description of the image"},
+	{Name: "endlongdesc", Help: "ends the long description started by <!--longdesc-->"},
+	{Name: "sep", Help: "separates the quotations inside <!--epigraph-->"},
+	{Name: "spoiler", Help: "inside a section body, starts a block collapsed behind the label", Label: true},
+	{Name: "endspoiler", Help: "ends the block started by <!--spoiler-->"},
+	{Name: "tocentry", Help: "inline marker inside a section body adding a TOC entry for this spot", Label: true},
+	{Name: "footnote", Help: "inside a section body, starts a note collected into the generated notes section", Args: []ArgSpec{
+		{Name: "id", Type: ArgIdentifier, Required: true, Help: "the note id, referenced by <a class=\"noteref\" href=\"#id\">"},
+	}},
+	{Name: "raw", Help: "hand-crafted XHTML page from the book directory, copied verbatim into the spine here", File: true, Args: []ArgSpec{
+		{Name: "toc", Type: ArgString, Required: true, Help: "the label of the page in the TOC"},
+		{Name: "type", Type: ArgEpubType, Help: "the epub:type of the page, such as appendix; by default frontmatter, chapter or backmatter by its place"},
+		{Name: "spine-properties", Type: ArgProperties, Help: "the properties of the page in the spine, such as page-spread-left"},
+	}},
+	{Name: "end", Help: "marks the end of the book"},
+}
+
+var (
+	// directiveArgRegexp matches a directive argument: name="value", name='value', name=value or a bare name.
+	directiveArgRegexp = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]*)(?:=("[^"]*"|'[^']*'|\S+))?`)
+
+	// identifierRegexp matches a valid XML NCName restricted to ASCII.
+	identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+)
+
+// Directive holds a parsed directive line such as <!--chapter id="ch1"-->.
+type Directive struct {
+	Name  string
+	Args  map[string]string
+	Label string // the quoted label, for directives that accept one
+	File  string // the file name, for directives that take one
+	Line  int    // the source line number
+}
+
+// lookupDirective returns the spec of the named directive, or nil if it is unknown.
+func lookupDirective(name string) *directiveSpec {
+	for i := range directiveRegistry {
+		if directiveRegistry[i].Name == name {
+			return &directiveRegistry[i]
+		}
+	}
+	return nil
+}
+
+// Directive parses the current line as a directive and validates its arguments against the registry.
+// Returns a Directive with an empty name if the current line is not a directive. Unknown directive names
+// are returned without validation so that each phase can decide whether it accepts them.
+func (b *InputBuffer) Directive() (_ Directive, err error) {
+	defer catch(&err)
+	return b.directive(), nil
+}
+
+// directive is Directive for use inside the package.
+func (b *InputBuffer) directive() Directive {
+	if !isDirective(b.CurrLine) {
+		return Directive{Line: b.LineNo()} // an ordinary comment, see isDirective
+	}
+	if b.commentLine != 0 {
+		b.fail("the comment started on line %d is not closed by --> before this directive", b.commentLine)
+	}
+	directive, _, err := parseDirective(b.CurrLine)
+	if err != nil {
+		b.fail("%s", err.Error())
+	}
+	directive.Line = b.LineNo()
+	if spec := lookupDirective(directive.Name); spec != nil {
+		if err = spec.validate(directive); err != nil {
+			failAt(directive.Line, "%s", err.Error())
+		}
+		b.checkKnownSpineProperties(directive)
+	}
+	return directive
+}
+
+// The two equivalent forms of a directive line: a comment, and a processing instruction for sources
+// edited with tools which reorder or strip the comments.
+const (
+	commentOpen  = "<!--"
+	commentClose = "-->"
+	piOpen       = "<?ep3"
+	piClose      = "?>"
+)
+
+// isDirective returns true if the line is a directive, which ends the lines of a section, rather than an
+// ordinary comment such as <!-- TODO: check this date -->. An <?ep3 ...?> processing instruction is always
+// a directive. A comment written <!--name ...-->, without a space after "<!--", is a directive if the name
+// is that of a directive or close to one, so that a misspelt directive is reported instead of being taken
+// as a comment. A comment written with a space, <!-- name ... -->, is a directive only if it is a valid one,
+// so that <!-- end of scene --> is an ordinary comment. A comment continued on the next lines is ordinary.
+func isDirective(line string) bool {
+	if isProcessingInstruction(line) {
+		return true
+	}
+	directive, ok, err := parseDirective(line)
+	if !ok || directive.Name == "" {
+		return false
+	}
+	spec := lookupDirective(directive.Name)
+	if spaced := strings.ContainsRune(" \t", rune(line[len(commentOpen)])); spaced {
+		return spec != nil && err == nil && spec.validate(directive) == nil
+	}
+	return spec != nil || suggestDirective(directive.Name) != ""
+}
+
+// suggestDirective returns the closest directive name within an edit distance of 2, or "" if there is none.
+func suggestDirective(name string) string {
+	names := make([]string, len(directiveRegistry))
+	for i, spec := range directiveRegistry {
+		names[i] = spec.Name
+	}
+	return textutil.Suggest(name, names)
+}
+
+// isComment returns true if the line starts an ordinary comment, see isDirective.
+func isComment(line string) bool {
+	return strings.HasPrefix(line, commentOpen) && !isDirective(line)
+}
+
+// isProcessingInstruction returns true if the line starts an <?ep3 ...?> processing instruction.
+func isProcessingInstruction(line string) bool {
+	return strings.HasPrefix(line, piOpen) && len(line) > len(piOpen) && strings.ContainsRune(" \t?", rune(line[len(piOpen)]))
+}
+
+// parseDirective parses a line of the form <!--name arg="value" ...--> or <?ep3 name arg="value" ...?>.
+// Returns false if the line is not a directive, and an error if it is one with malformed arguments.
+func parseDirective(line string) (Directive, bool, error) {
+	var body string
+	switch {
+	case len(line) < len(commentOpen)+len(commentClose):
+		return Directive{}, false, nil // such as <!--> or <!--->, an ordinary empty comment
+	case strings.HasPrefix(line, commentOpen) && strings.HasSuffix(line, commentClose):
+		body = line[len(commentOpen) : len(line)-len(commentClose)]
+	case isProcessingInstruction(line) && strings.HasSuffix(line, piClose):
+		body = line[len(piOpen) : len(line)-len(piClose)]
+		if strings.TrimSpace(body) == "" {
+			return Directive{}, true, fmt.Errorf("missing directive name in %s", line)
+		}
+	default:
+		return Directive{}, false, nil
+	}
+	name, rest, _ := strings.Cut(strings.TrimSpace(body), " ")
+	directive := Directive{Name: name, Args: make(map[string]string)}
+
+	rest = strings.TrimSpace(rest)
+	if spec := lookupDirective(name); spec != nil && spec.File {
+		file, after, _ := strings.Cut(rest, " ")
+		if file != "" && !strings.ContainsAny(file, "=\"'") {
+			directive.File = file
+			rest = strings.TrimSpace(after)
+		}
+	}
+	for rest != "" {
+		if rest[0] == '"' || rest[0] == '\'' {
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end == -1 {
+				return directive, true, fmt.Errorf("unterminated quoted label in directive %s", line)
+			}
+			if directive.Label != "" {
+				return directive, true, fmt.Errorf("more than one quoted label in directive %s", line)
+			}
+			directive.Label = rest[1 : end+1]
+			rest = strings.TrimSpace(rest[end+2:])
+			continue
+		}
+		match := directiveArgRegexp.FindStringSubmatch(rest)
+		if match == nil {
+			return directive, true, fmt.Errorf("invalid argument '%s' in directive %s", rest, line)
+		}
+		value := match[2]
+		if value == "" {
+			value = "true" // boolean shorthand: the bare argument name
+		} else if value[0] == '"' || value[0] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		directive.Args[match[1]] = value
+		rest = strings.TrimSpace(rest[len(match[0]):])
+	}
+	return directive, true, nil
+}
+
+// validate checks the arguments of the directive against the spec.
+func (spec *directiveSpec) validate(directive Directive) error {
+	if directive.Label != "" && !spec.Label {
+		return fmt.Errorf("directive <!--%s--> does not take a quoted label", spec.Name)
+	}
+	if directive.File == "" && spec.File {
+		return fmt.Errorf("directive <!--%s--> requires a file name, as in <!--%s page.xhtml-->", spec.Name, spec.Name)
+	}
+	names := make([]string, 0, len(directive.Args))
+	for name := range directive.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names) // report the problems in a stable order
+	for _, name := range names {
+		value := directive.Args[name]
+		arg := spec.lookupArg(name)
+		if arg == nil {
+			msg := fmt.Sprintf("unknown argument '%s' for directive <!--%s-->", name, spec.Name)
+			if suggestion := spec.suggestArg(name); suggestion != "" {
+				msg += fmt.Sprintf(" (did you mean '%s'?)", suggestion)
+			}
+			return fmt.Errorf("%s", msg)
+		}
+		if err := arg.check(value); err != nil {
+			return fmt.Errorf("argument '%s' of directive <!--%s-->: %s", name, spec.Name, err.Error())
+		}
+	}
+	for _, arg := range spec.Args {
+		if _, exists := directive.Args[arg.Name]; arg.Required && !exists {
+			return fmt.Errorf("directive <!--%s--> requires argument '%s'", spec.Name, arg.Name)
+		}
+	}
+	return nil
+}
+
+// lookupArg returns the spec of the named argument, or nil if the directive does not accept it.
+func (spec *directiveSpec) lookupArg(name string) *ArgSpec {
+	for i := range spec.Args {
+		if spec.Args[i].Name == name {
+			return &spec.Args[i]
+		}
+	}
+	return nil
+}
+
+// suggestArg returns the closest argument name within an edit distance of 2, or "" if there is none.
+func (spec *directiveSpec) suggestArg(name string) string {
+	names := make([]string, len(spec.Args))
+	for i, arg := range spec.Args {
+		names[i] = arg.Name
+	}
+	return textutil.Suggest(name, names)
+}
+
+// check validates the value against the argument type.
+func (arg *ArgSpec) check(value string) error {
+	switch arg.Type {
+	case ArgBool:
+		if _, ok := parseBool(value); !ok {
+			return fmt.Errorf("expects true/false, got '%s'", value)
+		}
+	case ArgEnum:
+		for _, allowed := range arg.Values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("expects one of %s, got '%s'", strings.Join(arg.Values, "/"), value)
+	case ArgDate:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Errorf("expects a date like 2006-01-02, got '%s'", value)
+		}
+	case ArgIdentifier:
+		if !identifierRegexp.MatchString(value) {
+			return fmt.Errorf("expects an identifier (a letter or '_' followed by letters, digits, '_', '-' or '.'), got '%s'", value)
+		}
+	case ArgProperties:
+		return checkSpineProperties(value)
+	case ArgEpubType:
+		if _, known := epubtype.Parse(value); !known {
+			terms := make([]string, 0)
+			for _, term := range epubtype.Terms() {
+				terms = append(terms, string(term))
+			}
+			if suggestion := textutil.Suggest(value, terms); suggestion != "" {
+				return fmt.Errorf("expects a term of the EPUB structural semantics vocabulary, got '%s' (did you mean '%s'?)", value, suggestion)
+			}
+			return fmt.Errorf("expects a term of the EPUB structural semantics vocabulary such as appendix, got '%s'", value)
+		}
+	}
+	return nil
+}
+
+// parseBool parses the boolean forms accepted in directive arguments.
+func parseBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on":
+		return true, true
+	case "false", "no", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// Bool returns the value of a boolean argument, or false if the argument is absent.
+func (d Directive) Bool(name string) bool {
+	value, _ := parseBool(d.Args[name])
+	return value
+}
+
+// PrintDirectives prints the reference of all the known directives and their arguments.
+func PrintDirectives() {
+	fmt.Println("Directives:")
+	for _, spec := range directiveRegistry {
+		usage := "<!--" + spec.Name
+		if spec.Label {
+			usage += ` "label"`
+		}
+		if spec.File {
+			usage += " file"
+		}
+		fmt.Printf("  %-24s %s\n", usage+"-->", spec.Help)
+		for _, arg := range spec.Args {
+			typeName := arg.Type.String()
+			if arg.Type == ArgEnum {
+				typeName = strings.Join(arg.Values, "|")
+			}
+			required := "optional"
+			if arg.Required {
+				required = "required"
+			}
+			fmt.Printf("      %s=%s (%s) %s\n", arg.Name, typeName, required, arg.Help)
+		}
+	}
+	fmt.Println("Each directive may also be written as a processing instruction, e.g. <?ep3 chapter?>.")
+	fmt.Println("The epub-type arguments take a term of the EPUB structural semantics vocabulary, by the area of the book:")
+	for _, area := range []epubtype.Area{epubtype.FrontArea, epubtype.BodyArea, epubtype.BackArea, epubtype.AnyArea} {
+		printTerms(area.String(), epubtype.TermsIn(area))
+	}
+}
+
+// printTerms prints the terms after the label, wrapped to the width of the directive reference.
+func printTerms(label string, terms []epubtype.Term) {
+	line := fmt.Sprintf("  %-12s", label+":")
+	for i, term := range terms {
+		word := string(term)
+		if i < len(terms)-1 {
+			word += ","
+		}
+		if len(line)+1+len(word) > 110 {
+			fmt.Println(line)
+			line = strings.Repeat(" ", 14)
+		}
+		line += " " + word
+	}
+	fmt.Println(line)
+}
@@ -0,0 +1,81 @@
+package gen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirectiveForms(t *testing.T) {
+	tests := []struct {
+		body string // the directive without its delimiters
+		want Directive
+	}{
+		{"chapter", Directive{Name: "chapter", Args: map[string]string{}}},
+		{`chapter id="x" spine-properties='page-spread-right'`,
+			Directive{Name: "chapter", Args: map[string]string{"id": "x", "spine-properties": "page-spread-right"}}},
+		{`tocentry "The Letter"`, Directive{Name: "tocentry", Args: map[string]string{}, Label: "The Letter"}},
+		{"figure inline", Directive{Name: "figure", Args: map[string]string{"inline": "true"}}},
+		{`raw map.xhtml toc="Map"`, Directive{Name: "raw", Args: map[string]string{"toc": "Map"}, File: "map.xhtml"}},
+	}
+	for _, test := range tests {
+		for _, line := range []string{"<!--" + test.body + "-->", "<?ep3 " + test.body + "?>"} {
+			if !isDirective(line) {
+				t.Errorf("isDirective(%q) = false", line)
+			}
+			got, ok, err := parseDirective(line)
+			if !ok || err != nil || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseDirective(%q) = %+v, %v, %v, want %+v", line, got, ok, err, test.want)
+			}
+		}
+	}
+}
+
+func TestIsDirective(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"<!--chpater-->", true}, // misspelt, so that it is reported
+		{"<!-- end of scene -->", false},
+		{"<!-- end -->", true},
+		{"<?ep3?>", true},
+		{"<?ep3 anything?>", true},
+		{"<?ep3x chapter?>", false},
+		{`<?xml version="1.0"?>`, false},
+		{"<p>text</p>", false},
+	}
+	for _, test := range tests {
+		if got := isDirective(test.line); got != test.want {
+			t.Errorf("isDirective(%q) = %v, want %v", test.line, got, test.want)
+		}
+	}
+	if _, ok, err := parseDirective("<?ep3 ?>"); !ok || err == nil {
+		t.Errorf("parseDirective(%q) = %v, %v, want the missing name reported", "<?ep3 ?>", ok, err)
+	}
+}
+
+func TestEmptyComments(t *testing.T) {
+	for _, line := range []string{"<!-->", "<!--->", "<!---->"} {
+		if directive, _, err := parseDirective(line); directive.Name != "" || err != nil {
+			t.Errorf("parseDirective(%q) = %+v, %v, want no directive", line, directive, err)
+		}
+		if isDirective(line) {
+			t.Errorf("isDirective(%q) = true, want false", line)
+		}
+		if !isComment(line) {
+			t.Errorf("isComment(%q) = false, want true", line)
+		}
+
+		// The comment ends on its line, so the next line is kept.
+		b := testBuffer(t, line, "<p>Kept.</p>")
+		for _, want := range []struct {
+			text string
+			kept bool
+		}{{"", false}, {"<p>Kept.</p>", true}} {
+			b.Next()
+			if text, kept := b.bodyText(); text != want.text || kept != want.kept {
+				t.Errorf("after %q: bodyText = %q, %v, want %q, %v", line, text, kept, want.text, want.kept)
+			}
+		}
+	}
+}
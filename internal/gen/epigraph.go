@@ -0,0 +1,120 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 14-Nov-2023
+//
+// The epigraph section with one or more quotations and their attributions.
+
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+// attributionRegexp matches a line starting with an em dash, optionally inside a <p> element,
+// and captures the attribution text after the dash.
+var attributionRegexp = regexp.MustCompile(`^(?:<p[^>]*>)?\s*(?:—|&mdash;|&#8212;|&#x2014;)\s*(.*?)\s*(?:</p>)?$`)
+
+// epigraphQuote is a single quotation on the epigraph page.
+type epigraphQuote struct {
+	Lines       []string // the lines of the quotation
+	Attribution string   // the text after the em dash of the last line, may contain markup; "" if none
+}
+
+type epigraphTemplateData struct {
+	pageSetup
+	Title       string
+	ID          string
+	EpubType    epubtype.Term
+	HeadingLine string // the heading line of the section
+	Quotes      []epigraphQuote
+	Lines       []string // all the lines without the separators, used when falling back to the frontmatter template
+}
+
+// GenEpigraphSection generates the epigraph section. The quotations are separated by <!--sep--> markers
+// and the last line of each quotation starting with an em dash is its attribution.
+// On entry, currLine contains the first line of this section, one of the <h1> to <h6> tags.
+func (b *InputBuffer) GenEpigraphSection(section SectionData) (err error) {
+	defer catch(&err)
+	b.combineFrontMatter(&section)
+	fileName := section.ID + ".xhtml"
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
+
+	outfile := b.createSectionFile(section)
+	defer outfile.Close()
+
+	// Read in the lines making up the section and stop when another directive line is encountered.
+	// The separator does not end the section but starts a new quotation, at the index of its first line.
+	headingLine := b.CurrLine
+	sectionLines := []string{headingLine}
+	starts := []int{len(sectionLines)}
+	for b.Next() {
+		if directive := b.directive(); directive.Name == "figure" {
+			sectionLines = append(sectionLines, b.genFigure(directive)...)
+		}
+		if isInlineSVG(b.CurrLine) {
+			b.CurrLine = b.readInlineSVG(section)
+		}
+		if directive := b.directive(); directive.Name == "tocentry" {
+			b.CurrLine = b.genTocEntry(section, directive)
+		}
+		for directive := b.directive(); directive.Name == "footnote"; directive = b.directive() {
+			b.readFootnote(directive) // collected into the notes section, see GenNotesSection
+		}
+		if b.directive().Name == "sep" { // separates the quotations
+			starts = append(starts, len(sectionLines))
+			continue
+		}
+		if isDirective(b.CurrLine) {
+			break
+		}
+		if line, ok := b.bodyText(); ok {
+			sectionLines = append(sectionLines, line)
+		}
+	}
+
+	// The quotations are split from the processed lines, with their note references, asset paths, image
+	// sizes and abbreviations rewritten.
+	b.processSection(section, sectionLines)
+
+	quotes := make([]epigraphQuote, 0, len(starts))
+	for i, start := range starts {
+		end := len(sectionLines)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		lines := sectionLines[start:end]
+		if len(lines) == 0 {
+			continue // a separator at the start or the end, or two in a row
+		}
+		quote := epigraphQuote{Lines: joinPreformatted(lines)}
+		if match := attributionRegexp.FindStringSubmatch(strings.TrimSpace(lines[len(lines)-1])); match != nil {
+			quote.Lines = joinPreformatted(lines[:len(lines)-1])
+			quote.Attribution = match[1]
+		}
+		quotes = append(quotes, quote)
+	}
+
+	// Struct to pass to the template
+	data := epigraphTemplateData{
+		pageSetup:   b.page,
+		Title:       b.attributes.get("title"),
+		ID:          section.ID,
+		EpubType:    section.EpubType,
+		HeadingLine: headingLine,
+		Quotes:      quotes,
+		Lines:       joinPreformatted(sectionLines),
+	}
+	if b.hasTemplate(epigraphTemplate) {
+		b.render(outfile, fileName, epigraphTemplate, data)
+		b.RegisterFeature("epigraph template", true, "")
+	} else {
+		b.render(outfile, fileName, frontmatterTemplate, data)
+		b.RegisterFeature("epigraph template", false, "epigraph.gohtml missing from templates_dir, used frontmatter.gohtml")
+	}
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
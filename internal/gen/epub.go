@@ -0,0 +1,150 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 30-Nov-2023
+//
+// Packaging of the generated book directory into the .epub file.
+
+package gen
+
+import (
+	"archive/zip"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// epubEntries returns the entries of the generated book directory which make up the .epub file, in order.
+// The mimetype entry must come first. Other files in the directory, such as the lock file and the build
+// report, are left out, as are any of the excludedFiles found under the entries.
+func (c *Context) epubEntries() []string {
+	return []string{"mimetype", "META-INF", c.layout.PackageDir}
+}
+
+// EpubFileSpec returns the path of the .epub file of the book, next to the generated book directory.
+func EpubFileSpec(targetDir, bookName string) string {
+	return filepath.Join(targetDir, bookName+".epub")
+}
+
+// PackageEpub writes the generated book directory into the .epub file. The mimetype entry is written first
+// and stored uncompressed as the EPUB container format requires; all the other files are deflated.
+// The file is written under a temporary name and renamed when complete, so that a failed build never
+// leaves a truncated .epub file behind. The entries are dated with the build timestamp rather than the times
+// of the files, so that the builds of the same source give the same file.
+func (c *Context) PackageEpub(epubFileSpec string, modified time.Time) (err error) {
+	defer catch(&err)
+	fmt.Fprintf(c.out, "Generating file %s (EPUB) ... ", filepath.Base(epubFileSpec))
+
+	tempFileSpec := epubFileSpec + ".tmp"
+	file, err := os.Create(tempFileSpec)
+	check(err)
+	defer os.Remove(tempFileSpec) // no-op once renamed
+	closed := false
+	defer func() {
+		if !closed {
+			file.Close() // on a failure, so that the file can be removed
+		}
+	}()
+
+	archive := zip.NewWriter(file)
+	c.packageChecksums = make([]FileChecksum, 0, 50)
+	for _, entry := range c.epubEntries() {
+		fileSpecs := c.epubFiles(filepath.Join(c.targetDirSpec, entry))
+		for _, fileSpec := range fileSpecs {
+			name, err := filepath.Rel(c.targetDirSpec, fileSpec)
+			check(err)
+			method := zip.Deflate
+			if entry == "mimetype" {
+				method = zip.Store
+			}
+			checksum := addEpubEntry(archive, filepath.ToSlash(name), fileSpec, method, modified)
+			c.packageChecksums = append(c.packageChecksums, checksum)
+		}
+	}
+	check(archive.Close())
+	closed = true
+	check(file.Close())
+	check(os.Rename(tempFileSpec, epubFileSpec))
+	c.packageChecksums = append(c.packageChecksums, fileChecksum(filepath.Base(epubFileSpec), epubFileSpec))
+
+	fmt.Fprintln(c.out, "done")
+	return nil
+}
+
+// epubFiles returns the file itself, or all the files under the directory in lexical order, except the
+// diagnostic and bookkeeping files of a build, see isExcludedFile.
+func (c *Context) epubFiles(root string) []string {
+	fileSpecs := make([]string, 0, 50)
+	err := filepath.Walk(root, func(fileSpec string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+		case isExcludedFile(fileSpec):
+			name, _ := filepath.Rel(c.targetDirSpec, fileSpec)
+			c.warn("%s is a build file and is left out of the package", filepath.ToSlash(name))
+		default:
+			fileSpecs = append(fileSpecs, fileSpec)
+		}
+		return nil
+	})
+	if err != nil {
+		fail("cannot package %s: %s", root, err.Error())
+	}
+	sort.Strings(fileSpecs)
+	return fileSpecs
+}
+
+// addEpubEntry copies the file into the archive under the given name with the given compression method and date,
+// and returns the checksum of the content written. A stored entry is written with its size and checksum up front, since readers of the mimetype entry
+// expect neither a data descriptor nor an extra field; it is therefore dated by its MS-DOS date and time alone.
+func addEpubEntry(archive *zip.Writer, name, fileSpec string, method uint16, modified time.Time) FileChecksum {
+	checksum := newChecksumWriter()
+	if method == zip.Store {
+		content, err := os.ReadFile(fileSpec)
+		check(err)
+		header := &zip.FileHeader{
+			Name:               name,
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(content),
+			CompressedSize64:   uint64(len(content)),
+			UncompressedSize64: uint64(len(content)),
+			Modified:           modified,
+		}
+		header.ModifiedDate, header.ModifiedTime = msDosTime(modified) // CreateRaw writes these fields as they are
+		writer, err := archive.CreateRaw(header)
+		check(err)
+		_, err = io.MultiWriter(writer, checksum).Write(content)
+		check(err)
+		return checksum.checksum(name)
+	}
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modified})
+	check(err)
+	file, err := os.Open(fileSpec)
+	check(err)
+	defer file.Close()
+	_, err = io.Copy(io.MultiWriter(writer, checksum), file)
+	check(err)
+	return checksum.checksum(name)
+}
+
+// RemoveExploded removes the files packaged into the .epub file from the generated book directory,
+// leaving the files which are not part of the book, such as the build report.
+func (c *Context) RemoveExploded() (err error) {
+	defer catch(&err)
+	for _, entry := range c.epubEntries() {
+		check(os.RemoveAll(filepath.Join(c.targetDirSpec, entry)))
+	}
+	return nil
+}
+
+// msDosTime returns the MS-DOS date and time of a ZIP entry header, to the even second as the format allows.
+func msDosTime(t time.Time) (date, timeOfDay uint16) {
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	timeOfDay = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, timeOfDay
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 03-Dec-2023
+//
+// Build errors returned by the exported functions of the package.
+
+package gen
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Error is a build failure meant for the author of the book, such as a missing attribute or an unknown
+// directive. Line is the line of source.html the failure refers to, or 0 if it does not concern a line.
+type Error struct {
+	Line  int
+	Msg   string
+	stack []byte // where the build failed, see Stack
+}
+
+// Error returns the message, prefixed with the source line if known, e.g.
+// "source.html line 42: unknown directive <!--chpater-->".
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("source.html line %d: %s", e.Line, e.Msg)
+	}
+	return e.Msg
+}
+
+// Stack returns the stack trace of the code where the build failed, shown by the -debug flag.
+func (e *Error) Stack() []byte {
+	return e.stack
+}
+
+// The helpers below abort the function being run deep inside the package. The exported function which
+// started it recovers with catch and returns the error, in the way the text/template package does.
+
+// fail aborts with the error message.
+func fail(format string, args ...any) {
+	panic(&Error{Msg: fmt.Sprintf(format, args...), stack: debug.Stack()})
+}
+
+// failAt aborts with the error message for the given source line.
+func failAt(line int, format string, args ...any) {
+	panic(&Error{Line: line, Msg: fmt.Sprintf(format, args...), stack: debug.Stack()})
+}
+
+// fail aborts with the error message for the current source line.
+func (b *InputBuffer) fail(format string, args ...any) {
+	failAt(b.LineNo(), format, args...)
+}
+
+// check aborts with the error if it is not nil. Used for the errors of the file operations, and of the
+// exported functions called inside the package.
+func check(err error) {
+	if e, ok := err.(*Error); ok {
+		panic(e)
+	}
+	if err != nil {
+		panic(&Error{Msg: err.Error(), stack: debug.Stack()})
+	}
+}
+
+// catch is deferred by the exported functions to return the error raised by fail, failAt or check in
+// *errp. Any other panic is a bug and is passed on. The error keeps the stack trace of the code where the
+// build failed, for the -debug flag.
+func catch(errp *error) {
+	switch r := recover().(type) {
+	case nil:
+	case *Error:
+		*errp = r
+	default:
+		panic(r)
+	}
+}
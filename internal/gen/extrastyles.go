@@ -0,0 +1,115 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 18-Jan-2024
+//
+// The stylesheet of the book written in source.html itself, with the <!--styles--> block.
+
+package gen
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/fileutil"
+)
+
+// extraStylesheetFile is the stylesheet written from the <!--styles--> block, linked after stylesheet.css.
+const extraStylesheetFile = "book-extra.css"
+
+// ReadStylesBlock reads the optional <!--styles--> block, which must start the body, up to <!--endstyles-->.
+// Its lines are the CSS rules of the book, such as a class for the ship names, written to extraStylesheetFile
+// by CopyStaticFiles and linked from every generated page after stylesheet.css, so that a few rules do not
+// need a copy of the whole stylesheet in the book directory. The block is no section and has no page. Must be
+// called on the first line of the body, before the cover page is generated. Leaves the current line after the
+// block.
+func (b *InputBuffer) ReadStylesBlock() (err error) {
+	defer catch(&err)
+	block := b.directive()
+	if block.Name != "styles" {
+		return nil
+	}
+	closed := false
+	for b.Next() {
+		if closed = b.directive().Name == "endstyles"; closed || isDirective(b.CurrLine) {
+			break
+		}
+		b.extraStyles = append(b.extraStyles, b.bodyLine())
+	}
+	if !closed {
+		failAt(block.Line, "<!--styles--> is not closed by <!--endstyles-->")
+	}
+	checkStyles(block.Line, b.extraStyles)
+	if strings.TrimSpace(strings.Join(b.extraStyles, "")) == "" {
+		failAt(block.Line, "<!--styles--> has no content")
+	}
+	if b.kindle != nil {
+		b.kindle.scanStylesheet(extraStylesheetFile, strings.Join(b.extraStyles, "\n"))
+	}
+	b.page.ExtraStylesheet = extraStylesheetFile
+	b.checkExtraStylesheetLinks()
+	b.nextLine()
+	return nil
+}
+
+// checkStyles checks the CSS lines of the <!--styles--> block starting on the line: the braces must balance,
+// and the block may not hold markup nor refer to other files, whose paths would be relative to the package
+// rather than to the book directory; such rules belong in a stylesheet of the book.
+func checkStyles(line int, lines []string) {
+	depth := 0
+	for i, cssLine := range lines {
+		switch {
+		case strings.Contains(cssLine, "<"):
+			failAt(line+i+1, "<!--styles--> holds CSS rules only, found markup: %s", strings.TrimSpace(cssLine))
+		case cssURLRegexp.MatchString(cssLine) || strings.Contains(cssLine, "@import"):
+			failAt(line+i+1, "<!--styles--> cannot refer to other files; put the rule in the stylesheet.css of the book")
+		}
+		for _, r := range cssLine {
+			switch r {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth < 0 {
+					failAt(line+i+1, "<!--styles--> has a } without a matching {")
+				}
+			}
+		}
+	}
+	if depth > 0 {
+		failAt(line, "<!--styles--> has a { not closed by }")
+	}
+}
+
+// checkExtraStylesheetLinks warns about the page templates which do not link the stylesheet of the <!--styles-->
+// block with {{.ExtraStylesheet}}, such as those of an older custom templates directory, as their pages would
+// miss the rules of the block.
+func (c *Context) checkExtraStylesheetLinks() {
+	names := make([]string, 0, len(c.tmplSources))
+	for name := range c.tmplSources {
+		if strings.HasSuffix(name, ".gohtml") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !c.templateFields(name)["ExtraStylesheet"] {
+			c.warn("template %s does not link the stylesheet of <!--styles--> with {{.ExtraStylesheet}}", name)
+		}
+	}
+}
+
+// writeExtraStylesheet writes the rules of the <!--styles--> block to extraStylesheetFile, if the book has one.
+func (b *InputBuffer) writeExtraStylesheet() {
+	if b.extraStyles == nil {
+		return
+	}
+	content := strings.Join(b.extraStyles, "\n") + "\n"
+	if !strings.HasPrefix(strings.TrimSpace(content), "@charset") {
+		content = "@charset \"utf-8\";\n\n" + content
+	}
+	check(fileutil.WriteFile(filepath.Join(b.packageDirSpec, b.layout.StylesDir, extraStylesheetFile), strings.NewReader(content)))
+	b.rendered = append(b.rendered, RenderRecord{
+		File:     extraStylesheetFile,
+		Template: "(<!--styles-->)",
+		Source:   filepath.Join(b.sourceDirSpec, "source.html"),
+	})
+}
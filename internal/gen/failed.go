@@ -0,0 +1,87 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 11-Jan-2024
+//
+// The partial output of a build stopped by a failing template, kept with -keep-failed for debugging.
+
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// failedFileName is the name of the record of the failed build written into the generated book directory.
+const failedFileName = "failed.json"
+
+// failedTemplateDataSuffix is appended to the name of the file whose template failed, to name the file
+// holding the data passed to the template.
+const failedTemplateDataSuffix = ".data.json"
+
+// failedData is the content of the record of the failed build.
+type failedData struct {
+	Book     string         `json:"book"`
+	File     string         `json:"file"`     // the file whose template failed
+	Template string         `json:"template"` // the template which failed
+	Source   string         `json:"source"`   // the file the template was loaded from
+	Error    string         `json:"error"`
+	Partial  string         `json:"partial"`  // the partial output of the template, as written
+	Data     string         `json:"data"`     // the data passed to the template, as JSON
+	Rendered []RenderRecord `json:"rendered"` // the files rendered before, in order
+}
+
+// keepFailed keeps the partial output of the template which failed for the file: the output written so far
+// goes into the file, the data passed to the template goes next to it as JSON, and the files rendered before
+// are recorded in failed.json in the generated book directory, which is left in place for inspection.
+// Problems writing them are printed rather than hiding the failure of the template.
+func (b *InputBuffer) keepFailed(outfile io.Writer, fileName, templateName string, data any, partial []byte, tmplErr error) {
+	dir := b.textDirSpec
+	if file, ok := outfile.(*os.File); ok {
+		dir = filepath.Dir(file.Name())
+	}
+	partialSpec := filepath.Join(dir, fileName)
+	dataSpec := partialSpec + failedTemplateDataSuffix
+	record := failedData{
+		Book:     filepath.Base(b.targetDirSpec),
+		File:     fileName,
+		Template: templateName,
+		Source:   b.tmplSources[templateName],
+		Error:    tmplErr.Error(),
+		Partial:  partialSpec,
+		Data:     dataSpec,
+		Rendered: append([]RenderRecord{}, b.rendered...),
+	}
+
+	problems := make([]string, 0)
+	if err := os.WriteFile(partialSpec, partial, 0660); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := writeJSON(dataSpec, data); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := writeJSON(filepath.Join(b.targetDirSpec, failedFileName), record); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	fmt.Fprintf(b.out, "\nKept the partial output of the failed build in %s (see %s)\n", b.targetDirSpec, failedFileName)
+	if len(problems) > 0 {
+		fmt.Fprintf(b.out, "epubgen: could not keep all of it: %s\n", strings.Join(problems, "; "))
+	}
+}
+
+// writeJSON writes the value as indented JSON into the file, with the markup of the section lines left as
+// it is rather than escaped, so that it can be read.
+func writeJSON(fileSpec string, value any) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	return os.WriteFile(fileSpec, buf.Bytes(), 0660)
+}
@@ -0,0 +1,45 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 23-Sep-2023
+//
+// Registry of the optional features and whether they ran in the current build.
+
+package gen
+
+import "fmt"
+
+// FeatureStatus records whether an optional feature ran and, if not, why it was skipped.
+type FeatureStatus struct {
+	Name   string `json:"name"`
+	Ran    bool   `json:"ran"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// RegisterFeature records the status of an optional feature. Registering the same feature again
+// replaces the earlier status so the last decision wins.
+func (b *InputBuffer) RegisterFeature(name string, ran bool, reason string) {
+	status := FeatureStatus{Name: name, Ran: ran, Reason: reason}
+	for i := range b.features {
+		if b.features[i].Name == name {
+			b.features[i] = status
+			return
+		}
+	}
+	b.features = append(b.features, status)
+}
+
+// Features returns the status of the optional features in the order they were registered.
+func (b *InputBuffer) Features() []FeatureStatus {
+	return b.features
+}
+
+// PrintFeatures prints the summary of which optional features ran and which were skipped.
+func (b *InputBuffer) PrintFeatures() {
+	fmt.Fprintln(b.out, "\nOptional features:")
+	for _, feature := range b.features {
+		if feature.Ran {
+			fmt.Fprintf(b.out, "  [x] %s\n", feature.Name)
+		} else {
+			fmt.Fprintf(b.out, "  [ ] %s: %s\n", feature.Name, feature.Reason)
+		}
+	}
+}
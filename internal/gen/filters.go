@@ -0,0 +1,101 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 24-Nov-2023
+//
+// Hooks for post-processing the generated sections and the metadata attributes.
+
+package gen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// SectionFilter transforms the XHTML of a generated section file, such as cover.xhtml or section001.xhtml.
+// The filters are given by the SectionFilters of the epub.Generator and run in that order, after the template
+// is executed and before the file is written, each receiving the output of the previous one. A filter must
+// return well-formed XHTML; it is checked after all the filters ran. A filter may return the body it was
+// given unchanged, and must not keep a reference to it. Returning an error aborts the build. The control
+// files (nav.xhtml, toc.ncx and package.opf) are not filtered.
+type SectionFilter func(section SectionData, body []byte) ([]byte, error)
+
+// MetadataFilter changes the metadata attributes read from the <meta> tags of the source file. The filters
+// are given by the MetadataFilters of the epub.Generator and run in that order, right after the attributes
+// are loaded and before any of them is checked, so a filter may add, change or remove attributes. The
+// attributes added by a filter come after the others, in the order of their names. Returning an error
+// aborts the build.
+type MetadataFilter func(attributes map[string]string) error
+
+// AddSectionFilter adds a filter applied to every generated section file of the build.
+func (c *Context) AddSectionFilter(filter SectionFilter) {
+	c.sectionFilters = append(c.sectionFilters, filter)
+}
+
+// AddMetadataFilter adds a filter applied to the metadata attributes of the build.
+func (c *Context) AddMetadataFilter(filter MetadataFilter) {
+	c.metadataFilters = append(c.metadataFilters, filter)
+}
+
+// ApplyMetadataFilters runs the metadata filters over the attributes. Returns an error naming the failing filter.
+func (b *InputBuffer) ApplyMetadataFilters() (err error) {
+	defer catch(&err)
+	for i, filter := range b.metadataFilters {
+		err := filter(b.attributes.values)
+		b.attributes.sync()
+		if err != nil {
+			fail("metadata filter %d failed: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+// filterSection runs the section filters over the generated file of the section with the given file name.
+// Fails naming the failing filter and the section, or if the filtered file is not well-formed.
+func (b *InputBuffer) filterSection(fileName string, body []byte) []byte {
+	if len(b.sectionFilters) == 0 || isControlFile(fileName) {
+		return body
+	}
+	section, found := b.sectionByFile(fileName)
+	if !found {
+		return body
+	}
+	for i, filter := range b.sectionFilters {
+		filtered, err := filter(section, body)
+		if err != nil {
+			fail("section filter %d failed on %s (%s): %s", i, fileName, section.Heading, err.Error())
+		}
+		body = filtered
+	}
+	if err := checkWellFormed(body); err != nil {
+		fail("%s (%s) is not well-formed after the section filters: %s", fileName, section.Heading, err.Error())
+	}
+	return body
+}
+
+// sectionByFile returns the section generated into the given file.
+func (b *InputBuffer) sectionByFile(fileName string) (SectionData, bool) {
+	id := strings.TrimSuffix(fileName, ".xhtml")
+	for _, section := range b.sections {
+		if section.ID == id {
+			return section, true
+		}
+	}
+	return SectionData{}, false
+}
+
+// checkWellFormed returns an error if the XHTML content is not well-formed XML. The HTML character
+// entities such as &nbsp; are accepted since the source lines may contain them.
+func checkWellFormed(content []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Entity = xml.HTMLEntity
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
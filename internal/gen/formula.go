@@ -0,0 +1,31 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 07-Dec-2023
+//
+// Images of mathematical and chemical formulas set inline with the text.
+
+package gen
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// inlineFormulaClass is the class of the images set inline by <!--figure inline-->, styled by the stylesheet.
+const inlineFormulaClass = "inline-formula"
+
+// inlineFormulaRegexp matches the class attribute of an inline formula image.
+var inlineFormulaRegexp = regexp.MustCompile(`\sclass="` + inlineFormulaClass + `"`)
+
+// emptyAltRegexp matches an empty alt attribute, which marks an image as decorative.
+var emptyAltRegexp = regexp.MustCompile(`(?i)\salt\s*=\s*(""|'')`)
+
+// genInlineFormula returns the <img> element of a formula image set inline with the text, without the
+// <figure> wrapper. The pixel size of the image is given as the width and height attributes so that the
+// reading system reserves the space before the image is loaded. SVG images have no pixel size and get none.
+func (c *Context) genInlineFormula(image ImageData, alt string) string {
+	line := `<img class="` + inlineFormulaClass + `" src="` + c.imageHref(image.FileName) + `" alt="` + alt + `"`
+	if image.MediaType != "image/svg+xml" {
+		line += ` width="` + strconv.Itoa(image.Width) + `" height="` + strconv.Itoa(image.Height) + `"`
+	}
+	return line + ` />`
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 12-Jan-2024
+//
+// The functions available to the templates.
+
+package gen
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/roslamir/ep3gen/internal/textutil"
+)
+
+// templateFuncs are the functions registered on the templates, such as {{upper .Heading}}. The names are
+// part of the template language of the books, so they must not be renamed; see the README.
+var templateFuncs = template.FuncMap{
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      titleCase,
+	"formatDate": formatDate,
+	"safeHTML":   safeHTML,
+	"add":        func(a, b int) int { return a + b },
+	"seq":        seq,
+	"slugify":    textutil.Slug,
+}
+
+// dateLayouts are the layouts tried in turn by formatDate to read a date given as a string, from the
+// timestamps of the created and modified attributes down to a year alone.
+var dateLayouts = []string{time.RFC3339, "2006-01-02", "January 2, 2006", "January 2006", "Jan 2006", "2006"}
+
+// titleCase returns the text with the first letter of each word in upper case, leaving the other letters
+// alone so that "the isle of MULL" becomes "The Isle Of MULL".
+func titleCase(text string) string {
+	var sb strings.Builder
+	atStart := true
+	for _, r := range text {
+		if atStart && unicode.IsLetter(r) {
+			r = unicode.ToUpper(r)
+		}
+		atStart = unicode.IsSpace(r) || r == '-'
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// formatDate returns the date formatted with the Go layout, such as {{formatDate "2 January 2006" .Date}}.
+// The date is a time.Time or a string in one of the dateLayouts, such as "2023-12-31T12:00:00Z" or
+// "April 2022". A date which cannot be read stops the template with an error naming it.
+func formatDate(layout string, value any) (string, error) {
+	switch date := value.(type) {
+	case time.Time:
+		return date.Format(layout), nil
+	case string:
+		trimmed := strings.TrimSpace(date)
+		for _, dateLayout := range dateLayouts {
+			if t, err := time.Parse(dateLayout, trimmed); err == nil {
+				return t.Format(layout), nil
+			}
+		}
+		return "", fmt.Errorf("formatDate: cannot read the date '%s'", date)
+	default:
+		return "", fmt.Errorf("formatDate: %T is not a date", value)
+	}
+}
+
+// safeHTML returns the text with the markup escaped for the package file, such as the &lt;i&gt; of the
+// description attribute, restored to the markup, so that it is shown formatted in a section page.
+func safeHTML(text string) string {
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">").Replace(text)
+}
+
+// seq returns the numbers from first to last, to number entries with {{range seq 1 .Count}}. Returns
+// none if last is before first.
+func seq(first, last int) []int {
+	if last < first {
+		return nil
+	}
+	numbers := make([]int, 0, last-first+1)
+	for n := first; n <= last; n++ {
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
@@ -6,138 +6,404 @@
 package gen
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"text/template"
+	"text/template/parse"
 
+	"github.com/roslamir/ep3gen/internal/epubtype"
 	"github.com/roslamir/ep3gen/internal/fileutil"
-	"github.com/roslamir/ep3gen/internal/parm"
+	"github.com/roslamir/ep3gen/internal/textutil"
 )
 
 const (
 	coverTemplate            = "cover.gohtml"
 	defaultTitlepageTemplate = "default-titlepage.gohtml"
 	imageTitlepageTemplate   = "image-titlepage.gohtml"
+	copyrightTemplate        = "copyright.gohtml"
+	quicknavTemplate         = "quicknav.gohtml"
+	epigraphTemplate         = "epigraph.gohtml"
 	frontmatterTemplate      = "frontmatter.gohtml"
 	bodymatterTemplate       = "bodymatter.gohtml"
 	backmatterTemplate       = "backmatter.gohtml"
 	navTemplate              = "nav.gohtml"
 	ncxTemplate              = "ncx.goxml"
 	opfTemplate              = "opf.goxml"
+	combinedTemplate         = "frontmatter-combined.gohtml"
+	notesTemplate            = "notes.gohtml"
+	containerTemplate        = "container.goxml"
+	halftitleTemplate        = "halftitle.gohtml"
+	loiTemplate              = "loi.gohtml"
+	descriptionsTemplate     = "descriptions.gohtml"
+	abbreviationsTemplate    = "abbreviations.gohtml"
+	warningsTemplate         = "warnings.gohtml"
+	coverTextTemplate        = "cover-text.gohtml"
+
+	// bookTemplatesDir is the directory of the book directory holding the templates overridden for the book.
+	bookTemplatesDir = "templates"
 )
 
 var (
-	tmpl           *template.Template
-	sourceDirSpec  string // the full path for the source directory
-	targetDirSpec  string // the full path for the output directory
-	packageDirSpec string // the full path for the OEBPS directory
-	textDirSpec    string // the full path for the OEBPS/Text directory
+	// copyrightRequirements are the attributes the structured copyright template may render, each by the field of
+	// copyrightTemplateData holding it and the field telling whether it is set, if any. An attribute is required
+	// if the template refers to its field without ever testing the guard field, see checkCopyrightAttributes.
+	copyrightRequirements = []struct {
+		Attribute string
+		Field     string
+		Guard     string
+	}{
+		{"publisher", "Publisher", ""},
+		{"isbn", "ISBN", "HasISBN"},
+		{"rights", "Rights", "HasRights"},
+	}
 )
 
-// LoadTemplates loads in the template files and panics if any error occurs.
-func LoadTemplates() {
-	tmpl = template.Must(template.ParseFiles(
-		filepath.Join(parm.TemplatesDir, coverTemplate),
-		filepath.Join(parm.TemplatesDir, defaultTitlepageTemplate),
-		filepath.Join(parm.TemplatesDir, imageTitlepageTemplate),
-		filepath.Join(parm.TemplatesDir, frontmatterTemplate),
-		filepath.Join(parm.TemplatesDir, bodymatterTemplate),
-		filepath.Join(parm.TemplatesDir, backmatterTemplate),
-		filepath.Join(parm.TemplatesDir, navTemplate),
-		filepath.Join(parm.TemplatesDir, ncxTemplate),
-		filepath.Join(parm.TemplatesDir, opfTemplate),
-	))
-}
-
-// Init creates the EPUB directory tree.
-func Init(sourceDir, targetDir string) {
-	sourceDirSpec = sourceDir
-	targetDirSpec = targetDir
-	packageDirSpec = filepath.Join(targetDirSpec, "OEBPS")
-	textDirSpec = filepath.Join(packageDirSpec, "Text")
+// isControlFile returns true for the generated files which are not sections: nav.xhtml, and the NCX and package
+// files of every rendition, such as toc.ncx and fixed.opf. Their hrefs are checked for backslashes.
+func isControlFile(fileName string) bool {
+	return fileName == "nav.xhtml" || path.Ext(fileName) == ".ncx" || path.Ext(fileName) == ".opf"
+}
+
+// createSectionFile creates the output file of a section in the Text directory. When the existing section
+// files are reused by a metadata-only build, it returns a writer which discards the output instead. The
+// output of a section sharing a file with other sections is collected for that file, see combinedPart.
+func (b *InputBuffer) createSectionFile(section SectionData) io.WriteCloser {
+	if section.File != "" {
+		return &combinedPart{b: b, fileName: section.ID + ".xhtml"}
+	}
+	if b.reuseSections {
+		return nopWriteCloser{io.Discard}
+	}
+	file, err := fileutil.CreateFile(filepath.Join(b.textDirSpec, section.FileName()))
+	check(err)
+	return file
+}
+
+// nopWriteCloser adds a no-op Close method to a writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// LoadTemplates loads in the template files, with the templateFuncs, and returns an error if any of them cannot
+// be parsed. A template found in the templates directory of the book directory, such as
+// source/<BookName>/templates/bodymatter.gohtml, overrides the one of the same name in templates_dir for this
+// book only; each override is printed.
+func (c *Context) LoadTemplates() (err error) {
+	defer catch(&err)
+	bookTemplates := filepath.Join(c.parms.SourceDir, c.parms.BookName, bookTemplatesDir)
+	c.tmplOverrides = make(map[string]bool)
+	templateFiles := make([]string, 0, 20)
+	addTemplate := func(name string, optional bool) {
+		fileSpec := filepath.Join(bookTemplates, name)
+		if _, err := os.Stat(fileSpec); err == nil {
+			c.tmplOverrides[name] = true
+		} else {
+			fileSpec = filepath.Join(c.parms.TemplatesDir, name)
+			if _, err := os.Stat(fileSpec); err != nil && optional {
+				return
+			}
+		}
+		templateFiles = append(templateFiles, fileSpec)
+	}
+	for _, name := range []string{coverTemplate, defaultTitlepageTemplate, imageTitlepageTemplate, frontmatterTemplate,
+		bodymatterTemplate, backmatterTemplate, navTemplate, ncxTemplate, opfTemplate} {
+		addTemplate(name, false)
+	}
+
+	// These templates are optional for compatibility with older custom templates directories.
+	for _, name := range []string{copyrightTemplate, quicknavTemplate, epigraphTemplate, combinedTemplate, notesTemplate, containerTemplate,
+		halftitleTemplate, loiTemplate, descriptionsTemplate, abbreviationsTemplate, warningsTemplate, coverTextTemplate} {
+		addTemplate(name, true)
+	}
+
+	c.tmpl, err = template.New(filepath.Base(templateFiles[0])).Funcs(templateFuncs).ParseFiles(templateFiles...)
+	check(err)
+	c.tmplSources = make(map[string]string, len(templateFiles))
+	for _, fileSpec := range templateFiles {
+		c.tmplSources[filepath.Base(fileSpec)] = fileSpec
+	}
+	c.checkBookTemplates(bookTemplates)
+
+	c.copyrightTemplateName = copyrightTemplate
+	if !c.hasTemplate(copyrightTemplate) {
+		c.copyrightTemplateName = frontmatterTemplate
+	}
+	return nil
+}
+
+// checkBookTemplates prints the templates overridden in the templates directory of the book directory, and
+// warns about the template files found there which are not known templates, such as a misspelt name.
+func (c *Context) checkBookTemplates(bookTemplates string) {
+	entries, err := os.ReadDir(bookTemplates)
+	if os.IsNotExist(err) {
+		return
+	}
+	check(err)
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case c.tmplOverrides[name]:
+			fmt.Fprintf(c.out, "Using template %s from %s\n", name, bookTemplates)
+		case strings.HasSuffix(name, ".gohtml") || strings.HasSuffix(name, ".goxml"):
+			c.warn("%s in %s is not a known template and is ignored", name, bookTemplates)
+		}
+	}
+}
+
+// templateOrigin returns where the named template was loaded from, as stamped into the output.
+func (c *Context) templateOrigin(name string) string {
+	if c.tmplOverrides[name] {
+		return "book templates"
+	}
+	return "templates_dir"
+}
+
+// hasTemplate returns true if the named template was loaded.
+func (c *Context) hasTemplate(name string) bool {
+	_, exists := c.tmplSources[name]
+	return exists
+}
+
+// templateFields returns the names of the fields of the data referred to in the named template, such as
+// "ISBN" for {{.ISBN}}.
+func (c *Context) templateFields(name string) map[string]bool {
+	fields := make(map[string]bool)
+	t := c.tmpl.Lookup(name)
+	if t == nil || t.Tree == nil {
+		return fields
+	}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, child := range n.Nodes {
+					walk(child)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, cmd := range n.Cmds {
+					walk(cmd)
+				}
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.FieldNode:
+			fields[n.Ident[0]] = true
+		}
+	}
+	walk(t.Tree.Root)
+	return fields
+}
+
+// render executes the named template and writes the result to the output file, after checking that a section
+// file is well-formed, see validateSection. It records which template produced the file and stamps the template name into the output as an
+// XML comment right after the XML declaration, to help debug custom templates, unless the build time is pinned
+// for a reproducible build, see BuildTime.
+func (b *InputBuffer) render(outfile io.Writer, fileName, templateName string, data any) {
+	var buf bytes.Buffer
+	if err := b.tmpl.ExecuteTemplate(&buf, templateName, data); err != nil {
+		if b.parms.KeepFailed {
+			b.keepFailed(outfile, fileName, templateName, data, buf.Bytes(), err)
+		}
+		check(err)
+	}
+
+	source := b.tmplSources[templateName]
+	content := b.filterSection(fileName, buf.Bytes())
+	if isControlFile(fileName) {
+		checkHrefSeparators(fileName, content)
+	}
+	b.validateSection(fileName, content)
+	if !b.pinnedTime {
+		content = stampTemplate(content, templateName, b.templateOrigin(templateName))
+	}
+	_, err := outfile.Write(content)
+	check(err)
+	file := fileName
+	if section, found := b.sectionByFile(fileName); found {
+		file = section.Href() // the fragment of the combined file for a combined section
+	}
+	b.rendered = append(b.rendered, RenderRecord{
+		File:     file,
+		Template: templateName,
+		Source:   source,
+	})
+
+	if b.parms.Verbose {
+		fmt.Fprintf(b.out, "[%s from %s] ", templateName, source)
+	}
+}
+
+// stampTemplate inserts the comment <!-- ep3gen: name (origin) --> after the XML declaration.
+// Comments are not allowed before the XML declaration, so the stamp goes first only when there is none.
+func stampTemplate(content []byte, templateName, origin string) []byte {
+	stamp := "<!-- ep3gen: " + templateName + " (" + origin + ") -->"
+	trimmed := bytes.TrimLeft(content, " \t\r\n")
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) {
+		if end := bytes.Index(trimmed, []byte("?>")); end != -1 {
+			end += len("?>")
+			stamped := make([]byte, 0, len(trimmed)+len(stamp)+1)
+			stamped = append(stamped, trimmed[:end]...)
+			stamped = append(stamped, '\n')
+			stamped = append(stamped, stamp...)
+			return append(stamped, trimmed[end:]...)
+		}
+	}
+	return append([]byte(stamp+"\n"), content...)
 }
 
 type coverTemplateData struct {
+	pageSetup
 	Title      string
 	CoverImage ImageData
 }
 
-// GenCoverSection generates the cover page section.
-func (b *InputBuffer) GenCoverSection() {
+type coverTextTemplateData struct {
+	pageSetup
+	Title       string
+	HasSubtitle bool
+	Subtitle    string
+	HasSeries   bool
+	Series      string
+	SeriesIndex string
+	Author      string
+}
+
+// GenCoverSection generates the cover page section. A book with the attribute "cover-image" set to
+// generatedCover gets a text-only cover with the title, the author and the series, rendered by the template
+// cover-text.gohtml; the page is still the cover in the landmarks, but the package has no cover image.
+func (b *InputBuffer) GenCoverSection() (err error) {
+	defer catch(&err)
 	section := SectionData{
 		ID:       "cover",
-		EpubType: "cover",
+		EpubType: epubtype.Cover,
 		Heading:  "Cover Page",
 	}
 	b.sections = append(b.sections, section)
 	b.guides = append(b.guides, section)
+	if b.hasCoverImage() {
+		b.addAssetRef(section.ID, b.layout.imagesHref(b.coverImage.FileName))
+	} else if !b.hasTemplate(coverTextTemplate) {
+		fail("template %s not found in templates_dir, needed by the attribute 'cover-image' \"%s\"", coverTextTemplate, generatedCover)
+	}
+	b.traceSection("generated", section)
 
 	fileName := section.ID + ".xhtml"
-	fmt.Printf("Generating file %s (%s) ... ", fileName, section.Heading)
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
 
-	outfile := fileutil.CreateFile(filepath.Join(textDirSpec, fileName))
+	outfile := b.createSectionFile(section)
 	defer outfile.Close()
 
+	if !b.hasCoverImage() {
+		subtitle, hasSubtitle := b.attributes.lookup("subtitle")
+		series, hasSeries := b.attributes.lookup("series")
+		data := coverTextTemplateData{
+			pageSetup:   b.page,
+			Title:       b.attributes.get("title"),
+			HasSubtitle: hasSubtitle,
+			Subtitle:    subtitle,
+			HasSeries:   hasSeries,
+			Series:      series,
+			SeriesIndex: b.attributes.get("series-index"),
+			Author:      b.attributes.get("author"),
+		}
+		b.render(outfile, fileName, coverTextTemplate, data)
+		fmt.Fprintln(b.out, "done")
+		return nil
+	}
+
 	// Struct to pass to the template
 	data := coverTemplateData{
-		Title:      b.attributes["title"],
+		pageSetup:  b.page,
+		Title:      b.attributes.get("title"),
 		CoverImage: b.coverImage,
 	}
-	if err := tmpl.ExecuteTemplate(outfile, coverTemplate, data); err != nil {
-		panic(err)
-	}
+	b.render(outfile, fileName, coverTemplate, data)
 
-	fmt.Println("done")
+	fmt.Fprintln(b.out, "done")
+	return nil
 }
 
 // GenTitlePageSection generates the title page section.
 // If the attribute "titlepage" is not given or has the value of "default", we generate the default title page section.
 // If it has the value of "custom", the first directive encountered must be "<!--titlepage-->" and it must be followed
 // by one or more formatted HTML lines making up the title page section.
-// Any other value is assumed to be the name of an image file with either "png" or "jpeg" extension which will be used
-// as the title page.
-func (b *InputBuffer) GenTitlePageSection() {
+// Any other value is assumed to be the name of an image file with a "png", "jpeg", "jpg", "gif" or "svg" extension
+// which will be used as the title page.
+func (b *InputBuffer) GenTitlePageSection() (err error) {
+	defer catch(&err)
 	var titlePage string
-	if titlePage = b.attributes["titlepage"]; titlePage == "" {
+	if titlePage = b.attributes.get("titlepage"); titlePage == "" {
 		titlePage = "default"
 	}
 
 	section := SectionData{
 		ID:       "titlepage",
-		EpubType: "titlepage",
+		EpubType: epubtype.TitlePage,
 		Heading:  "Title Page",
 	}
+	b.combineFrontMatter(&section)
 	b.sections = append(b.sections, section)
 	b.guides = append(b.guides, section)
 
 	switch titlePage {
 	case "default":
-		b.GenDefaultTitlePageSection(section)
+		b.traceSection("generated", section)
+		check(b.GenDefaultTitlePageSection(section))
 
 	case "custom":
-		b.NextLine()
-		if b.CurrLine == "<!--titlepage-->" {
-			b.NextLine()
-			b.GenFrontMatterSection(section)
+		b.nextLine()
+		if directive := b.directive(); directive.Name == "titlepage" {
+			b.TraceSection(directive, section)
+			b.nextLine()
+			check(b.GenFrontMatterSection(section))
 		} else {
-			panic("epubgen: <!--titlepage--> directive expected")
+			fail("<!--titlepage--> directive expected")
 		}
 
 	default: // assumes titlepage contains an image file name to be used for the title page
-		_, mediaType, _ := strings.Cut(titlePage, ".")
-		if mediaType != "png" && mediaType != "jpeg" {
-			panic("epubgen: only image files with extension 'png' or 'jpeg' are accepted")
-		}
-		image := ImageData{
-			FileName:  titlePage,
-			MediaType: mediaType,
-		}
-		b.GenImageTitlePageSection(section, image)
+		image := b.registerTitlePageImage(newImageData(titlePage))
+		b.addAssetRef(section.ID, b.layout.imagesHref(image.FileName))
+		b.traceSection("generated", section)
+		check(b.GenImageTitlePageSection(section, image))
 	}
+	return nil
 }
 
 type defaultTitlepageTemplateData struct {
+	pageSetup
 	Title       string
 	HasSubtitle bool
 	Subtitle    string
@@ -145,7 +411,9 @@ type defaultTitlepageTemplateData struct {
 	Series      string
 	SeriesIndex string
 	Author      string
-	HasAuthor2  bool
+	CoAuthors   []Contributor // the authors after the first, listed under it
+	Credits     []Contributor // the other contributors credited for their role, such as the translator
+	HasAuthor2  bool          // deprecated, for the custom title page templates written before CoAuthors
 	Author2     string
 	HasAuthor3  bool
 	Author3     string
@@ -154,239 +422,343 @@ type defaultTitlepageTemplateData struct {
 }
 
 // GenDefaultTitlePageSection generates the default title page section.
-func (b *InputBuffer) GenDefaultTitlePageSection(section SectionData) {
+func (b *InputBuffer) GenDefaultTitlePageSection(section SectionData) (err error) {
+	defer catch(&err)
 	fileName := section.ID + ".xhtml"
-	fmt.Printf("Generating file %s (%s) ... ", fileName, section.Heading)
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
 
-	var err error
-	outfile := fileutil.CreateFile(filepath.Join(textDirSpec, fileName))
+	outfile := b.createSectionFile(section)
 	defer outfile.Close()
 
 	// Struct to pass to the template
-	subtitle, hasSubtitle := b.attributes["subtitle"]
-	series, hasSeries := b.attributes["series"]
-	author2, hasAuthor2 := b.attributes["author2"]
-	author3, hasAuthor3 := b.attributes["author3"]
+	subtitle, hasSubtitle := b.attributes.lookup("subtitle")
+	series, hasSeries := b.attributes.lookup("series")
+	author2, hasAuthor2 := b.attributes.lookup("author2")
+	author3, hasAuthor3 := b.attributes.lookup("author3")
 	data := defaultTitlepageTemplateData{
-		Title:       b.attributes["title"],
+		pageSetup:   b.page,
+		Title:       b.attributes.get("title"),
 		HasSubtitle: hasSubtitle,
 		Subtitle:    subtitle,
 		HasSeries:   hasSeries,
 		Series:      series,
-		SeriesIndex: b.attributes["series-index"],
-		Author:      b.attributes["author"],
+		SeriesIndex: b.attributes.get("series-index"),
+		Author:      b.attributes.get("author"),
+		CoAuthors:   b.coAuthors(),
+		Credits:     b.credits(),
 		HasAuthor2:  hasAuthor2,
 		Author2:     author2,
 		HasAuthor3:  hasAuthor3,
 		Author3:     author3,
-		Publisher:   b.attributes["publisher"],
-		Published:   b.attributes["published"],
+		Publisher:   b.attributes.get("publisher"),
+		Published:   b.attributes.get("published"),
 	}
 
-	if err = tmpl.ExecuteTemplate(outfile, defaultTitlepageTemplate, data); err != nil {
-		panic(err)
-	}
+	b.render(outfile, fileName, defaultTitlepageTemplate, data)
 
-	fmt.Println("done")
+	fmt.Fprintln(b.out, "done")
+	return nil
 }
 
 type imageTitlepageTemplateData struct {
+	pageSetup
 	Title    string
 	ID       string
-	EpubType string
+	EpubType epubtype.Term
 	Image    ImageData
 	Heading  string
 }
 
 // GenImageTitlePageSection generates the title page section comprising a single image.
-func (b *InputBuffer) GenImageTitlePageSection(section SectionData, image ImageData) {
+func (b *InputBuffer) GenImageTitlePageSection(section SectionData, image ImageData) (err error) {
+	defer catch(&err)
 	fileName := section.ID + ".xhtml"
-	fmt.Printf("Generating file %s (%s) ... ", fileName, section.Heading)
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
 
-	outfile := fileutil.CreateFile(filepath.Join(textDirSpec, fileName))
+	outfile := b.createSectionFile(section)
 	defer outfile.Close()
 
 	// Struct to pass to the template
 	data := imageTitlepageTemplateData{
-		Title:    b.attributes["title"],
-		ID:       section.ID,
-		EpubType: section.EpubType,
-		Image:    image,
-		Heading:  section.Heading,
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+		Image:     image,
+		Heading:   section.Heading,
 	}
 
-	if err := tmpl.ExecuteTemplate(outfile, imageTitlepageTemplate, data); err != nil {
-		panic(err)
-	}
+	b.render(outfile, fileName, imageTitlepageTemplate, data)
 
-	fmt.Println("done")
+	fmt.Fprintln(b.out, "done")
+	return nil
 }
 
 type standardTemplateData struct {
+	pageSetup
 	Title       string
 	ID          string
-	EpubType    string
+	EpubType    epubtype.Term
+	Role        string // the DPUB-ARIA role of the section, if any
 	Lines       []string
 	IsCopyright bool
 	Date        string
 }
 
+type copyrightTemplateData struct {
+	pageSetup
+	Title       string
+	ID          string
+	EpubType    epubtype.Term
+	Lines       []string
+	IsCopyright bool // always true, used when falling back to the frontmatter template
+	Date        string
+	Publisher   string
+	HasISBN     bool
+	ISBN        string
+	HasRights   bool
+	Rights      string
+	Conformance *conformanceData // the accessibility conformance claim, nil if none
+}
+
+// checkCopyrightAttributes warns about all the attributes the structured copyright template renders which are not
+// set, since the page would show a label such as "ISBN:" with nothing after it, see copyrightRequirements. With the
+// -strict flag, it fails instead. The frontmatter template used in place of copyright.gohtml renders only the lines
+// of the section, so nothing is checked then.
+func (b *InputBuffer) checkCopyrightAttributes() {
+	if b.copyrightTemplateName != copyrightTemplate {
+		return
+	}
+	fields := b.templateFields(copyrightTemplate)
+	missing := make([]string, 0, len(copyrightRequirements))
+	for _, req := range copyrightRequirements {
+		if !fields[req.Field] || (req.Guard != "" && fields[req.Guard]) {
+			continue
+		}
+		if _, set := b.attributes.lookup(req.Attribute); !set {
+			missing = append(missing, req.Attribute)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	if b.parms.Strict {
+		fail("template %s renders the attributes %s, which are not set", copyrightTemplate, strings.Join(missing, ", "))
+	}
+	b.warn("template %s renders the attributes %s, which are not set", copyrightTemplate, strings.Join(missing, ", "))
+}
+
+// bodyDirectives are the directives which may only appear inside the body of a section, see readSectionLine.
+var bodyDirectives = map[string]bool{
+	"figure":     true,
+	"tocentry":   true,
+	"image":      true,
+	"footnote":   true,
+	"spoiler":    true,
+	"endspoiler": true,
+}
+
+// readSectionLines reads in the lines making up the section and stops when another directive line is
+// encountered, or at the end of the input file, see readSectionLine.
+func (b *InputBuffer) readSectionLines(section SectionData) []string {
+	sectionLines := make([]string, 0, 50)
+	afterTocEntry := false
+	for b.readSectionLine(section, &sectionLines, &afterTocEntry) {
+	}
+	b.checkSpoilerClosed()
+	return sectionLines
+}
+
+// readSectionLine appends the current line to the lines of the section, unless it is left out, and moves to the
+// next line. The directives inside the body of the section, see bodyDirectives, and the inline SVG drawings are
+// handled as they are read; the copyright page takes none of these directives. In a part or a chapter, headings
+// which look like the start of another chapter are reported, unless marked by <!--tocentry-->. Returns false at
+// the end of the section: at the end of the input file or at a directive line which is not one of the body.
+func (b *InputBuffer) readSectionLine(section SectionData, sectionLines *[]string, afterTocEntry *bool) bool {
+	if line, ok := b.bodyText(); ok {
+		*sectionLines = append(*sectionLines, line)
+	}
+	if !b.Next() {
+		return false
+	}
+	if directive := b.directive(); section.EpubType == epubtype.CopyrightPage && bodyDirectives[directive.Name] {
+		failAt(directive.Line, "<!--%s--> is not allowed on the copyright page", directive.Name)
+	}
+	if directive := b.directive(); directive.Name == "figure" {
+		figure := b.genFigure(directive)
+		*sectionLines = append(*sectionLines, figure...)
+	}
+	if isInlineSVG(b.CurrLine) {
+		b.CurrLine = b.readInlineSVG(section) // appended as a body line on the next call
+	}
+	if isBodymatter(section) {
+		b.checkMergedChapter(section, *afterTocEntry)
+	}
+	*afterTocEntry = false
+	if directive := b.directive(); directive.Name == "tocentry" {
+		b.CurrLine = b.genTocEntry(section, directive) // appended as a body line on the next call
+		*afterTocEntry = true
+	}
+	if directive := b.directive(); directive.Name == "image" {
+		b.CurrLine = b.genImage(section, directive) // appended as a body line on the next call
+	}
+	for directive := b.directive(); directive.Name == "footnote"; directive = b.directive() {
+		b.readFootnote(directive) // collected into the notes section, see GenNotesSection
+	}
+	if directive := b.directive(); directive.Name == "spoiler" || directive.Name == "endspoiler" {
+		b.CurrLine = b.genSpoiler(directive) // appended as a body line on the next call
+	}
+	return !isDirective(b.CurrLine)
+}
+
 // GenCopyrightSection generates the mandatory copyright section file.
 // On entry, currLine should contain the directive <!--copyright-->.
-func (b *InputBuffer) GenCopyrightSection(currDate string) {
-	if b.CurrLine != "<!--copyright-->" {
-		panic("epubgen: <!--copyright--> directive expected")
+func (b *InputBuffer) GenCopyrightSection(currDate string) (err error) {
+	defer catch(&err)
+	directive := b.directive()
+	switch directive.Name {
+	case "copyright":
+	default:
+		if bodyDirectives[directive.Name] {
+			failAt(directive.Line, "<!--%s--> is only allowed inside the body of a section", directive.Name)
+		}
+		fail("<!--copyright--> directive expected")
 	}
-	b.NextLine()
+	b.checkCopyrightAttributes()
+	b.nextLine()
 
 	section := SectionData{
 		ID:       "copyright",
-		EpubType: "copyright-page",
+		EpubType: epubtype.CopyrightPage,
 		Heading:  "Copyright",
 	}
+	b.combineFrontMatter(&section)
 	b.sections = append(b.sections, section)
+	b.TraceSection(directive, section)
 
 	fileName := section.ID + ".xhtml"
-	fmt.Printf("Generating file %s (%s) ... ", fileName, section.Heading)
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
 
-	outfile := fileutil.CreateFile(filepath.Join(textDirSpec, fileName))
+	outfile := b.createSectionFile(section)
 	defer outfile.Close()
 
-	// Read in the lines making up the section and stop when another directive line is encountered.
-	sectionLines := make([]string, 0, 50)
-	for {
-		sectionLines = append(sectionLines, b.CurrLine)
-		b.NextLine()
-		if strings.HasPrefix(b.CurrLine, "<!--") {
-			break
-		}
-	}
+	sectionLines := b.readSectionLines(section)
+
+	b.processSection(section, sectionLines)
 
 	// Struct to pass to the template
-	data := standardTemplateData{
-		Title:       b.attributes["title"],
+	isbn, hasISBN := b.attributes.lookup("isbn")
+	rights, hasRights := b.attributes.lookup("rights")
+	data := copyrightTemplateData{
+		pageSetup:   b.page,
+		Title:       b.attributes.get("title"),
 		ID:          section.ID,
 		EpubType:    section.EpubType,
-		Lines:       sectionLines,
+		Lines:       joinPreformatted(sectionLines),
 		IsCopyright: true,
 		Date:        currDate,
+		Publisher:   b.attributes.get("publisher"),
+		HasISBN:     hasISBN,
+		ISBN:        isbn,
+		HasRights:   hasRights,
+		Rights:      rights,
+		Conformance: b.conformance,
 	}
-	if err := tmpl.ExecuteTemplate(outfile, frontmatterTemplate, data); err != nil {
-		panic(err)
+	b.render(outfile, fileName, b.copyrightTemplateName, data)
+	if b.copyrightTemplateName == copyrightTemplate {
+		b.RegisterFeature("copyright template", true, "")
+	} else {
+		b.RegisterFeature("copyright template", false, "copyright.gohtml missing from templates_dir, used frontmatter.gohtml")
 	}
 
-	fmt.Println("done")
+	fmt.Fprintln(b.out, "done")
+	return nil
 }
 
 // GenFrontMatterSection generates one of the various frontmatter sections file.
-// On entry, currLine contains the first line of this section, either <h1>, <h2> or <h3> tag.
-func (b *InputBuffer) GenFrontMatterSection(section SectionData) {
+// On entry, currLine contains the first line of this section, one of the <h1> to <h6> tags.
+func (b *InputBuffer) GenFrontMatterSection(section SectionData) (err error) {
+	defer catch(&err)
+	b.combineFrontMatter(&section)
 	fileName := section.ID + ".xhtml"
-	fmt.Printf("Generating file %s (%s) ... ", fileName, section.Heading)
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
 
-	outfile := fileutil.CreateFile(filepath.Join(textDirSpec, fileName))
+	outfile := b.createSectionFile(section)
 	defer outfile.Close()
 
-	// Read in the lines making up the section and stop when another directive line is encountered.
-	sectionLines := make([]string, 0, 50)
-	for {
-		sectionLines = append(sectionLines, b.CurrLine)
-		b.NextLine()
-		if b.CurrLine == "<!--figure-->" {
-			figure := b.genFigure()
-			sectionLines = append(sectionLines, figure)
-		}
-		if strings.HasPrefix(b.CurrLine, "<!--") {
-			break
-		}
-	}
+	sectionLines := b.readSectionLines(section)
+
+	b.processSection(section, sectionLines)
 
 	// Struct to pass to the template
 	data := standardTemplateData{
-		Title:    b.attributes["title"],
-		ID:       section.ID,
-		EpubType: section.EpubType,
-		Lines:    sectionLines,
-	}
-	if err := tmpl.ExecuteTemplate(outfile, frontmatterTemplate, data); err != nil {
-		panic(err)
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+		Lines:     joinPreformatted(sectionLines),
 	}
+	b.render(outfile, fileName, frontmatterTemplate, data)
 
-	fmt.Println("done")
+	fmt.Fprintln(b.out, "done")
+	return nil
 }
 
 // GenBodyMatterSection generates the bodymatter (part or chapter) section file.
-// On entry, currLine contains the first line of this section, either <h1>, <h2> or <h3> tag.
-func (b *InputBuffer) GenBodyMatterSection(section SectionData) {
+// On entry, currLine contains the first line of this section, one of the <h1> to <h6> tags.
+func (b *InputBuffer) GenBodyMatterSection(section SectionData) (err error) {
+	defer catch(&err)
 	fileName := section.ID + ".xhtml"
-	fmt.Printf("Generating file %s (%s) ... ", fileName, section.Heading)
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
 
-	outfile := fileutil.CreateFile(filepath.Join(textDirSpec, fileName))
+	outfile := b.createSectionFile(section)
 	defer outfile.Close()
 
-	// Read in the lines making up the section and stop when another directive line is encountered.
-	sectionLines := make([]string, 0, 50)
-	for {
-		sectionLines = append(sectionLines, b.CurrLine)
-		b.NextLine()
-		if b.CurrLine == "<!--figure-->" {
-			figure := b.genFigure()
-			sectionLines = append(sectionLines, figure)
-		}
-		if strings.HasPrefix(b.CurrLine, "<!--") {
-			break
-		}
-	}
+	sectionLines := b.readSectionLines(section)
+
+	b.processSection(section, sectionLines)
 
 	// Struct to pass to the template
 	data := standardTemplateData{
-		Title:    b.attributes["title"],
-		ID:       section.ID,
-		EpubType: section.EpubType,
-		Lines:    sectionLines,
-	}
-	if err := tmpl.ExecuteTemplate(outfile, bodymatterTemplate, data); err != nil {
-		panic(err)
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+		Lines:     joinPreformatted(sectionLines),
 	}
+	b.render(outfile, fileName, bodymatterTemplate, data)
 
-	fmt.Println("done")
+	fmt.Fprintln(b.out, "done")
+	return nil
 }
 
-// GenBackMatterSection generates the copyright section file.
-// On entry, currLine contains the first line of this section, either <h1>, <h2> or <h3> tag.
-func (b *InputBuffer) GenBackMatterSection(section SectionData) {
+// GenBackMatterSection generates a backmatter section file.
+// On entry, currLine contains the first line of this section, one of the <h1> to <h6> tags.
+func (b *InputBuffer) GenBackMatterSection(section SectionData) (err error) {
+	defer catch(&err)
 	fileName := section.ID + ".xhtml"
-	fmt.Printf("Generating file %s (%s) ... ", fileName, section.Heading)
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
 
-	outfile := fileutil.CreateFile(filepath.Join(textDirSpec, fileName))
+	outfile := b.createSectionFile(section)
 	defer outfile.Close()
 
-	// Read in the lines making up the section and stop when another directive line is encountered.
-	sectionLines := make([]string, 0, 50)
-	for {
-		sectionLines = append(sectionLines, b.CurrLine)
-		b.NextLine()
-		if b.CurrLine == "<!--figure-->" {
-			figure := b.genFigure()
-			sectionLines = append(sectionLines, figure)
-		}
-		if strings.HasPrefix(b.CurrLine, "<!--") {
-			break
-		}
-	}
+	sectionLines := b.readSectionLines(section)
+
+	b.processSection(section, sectionLines)
 
 	// Struct to pass to the template
 	data := standardTemplateData{
-		Title:    b.attributes["title"],
-		ID:       section.ID,
-		EpubType: section.EpubType,
-		Lines:    sectionLines,
-	}
-	if err := tmpl.ExecuteTemplate(outfile, backmatterTemplate, data); err != nil {
-		panic(err)
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+		Role:      section.EpubType.Role(),
+		Lines:     joinPreformatted(sectionLines),
 	}
+	b.render(outfile, fileName, backmatterTemplate, data)
 
-	fmt.Println("done")
+	fmt.Fprintln(b.out, "done")
+	return nil
 }
 
 // PartSectionData holds the list of part sections with their chapter sections.
@@ -396,6 +768,7 @@ type PartSectionData struct {
 }
 
 type navTemplateData struct {
+	pageSetup
 	Title           string
 	FrontSections   []SectionData
 	HasParts        bool
@@ -403,237 +776,460 @@ type navTemplateData struct {
 	ChapterSections []SectionData
 	BackSections    []SectionData
 	Guides          []SectionData
+	Start           *SectionData
+}
+
+// partitionSections splits the sections into the frontmatter before the first part or chapter, the run of
+// parts and chapters, and the backmatter after it. The run is returned as the parts with their chapters when
+// it starts with a part, or else as the chapters. Each part takes the chapters up to the next part.
+func partitionSections(sections []SectionData) (front []SectionData, parts []PartSectionData, chapters, back []SectionData) {
+	start := 0
+	for start < len(sections) && !isBodymatter(sections[start]) {
+		start++
+	}
+	end := start
+	for end < len(sections) && isBodymatter(sections[end]) {
+		end++
+	}
+	front, back = sections[:start], sections[end:]
+	if start == end || sections[start].EpubType != epubtype.Part {
+		return front, nil, sections[start:end], back
+	}
+
+	parts = make([]PartSectionData, 0, 10)
+	for index := start; index < end; {
+		next := index + 1
+		for next < end && sections[next].EpubType != epubtype.Part {
+			next++
+		}
+		parts = append(parts, PartSectionData{Part: sections[index], Chapters: sections[index+1 : next]})
+		index = next
+	}
+	return front, parts, nil, back
 }
 
 // GenNAVFile generates the NAV (TOC) file (required for EPUB3).
-func (b *InputBuffer) GenNAVFile() {
+func (b *InputBuffer) GenNAVFile() (err error) {
+	defer catch(&err)
 	fileName := "nav.xhtml"
-	fmt.Printf("Generating file %s (TOC) ... ", fileName)
+	fmt.Fprintf(b.out, "Generating file %s (TOC) ... ", fileName)
 
-	outfile := fileutil.CreateFile(filepath.Join(textDirSpec, fileName))
+	outfile, err := fileutil.CreateFile(filepath.Join(b.textDirSpec, fileName))
+	check(err)
 	defer outfile.Close()
 
-	// Get the slice of 'sections' that forms the frontmatter
-	var index int
-	var section SectionData
-	for index, section = range b.sections {
-		if section.EpubType == "part" || section.EpubType == "chapter" {
-			break
-		}
-	}
-	frontSections := b.sections[:index]
-
-	// Flag indicating whether this book contains parts and chapters or just chapters
-	hasParts := section.EpubType == "part"
-
-	var partSections []PartSectionData
-	var chapterSections []SectionData
-	var startIndex int
-	if hasParts {
-		// Get the slice of 'sections' that forms the parts and chapters
-		firstTime := true
-		var currPart SectionData
-		for {
-			section = b.sections[index]
-			if section.EpubType == "part" {
-				if firstTime {
-					firstTime = false
-					partSections = make([]PartSectionData, 0, 10)
-					currPart = section
-					startIndex = index + 1
-				} else {
-					partSection := PartSectionData{
-						Part:     currPart,
-						Chapters: b.sections[startIndex:index],
-					}
-					partSections = append(partSections, partSection)
-					currPart = section
-					startIndex = index + 1
-				}
-			} else if section.EpubType != "chapter" {
-				partSection := PartSectionData{
-					Part:     currPart,
-					Chapters: b.sections[startIndex:index],
-				}
-				partSections = append(partSections, partSection)
-				break
-			}
-			index++
-		}
-	} else {
-		// Get the slice of 'sections' that forms the chapters (no parts)
-		startIndex := index
-		for ; b.sections[index].EpubType != "chapter"; index++ {
-			break
-		}
-		chapterSections = b.sections[startIndex:index]
-	}
+	sections := b.tocSections()
 
-	// Get the slice of 'sections' that forms the backmatter
-	backSections := b.sections[index:]
+	frontSections, partSections, chapterSections, backSections := partitionSections(sections)
+	hasParts := len(partSections) > 0
 
 	// Struct to pass to the template
 	data := navTemplateData{
-		Title:           b.attributes["title"],
+		pageSetup:       b.page,
+		Title:           b.attributes.get("title"),
 		FrontSections:   frontSections,
 		HasParts:        hasParts,
 		PartSections:    partSections,
 		ChapterSections: chapterSections,
 		BackSections:    backSections,
-		Guides:          b.guides,
+		Guides:          b.tocLabels(b.guides),
+		Start:           b.StartSection(),
 	}
 
-	if err := tmpl.ExecuteTemplate(outfile, navTemplate, data); err != nil {
-		panic(err)
+	b.render(outfile, fileName, navTemplate, data)
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
+
+// tocOptionalPages lists the generated pages which the book may leave out of the TOC, with the attribute
+// which does so when set to false. The pages stay in the spine and the landmarks whatever the attribute.
+var tocOptionalPages = []struct{ ID, Attribute string }{
+	{"cover", "toc-cover"},
+	{"titlepage", "toc-titlepage"},
+	{"copyright", "toc-copyright"},
+}
+
+// tocSections returns the sections listed in nav.xhtml and toc.ncx: the sections of the spine less the pages
+// left out by their toc- attribute, with the appendices grouped, the sections with a parent nested under it
+// and the labels shortened.
+func (b *InputBuffer) tocSections() []SectionData {
+	hidden := make(map[string]bool)
+	for _, page := range tocOptionalPages {
+		if value, exists := b.attributes.lookup(page.Attribute); exists {
+			listed, ok := parseBool(value)
+			if !ok {
+				fail("attribute '%s' must be 'true' or 'false', got '%s'", page.Attribute, value)
+			}
+			hidden[page.ID] = !listed
+		}
+	}
+	sections := make([]SectionData, 0, len(b.sections))
+	for _, section := range b.sections {
+		if !hidden[section.ID] {
+			sections = append(sections, section)
+		}
+	}
+	return b.tocLabels(nestUnderParents(b.groupSections(sections)))
+}
+
+// tocLabels returns a copy of the sections with the headings and the TOC entry labels recased as set by
+// toc_case and shortened to the configured maximum label length. The headings inside the sections
+// themselves are left as they are.
+func (b *InputBuffer) tocLabels(sections []SectionData) []SectionData {
+	if b.parms.MaxLabel == 0 && (b.parms.TOCCase == "" || b.parms.TOCCase == "preserve") {
+		return sections
+	}
+	labelled := make([]SectionData, len(sections))
+	for i, section := range sections {
+		section.Heading = b.tocLabel(section.Heading)
+		if len(section.Entries) > 0 {
+			entries := make([]TocEntry, len(section.Entries))
+			for j, entry := range section.Entries {
+				entry.Label = b.tocLabel(entry.Label)
+				entries[j] = entry
+			}
+			section.Entries = entries
+		}
+		if len(section.Children) > 0 {
+			section.Children = b.tocLabels(section.Children)
+		}
+		labelled[i] = section
 	}
+	return labelled
+}
 
-	fmt.Println("done")
+// tocLabel returns the label of a TOC entry recased, then shortened, as set by the config.
+func (b *InputBuffer) tocLabel(label string) string {
+	label = textutil.CaseLabel(label, b.parms.TOCCase, b.page.Lang, b.parms.TOCCaseProtected)
+	return textutil.TruncateLabel(label, b.parms.MaxLabel)
 }
 
 type ncxTemplateData struct {
+	packageLayout
 	UUID     string
 	Title    string
+	Depth    int
 	Sections []SectionData
 }
 
 // GenNCXFile generates the NCX file (for EPUB2 compatibility).
-func (b *InputBuffer) GenNCXFile() {
+func (b *InputBuffer) GenNCXFile() (err error) {
+	defer catch(&err)
 	fileName := "toc.ncx"
-	fmt.Printf("Generating file %s (NCX) ... ", fileName)
+	fmt.Fprintf(b.out, "Generating file %s (NCX) ... ", fileName)
 
-	outfile := fileutil.CreateFile(filepath.Join(packageDirSpec, fileName))
+	outfile, err := fileutil.CreateFile(filepath.Join(b.packageDirSpec, fileName))
+	check(err)
 	defer outfile.Close()
 
-	// Struct to pass to the template
-	data := ncxTemplateData{
-		UUID:     parm.BookUUID,
-		Title:    b.attributes["title"],
-		Sections: b.sections,
-	}
+	b.render(outfile, fileName, ncxTemplate, b.ncxData())
 
-	if err := tmpl.ExecuteTemplate(outfile, ncxTemplate, data); err != nil {
-		panic(err)
-	}
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
 
-	fmt.Println("done")
+// ncxData returns the data passed to the NCX template.
+func (b *InputBuffer) ncxData() ncxTemplateData {
+	sections := b.tocSections()
+	return ncxTemplateData{
+		packageLayout: b.layout,
+		UUID:          b.bookUUID,
+		Title:         b.attributes.get("title"),
+		Depth:         tocDepth(sections),
+		Sections:      sections,
+	}
 }
 
 type opfTemplateData struct {
-	UUID        string
-	HasISBN     bool
-	ISBN        string
-	Language    string
-	Title       string
-	TitleSort   string
-	Author      string
-	AuthorSort  string
-	HasSeries   bool
-	SeriesTitle string
-	SeriesIndex string
-	Publisher   string
-	Description string
-	Subjects    []string
-	HasRights   bool
-	Rights      string
-	Created     string
-	Modified    string
-	CoverImage  ImageData
-	// Images      []ImageData
-	Images   map[string]ImageData
-	Sections []SectionData
-	Guides   []SectionData
+	packageLayout
+	UUID            string
+	HasISBN         bool
+	ISBN            string
+	Language        string
+	Title           string
+	TitleSort       string
+	Author          string
+	AuthorSort      string
+	Contributors    []Contributor // the author first, see CheckContributors
+	HasSeries       bool
+	SeriesTitle     string
+	SeriesIndex     string
+	Collection      *collectionData // the series as an EPUB3 collection, nil without a series
+	Publisher       string
+	Description     string
+	Subjects        []string
+	HasRights       bool
+	Rights          string
+	Created         string
+	Modified        string
+	CoverImage      ImageData
+	Images          []ImageData
+	Resources       []ResourceData
+	Sections        []SectionData
+	PageProgression string
+	Conformance     *conformanceData
+	Accessibility   []a11yProperty // the schema.org accessibility metadata, see accessibilityProperties
+	Provenance      string
+	Start           *SectionData
+	Guides          []SectionData
+	Stylesheet      string // the file name of the stylesheet in the styles directory
+	ExtraStylesheet string // the stylesheet of the <!--styles--> block, "" if none
+	NCX             string // the path of the NCX file from the package directory
+	RenditionLayout string // the rendition:layout of the package, only set when the book has several renditions
 }
 
 // GenOPFFile generates the package file (package.opf).
-func (b *InputBuffer) GenOPFFile() {
+func (b *InputBuffer) GenOPFFile() (err error) {
+	defer catch(&err)
 	fileName := "package.opf"
-	fmt.Printf("Generating file %s (PACKAGE file) ... ", fileName)
+	fmt.Fprintf(b.out, "Generating file %s (PACKAGE file) ... ", fileName)
 
-	outfile := fileutil.CreateFile(filepath.Join(packageDirSpec, fileName))
+	outfile, err := fileutil.CreateFile(filepath.Join(b.packageDirSpec, fileName))
+	check(err)
 	defer outfile.Close()
 
-	isbn, hasISBN := b.attributes["isbn"]
-	series, hasSeries := b.attributes["series"]
-	rights, hasRights := b.attributes["rights"]
-	description := strings.Replace(b.attributes["description"], "<", "&lt;", -1)
+	b.render(outfile, fileName, opfTemplate, b.opfData())
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
+
+// opfData returns the data passed to the package template for the default rendition.
+func (b *InputBuffer) opfData() opfTemplateData {
+	isbn, hasISBN := b.attributes.lookup("isbn")
+	series, hasSeries := b.attributes.lookup("series")
+	rights, hasRights := b.attributes.lookup("rights")
+	description := strings.Replace(b.attributes.get("description"), "<", "&lt;", -1)
 	description = strings.Replace(description, ">", "&gt;", -1)
 
 	// Struct to pass to the template
 	data := opfTemplateData{
-		UUID:        parm.BookUUID,
-		HasISBN:     hasISBN,
-		ISBN:        isbn,
-		Language:    b.attributes["language"],
-		Title:       b.attributes["title"],
-		TitleSort:   b.attributes["title-sort"],
-		Author:      b.attributes["author"],
-		AuthorSort:  b.attributes["author-sort"],
-		HasSeries:   hasSeries,
-		SeriesTitle: series,
-		SeriesIndex: b.attributes["series-index"],
-		Publisher:   b.attributes["publisher"],
-		Description: description,
-		Subjects:    strings.Split(b.attributes["subject"], ", "),
-		HasRights:   hasRights,
-		Rights:      rights,
-		Created:     b.attributes["created"],
-		Modified:    b.attributes["modified"],
-		CoverImage:  b.coverImage,
-		Images:      b.images,
-		Sections:    b.sections,
-		Guides:      b.guides,
+		packageLayout:   b.layout,
+		UUID:            b.bookUUID,
+		HasISBN:         hasISBN,
+		ISBN:            isbn,
+		Language:        b.attributes.get("language"),
+		Title:           b.attributes.get("title"),
+		TitleSort:       b.attributes.get("title-sort"),
+		Author:          b.attributes.get("author"),
+		AuthorSort:      b.attributes.get("author-sort"),
+		Contributors:    b.contributors,
+		HasSeries:       hasSeries,
+		SeriesTitle:     series,
+		SeriesIndex:     b.attributes.get("series-index"),
+		Collection:      b.collection,
+		Publisher:       b.attributes.get("publisher"),
+		Description:     description,
+		Subjects:        strings.Split(b.attributes.get("subject"), ", "),
+		HasRights:       hasRights,
+		Rights:          rights,
+		Created:         b.attributes.get("created"),
+		Modified:        b.attributes.get("modified"),
+		CoverImage:      b.coverImage,
+		Images:          b.sortedImages(),
+		Resources:       b.resources,
+		PageProgression: b.PageProgression(),
+		Conformance:     b.conformance,
+		Accessibility:   b.accessibilityProperties(),
+		Provenance:      b.inputHash,
+		Start:           b.StartSection(),
+		Sections:        b.manifestSections(),
+		Guides:          b.guides,
+		Stylesheet:      stylesheetFile,
+		ExtraStylesheet: b.page.ExtraStylesheet,
+		NCX:             "toc.ncx",
 	}
+	if len(b.parms.Renditions) > 0 {
+		data.RenditionLayout = b.parms.Renditions[0].Layout
+	}
+	return data
+}
 
-	if err := tmpl.ExecuteTemplate(outfile, opfTemplate, data); err != nil {
-		panic(err)
+// CheckManifestFiles checks that every file listed in the manifest exists in the target directory.
+func (b *InputBuffer) CheckManifestFiles() (err error) {
+	defer catch(&err)
+	fileSpecs := []string{
+		filepath.Join(b.packageDirSpec, b.layout.StylesDir, stylesheetFile),
+		filepath.Join(b.textDirSpec, "nav.xhtml"),
+		filepath.Join(b.packageDirSpec, "toc.ncx"),
+	}
+	if b.hasCoverImage() {
+		fileSpecs = append(fileSpecs, filepath.Join(b.packageDirSpec, b.layout.ImagesDir, b.coverImage.FileName))
+	}
+	if b.page.ExtraStylesheet != "" {
+		fileSpecs = append(fileSpecs, filepath.Join(b.packageDirSpec, b.layout.StylesDir, b.page.ExtraStylesheet))
+	}
+	for _, image := range b.sortedImages() {
+		fileSpecs = append(fileSpecs, filepath.Join(b.packageDirSpec, b.layout.ImagesDir, image.FileName))
+	}
+	for _, resource := range b.resources {
+		fileSpecs = append(fileSpecs, filepath.Join(b.packageDirSpec, filepath.FromSlash(resource.Href)))
+	}
+	for _, section := range b.manifestSections() {
+		fileSpecs = append(fileSpecs, filepath.Join(b.textDirSpec, section.ID+".xhtml"))
 	}
 
-	fmt.Println("done")
+	missing := make([]string, 0)
+	for _, fileSpec := range fileSpecs {
+		if _, err := os.Stat(fileSpec); err != nil {
+			missing = append(missing, fileSpec)
+		}
+	}
+	if len(missing) > 0 {
+		fail("files listed in the manifest are missing from the target directory:\n  %s",
+			strings.Join(missing, "\n  "))
+	}
+	return nil
 }
 
-// CopyStaticFiles copies	the control files, the stylesheet and the image files.
-func (b *InputBuffer) CopyStaticFiles() {
+// CopyStaticFiles copies	the control files, the stylesheet and the image files, and writes the stylesheet of
+// the <!--styles--> block.
+func (b *InputBuffer) CopyStaticFiles() (err error) {
+	defer catch(&err)
 	// <targetdir>/mimetype
-	sourceFileSpec := filepath.Join(parm.ResourceDir, "mimetype")
-	targetFileSpec := filepath.Join(targetDirSpec, "mimetype")
-	fileutil.CopyFile(sourceFileSpec, targetFileSpec)
+	sourceFileSpec := filepath.Join(b.parms.ResourceDir, "mimetype")
+	targetFileSpec := filepath.Join(b.targetDirSpec, "mimetype")
+	check(copyToPackage(sourceFileSpec, targetFileSpec))
 
 	// <targetdir>/META-INF/container.xml
-	sourceFileSpec = filepath.Join(parm.ResourceDir, "container.xml")
-	targetFileSpec = filepath.Join(targetDirSpec, "META-INF", "container.xml")
-	fileutil.CopyFile(sourceFileSpec, targetFileSpec)
+	b.genContainerFile()
+
+	// <targetdir>/OEBPS/Styles/stylesheet.css, from the book directory if the book has its own
+	targetFileSpec = filepath.Join(b.packageDirSpec, b.layout.StylesDir, stylesheetFile)
+	if b.bookHasStylesheet() {
+		sourceFileSpec = filepath.Join(b.sourceDirSpec, stylesheetFile)
+		check(b.copySourceToPackage(stylesheetFile, targetFileSpec))
+	} else {
+		sourceFileSpec = filepath.Join(b.parms.ResourceDir, stylesheetFile)
+		check(copyToPackage(sourceFileSpec, targetFileSpec))
+	}
+	b.rendered = append(b.rendered, RenderRecord{
+		File:     stylesheetFile,
+		Template: "(stylesheet)",
+		Source:   sourceFileSpec,
+	})
+	b.writeExtraStylesheet()
+
+	b.copyAssets()
+	return nil
+}
 
-	// <targetdir>/OEBPS/Styles/stylesheet.css
-	sourceFileSpec = filepath.Join(parm.ResourceDir, "stylesheet.css")
-	targetFileSpec = filepath.Join(packageDirSpec, "Styles", "stylesheet.css")
-	fileutil.CopyFile(sourceFileSpec, targetFileSpec)
+// CopyAssets copies the images and the files referenced from the stylesheet again, for a metadata-only build,
+// which reuses the section files of the last build but not its assets, since they may have been retouched.
+func (b *InputBuffer) CopyAssets() (err error) {
+	defer catch(&err)
+	b.copyAssets()
+	return nil
+}
 
+// copyAssets copies the images, or their placeholders, the files referenced from the stylesheet and the audio
+// and video files.
+func (b *InputBuffer) copyAssets() {
 	// <targetdir>/OEBPS/Images/*
-	sourceFileSpec = filepath.Join(sourceDirSpec, b.coverImage.FileName)
-	targetFileSpec = filepath.Join(packageDirSpec, "Images", b.coverImage.FileName)
-	fileutil.CopyFile(sourceFileSpec, targetFileSpec)
+	targetFileSpec := filepath.Join(b.packageDirSpec, b.layout.ImagesDir, b.coverImage.FileName)
+	if b.hasCoverImage() {
+		check(b.copySourceToPackage(b.coverImage.Source, targetFileSpec))
+	}
 
-	for _, image := range b.images {
-		sourceFileSpec = filepath.Join(sourceDirSpec, image.FileName)
-		targetFileSpec = filepath.Join(packageDirSpec, "Images", image.FileName)
-		fileutil.CopyFile(sourceFileSpec, targetFileSpec)
+	for _, image := range b.sortedImages() {
+		targetFileSpec = filepath.Join(b.packageDirSpec, b.layout.ImagesDir, image.FileName)
+		if b.placeholders[image.FileName] {
+			outfile, err := fileutil.CreateFile(targetFileSpec)
+			check(err)
+			err = writePlaceholder(outfile, image)
+			outfile.Close()
+			check(err)
+			continue
+		}
+		check(b.copySourceToPackage(image.Source, targetFileSpec))
+	}
+
+	// <targetdir>/OEBPS/... files referenced from the stylesheet, and <targetdir>/OEBPS/Media/* files of the 'media' attribute
+	for _, resource := range b.resources {
+		targetFileSpec = filepath.Join(b.packageDirSpec, filepath.FromSlash(resource.Href))
+		if resource.source != "" {
+			check(b.copySourceToPackage(resource.source, targetFileSpec))
+			continue
+		}
+		check(copyToPackage(resource.sourceSpec, targetFileSpec))
+	}
+}
+
+// copyToPackage copies the file into the generated book directory, refusing the diagnostic and bookkeeping
+// files of a build, see isExcludedFile, so that none of them is ever packaged.
+func copyToPackage(sourceFileSpec, targetFileSpec string) error {
+	if isExcludedFile(targetFileSpec) {
+		return fmt.Errorf("%s is the name of a build file, which is never packaged; rename it", filepath.Base(targetFileSpec))
+	}
+	return fileutil.CopyFile(sourceFileSpec, targetFileSpec)
+}
+
+// copySourceToPackage copies the named file of the book directory, read through sourceFS, into the generated
+// book directory, like copyToPackage.
+func (c *Context) copySourceToPackage(name, targetFileSpec string) error {
+	if isExcludedFile(targetFileSpec) {
+		return fmt.Errorf("%s is the name of a build file, which is never packaged; rename it", filepath.Base(targetFileSpec))
+	}
+	infile, err := c.sourceFS.Open(name)
+	if err != nil {
+		return err
+	}
+	defer infile.Close()
+	return fileutil.WriteFile(targetFileSpec, infile)
+}
+
+// processSection runs the per-section passes over the collected lines of a section.
+// The lines are rewritten in place where needed, so this must run before the section is rendered.
+func (b *InputBuffer) processSection(section SectionData, lines []string) {
+	b.rewriteNoteRefs(section, lines)
+	b.rewriteAssetRefs(section, lines)
+	b.addImageSizes(lines)
+	b.recordAssets(section, lines)
+	if b.abbrevs != nil {
+		b.abbrevs.expand(lines)
+	}
+	if b.inlineStyles != nil {
+		b.inlineStyles.scan(section, lines)
+	}
+	b.bodies[section.ID] = lines
+	b.wordCounts[section.ID] = countWords(lines)
+	if b.glyphs != nil {
+		b.glyphs.scan(section, lines)
+	}
+	if b.kindle != nil {
+		b.kindle.scan(section, lines, b.sourceLineOf)
+	}
+	if b.lint != nil {
+		b.lint.scan(section, lines, b.sourceLinesBefore(lines))
 	}
 }
 
 // genFigure generates a <figure> HTML element whenever the directive <!--figure--> is encountered.
 // It expects that the next line after the directive is a single line comprising an image file name.
-// This image file must be one of the images specified in the "images" attribute.
-// Returns the generated HTML line.
-func (b *InputBuffer) genFigure() string {
-	var line string
-	b.NextLine()
-	line = strings.TrimSpace(b.CurrLine)
-	imageFile, caption, _ := strings.Cut(line, " ")
-	if _, exists := b.images[imageFile]; exists {
-		line = `<figure><img src="../Images/` + imageFile + `" alt="` + caption + `" /></figure>`
-	} else {
-		panic(fmt.Sprintf("epubgen: image file %s is not defined", imageFile))
+// This image file must be the cover image or one of the images specified in the "images" attribute.
+// With the argument inline, the image is set inline with the text instead, see genInlineFormula.
+// A long description may follow the image line, see readLongDesc.
+// Returns the generated HTML lines.
+func (b *InputBuffer) genFigure(directive Directive) []string {
+	b.nextLine()
+	imageFile, caption, _ := strings.Cut(strings.TrimSpace(b.CurrLine), " ")
+	if !b.isPackagedImage(imageFile) {
+		fail("image file %s is not defined", imageFile)
+	}
+	b.setCaption(imageFile, caption)
+	b.addImageRef(imageFile, b.sections[len(b.sections)-1])
+	b.Next()
+
+	desc, described := b.readLongDesc(directive, imageFile, caption)
+	switch {
+	case directive.Bool("inline") && described:
+		failAt(directive.Line, "an inline <!--figure--> cannot have a long description")
+	case directive.Bool("inline"):
+		image, _ := b.packagedImage(imageFile)
+		return []string{b.genInlineFormula(image, caption)}
+	case described:
+		return b.genDescribedFigure(imageFile, caption, desc)
 	}
-	b.NextLine()
-	return line
+	return []string{`<figure><img src="` + b.imageHref(imageFile) + `" alt="` + caption + `" /></figure>`}
 }
@@ -0,0 +1,122 @@
+package gen
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+func TestStampTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"after the XML declaration", "\n<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<html/>",
+			"<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<!-- ep3gen: nav.goxml (book templates) -->\n<html/>"},
+		{"no XML declaration", "<html/>", "<!-- ep3gen: nav.goxml (book templates) -->\n<html/>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(stampTemplate([]byte(test.content), "nav.goxml", "book templates")); got != test.want {
+				t.Errorf("stampTemplate = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// testSections returns the sections of the given epub:types, with IDs such as "chapter2" numbering the
+// sections from 1.
+func testSections(types ...epubtype.Term) []SectionData {
+	sections := make([]SectionData, 0, len(types))
+	for i, epubType := range types {
+		sections = append(sections, SectionData{ID: fmt.Sprintf("%s%d", epubType, i+1), EpubType: epubType})
+	}
+	return sections
+}
+
+// sectionIDs returns the IDs of the sections joined by spaces.
+func sectionIDs(sections []SectionData) string {
+	ids := make([]string, 0, len(sections))
+	for _, section := range sections {
+		ids = append(ids, section.ID)
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestPartitionSections(t *testing.T) {
+	const (
+		foreword  = epubtype.Foreword
+		part      = epubtype.Part
+		chapter   = epubtype.Chapter
+		afterword = epubtype.Afterword
+	)
+	tests := []struct {
+		name     string
+		sections []SectionData
+		front    string
+		parts    []string // each part followed by its chapters
+		chapters string
+		back     string
+	}{
+		{"no sections", testSections(), "", nil, "", ""},
+		{"frontmatter only", testSections(foreword), "foreword1", nil, "", ""},
+		{"chapters only", testSections(chapter, chapter, chapter), "", nil, "chapter1 chapter2 chapter3", ""},
+		{"chapters with backmatter", testSections(foreword, chapter, chapter, afterword),
+			"foreword1", nil, "chapter2 chapter3", "afterword4"},
+		{"chapters without backmatter", testSections(foreword, chapter, chapter),
+			"foreword1", nil, "chapter2 chapter3", ""},
+		{"parts and chapters", testSections(foreword, part, chapter, chapter, part, chapter, afterword),
+			"foreword1", []string{"part2 chapter3 chapter4", "part5 chapter6"}, "", "afterword7"},
+		{"parts without backmatter", testSections(part, chapter, part, chapter),
+			"", []string{"part1 chapter2", "part3 chapter4"}, "", ""},
+		{"a part last", testSections(part, chapter, part), "", []string{"part1 chapter2", "part3"}, "", ""},
+		{"a part last with backmatter", testSections(part, chapter, part, afterword),
+			"", []string{"part1 chapter2", "part3"}, "", "afterword4"},
+		// Without a part or a chapter, all the sections are before the first one.
+		{"no bodymatter", testSections(foreword, afterword), "foreword1 afterword2", nil, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			front, parts, chapters, back := partitionSections(test.sections)
+			if got := sectionIDs(front); got != test.front {
+				t.Errorf("front = %q, want %q", got, test.front)
+			}
+			gotParts := make([]string, 0, len(parts))
+			for _, part := range parts {
+				gotParts = append(gotParts, sectionIDs(append([]SectionData{part.Part}, part.Chapters...)))
+			}
+			if strings.Join(gotParts, " | ") != strings.Join(test.parts, " | ") {
+				t.Errorf("parts = %q, want %q", gotParts, test.parts)
+			}
+			if got := sectionIDs(chapters); got != test.chapters {
+				t.Errorf("chapters = %q, want %q", got, test.chapters)
+			}
+			if got := sectionIDs(back); got != test.back {
+				t.Errorf("back = %q, want %q", got, test.back)
+			}
+		})
+	}
+}
+
+func TestPrefixHeadingLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		empty bool
+		want  string
+	}{
+		{"<h1>Maps</h1>", false, "<h1>Appendix A: Maps</h1>"},
+		{`  <h2 class="appendix" id="maps">The <i>Hispaniola</i></h2>`, false,
+			`<h2 class="appendix" id="maps">Appendix A: The <i>Hispaniola</i></h2>`},
+		{"<h1>&#160;</h1>", true, "<h1>Appendix A</h1>"},
+		{"<h1></h1>", true, "<h1>Appendix A</h1>"},
+		{"<p>Maps</p>", false, "<p>Maps</p>"},
+	}
+	for _, test := range tests {
+		if got := prefixHeadingLine(test.line, "Appendix A", test.empty); got != test.want {
+			t.Errorf("prefixHeadingLine(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 02-Sep-2023
+//
+// Audit for characters that may render as missing glyphs (tofu) on reading devices.
+
+package gen
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// defaultGlyphRanges is the whitelist used when the config parameter 'glyph_ranges' is not given:
+// Basic Latin, Latin-1 Supplement, Latin Extended-A/B, Latin Extended Additional and General Punctuation.
+const defaultGlyphRanges = "0000-024F,1E00-1EFF,2000-206F"
+
+// languageScripts maps the primary language subtag to the scripts a device is expected to support for it.
+var languageScripts = map[string][]*unicode.RangeTable{
+	"ar": {unicode.Arabic},
+	"el": {unicode.Greek},
+	"fa": {unicode.Arabic},
+	"he": {unicode.Hebrew},
+	"hi": {unicode.Devanagari},
+	"ja": {unicode.Han, unicode.Hiragana, unicode.Katakana},
+	"ko": {unicode.Hangul, unicode.Han},
+	"ru": {unicode.Cyrillic},
+	"th": {unicode.Thai},
+	"uk": {unicode.Cyrillic},
+	"zh": {unicode.Han},
+}
+
+// glyphHit records the occurrences of a single character outside the whitelist.
+type glyphHit struct {
+	char     rune
+	count    int
+	sections []string       // section IDs in order of first occurrence
+	perSect  map[string]int // occurrences per section ID
+}
+
+// glyphAudit holds the whitelist and the hits collected so far.
+type glyphAudit struct {
+	allowed []*unicode.RangeTable
+	hits    map[rune]*glyphHit
+	labels  map[string]string // section ID to heading, used in the report
+}
+
+// newGlyphAudit creates the glyph audit from the configured ranges and the book language.
+func newGlyphAudit(ranges, language string) *glyphAudit {
+	if ranges == "" {
+		ranges = defaultGlyphRanges
+	}
+	table := &unicode.RangeTable{}
+	for _, item := range strings.Split(ranges, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		loStr, hiStr, found := strings.Cut(item, "-")
+		if !found {
+			hiStr = loStr
+		}
+		lo, err1 := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(loStr), "U+"), 16, 32)
+		hi, err2 := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(hiStr), "U+"), 16, 32)
+		if err1 != nil || err2 != nil || lo > hi {
+			fail("invalid glyph range '%s' in config parameter 'glyph_ranges'", item)
+		}
+		table.R32 = append(table.R32, unicode.Range32{Lo: uint32(lo), Hi: uint32(hi), Stride: 1})
+	}
+	sort.Slice(table.R32, func(i, j int) bool { return table.R32[i].Lo < table.R32[j].Lo })
+
+	audit := &glyphAudit{
+		allowed: []*unicode.RangeTable{table},
+		hits:    make(map[rune]*glyphHit),
+		labels:  make(map[string]string),
+	}
+	primary, _, _ := strings.Cut(strings.ToLower(language), "-")
+	audit.allowed = append(audit.allowed, languageScripts[primary]...)
+	return audit
+}
+
+// scan checks the text content of the given section lines, ignoring the markup.
+// Character references (&#NNNN; and &#xHHHH;) are decoded before checking.
+func (a *glyphAudit) scan(section SectionData, lines []string) {
+	a.labels[section.ID] = section.Heading
+	for _, line := range lines {
+		for _, char := range html.UnescapeString(stripTags(line)) {
+			if unicode.IsSpace(char) || unicode.In(char, a.allowed...) {
+				continue
+			}
+			hit, exists := a.hits[char]
+			if !exists {
+				hit = &glyphHit{char: char, perSect: make(map[string]int)}
+				a.hits[char] = hit
+			}
+			if hit.perSect[section.ID] == 0 {
+				hit.sections = append(hit.sections, section.ID)
+			}
+			hit.perSect[section.ID]++
+			hit.count++
+		}
+	}
+}
+
+// report prints the per-character totals with their section locations.
+func (a *glyphAudit) report(out io.Writer) {
+	if len(a.hits) == 0 {
+		fmt.Fprintln(out, "\nGlyph audit: no characters outside the allowed ranges")
+		return
+	}
+
+	hits := make([]*glyphHit, 0, len(a.hits))
+	total := 0
+	for _, hit := range a.hits {
+		hits = append(hits, hit)
+		total += hit.count
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].char < hits[j].char })
+
+	fmt.Fprintf(out, "\nGlyph audit: %d character(s) outside the allowed ranges, %d occurrence(s)\n", len(hits), total)
+	for _, hit := range hits {
+		locations := make([]string, 0, len(hit.sections))
+		for _, id := range hit.sections {
+			locations = append(locations, fmt.Sprintf("%s \"%s\" (%d)", id, a.labels[id], hit.perSect[id]))
+		}
+		fmt.Fprintf(out, "  U+%04X %q: %d in %s\n", hit.char, hit.char, hit.count, strings.Join(locations, ", "))
+	}
+
+	// When the hits are concentrated in a few characters, a small symbol font is the cheapest fix.
+	if len(hits) <= 3 {
+		fmt.Fprintln(out, "  Suggestion: the hits are concentrated in a few characters; consider embedding a symbol font covering them or substituting them.")
+	}
+}
+
+// stripTags removes the HTML tags from the line, leaving only the text content.
+func stripTags(line string) string {
+	var sb strings.Builder
+	inTag := false
+	for _, char := range line {
+		switch {
+		case char == '<':
+			inTag = true
+		case char == '>' && inTag:
+			inTag = false
+		case !inTag:
+			sb.WriteRune(char)
+		}
+	}
+	return sb.String()
+}
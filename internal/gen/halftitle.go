@@ -0,0 +1,54 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 13-Dec-2023
+//
+// The half-title page, with just the title of the book.
+
+package gen
+
+import (
+	"fmt"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+type halftitleTemplateData struct {
+	pageSetup
+	Title    string
+	ID       string
+	EpubType epubtype.Term
+}
+
+// GenHalfTitleSection generates the half-title page for the <!--halftitle--> directive. The page is made
+// from the title attribute alone, so the directive takes no content lines.
+func (b *InputBuffer) GenHalfTitleSection(directive Directive) (err error) {
+	defer catch(&err)
+	if !b.hasTemplate(halftitleTemplate) {
+		fail("template %s not found in templates_dir", halftitleTemplate)
+	}
+	section := SectionData{
+		ID:       "halftitle",
+		EpubType: epubtype.HalfTitle,
+		Heading:  b.DefaultHeading("halftitle"),
+	}
+	b.combineFrontMatter(&section)
+	b.sections = append(b.sections, section)
+	b.TraceSection(directive, section)
+
+	fileName := section.ID + ".xhtml"
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
+
+	outfile := b.createSectionFile(section)
+	defer outfile.Close()
+
+	// Struct to pass to the template
+	data := halftitleTemplateData{
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+	}
+	b.render(outfile, fileName, halftitleTemplate, data)
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
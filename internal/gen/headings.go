@@ -0,0 +1,185 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 16-Sep-2023
+//
+// Section heading acquisition and the default headings used when a directive is followed by an empty heading.
+
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// headingAttrPrefix is the prefix of the per-book attributes overriding a default heading,
+// e.g. <meta name="default-heading.preamble" content="Author's Note"/>.
+const headingAttrPrefix = "default-heading."
+
+var (
+	// headingStartRegexp matches the start tag of a heading element, <h1> to <h6>.
+	headingStartRegexp = regexp.MustCompile(`^<h[1-6][\s>]`)
+
+	// headingRegexp matches a complete heading element and captures the level of the start and end tags
+	// and the content between them.
+	headingRegexp = regexp.MustCompile(`^<h([1-6])(?:\s[^>]*)?>(.*)</h([1-6])>$`)
+
+	// brRegexp matches a line break element.
+	brRegexp = regexp.MustCompile(`<br\s*/?>`)
+)
+
+// defaultHeadings holds the built-in English headings for the directives that allow an empty heading.
+var defaultHeadings = map[string]string{
+	"bibliography":     "Bibliography",
+	"acknowledgments":  "Acknowledgments",
+	"dedication":       "Dedication",
+	"epigraph":         "Epigraph",
+	"foreword":         "Foreword",
+	"introduction":     "Introduction",
+	"preface":          "Preface",
+	"prologue":         "Prologue",
+	"preamble":         "Preamble",
+	"afterword":        "Afterword",
+	"epilogue":         "Epilogue",
+	"appendix":         "Appendix",
+	"appendices":       "Appendices",
+	"about-the-author": "About the Author",
+	"also-by":          "Also by the Author",
+	"glossary":         "Glossary",
+	"colophon":         "Colophon",
+	"quicknav":         "Quick Navigation",
+	"halftitle":        "Half Title",
+	"loi":              "List of Illustrations",
+	"abbreviations":    "Abbreviations",
+	"warnings":         "Content Warnings",
+	"longdesc":         "Image Descriptions",
+	"footnote":         "Notes",
+}
+
+// CheckDefaultHeadings validates the default heading overrides from the config file and from the
+// per-book attributes, and returns an error if any of them refers to an unknown directive.
+func (b *InputBuffer) CheckDefaultHeadings() (err error) {
+	defer catch(&err)
+	directives := make([]string, 0, len(b.parms.DefaultHeadings))
+	for directive := range b.parms.DefaultHeadings {
+		directives = append(directives, directive)
+	}
+	sort.Strings(directives) // so that the same one is reported on every run
+	for _, directive := range directives {
+		if _, exists := defaultHeadings[directive]; !exists {
+			fail("config parameter 'default_headings' has unknown directive '%s' (expected one of %s)",
+				directive, knownHeadingDirectives())
+		}
+	}
+	bookOverrides := false
+	for _, name := range b.attributes.names {
+		if strings.HasPrefix(name, headingAttrPrefix) {
+			bookOverrides = true
+			directive := strings.TrimPrefix(name, headingAttrPrefix)
+			if _, exists := defaultHeadings[directive]; !exists {
+				fail("attribute '%s' has unknown directive '%s' (expected one of %s)",
+					name, directive, knownHeadingDirectives())
+			}
+		}
+	}
+
+	if len(b.parms.DefaultHeadings) > 0 || bookOverrides {
+		b.RegisterFeature("default heading overrides", true, "")
+	} else {
+		b.RegisterFeature("default heading overrides", false, "not configured")
+	}
+	return nil
+}
+
+// DefaultHeading returns the heading to use for the given directive when the source heading is empty.
+// The per-book attribute is consulted first, then the config file and finally the built-in default.
+func (b *InputBuffer) DefaultHeading(directive string) string {
+	if heading := b.attributes.get(headingAttrPrefix + directive); heading != "" {
+		return heading
+	}
+	if heading := b.parms.DefaultHeadings[directive]; heading != "" {
+		return heading
+	}
+	return defaultHeadings[directive]
+}
+
+// knownHeadingDirectives returns the sorted, comma-separated list of directives with a default heading.
+func knownHeadingDirectives() string {
+	directives := make([]string, 0, len(defaultHeadings))
+	for directive := range defaultHeadings {
+		directives = append(directives, directive)
+	}
+	sort.Strings(directives)
+	return strings.Join(directives, ", ")
+}
+
+// Heading returns the section heading from the current line, which must be the heading line following
+// the given directive. A directive or paragraph text found instead of the heading is an error, unless
+// the -permissive flag is given: then a numbered heading such as "Chapter 3" (or the default heading for
+// the directive) is synthesised and the current line is left to be read again as the first body line.
+func (b *InputBuffer) Heading(directive string) (_ string, err error) {
+	defer catch(&err)
+	if isHeadingLine(b.CurrLine) {
+		heading, ok := extractHeading(b.CurrLine)
+		if !ok {
+			b.fail("the %s heading must be a single <h1> to <h6> element on one line, found %s", directive, b.CurrLine)
+		}
+		return heading, nil
+	}
+
+	var problem string
+	if found, _, _ := parseDirective(b.CurrLine); isDirective(b.CurrLine) {
+		problem = fmt.Sprintf("directive <!--%s--> found where a %s heading (<h1> to <h6>) was expected",
+			found.Name, directive)
+	} else {
+		problem = fmt.Sprintf("paragraph text found where a heading was expected — did you forget the heading line? (after <!--%s-->)",
+			directive)
+	}
+	if !b.parms.Permissive {
+		b.fail("%s", problem)
+	}
+
+	heading := b.numberedHeading(directive)
+	b.warn("line %d: %s; using the heading \"%s\"", b.LineNo(), problem, heading)
+	b.CurrLine = "<h1>" + heading + "</h1>"
+	b.lineIndex-- // the next call to Next or NextLine reads the current line again
+	return heading, nil
+}
+
+// numberedHeading returns the heading synthesised for a section without a heading line: "Part N" or
+// "Chapter N" numbered in order of appearance, or the default heading for the other directives.
+func (b *InputBuffer) numberedHeading(directive string) string {
+	switch directive {
+	case "part", "chapter":
+		count := 1
+		for _, section := range b.sections {
+			if string(section.EpubType) == directive {
+				count++
+			}
+		}
+		return fmt.Sprintf("%s %d", strings.ToUpper(directive[:1])+directive[1:], count)
+	}
+	return b.DefaultHeading(directive)
+}
+
+// isHeadingLine returns true if the line starts an <h1> to <h6> element.
+func isHeadingLine(line string) bool {
+	return headingStartRegexp.MatchString(line)
+}
+
+// extractHeading extracts the plain text heading from the single line HTML element <hN>...</hN>, where N is
+// one of 1 to 6, for the TOC. The inline markup such as <i> and <span> is removed and a <br /> becomes a space,
+// while the character references such as &amp; are kept. Returns "" for the empty heading <hN>&#160;</hN>,
+// and false if the line is not a complete heading element.
+func extractHeading(line string) (string, bool) {
+	match := headingRegexp.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil || match[1] != match[3] {
+		return "", false
+	}
+	heading := stripTags(brRegexp.ReplaceAllString(match[2], " "))
+	heading = strings.Join(strings.Fields(heading), " ")
+	if heading == "&#160;" || heading == "&nbsp;" {
+		heading = ""
+	}
+	return heading, true
+}
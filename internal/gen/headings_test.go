@@ -0,0 +1,46 @@
+package gen
+
+import "testing"
+
+func TestExtractHeading(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{"<h1>Chapter 1</h1>", "Chapter 1", true},
+		{"<h2>The <i>Silmarillion</i> Problem</h2>", "The Silmarillion Problem", true},
+		{`<h3 class="title">The <span class="sc"><em>Nested</em> Tags</span></h3>`, "The Nested Tags", true},
+		{"<h4>Part One<br />The Voyage</h4>", "Part One The Voyage", true},
+		{"<h5>Line<br/>Break</h5>", "Line Break", true},
+		{"<h6>Salt &amp; Pepper &#8212; <b>Bold</b></h6>", "Salt &amp; Pepper &#8212; Bold", true},
+		{"<h1>&#160;</h1>", "", true},
+		{"<h3>&nbsp;</h3>", "", true},
+		{"<h2> <i>&#160;</i> </h2>", "", true},
+		{"<h1>Chapter 1</h2>", "", false},
+		{"<h1>Chapter 1", "", false},
+		{"<h7>Chapter 1</h7>", "", false},
+		{"<p>Chapter 1</p>", "", false},
+	}
+	for _, test := range tests {
+		got, ok := extractHeading(test.line)
+		if got != test.want || ok != test.ok {
+			t.Errorf("extractHeading(%q) = %q, %v, want %q, %v", test.line, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestIsHeadingLine(t *testing.T) {
+	for line, want := range map[string]bool{
+		"<h1>One</h1>":         true,
+		`<h6 class="x">Six`:    true,
+		"<h7>Seven</h7>":       false,
+		"<header>Top</header>": false,
+		"<hr />":               false,
+		"<p>Text</p>":          false,
+	} {
+		if got := isHeadingLine(line); got != want {
+			t.Errorf("isHeadingLine(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
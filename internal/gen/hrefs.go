@@ -0,0 +1,113 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 07-Oct-2023
+//
+// Rewriting of source-relative asset references to their location in the EPUB package.
+
+package gen
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// srcAttrRegexp matches the src attribute of the elements referring to image and media files.
+	srcAttrRegexp = regexp.MustCompile(`(<(?:img|audio|video|source)\b[^>]*?\bsrc=)("[^"]*"|'[^']*')`)
+
+	// pathAttrRegexp matches the attributes holding a path in the generated control files.
+	pathAttrRegexp = regexp.MustCompile(`\b(href|src|full-path)="([^"]*)"`)
+
+	// hrefAttrRegexp matches the href and xlink:href attributes of the SVG <image> element.
+	hrefAttrRegexp = regexp.MustCompile(`(<image\b[^>]*?\b(?:xlink:)?href=)("[^"]*"|'[^']*')`)
+)
+
+// rewriteAssetRefs rewrites bare file names in asset references (such as <img src="map.png"> or
+// <audio src="theme.mp3">) to the path where the file is placed in the package (../Images/map.png or
+// ../Media/theme.mp3), as well as the paths of the packaged files in the book directory (such as
+// Images/map.png). Other references which already contain a path,
+// remote URLs and data URIs are left alone. Fails if a bare file name is not packaged.
+func (b *InputBuffer) rewriteAssetRefs(section SectionData, lines []string) {
+	for i, line := range lines {
+		if !strings.Contains(line, "src=") && !strings.Contains(line, "href=") {
+			continue
+		}
+		line = b.rewriteAttrs(section, line, srcAttrRegexp)
+		lines[i] = b.rewriteAttrs(section, line, hrefAttrRegexp)
+	}
+}
+
+// rewriteAttrs rewrites the attribute values matched by the given regular expression.
+func (b *InputBuffer) rewriteAttrs(section SectionData, line string, attrRegexp *regexp.Regexp) string {
+	return attrRegexp.ReplaceAllStringFunc(line, func(match string) string {
+		parts := attrRegexp.FindStringSubmatch(match)
+		quote := parts[2][:1]
+		value := parts[2][1 : len(parts[2])-1]
+		if image, found := b.imageAtSource(value); found {
+			value = image.FileName // the path in the book directory, such as Images/map.png
+		} else if media, found := b.mediaAtSource(value); found {
+			value = path.Base(media.Href) // such as Media/theme.mp3
+		}
+		if value == "" || strings.ContainsAny(value, "/:#") {
+			return match // already has a path, or is a URL, data URI or fragment
+		}
+		if _, found := b.packagedMedia(value); found {
+			return parts[1] + quote + b.mediaHref(value) + quote
+		}
+		if !b.isPackagedImage(value) {
+			fail("section %s (%s) refers to file %s which is not packaged (add it to the 'images' or the 'media' attribute)",
+				section.ID, section.Heading, value)
+		}
+		b.addImageRef(value, section)
+		return parts[1] + quote + b.imageHref(value) + quote
+	})
+}
+
+// imageHref returns the href of the image file relative to the section files, such as ../Images/map.png.
+func (c *Context) imageHref(fileName string) string {
+	return path.Join("..", c.layout.imagesHref(fileName))
+}
+
+// checkHrefSeparators fails if any href, src or full-path attribute in the generated file contains a
+// backslash. Such paths work when the book is built and read on Windows but break everywhere else.
+func checkHrefSeparators(fileName string, content []byte) {
+	for _, match := range pathAttrRegexp.FindAllSubmatch(content, -1) {
+		if bytes.ContainsRune(match[2], '\\') {
+			fail("%s contains %s=\"%s\" with a backslash; paths must use forward slashes",
+				fileName, match[1], match[2])
+		}
+	}
+}
+
+// isPackagedImage returns true if the file is the cover image or one of the declared images.
+func (b *InputBuffer) isPackagedImage(fileName string) bool {
+	_, exists := b.packagedImage(fileName)
+	return exists
+}
+
+// packagedImage returns the cover image or the declared image with the file name, if any.
+func (b *InputBuffer) packagedImage(fileName string) (ImageData, bool) {
+	if b.hasCoverImage() && fileName == b.coverImage.FileName {
+		return b.coverImage, true
+	}
+	image, exists := b.images[fileName]
+	return image, exists
+}
+
+// imageAtSource returns the packaged image whose file is at the path in the book directory, such as
+// Images/map.png, if the path is not a bare file name.
+func (b *InputBuffer) imageAtSource(source string) (ImageData, bool) {
+	if !strings.Contains(source, "/") {
+		return ImageData{}, false
+	}
+	if b.hasCoverImage() && source == b.coverImage.Source {
+		return b.coverImage, true
+	}
+	for _, image := range b.images {
+		if image.Source == source {
+			return image, true
+		}
+	}
+	return ImageData{}, false
+}
@@ -0,0 +1,75 @@
+package gen
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckHrefSeparators(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"forward slashes", `<item id="map" href="Images/map.png" media-type="image/png" /><content src="Text/section001.xhtml" />`, ""},
+		{"href", `<item id="map" href="Images\map.png" media-type="image/png" />`, `package.opf contains href="Images\map.png" with a backslash`},
+		{"src", `<content src="Text\section001.xhtml" />`, `contains src="Text\section001.xhtml" with a backslash`},
+		{"full-path", `<rootfile full-path="OEBPS\package.opf" />`, `contains full-path="OEBPS\package.opf" with a backslash`},
+		{"other attributes", `<meta name="path" content="C:\Books" />`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := func() (err error) {
+				defer catch(&err)
+				checkHrefSeparators("package.opf", []byte(test.content))
+				return nil
+			}()
+			if test.want == "" && err != nil {
+				t.Errorf("checkHrefSeparators = %v, want no error", err)
+			}
+			if test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)) {
+				t.Errorf("checkHrefSeparators = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLayoutHrefs(t *testing.T) {
+	layout := packageLayout{PackageDir: "OPS", TextDir: "xhtml", ImagesDir: "img", StylesDir: "css", MediaDir: "audio"}
+	c := &Context{layout: layout}
+	// A relative path of the file system, as filepath.Join builds it on the build platform, becomes an href
+	// only through filepath.ToSlash.
+	nested := filepath.ToSlash(filepath.Join("maps", "north.png"))
+	tests := []struct {
+		got, want string
+	}{
+		{layout.imagesHref("map.png"), "img/map.png"},
+		{layout.imagesHref(nested), "img/maps/north.png"},
+		{layout.mediaHref("theme.mp3"), "audio/theme.mp3"},
+		{c.imageHref("map.png"), "../img/map.png"},
+		{c.imageHref(nested), "../img/maps/north.png"},
+		{c.mediaHref("theme.mp3"), "../audio/theme.mp3"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("href = %q, want %q", test.got, test.want)
+		}
+	}
+}
+
+func TestIsControlFile(t *testing.T) {
+	for fileName, want := range map[string]bool{
+		"nav.xhtml":        true,
+		"toc.ncx":          true,
+		"package.opf":      true,
+		"fixed.ncx":        true,
+		"fixed.opf":        true,
+		"section001.xhtml": false,
+		"copyright.xhtml":  false,
+	} {
+		if got := isControlFile(fileName); got != want {
+			t.Errorf("isControlFile(%q) = %v, want %v", fileName, got, want)
+		}
+	}
+}
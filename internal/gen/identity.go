@@ -0,0 +1,60 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 02-Jan-2024
+//
+// The identifier and the timestamp of the e-book, stable across builds of the same source.
+
+package gen
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// bookNamespace is the namespace of the UUIDs derived from the title and the author, see BookUUID.
+// It must never change, or the derived UUIDs of all the books change with it.
+var bookNamespace = uuid.MustParse("0fec1f3c-07ea-4330-8cac-630fd662c99c")
+
+// sourceDateEpoch is the environment variable pinning the build timestamp, see BuildTime.
+const sourceDateEpoch = "SOURCE_DATE_EPOCH"
+
+// BookUUID returns the unique identifier of the e-book: the attribute "uuid" as written, or else a UUID derived
+// from the title and the author, so that rebuilding the same book gives the same identifier.
+func (b *InputBuffer) BookUUID() (_ string, err error) {
+	defer catch(&err)
+	if value := b.attributes.get("uuid"); value != "" {
+		if _, err := uuid.Parse(value); err != nil {
+			fail("attribute 'uuid' must be a UUID such as 0FEC1F3C-07EA-4330-8CAC-630FD662C99C, got '%s'", value)
+		}
+		return value, nil
+	}
+	name := b.attributes.get("title") + "\n" + b.attributes.get("author")
+	return strings.ToUpper(uuid.NewSHA1(bookNamespace, []byte(name)).String()), nil
+}
+
+// BuildTime returns the timestamp of the build, recorded as the "modified" date of the e-book: the attribute
+// "modified" in the RFC3339 format, or else the time given in seconds since 1970 by the environment variable
+// SOURCE_DATE_EPOCH, read into the parameters of the build, or else the current time. Pinning it makes the
+// builds of the same source identical, and leaves the template stamps out of the files, see render.
+func (b *InputBuffer) BuildTime() (_ time.Time, err error) {
+	defer catch(&err)
+	if value := b.attributes.get("modified"); value != "" {
+		pinned, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			fail("attribute 'modified' must be a date and time in the RFC3339 format such as 2023-12-31T12:00:00Z, got '%s'", value)
+		}
+		b.pinnedTime = true
+		return pinned.UTC(), nil
+	}
+	if value := b.parms.SourceDateEpoch; value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds < 0 {
+			fail("environment variable %s must be a number of seconds since 1970, got '%s'", sourceDateEpoch, value)
+		}
+		b.pinnedTime = true
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Now().UTC().Truncate(time.Second), nil
+}
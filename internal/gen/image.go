@@ -0,0 +1,47 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 16-Jan-2024
+//
+// Figures with a caption placed by the <!--image--> marker.
+
+package gen
+
+import (
+	"html"
+	"strings"
+)
+
+// genImage replaces the <!--image file="map.png" caption="…" alt="…"--> marker on the current line by a
+// <figure> with the image, its alt text and its caption. The image need not be declared in the "images"
+// attribute: it is packaged like the declared images, and its caption is kept for the list of illustrations.
+// A missing alt attribute is warned about, or fails the build with the -strict flag; alt="" marks the image as
+// decorative. Returns the figure HTML line.
+func (b *InputBuffer) genImage(section SectionData, directive Directive) string {
+	imageFile := directive.Args["file"]
+	if strings.ContainsAny(imageFile, `/\`) {
+		failAt(directive.Line, "<!--image--> file %s must be the name of a file in the book directory, without a path", imageFile)
+	}
+	if !b.isPackagedImage(imageFile) {
+		image := b.checkImageSource(newImageData(imageFile))
+		if b.images == nil {
+			b.images = make(map[string]ImageData)
+		}
+		b.images[imageFile] = b.measureImage(image)
+		b.dropResource(b.layout.imagesHref(imageFile)) // now packaged as an image, if the stylesheet also refers to it
+	}
+	caption := html.EscapeString(directive.Args["caption"])
+	b.setCaption(imageFile, caption)
+	b.addImageRef(imageFile, section)
+
+	img := `<img src="` + b.imageHref(imageFile) + `"`
+	if alt, given := directive.Args["alt"]; given {
+		img += ` alt="` + html.EscapeString(alt) + `"`
+	} else if b.parms.Strict {
+		failAt(directive.Line, "<!--image--> %s has no alt text (use alt=\"\" for a decorative image)", imageFile)
+	} else {
+		b.warn("line %d: <!--image--> %s has no alt text (use alt=\"\" for a decorative image)", directive.Line, imageFile)
+	}
+	if caption == "" {
+		return `<figure>` + img + ` /></figure>`
+	}
+	return `<figure>` + img + ` /><figcaption>` + caption + `</figcaption></figure>`
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 19-Jan-2024
+//
+// The location of the image files in the book directory.
+
+package gen
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// imagesFolder is the conventional folder of the image files in the book directory.
+const imagesFolder = "Images"
+
+// imageLocations returns the paths in the book directory where the image file given by an attribute, such as
+// map.png or Images/map.png, is looked for, in order: the path as given, then the file name in the book
+// directory itself and in its imagesFolder.
+func imageLocations(name string) []string {
+	return fileLocations(name, imagesFolder)
+}
+
+// fileLocations returns the paths in the book directory where the file given by an attribute is looked for,
+// in order: the path as given, then the file name in the book directory itself and in the folder.
+func fileLocations(name, folder string) []string {
+	base := path.Base(name)
+	locations := make([]string, 0, 3)
+	for _, location := range []string{name, base, path.Join(folder, base)} {
+		known := false
+		for _, prev := range locations {
+			known = known || prev == location
+		}
+		if !known {
+			locations = append(locations, location)
+		}
+	}
+	return locations
+}
+
+// locateImage returns the image with its Source set to the first of its imageLocations holding the file, and
+// true, or the image as it is and false if there is none.
+func (c *Context) locateImage(image ImageData) (ImageData, bool) {
+	if location, found := c.locateFile(image.Source, imagesFolder); found {
+		image.Source = location
+		return image, true
+	}
+	return image, false
+}
+
+// locateFile returns the first of the fileLocations of the file holding it, and true, or false if there is none.
+func (c *Context) locateFile(name, folder string) (string, bool) {
+	for _, location := range fileLocations(name, folder) {
+		if info, err := fs.Stat(c.sourceFS, location); err == nil && !info.IsDir() {
+			return location, true
+		}
+	}
+	return "", false
+}
+
+// imageLocationList returns the imageLocations of the image for the messages about a missing image file.
+func imageLocationList(image ImageData) string {
+	return strings.Join(imageLocations(image.Source), ", ")
+}
+
+// checkUniqueName fails if the image has the same file name as the packaged image but comes from another place
+// in the book directory, such as Images/map.png and maps/map.png, as the package keeps the file name only.
+func (c *Context) checkUniqueName(packaged, image ImageData) {
+	if packaged.Source != image.Source {
+		fail("image files %s and %s have the same name, which must be unique in the %s directory of the package",
+			packaged.Source, image.Source, c.layout.ImagesDir)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 15-Jan-2024
+//
+// The pixel size of the raster images, given as the width and height attributes of their <img> elements.
+
+package gen
+
+import (
+	"image"
+	_ "image/gif" // register the decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sizedImageClass is the class of the images given their pixel size by the program, so that the stylesheet can
+// scale them while keeping their aspect ratio.
+const sizedImageClass = "sized"
+
+var (
+	// sizeAttrRegexp matches the width or height attribute of an element.
+	sizeAttrRegexp = regexp.MustCompile(`(?i)\s(?:width|height)\s*=`)
+
+	// imgSrcRegexp matches the src attribute of an <img> element, with the value in the first group.
+	imgSrcRegexp = regexp.MustCompile(`\ssrc=(?:"([^"]*)"|'([^']*)')`)
+
+	// classAttrRegexp matches the class attribute of an element, with the value in the first group.
+	classAttrRegexp = regexp.MustCompile(`\sclass="([^"]*)"`)
+)
+
+// measureImage returns the image with the pixel size of the image file, read once when the image is registered.
+// SVG images have no pixel size and are returned as they are.
+func (c *Context) measureImage(image ImageData) ImageData {
+	if image.MediaType != "image/svg+xml" {
+		image.Width, image.Height = c.imageSize(image.Source)
+	}
+	return image
+}
+
+// imageSize returns the pixel size of the image file at the path in the source directory.
+func (c *Context) imageSize(imageFile string) (int, int) {
+	file, err := c.sourceFS.Open(imageFile)
+	if os.IsNotExist(err) && c.parms.Placeholders {
+		return placeholderWidth, placeholderHeight // replaced by a placeholder image, see checkImageSource
+	}
+	check(err)
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		fail("cannot read the size of image file %s: %s", imageFile, err.Error())
+	}
+	return config.Width, config.Height
+}
+
+// checkCoverSize warns when the long edge of the raster cover image is shorter than the min_cover_size config
+// key, 1600 pixels by default, as the retailers reject such covers; with the flag -strict it stops instead.
+// An SVG cover has no pixel size and is not checked.
+func (c *Context) checkCoverSize(cover ImageData) {
+	longEdge := cover.Width
+	if cover.Height > longEdge {
+		longEdge = cover.Height
+	}
+	if longEdge == 0 || longEdge >= c.parms.MinCoverSize {
+		return
+	}
+	if c.parms.Strict {
+		fail("cover image %s is %dx%d pixels, under the %d pixels required on the long edge", cover.FileName, cover.Width,
+			cover.Height, c.parms.MinCoverSize)
+	}
+	c.warn("cover image %s is %dx%d pixels, under the %d pixels required on the long edge", cover.FileName, cover.Width,
+		cover.Height, c.parms.MinCoverSize)
+}
+
+// addImageSizes adds the width and height attributes, and the sizedImageClass, to the <img> elements of the
+// packaged raster images in the lines, so that the reading system reserves the space of the image before it
+// is loaded instead of shifting the text. An element with a width or a height given by the author is left
+// alone, as are the SVG images and the images outside the package. Must run after rewriteAssetRefs.
+func (b *InputBuffer) addImageSizes(lines []string) {
+	for i, line := range lines {
+		if !strings.Contains(line, "<img") {
+			continue
+		}
+		lines[i] = imgTagRegexp.ReplaceAllStringFunc(line, func(tag string) string {
+			match := imgSrcRegexp.FindStringSubmatch(tag)
+			if match == nil || sizeAttrRegexp.MatchString(tag) {
+				return tag
+			}
+			src := match[1] + match[2]
+			image, packaged := b.packagedImage(path.Base(src))
+			if !packaged || src != b.imageHref(image.FileName) || image.Width == 0 {
+				return tag
+			}
+			if classAttrRegexp.MatchString(tag) {
+				tag = classAttrRegexp.ReplaceAllString(tag, ` class="$1 `+sizedImageClass+`"`)
+			} else {
+				tag = strings.Replace(tag, "<img", `<img class="`+sizedImageClass+`"`, 1)
+			}
+			size := ` width="` + strconv.Itoa(image.Width) + `" height="` + strconv.Itoa(image.Height) + `"`
+			if strings.HasSuffix(tag, "/>") {
+				return strings.TrimRight(strings.TrimSuffix(tag, "/>"), " ") + size + " />"
+			}
+			return strings.TrimSuffix(tag, ">") + size + ">"
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 26-Nov-2023
+//
+// Lint and cleanup of the inline style attributes left in the body content by word processors.
+
+package gen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// inlineStyleStats holds the inline style attributes found in a section.
+type inlineStyleStats struct {
+	section    SectionData
+	count      int            // the number of style attributes
+	properties map[string]int // the number of declarations of each property name
+	removed    int            // the number of style attributes removed by the cleanup
+}
+
+// inlineStyleAudit holds the settings and the per-section results of the inline style scan.
+type inlineStyleAudit struct {
+	strip    bool
+	keep     map[string]bool
+	sections []*inlineStyleStats
+}
+
+// inlineStyleScan holds the state of the scan of a section, carried from line to line.
+type inlineStyleScan struct {
+	stats *inlineStyleStats
+	strip bool            // remove the style attributes
+	keep  map[string]bool // the property names kept when stripping
+	inPre bool            // inside a <pre> element, which is left untouched
+}
+
+// StartInlineStyles enables the scan of the inline style attributes. With strip set, the style attributes
+// are removed from the body content except for the declarations of the properties in the comma-separated
+// keep list, such as "text-align". Must be called before the sections are generated.
+func (b *InputBuffer) StartInlineStyles(strip bool, keep string) {
+	b.inlineStyles = &inlineStyleAudit{strip: strip, keep: make(map[string]bool)}
+	for _, name := range strings.Split(keep, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			b.inlineStyles.keep[name] = true
+		}
+	}
+}
+
+// scan counts, and when stripping removes, the style attributes in the lines of the section.
+func (a *inlineStyleAudit) scan(section SectionData, lines []string) {
+	s := inlineStyleScan{
+		stats: &inlineStyleStats{section: section, properties: make(map[string]int)},
+		strip: a.strip,
+		keep:  a.keep,
+	}
+	for i, line := range lines {
+		if strings.Contains(line, "<") {
+			lines[i] = s.scanLine(line)
+		}
+	}
+	if s.stats.count > 0 {
+		a.sections = append(a.sections, s.stats)
+	}
+}
+
+// scanLine scans the tags of the line and returns the line with the style attributes removed if stripping.
+// Quotes inside attribute values are honoured, and tags split over lines are left alone.
+func (s *inlineStyleScan) scanLine(line string) string {
+	var out strings.Builder
+	last := 0
+	for i := 0; i < len(line); i++ {
+		if line[i] != '<' {
+			continue
+		}
+		end := tagEnd(line, i)
+		if end == -1 {
+			break
+		}
+		tag := line[i : end+1]
+		name := strings.ToLower(tagName(tag))
+		switch {
+		case name == "pre" && !strings.HasPrefix(tag, "</"):
+			s.inPre = true
+		case name == "pre":
+			s.inPre = false
+		case !s.inPre && !strings.HasPrefix(tag, "</") && !strings.HasPrefix(tag, "<!"):
+			if cleaned := s.scanTag(tag); cleaned != tag {
+				out.WriteString(line[last:i])
+				out.WriteString(cleaned)
+				last = end + 1
+			}
+		}
+		i = end
+	}
+	if last == 0 {
+		return line
+	}
+	out.WriteString(line[last:])
+	return out.String()
+}
+
+// scanTag counts the style attribute of the start tag and returns the tag without it if stripping,
+// keeping the declarations of the whitelisted properties.
+func (s *inlineStyleScan) scanTag(tag string) string {
+	start, valueStart, valueEnd, end := findAttr(tag, "style")
+	if start == -1 {
+		return tag
+	}
+	s.stats.count++
+	declarations := splitDeclarations(tag[valueStart:valueEnd])
+	kept := make([]string, 0)
+	for _, declaration := range declarations {
+		name, _, _ := strings.Cut(declaration, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		s.stats.properties[name]++
+		if s.keep[name] {
+			kept = append(kept, declaration)
+		}
+	}
+	if !s.strip {
+		return tag
+	}
+	if len(kept) == 0 {
+		s.stats.removed++
+		return tag[:start] + tag[end:]
+	}
+	quote := "\""
+	if strings.Contains(strings.Join(kept, ""), "\"") {
+		quote = "'"
+	}
+	return tag[:start] + ` style=` + quote + strings.Join(kept, "; ") + quote + tag[end:]
+}
+
+// tagEnd returns the index of the '>' closing the tag starting at start, skipping quoted attribute values,
+// or -1 if the tag does not end on the line.
+func tagEnd(line string, start int) int {
+	var quote byte
+	for i := start + 1; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// tagName returns the element name of the tag, e.g. "p" for `<p class="x">` and `</p>`.
+func tagName(tag string) string {
+	name := strings.TrimPrefix(tag[1:], "/")
+	if index := strings.IndexAny(name, " \t/>"); index != -1 {
+		name = name[:index]
+	}
+	return name
+}
+
+// findAttr finds the attribute with the given name in the tag. Returns the start of the attribute including
+// the whitespace before it, the start and end of its value without the quotes, and the end of the attribute,
+// or -1 for all if the tag has no such attribute.
+func findAttr(tag, name string) (int, int, int, int) {
+	i := strings.IndexAny(tag, " \t")
+	for i != -1 && i < len(tag) {
+		// Skip the whitespace before the attribute.
+		start := i
+		for i < len(tag) && (tag[i] == ' ' || tag[i] == '\t') {
+			i++
+		}
+		nameStart := i
+		for i < len(tag) && !strings.ContainsRune(" \t=/>", rune(tag[i])) {
+			i++
+		}
+		attrName := tag[nameStart:i]
+		if attrName == "" {
+			return -1, -1, -1, -1
+		}
+		valueStart, valueEnd := i, i
+		if i < len(tag) && tag[i] == '=' {
+			i++
+			if i < len(tag) && (tag[i] == '"' || tag[i] == '\'') {
+				quote := tag[i]
+				valueStart = i + 1
+				i = valueStart
+				for i < len(tag) && tag[i] != quote {
+					i++
+				}
+				valueEnd = i
+				i++ // skip the closing quote
+			} else {
+				valueStart = i
+				for i < len(tag) && !strings.ContainsRune(" \t>", rune(tag[i])) {
+					i++
+				}
+				valueEnd = i
+			}
+		}
+		if strings.EqualFold(attrName, name) {
+			return start, valueStart, valueEnd, i
+		}
+	}
+	return -1, -1, -1, -1
+}
+
+// splitDeclarations splits a style attribute value into its declarations at the semicolons outside quotes
+// and parentheses, such as the one in url("a;b").
+func splitDeclarations(value string) []string {
+	declarations := make([]string, 0, 4)
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i <= len(value); i++ {
+		if i < len(value) {
+			c := value[i]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+				continue
+			case c == '"' || c == '\'':
+				quote = c
+				continue
+			case c == '(':
+				depth++
+				continue
+			case c == ')':
+				depth--
+				continue
+			case c != ';' || depth > 0:
+				continue
+			}
+		}
+		if declaration := strings.TrimSpace(value[start:i]); declaration != "" {
+			declarations = append(declarations, declaration)
+		}
+		start = i + 1
+	}
+	return declarations
+}
+
+// ReportInlineStyles prints the number of inline style attributes in each section with the most common
+// property names, and how many were removed, if the scan was enabled.
+func (b *InputBuffer) ReportInlineStyles() {
+	a := b.inlineStyles
+	if a == nil {
+		return
+	}
+	if len(a.sections) == 0 {
+		fmt.Fprintln(b.out, "\nInline styles: none found")
+		return
+	}
+
+	total, removed := 0, 0
+	for _, stats := range a.sections {
+		total += stats.count
+		removed += stats.removed
+	}
+	fmt.Fprintf(b.out, "\nInline styles: %d style attribute(s) in %d section(s)\n", total, len(a.sections))
+	for _, stats := range a.sections {
+		fmt.Fprintf(b.out, "  %s \"%s\": %d (%s)\n", stats.section.ID, stats.section.Heading, stats.count, topProperties(stats.properties, 3))
+	}
+	if a.strip {
+		fmt.Fprintf(b.out, "  Removed %d style attribute(s), kept %d with the properties in 'keep_styles'\n", removed, total-removed)
+	}
+}
+
+// topProperties returns the n most frequent property names with their counts, e.g. "font-family 12, margin 3".
+func topProperties(properties map[string]int, n int) string {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if properties[names[i]] != properties[names[j]] {
+			return properties[names[i]] > properties[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s %d", name, properties[name])
+	}
+	return strings.Join(names, ", ")
+}
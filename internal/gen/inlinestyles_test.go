@@ -0,0 +1,59 @@
+package gen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitDeclarations(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", []string{}},
+		{"color: red", []string{"color: red"}},
+		{" margin:0cm ; ;line-height:normal; ", []string{"margin:0cm", "line-height:normal"}},
+		{`font-family:"A;B",serif;color:red`, []string{`font-family:"A;B",serif`, "color:red"}},
+		{"background: url(a;b.png); color: red", []string{"background: url(a;b.png)", "color: red"}},
+		{"font-family: 'Times; New'", []string{"font-family: 'Times; New'"}},
+	}
+	for _, test := range tests {
+		if got := splitDeclarations(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitDeclarations(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestScanInlineStyles(t *testing.T) {
+	lines := []string{
+		`<p style="color: red" class="x">One</p>`,
+		`<pre>`,
+		`<span style="color: red">kept in the pre</span>`,
+		`</pre>`,
+		`<p title='say "hi" > there' style='text-align:center; color:"x;y"'>Two</p>`,
+		`<p data-style="color: red">Three</p>`,
+	}
+	audit := &inlineStyleAudit{strip: true, keep: map[string]bool{"text-align": true}}
+	audit.scan(SectionData{ID: "chapter1"}, lines)
+	want := []string{
+		`<p class="x">One</p>`,
+		`<pre>`,
+		`<span style="color: red">kept in the pre</span>`,
+		`</pre>`,
+		`<p title='say "hi" > there' style="text-align:center">Two</p>`,
+		`<p data-style="color: red">Three</p>`,
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+	if len(audit.sections) != 1 {
+		t.Fatalf("%d sections with styles, want 1", len(audit.sections))
+	}
+	stats := audit.sections[0]
+	if stats.count != 2 || stats.removed != 1 {
+		t.Errorf("count = %d, removed = %d, want 2 and 1", stats.count, stats.removed)
+	}
+	if got := topProperties(stats.properties, 3); got != "color 2, text-align 1" {
+		t.Errorf("topProperties = %q, want %q", got, "color 2, text-align 1")
+	}
+}
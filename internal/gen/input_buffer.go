@@ -6,143 +6,380 @@
 package gen
 
 import (
-	"fmt"
+	"html"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/roslamir/ep3gen/internal/epubtype"
 	"github.com/roslamir/ep3gen/internal/fileutil"
 )
 
 // SectionData holds the attributes for a section.
 // Each generated HTML is considered a section and each section metadata is kept here.
 type SectionData struct {
-	ID       string // section id is used as the name of the section file and also used as the id in the package manifest
-	EpubType string // used as the value for "epub-type" attribute for the HTML <section> tag
-	Heading  string // used as the section heading to be displayed in the table of contents (TOC)
+	ID         string        // section id is used as the name of the section file and also used as the id in the package manifest
+	EpubType   epubtype.Term // used as the value for "epub-type" attribute for the HTML <section> tag
+	Heading    string        // used as the section heading to be displayed in the table of contents (TOC)
+	Entries    []TocEntry    // the entries pointing into the section body, nested under the section in the TOC
+	Children   []SectionData // the sections nested under a group entry in the TOC, see groupSections
+	Properties string        // the properties of the manifest item, such as "svg" for inline drawings
+	File       string        // the file holding the section when it is not its own file, see combineFrontMatter
+	Parent     string        // the label of the TOC entry the section is nested under, from the parent argument
+	Unlinked   bool          // the entry is a label nesting the Children in the TOC, with no page, see nestUnderParents
+	Assets     []string      // the asset files the section refers to, relative to the package directory, see recordAssets
+
+	SpineProperties string // the properties of the spine itemref, from the spine-properties argument of the directive
 }
 
-// ImageData holds the file name, the media type and optionally the caption for an image file.
+// FileName returns the name of the file holding the section, relative to the Text directory.
+func (s SectionData) FileName() string {
+	if s.File != "" {
+		return s.File
+	}
+	return s.ID + ".xhtml"
+}
+
+// Href returns the link to the section used in the TOC and the guides, relative to the Text directory.
+// A section sharing a file with other sections is linked by its id within that file.
+func (s SectionData) Href() string {
+	if s.File != "" {
+		return s.File + "#" + s.ID
+	}
+	return s.ID + ".xhtml"
+}
+
+// ImageData holds the file name, the media type, the pixel size and optionally the caption for an image file.
 type ImageData struct {
-	FileName  string // image file name with extension
-	MediaType string // the media type (png/jpeg) based on extension
+	FileName  string // image file name with extension, which is also its name in the package
+	Source    string // the path of the image file in the book directory, such as Images/map.png, see locateImage
+	MediaType string // the full media type, such as image/png or image/svg+xml, based on extension
 	Caption   string // the caption for the image (optional)
+	Width     int    // the width in pixels, 0 for an SVG image, see measureImage
+	Height    int    // the height in pixels, 0 for an SVG image
+}
+
+// imageMediaTypes maps the lowercase file extensions of the image files to their media types.
+var imageMediaTypes = map[string]string{
+	".png":  "image/png",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+}
+
+// newImageData returns the ImageData for the image file, with the media type taken from the extension
+// after the last dot regardless of case, so that "Cover.JPG" and "my.cover.v2.jpeg" are both JPEG images.
+// The file may be given with a path in the book directory, such as Images/map.png, which is kept as the source
+// until the file is located. Fails if the extension is not that of a PNG, JPEG, GIF or SVG image.
+func newImageData(fileName string) ImageData {
+	mediaType, known := imageMediaTypes[strings.ToLower(filepath.Ext(fileName))]
+	if !known {
+		fail("image file %s: only image files with extension 'png', 'jpeg', 'jpg', 'gif' or 'svg' are accepted", fileName)
+	}
+	return ImageData{
+		FileName:  path.Base(fileName),
+		Source:    fileName,
+		MediaType: mediaType,
+	}
 }
 
 // InputBuffer contains the input lines and other artifacts derived from the input lines.
 type InputBuffer struct {
-	CurrLine   string            // holds the string representing the current line
-	lineIndex  int               // index into the 'lines' slice', points to the current line
-	lines      []string          // holds the list of all lines from the source HTML file
-	attributes map[string]string // contains all the metadata attibutes
-	coverImage ImageData         // holds the file name and extension for the cover image
+	*Context // the parameters and the state of the build
+
+	CurrLine   string          // holds the string representing the current line
+	lineIndex  int             // index into the 'lines' slice', points to the current line
+	lines      []string        // holds the list of all lines from the source HTML file
+	lineNos    []int           // the line number in the source file of each line, see normaliseHead
+	attributes *attributeStore // contains all the metadata attibutes, in the order they were set
+	coverImage ImageData       // holds the file name and extension for the cover image
 	// images        []ImageData       // holds the list of all image files (other than the cover image) used in the book
-	images        map[string]ImageData // holds the maps of all image files (other than the cover image) used in the book
-	sections      []SectionData        // used to generated TOC and MANIFEST files
-	guides        []SectionData        // used in the Guides section of the manifest
-	currSectionNo int                  // Holds the current section counter
+	images         map[string]ImageData // holds the maps of all image files (other than the cover image) used in the book
+	sections       []SectionData        // used to generated TOC and MANIFEST files
+	guides         []SectionData        // used in the Guides section of the manifest
+	currSectionNo  int                  // Holds the current section counter
+	glyphs         *glyphAudit          // the glyph audit, only set when requested
+	kindle         *kindleAudit         // the Kindle analysis, only set when requested with -target kindle
+	lint           *contentLint         // the lint of the section content, unless all its rules are disabled
+	rendered       []RenderRecord       // records which template produced each output file
+	features       []FeatureStatus      // the status of the optional features in this build
+	wordCounts     map[string]int       // the number of words in each section, keyed by section ID
+	quickNav       *SectionData         // the quick navigation section, rendered after all other sections
+	resources      []ResourceData       // other packaged files, such as the images referenced from the stylesheet
+	page           pageSetup            // the language, text direction and writing mode of the generated pages
+	extraStyles    []string             // the CSS lines of the <!--styles--> block, nil if none, see ReadStylesBlock
+	bodies         map[string][]string  // the processed body lines of each section, keyed by section ID
+	conformance    *conformanceData     // the accessibility conformance claim, only set when claimed
+	a11y           *a11yMetadata        // the schema.org accessibility metadata, only set when given
+	contributors   []Contributor        // the author first, then the other contributors, see CheckContributors
+	collection     *collectionData      // the series of the book, only set when it has one
+	inputHash      string               // the hash of all the inputs, recorded as the provenance of the book
+	pinnedTime     bool                 // the build time is pinned for a reproducible build, see BuildTime
+	previewSkipped map[string]bool      // the IDs of the sections marked preview="skip"
+	tocGroups      []*tocGroup          // the groups of sections nested under a single TOC entry
+	appendices     *tocGroup            // the group of the appendices, only set when grouped
+	appendixCount  int                  // the number of appendices so far, used for the letters
+	inlineStyles   *inlineStyleAudit    // the inline style scan, only set when requested or stripping
+	chapterHeading *regexp.Regexp       // matches the headings starting a chapter, see checkMergedChapter
+	slugs          *slugRegistry        // the IDs in use, for the section IDs derived from the headings
+	combined       []renderedPage       // the pages of the sections placed in the combined frontmatter file
+	trace          *parseTrace          // the trace of the parse, only set when requested
+	notes          []noteData           // the notes of all the sections, in the order they were read
+	noteRefs       []noteRef            // the references to the notes, in the order they were read
+	loi            *SectionData         // the list of illustrations, rendered after all other sections
+	imageRefs      []imageRef           // the first reference to each declared image, in the order they were read
+	longDescs      []longDesc           // the long descriptions of the figures, in the order they were read
+	abbrevs        *abbreviations       // the abbreviations from abbreviations.yaml, only set when the file exists
+	placeholders   map[string]bool      // the missing images replaced by a placeholder image, with -placeholders
+	commentLine    int                  // the line starting the comment continued on the next lines, see bodyText
+	headingChanges []HeadingChange      // the sections added, removed or renamed since the last build, see CompareHeadings
+	spoiler        *Directive           // the <!--spoiler--> open in the section being read, see genSpoiler
+	styleAssets    []string             // the asset files the stylesheet refers to, see CheckStylesheetAssets
+}
+
+// NewInputBuffer reads in the whole source file. Returns an error if it cannot be read.
+func (c *Context) NewInputBuffer(sourceFileSpec string) (*InputBuffer, error) {
+	infile, err := fileutil.OpenFile(sourceFileSpec)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+	return c.NewInputBufferFromReader(infile)
 }
 
-func NewInputBuffer(sourceFileSpec string) *InputBuffer {
-	b := InputBuffer{}
-	b.lines = fileutil.ReadLines(sourceFileSpec)
-	b.attributes = make(map[string]string)
+// NewInputBufferFromReader reads the source HTML from the reader, such as an upload held in memory, and
+// returns the buffer for its lines.
+func (c *Context) NewInputBufferFromReader(reader io.Reader) (*InputBuffer, error) {
+	lines, err := fileutil.ReadLines(reader)
+	if err != nil {
+		return nil, err
+	}
+	b := InputBuffer{Context: c}
+	b.lines, b.lineNos = normaliseHead(lines)
+	b.lineIndex = -1 // the first call to Next or NextLine moves to the first line
+	b.attributes = newAttributeStore()
 	b.sections = make([]SectionData, 0, 50)
 	b.guides = make([]SectionData, 0, 10)
-	return &b
+	b.wordCounts = make(map[string]int)
+	b.bodies = make(map[string][]string)
+	b.previewSkipped = make(map[string]bool)
+	b.slugs = newSlugRegistry()
+	return &b, nil
 }
 
-// NewSectionData creates a new instance of SectionData and adds it to the 'sections' list.
-// It uses a running number to generate the section ID in the format "sectionNNN".
-func (b *InputBuffer) NewSectionData(epubType, heading string) SectionData {
+// NewSectionData creates a new instance of SectionData for the section started by the directive.
+// It uses the id argument of the directive as the section ID, reserved by ReserveSectionIDs, or else a running
+// number to generate the section ID in the format "sectionNNN", or the heading, see sectionID.
+// The toc argument of the directive replaces the heading as the label of the section in the TOC, its
+// spine-properties argument gives the properties of the section in the spine, and its parent argument the
+// label of the TOC entry it is nested under.
+func (b *InputBuffer) NewSectionData(directive Directive, epubType epubtype.Term, heading string) SectionData {
 	b.currSectionNo++
+	id, explicit := directive.Args["id"]
+	if !explicit {
+		id = b.sectionID(epubType, heading)
+	}
+	if toc := directive.Args["toc"]; toc != "" {
+		heading = toc
+	}
 	return SectionData{
-		ID:       fmt.Sprintf("section%03d", b.currSectionNo),
+		ID:       id,
 		EpubType: epubType,
 		Heading:  heading,
+		Parent:   html.EscapeString(directive.Args["parent"]),
+
+		SpineProperties: spinePropertiesOf(directive),
 	}
 }
 
-// NumLines returns the number of lines in the buffer.
+// NumLines returns the number of lines in the source file.
 func (b *InputBuffer) NumLines() int {
+	if len(b.lineNos) > 0 {
+		return b.lineNos[len(b.lineNos)-1]
+	}
 	return len(b.lines)
 }
 
-// NextLine returns the next source line.
-func (b *InputBuffer) NextLine() {
+// Next advances to the next source line and reports whether there was one, similar to bufio.Scanner.Scan.
+// At the end of the input, CurrLine is set to the empty string and AtEOF returns true.
+func (b *InputBuffer) Next() bool {
+	if b.lineIndex+1 >= len(b.lines) {
+		b.lineIndex = len(b.lines)
+		b.CurrLine = ""
+		return false
+	}
 	b.lineIndex++
-	if b.lineIndex == len(b.lines) {
-		panic("epubgen: unexpected end of input file")
+	b.CurrLine = strings.TrimSpace(b.lines[b.lineIndex])
+	return true
+}
+
+// bodyLine returns the current line as a body line of a section: the source line as it is, keeping the
+// indentation which CurrLine is trimmed of, unless CurrLine was replaced by a generated line.
+func (b *InputBuffer) bodyLine() string {
+	if b.lineIndex >= 0 && b.lineIndex < len(b.lines) && b.CurrLine == strings.TrimSpace(b.lines[b.lineIndex]) {
+		return b.lines[b.lineIndex]
+	}
+	return b.CurrLine
+}
+
+// bodyText returns the current line as a body line of a section like bodyLine, and false if the line is to be
+// left out. The ordinary comments, see isDirective, are dropped unless the config key "comments" is "keep": a
+// line starting with a comment is left out up to the end of the comment, which may be on a later line. A comment
+// after some text on the line is left as it is.
+func (b *InputBuffer) bodyText() (string, bool) {
+	line := b.bodyLine()
+	rest := b.CurrLine
+	if b.commentLine == 0 {
+		if !isComment(rest) {
+			return line, true
+		}
+		b.commentLine = b.LineNo()
+		rest = rest[len("<!"):] // so that the empty comments <!--> and <!---> end at once, as in HTML
+	}
+	end := strings.Index(rest, commentClose)
+	if end != -1 {
+		b.commentLine = 0
+		rest = strings.TrimSpace(rest[end+len(commentClose):])
+	}
+	switch {
+	case b.parms.Comments == "keep":
+		return line, true
+	case end == -1 || rest == "":
+		return "", false
+	}
+	return rest, true
+}
+
+// LineNo returns the 1-based line number of the current line in the source file.
+func (b *InputBuffer) LineNo() int {
+	if b.lineIndex >= 0 && b.lineIndex < len(b.lineNos) {
+		return b.lineNos[b.lineIndex]
 	}
-	b.CurrLine = b.lines[b.lineIndex]
+	return b.lineIndex + 1
+}
+
+// AtEOF returns true if all the source lines have been consumed.
+func (b *InputBuffer) AtEOF() bool {
+	return b.lineIndex >= len(b.lines)
+}
+
+// NextLine advances to the next source line and returns an error at the end of the input.
+// Used by the strict phases where running out of input is always an error.
+func (b *InputBuffer) NextLine() (err error) {
+	defer catch(&err)
+	b.nextLine()
+	return nil
+}
+
+// nextLine is NextLine for use inside the package.
+func (b *InputBuffer) nextLine() {
+	if !b.Next() {
+		fail("unexpected end of input file")
+	}
+}
+
+// NextLineFor is NextLine for the scans looking for the given marker, such as "<body>", which the error names
+// when the input ends before the marker is found.
+func (b *InputBuffer) NextLineFor(marker string) (err error) {
+	defer catch(&err)
+	if !b.Next() {
+		fail("unexpected end of input file while looking for %s", marker)
+	}
+	return nil
 }
 
 // LoadAttributes scans the metadata lines from the input file and extract the attributes.
-func (b *InputBuffer) LoadAttributes() {
+func (b *InputBuffer) LoadAttributes() (err error) {
+	defer catch(&err)
 	for {
-		b.NextLine()
-		if b.CurrLine == "</head>" {
+		check(b.NextLineFor("</head>"))
+		if IsEndTag(b.CurrLine, "head") {
 			break
 		}
-		if strings.HasPrefix(b.CurrLine, "<meta") {
-			index := strings.Index(b.CurrLine, "name=")
+		// Only <meta> tags with a quoted name are attributes; exports from word processors add others
+		// such as <meta name=Generator content="Microsoft Word 15">.
+		if len(b.CurrLine) >= len("<meta") && strings.EqualFold(b.CurrLine[:len("<meta")], "<meta") {
+			index := strings.Index(b.CurrLine, "name=\"")
 			if index != -1 {
 				name := b.CurrLine[index+len("name=")+1:] // skip past 'name="'
 				index = strings.Index(name, "\"")
 				if index == -1 {
-					panic("Invalid 'meta' HTML line: " + b.CurrLine)
+					b.fail("invalid 'meta' HTML line: %s", b.CurrLine)
 				}
 				name = name[:index]
 
 				index = strings.Index(b.CurrLine, "content=")
 				if index == -1 {
-					panic("Invalid 'meta' HTML line: " + b.CurrLine)
+					b.fail("invalid 'meta' HTML line: %s", b.CurrLine)
 				}
 				content := b.CurrLine[index+len("content=")+1:] // skip past 'content="'
 				index = strings.Index(content, "\"")
 				if index == -1 {
-					panic("Invalid 'meta' HTML line: " + b.CurrLine)
+					b.fail("invalid 'meta' HTML line: %s", b.CurrLine)
 				}
 				content = content[:index]
 				if name != "" {
-					b.attributes[name] = content
+					b.attributes.set(name, content)
 				}
 			}
 		}
 	}
+	return nil
 }
 
 // GetAttribute returns the attribute value or the empty string if the atrribute with the given key does not exist.
 func (b *InputBuffer) GetAttribute(key string) string {
-	return b.attributes[key]
+	return b.attributes.get(key)
 }
 
-// SetAttribute sets or adds an attribute with the given key/value pair.
+// SetAttribute sets or adds an attribute with the given key/value pair. A new attribute comes after all the others.
 func (b *InputBuffer) SetAttribute(key, value string) {
-	b.attributes[key] = value
+	b.attributes.set(key, value)
+}
+
+// AttributeNames returns the names of the attributes in a stable order: the order of the <meta> tags in the
+// source file, followed by the attributes added since. Anything listing the attributes must use this order.
+func (b *InputBuffer) AttributeNames() []string {
+	return append([]string(nil), b.attributes.names...)
 }
 
+// generatedCover is the value of the attribute "cover-image" for a book without cover art, such as an advance
+// reading copy, whose cover page is generated from the title and the author, see GenCoverSection.
+const generatedCover = "generate"
+
 // CheckCoverImage checks for the presence of the attribute "cover-image".
-// The value must be the name of the cover image file with extension of either ".jpeg" or ".png".
-// To make life easier, assume all JPEG files have extension ".jpeg" instead of ".jpg".
-func (b *InputBuffer) CheckCoverImage() {
-	imageFile := b.attributes["cover-image"]
+// The value must be the name of the cover image file with extension ".png", ".jpeg", ".jpg", ".gif" or ".svg", in any case,
+// or generatedCover for a text-only cover, which leaves the cover image empty.
+// The pixel size of a raster cover is read here, for the cover template and checkCoverSize.
+func (b *InputBuffer) CheckCoverImage() (err error) {
+	defer catch(&err)
+	imageFile := b.attributes.get("cover-image")
 	if imageFile == "" {
-		panic("epubgen: attribute 'cover-image' required")
+		fail("attribute 'cover-image' required (use \"%s\" for a text-only cover)", generatedCover)
 	}
-	_, mediaType, _ := strings.Cut(imageFile, ".")
-	if mediaType != "png" && mediaType != "jpeg" {
-		panic("epubgen: only image files with extension 'png' or 'jpeg' are accepted")
+	if imageFile == generatedCover {
+		return nil
 	}
-	b.coverImage = ImageData{
-		FileName:  imageFile,
-		MediaType: mediaType,
+	image, found := b.locateImage(newImageData(imageFile))
+	if !found {
+		fail("cover image file %s not found in the book directory as %s", imageFile, imageLocationList(image))
 	}
+	b.coverImage = b.measureImage(image)
+	b.checkCoverSize(b.coverImage)
+	return nil
 }
 
 // CheckImageFiles checks for the presence of the optional attribute "images".
-// The value must be the comma-separated image file names with extension of either ".jpeg" or ".png".
-// To make life easier, assume all JPEG files have extension ".jpeg" instead of ".jpg".
-func (b *InputBuffer) CheckImageFiles() {
-	value := b.attributes["images"]
+// The value must be the comma-separated image file names with extension ".png", ".jpeg", ".jpg", ".gif" or ".svg",
+// in any case. An SVG image referenced with <img> is not embedded in the section, so it does not make the section
+// an "svg" manifest item; only inline <svg> drawings do, see readInlineSVG.
+func (b *InputBuffer) CheckImageFiles() (err error) {
+	defer catch(&err)
+	value := b.attributes.get("images")
 	if value == "" {
 		return
 	}
@@ -150,17 +387,58 @@ func (b *InputBuffer) CheckImageFiles() {
 	b.images = make(map[string]ImageData)
 	files := strings.Split(value, ",")
 	for _, imageFile := range files {
-		_, mediaType, _ := strings.Cut(imageFile, ".")
-		if mediaType != "png" && mediaType != "jpeg" {
-			panic("epubgen: only image files with extension 'png' or 'jpeg' are accepted")
+		image := b.checkImageSource(newImageData(imageFile))
+		// b.images = append(b.images, image)
+		packaged, exists := b.packagedImage(image.FileName)
+		if exists {
+			b.checkUniqueName(packaged, image)
 		}
-		image := ImageData{
-			FileName:  imageFile,
-			MediaType: mediaType,
+		switch {
+		case exists && b.hasCoverImage() && image.FileName == b.coverImage.FileName:
+			b.warn("%s in attribute 'images' is already packaged as the cover image; the declaration is unnecessary", imageFile)
+		case exists:
+			b.warn("%s is listed more than once in attribute 'images'; the repeated declaration is unnecessary", imageFile)
+		default:
+			b.images[image.FileName] = b.measureImage(image)
 		}
-		// b.images = append(b.images, image)
-		b.images[imageFile] = image
 	}
+	return nil
+}
+
+// hasCoverImage returns true unless the book has a generated text-only cover, see generatedCover.
+func (b *InputBuffer) hasCoverImage() bool {
+	return b.coverImage.FileName != ""
+}
+
+// sortedImages returns the packaged images other than the cover image in file name order, so that the
+// manifest and the other lists of images are the same from build to build.
+func (b *InputBuffer) sortedImages() []ImageData {
+	images := make([]ImageData, 0, len(b.images))
+	for _, image := range b.images {
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].FileName < images[j].FileName })
+	return images
+}
+
+// registerTitlePageImage adds the image of an image title page to the packaged images, so that each
+// image file is listed exactly once in the manifest. An image already packaged as the cover image is
+// shared with the title page, and one also declared in the "images" attribute gets a warning that the
+// declaration is unnecessary. Returns the packaged image, with its pixel size.
+func (b *InputBuffer) registerTitlePageImage(image ImageData) ImageData {
+	image = b.checkImageSource(image)
+	if packaged, exists := b.packagedImage(image.FileName); exists {
+		b.checkUniqueName(packaged, image)
+		if packaged.FileName != b.coverImage.FileName {
+			b.warn("%s in attribute 'images' is already packaged as the title page image; the declaration is unnecessary", image.FileName)
+		}
+		return packaged
+	}
+	if b.images == nil {
+		b.images = make(map[string]ImageData)
+	}
+	b.images[image.FileName] = b.measureImage(image)
+	return b.images[image.FileName]
 }
 
 // AddSection adds the given section to the list of sections.
@@ -168,7 +446,27 @@ func (b *InputBuffer) AddSection(section SectionData) {
 	b.sections = append(b.sections, section)
 }
 
+// SetInputHash sets the hash of the inputs of the build, see InputHash.
+func (b *InputBuffer) SetInputHash(inputHash string) {
+	b.inputHash = inputHash
+}
+
 // AddGuide adds the given section to the list of guides.
 func (b *InputBuffer) AddGuide(section SectionData) {
 	b.guides = append(b.guides, section)
 }
+
+// StartGlyphAudit enables the audit for characters that may render as missing glyphs.
+// Must be called after the attributes are loaded since the book language extends the allowed ranges.
+func (b *InputBuffer) StartGlyphAudit(ranges string) (err error) {
+	defer catch(&err)
+	b.glyphs = newGlyphAudit(ranges, b.attributes.get("language"))
+	return nil
+}
+
+// ReportGlyphs prints the result of the glyph audit if it was enabled.
+func (b *InputBuffer) ReportGlyphs() {
+	if b.glyphs != nil {
+		b.glyphs.report(b.out)
+	}
+}
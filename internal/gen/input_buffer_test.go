@@ -0,0 +1,83 @@
+package gen
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/roslamir/ep3gen/internal/parm"
+)
+
+// testBuffer returns the input buffer of the source lines.
+func testBuffer(t *testing.T, lines ...string) *InputBuffer {
+	t.Helper()
+	b, err := NewContext(parm.Defaults(), io.Discard).NewInputBufferFromReader(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestNextAtEOF(t *testing.T) {
+	b := testBuffer(t, "<p>One</p>", "  <p>Two</p>")
+	if b.AtEOF() {
+		t.Fatal("AtEOF before the first line")
+	}
+	for _, want := range []string{"<p>One</p>", "<p>Two</p>"} {
+		if !b.Next() || b.CurrLine != want || b.AtEOF() {
+			t.Fatalf("Next: CurrLine = %q, AtEOF = %v, want %q", b.CurrLine, b.AtEOF(), want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if b.Next() || b.CurrLine != "" || !b.AtEOF() {
+			t.Errorf("Next at the end: CurrLine = %q, AtEOF = %v, want the end", b.CurrLine, b.AtEOF())
+		}
+	}
+	if err := b.NextLine(); err == nil || err.Error() != "unexpected end of input file" {
+		t.Errorf("NextLine at the end = %v, want the end of input error", err)
+	}
+	if err := b.NextLineFor("<body>"); err == nil || !strings.Contains(err.Error(), "while looking for <body>") {
+		t.Errorf("NextLineFor at the end = %v, want the end of input error naming <body>", err)
+	}
+}
+
+func TestNextEmptyInput(t *testing.T) {
+	b := testBuffer(t)
+	if b.Next() || !b.AtEOF() {
+		t.Errorf("Next on an empty input = true or AtEOF = false, want the end")
+	}
+}
+
+func TestNewImageData(t *testing.T) {
+	tests := []struct {
+		fileName string
+		want     ImageData // the zero ImageData for a rejected file
+	}{
+		{"cover.jpeg", ImageData{FileName: "cover.jpeg", Source: "cover.jpeg", MediaType: "image/jpeg"}},
+		{"cover.jpg", ImageData{FileName: "cover.jpg", Source: "cover.jpg", MediaType: "image/jpeg"}},
+		{"Cover.JPG", ImageData{FileName: "Cover.JPG", Source: "Cover.JPG", MediaType: "image/jpeg"}},
+		{"Cover.JpEg", ImageData{FileName: "Cover.JpEg", Source: "Cover.JpEg", MediaType: "image/jpeg"}},
+		{"MAP.PNG", ImageData{FileName: "MAP.PNG", Source: "MAP.PNG", MediaType: "image/png"}},
+		{"my.cover.v2.jpeg", ImageData{FileName: "my.cover.v2.jpeg", Source: "my.cover.v2.jpeg", MediaType: "image/jpeg"}},
+		{"Images/map.v1.png", ImageData{FileName: "map.v1.png", Source: "Images/map.v1.png", MediaType: "image/png"}},
+		{"map.png.txt", ImageData{}},
+		{"map.jpeg.bak", ImageData{}},
+		{"cover", ImageData{}},
+	}
+	for _, test := range tests {
+		var got ImageData
+		err := func() (err error) {
+			defer catch(&err)
+			got = newImageData(test.fileName)
+			return nil
+		}()
+		switch {
+		case test.want == ImageData{}:
+			if err == nil || !strings.Contains(err.Error(), "only image files with extension") {
+				t.Errorf("newImageData(%q) = %+v, %v, want the extension rejected", test.fileName, got, err)
+			}
+		case err != nil || got != test.want:
+			t.Errorf("newImageData(%q) = %+v, %v, want %+v", test.fileName, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 18-Dec-2023
+//
+// Analysis of the constructs known to degrade when the e-book is converted for Kindle.
+
+package gen
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// kindleRule is a construct which degrades or disappears when the e-book is converted for Kindle
+// (KF8 and Enhanced Typesetting). The pattern is matched against each line of the sections, or against
+// each rule of the stylesheet.
+type kindleRule struct {
+	Name       string
+	Stylesheet bool // matched against the rules of the stylesheet instead of the section lines
+	Pattern    *regexp.Regexp
+	Advice     string
+}
+
+// kindleRules lists the constructs reported by the Kindle analysis, in the order of the report.
+var kindleRules = []kindleRule{
+	{
+		Name:    "embedded audio",
+		Pattern: regexp.MustCompile(`<audio\b`),
+		Advice:  "removed by the conversion; describe the audio in the text or link to it online",
+	},
+	{
+		Name:    "embedded video",
+		Pattern: regexp.MustCompile(`<video\b`),
+		Advice:  "removed by the conversion; describe the video in the text or link to it online",
+	},
+	{
+		Name:    "scripted content",
+		Pattern: regexp.MustCompile(`<script\b|\son[a-z]+\s*=\s*["']`),
+		Advice:  "scripts are not run and event handlers are dropped; the content must work without them",
+	},
+	{
+		Name:    "epub:switch or epub:trigger",
+		Pattern: regexp.MustCompile(`<epub:(?:switch|trigger)\b`),
+		Advice:  "only the epub:default content of a switch is kept and triggers are dropped",
+	},
+	{
+		Name:    "embedded object",
+		Pattern: regexp.MustCompile(`<(?:iframe|object|embed)\b`),
+		Advice:  "dropped by the conversion; only the fallback content, if any, is kept",
+	},
+	{
+		Name:    "form controls",
+		Pattern: regexp.MustCompile(`<(?:form|input|button|select|textarea)\b`),
+		Advice:  "not supported; the controls are dropped or shown as plain text",
+	},
+	{
+		Name:    "MathML",
+		Pattern: regexp.MustCompile(`<(?:m:)?math\b`),
+		Advice:  "not supported by Enhanced Typesetting; use images of the formulas with <!--figure inline-->",
+	},
+	{
+		Name:    "epub:type without a Kindle equivalent",
+		Pattern: regexp.MustCompile(`\bepub:type="[^"]*\b(?:pullquote|sidebar|marginalia|help|tip)\b`),
+		Advice:  "ignored; the content is shown inline without its special layout",
+	},
+	{
+		Name:    "fixed or absolute positioning",
+		Pattern: regexp.MustCompile(`\sstyle="[^"]*\bposition\s*:\s*(?:fixed|absolute)`),
+		Advice:  "ignored by Enhanced Typesetting; the element flows with the text",
+	},
+	{
+		Name:       "float-based drop cap",
+		Stylesheet: true,
+		Pattern:    regexp.MustCompile(`(?s):?:first-letter\b[^{]*\{[^}]*\bfloat\s*:`),
+		Advice:     "misplaced or dropped by Enhanced Typesetting; prefer a raised initial without float",
+	},
+	{
+		Name:       "fixed or absolute positioning in the stylesheet",
+		Stylesheet: true,
+		Pattern:    regexp.MustCompile(`(?s)\{[^}]*\bposition\s*:\s*(?:fixed|absolute)`),
+		Advice:     "ignored by Enhanced Typesetting; the element flows with the text",
+	},
+}
+
+// kindleHit is an occurrence of a construct matched by a rule.
+type kindleHit struct {
+	rule     *kindleRule
+	location string // the section ID and heading, or the stylesheet
+	line     int    // the line in source.html or the stylesheet, 0 if not known
+}
+
+// kindleAudit holds the hits collected so far.
+type kindleAudit struct {
+	hits []kindleHit
+}
+
+// scan matches the section lines against the rules for the sections. The line of a hit is looked up with
+// lineOf, since the lines may have been rewritten.
+func (a *kindleAudit) scan(section SectionData, lines []string, lineOf func(string) int) {
+	location := fmt.Sprintf("%s \"%s\"", section.ID, section.Heading)
+	for i := range kindleRules {
+		rule := &kindleRules[i]
+		if rule.Stylesheet {
+			continue
+		}
+		for _, line := range lines {
+			if rule.Pattern.MatchString(line) {
+				a.hits = append(a.hits, kindleHit{rule: rule, location: location, line: lineOf(strings.TrimSpace(line))})
+			}
+		}
+	}
+}
+
+// scanStylesheet matches each rule of the stylesheet, up to its closing brace, against the rules for the stylesheet.
+func (a *kindleAudit) scanStylesheet(name, content string) {
+	start, line := 0, 1
+	for start < len(content) {
+		end := strings.IndexByte(content[start:], '}')
+		if end == -1 {
+			end = len(content)
+		} else {
+			end += start + 1
+		}
+		cssRule := content[start:end]
+		leading := len(cssRule) - len(strings.TrimLeft(cssRule, " \t\r\n"))
+		ruleLine := line + strings.Count(cssRule[:leading], "\n") // the line of the selector
+		for i := range kindleRules {
+			rule := &kindleRules[i]
+			if rule.Stylesheet && rule.Pattern.MatchString(cssRule) {
+				a.hits = append(a.hits, kindleHit{rule: rule, location: name, line: ruleLine})
+			}
+		}
+		line += strings.Count(cssRule, "\n")
+		start = end
+	}
+}
+
+// report prints the hits grouped by rule, in the order of the rules table.
+func (a *kindleAudit) report(out io.Writer) {
+	if len(a.hits) == 0 {
+		fmt.Fprintln(out, "\nKindle analysis: no constructs known to degrade on KF8/Enhanced Typesetting")
+		return
+	}
+	fmt.Fprintf(out, "\nKindle analysis: %d construct(s) known to degrade on KF8/Enhanced Typesetting\n", len(a.hits))
+	for i := range kindleRules {
+		rule := &kindleRules[i]
+		first := true
+		for _, hit := range a.hits {
+			if hit.rule != rule {
+				continue
+			}
+			if first {
+				fmt.Fprintf(out, "  %s: %s\n", rule.Name, rule.Advice)
+				first = false
+			}
+			if hit.line > 0 {
+				fmt.Fprintf(out, "    %s, line %d\n", hit.location, hit.line)
+			} else {
+				fmt.Fprintf(out, "    %s\n", hit.location)
+			}
+		}
+	}
+}
+
+// StartKindleAudit enables the analysis of the constructs which degrade when the e-book is converted for Kindle,
+// and scans the stylesheet. The e-book itself is not changed.
+func (b *InputBuffer) StartKindleAudit() (err error) {
+	defer catch(&err)
+	content, _, err := b.readStylesheet()
+	check(err)
+	b.kindle = &kindleAudit{}
+	b.kindle.scanStylesheet(stylesheetFile, string(content))
+	return nil
+}
+
+// ReportKindle prints the result of the Kindle analysis if it was enabled.
+func (b *InputBuffer) ReportKindle() {
+	if b.kindle != nil {
+		b.kindle.report(b.out)
+	}
+}
@@ -0,0 +1,97 @@
+package gen
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKindleRules(t *testing.T) {
+	// Each construct is found by its rule only.
+	sections := map[string]string{
+		"embedded audio":                        `<audio src="../Media/theme.mp3" controls="controls"></audio>`,
+		"embedded video":                        `<video controls="controls"><source src="../Media/clip.mp4"/></video>`,
+		"scripted content":                      `<p onclick="reveal()">Tap to reveal.</p>`,
+		"epub:switch or epub:trigger":           `<epub:switch id="formula">`,
+		"embedded object":                       `<iframe src="map.xhtml"></iframe>`,
+		"form controls":                         `<p><input type="text"/></p>`,
+		"MathML":                                `<math xmlns="http://www.w3.org/1998/Math/MathML"><mi>x</mi></math>`,
+		"epub:type without a Kindle equivalent": `<aside epub:type="pullquote"><p>Quoted.</p></aside>`,
+		"fixed or absolute positioning":         `<div style="top: 0; position: absolute">Corner</div>`,
+	}
+	stylesheets := map[string]string{
+		"float-based drop cap":                            "p.first::first-letter {\n  float: left;\n  font-size: 3em;\n}",
+		"fixed or absolute positioning in the stylesheet": ".corner {\n  position: fixed;\n}",
+	}
+	for i := range kindleRules {
+		rule := &kindleRules[i]
+		a := &kindleAudit{}
+		if css, found := stylesheets[rule.Name]; found {
+			a.scanStylesheet("stylesheet.css", css)
+		} else if line, found := sections[rule.Name]; found {
+			a.scan(SectionData{ID: "chapter1", Heading: "Chapter 1"}, []string{line}, func(string) int { return 12 })
+		} else {
+			t.Errorf("no fixture for the rule %q", rule.Name)
+			continue
+		}
+		if len(a.hits) != 1 || a.hits[0].rule != rule {
+			names := make([]string, len(a.hits))
+			for i, hit := range a.hits {
+				names[i] = hit.rule.Name
+			}
+			t.Errorf("the fixture of %q is found by the rules %q, want that one only", rule.Name, names)
+		}
+	}
+}
+
+func TestKindleRulesClean(t *testing.T) {
+	a := &kindleAudit{}
+	a.scan(SectionData{ID: "chapter1"}, []string{
+		`<p class="first">The audio of the ship was heard, and the video was lost.</p>`,
+		`<p>One <i>position: absolute</i> and a <span class="math">formula</span>.</p>`,
+		`<section epub:type="chapter">`,
+		`<p><img class="inline-formula" src="../Images/e-mc2.png" alt="E equals m c squared" /></p>`,
+		`<p style="text-align: center">Centered, with a positioned element described.</p>`,
+	}, func(string) int { return 0 })
+	a.scanStylesheet("stylesheet.css", "p.first::first-letter {\n  font-size: 3em;\n}\n.float { float: left; }\n")
+	if len(a.hits) != 0 {
+		t.Errorf("%d hits in content without any construct of the rules: %+v", len(a.hits), a.hits)
+	}
+}
+
+func TestKindleReport(t *testing.T) {
+	a := &kindleAudit{}
+	a.scanStylesheet("stylesheet.css", "body { margin: 0; }\n\np.first::first-letter {\n  float: left;\n}\n")
+	lineOf := map[string]int{
+		`<audio src="../Media/theme.mp3"></audio>`: 41,
+		`<video src="../Media/clip.mp4"></video>`:  42,
+	}
+	a.scan(SectionData{ID: "section004", Heading: "Chapter 1"}, []string{
+		`  <video src="../Media/clip.mp4"></video>`,
+		`  <audio src="../Media/theme.mp3"></audio>`,
+	}, func(line string) int { return lineOf[line] })
+	a.scan(SectionData{ID: "section005", Heading: "Chapter 2"}, []string{
+		`<audio src="../Media/theme.mp3"></audio>`,
+	}, func(string) int { return 0 })
+
+	var out bytes.Buffer
+	a.report(&out)
+	want := `
+Kindle analysis: 4 construct(s) known to degrade on KF8/Enhanced Typesetting
+  embedded audio: removed by the conversion; describe the audio in the text or link to it online
+    section004 "Chapter 1", line 41
+    section005 "Chapter 2"
+  embedded video: removed by the conversion; describe the video in the text or link to it online
+    section004 "Chapter 1", line 42
+  float-based drop cap: misplaced or dropped by Enhanced Typesetting; prefer a raised initial without float
+    stylesheet.css, line 3
+`
+	if out.String() != want {
+		t.Errorf("report:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	(&kindleAudit{}).report(&out)
+	if want := "\nKindle analysis: no constructs known to degrade on KF8/Enhanced Typesetting\n"; out.String() != want {
+		t.Errorf("report = %q, want %q", out.String(), want)
+	}
+}
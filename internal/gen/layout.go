@@ -0,0 +1,44 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 11-Dec-2023
+//
+// Names of the directories making up the package, configurable for ingestion pipelines expecting another layout.
+
+package gen
+
+import (
+	"path"
+
+	"github.com/roslamir/ep3gen/internal/parm"
+)
+
+// packageLayout holds the names of the package directory and of the directories inside it, see parm.Parms.
+// It is embedded in the template data so that the templates build their paths from the configured names.
+type packageLayout struct {
+	PackageDir string // the directory holding package.opf, OEBPS by default
+	TextDir    string // the directory of the section files inside the package directory
+	ImagesDir  string // the directory of the image files inside the package directory
+	StylesDir  string // the directory of the stylesheet inside the package directory
+	MediaDir   string // the directory of the audio and video files inside the package directory
+}
+
+// currentLayout returns the package layout from the config parameters.
+func currentLayout(parms *parm.Parms) packageLayout {
+	return packageLayout{
+		PackageDir: parms.PackageDir,
+		TextDir:    parms.TextDir,
+		ImagesDir:  parms.ImagesDir,
+		StylesDir:  parms.StylesDir,
+		MediaDir:   parms.MediaDir,
+	}
+}
+
+// imagesHref returns the path of the file in the images directory relative to the package directory.
+// Hrefs always use forward slashes, so they must be built with path.Join and never with filepath.Join.
+func (l packageLayout) imagesHref(fileName string) string {
+	return path.Join(l.ImagesDir, fileName)
+}
+
+// mediaHref returns the path of the file in the media directory relative to the package directory.
+func (l packageLayout) mediaHref(fileName string) string {
+	return path.Join(l.MediaDir, fileName)
+}
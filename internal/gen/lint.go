@@ -0,0 +1,279 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 09-Jan-2024
+//
+// Lint of the section content for the markup which renders badly or inconsistently on reading systems.
+
+package gen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// lintRule is a check of the section content, identified by a stable ID which can be given to -disable.
+type lintRule struct {
+	ID     string
+	Name   string
+	Advice string
+}
+
+// The IDs of the lint rules.
+const (
+	lintEmptyParagraph = "EP3L001"
+	lintLineBreakRun   = "EP3L002"
+	lintHeadingInPara  = "EP3L003"
+	lintNestedPara     = "EP3L004"
+	lintBlockInInline  = "EP3L005"
+	lintInvalidID      = "EP3L006"
+	lintNestedTable    = "EP3L007"
+)
+
+// lintRules lists the lint rules, in the order of their IDs.
+var lintRules = []lintRule{
+	{
+		ID:     lintEmptyParagraph,
+		Name:   "empty paragraph",
+		Advice: "empty paragraphs used for spacing collapse on some readers; use a CSS margin instead",
+	},
+	{
+		ID:     lintLineBreakRun,
+		Name:   "consecutive <br/>",
+		Advice: "runs of line breaks are collapsed or doubled by some readers; use separate paragraphs or a CSS margin",
+	},
+	{
+		ID:     lintHeadingInPara,
+		Name:   "heading inside a paragraph",
+		Advice: "a paragraph cannot hold a heading; close the <p> before the heading",
+	},
+	{
+		ID:     lintNestedPara,
+		Name:   "nested <p>",
+		Advice: "a paragraph cannot hold another one; close the outer <p> first or use a <div>",
+	},
+	{
+		ID:     lintBlockInInline,
+		Name:   "block element inside an inline element",
+		Advice: "readers may drop or misplace the block; move the inline element inside the block instead",
+	},
+	{
+		ID:     lintInvalidID,
+		Name:   "invalid id",
+		Advice: "an id must be an XML name, starting with a letter or underscore and without spaces or colons",
+	},
+	{
+		ID:     lintNestedTable,
+		Name:   "table nested more than two deep",
+		Advice: "deeply nested tables overflow small screens; flatten the layout or use an image",
+	},
+}
+
+var (
+	// ncNameRegexp matches an XML NCName, the form of a valid id value.
+	ncNameRegexp = regexp.MustCompile(`^[\p{L}_][\p{L}\p{M}\p{N}_.\-\x{B7}]*$`)
+
+	// lintHeadings are the heading elements.
+	lintHeadings = map[string]bool{"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true}
+
+	// lintBlocks are the block elements which may not appear inside an inline element.
+	lintBlocks = map[string]bool{
+		"address": true, "aside": true, "blockquote": true, "div": true, "dl": true, "figure": true, "footer": true,
+		"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+		"nav": true, "ol": true, "p": true, "pre": true, "section": true, "table": true, "ul": true,
+	}
+
+	// lintInlines are the inline elements which may not hold a block element.
+	lintInlines = map[string]bool{
+		"abbr": true, "b": true, "cite": true, "code": true, "dfn": true, "em": true, "i": true, "kbd": true,
+		"mark": true, "q": true, "s": true, "samp": true, "small": true, "span": true, "strong": true,
+		"sub": true, "sup": true, "u": true, "var": true,
+	}
+)
+
+// lintFinding is a problem found by a lint rule.
+type lintFinding struct {
+	rule    *lintRule
+	section SectionData
+	line    int // the line in source.html, 0 if not known
+}
+
+// contentLint holds the enabled rules and the findings collected so far.
+type contentLint struct {
+	enabled  map[string]bool
+	findings []lintFinding
+}
+
+// lintElement is an element of the section content whose end tag has not been read yet.
+type lintElement struct {
+	name  string
+	empty bool // a <p> with no text and no element other than <br/> so far
+}
+
+// StartLint enables the lint of the section content, except for the rules in the comma-separated list of
+// disabled rule IDs, such as "EP3L001,EP3L002". Fails on an unknown rule ID. Must be called before the
+// sections are generated.
+func (b *InputBuffer) StartLint(disabled string) (err error) {
+	defer catch(&err)
+	lint := &contentLint{enabled: make(map[string]bool)}
+	for _, rule := range lintRules {
+		lint.enabled[rule.ID] = true
+	}
+	for _, id := range strings.Split(disabled, ",") {
+		id = strings.ToUpper(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		if _, known := lint.enabled[id]; !known {
+			fail("unknown lint rule '%s' to disable, expected one of %s", id, lintRuleIDs())
+		}
+		lint.enabled[id] = false
+	}
+	for _, enabled := range lint.enabled {
+		if enabled {
+			b.lint = lint
+			b.RegisterFeature("content lint", true, "")
+			return nil
+		}
+	}
+	b.RegisterFeature("content lint", false, "all the rules disabled")
+	return nil
+}
+
+// lintRuleIDs returns the IDs of the lint rules, separated by commas.
+func lintRuleIDs() string {
+	ids := make([]string, len(lintRules))
+	for i, rule := range lintRules {
+		ids[i] = rule.ID
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ", ")
+}
+
+// lintRuleByID returns the lint rule with the given ID.
+func lintRuleByID(id string) *lintRule {
+	for i := range lintRules {
+		if lintRules[i].ID == id {
+			return &lintRules[i]
+		}
+	}
+	panic("unknown lint rule " + id)
+}
+
+// scan checks the section lines against the enabled rules. The lines are numbered with lineNos, their lines
+// in source.html, since they may have been rewritten. Content which is not well-formed is left to validateSection,
+// and the scan stops at the first error.
+func (l *contentLint) scan(section SectionData, lines []string, lineNos []int) {
+	content := []byte(strings.Join(lines, "\n"))
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Entity = xml.HTMLEntity
+	lineAt := func(offset int64) int {
+		return lineNos[bytes.Count(content[:offset], []byte("\n"))]
+	}
+	report := func(id string, offset int64) {
+		if l.enabled[id] {
+			l.findings = append(l.findings, lintFinding{rule: lintRuleByID(id), section: section, line: lineAt(offset)})
+		}
+	}
+
+	var stack []lintElement
+	within := func(match func(name string) bool) int {
+		count := 0
+		for _, element := range stack {
+			if match(element.name) {
+				count++
+			}
+		}
+		return count
+	}
+	lineBreaks := 0 // the <br/> elements in a row, separated by white space only
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(token.Name.Local)
+			for _, attr := range token.Attr {
+				if attr.Name.Space == "" && attr.Name.Local == "id" && !ncNameRegexp.MatchString(attr.Value) {
+					report(lintInvalidID, offset)
+				}
+			}
+			if len(stack) > 0 && name != "br" {
+				stack[len(stack)-1].empty = false
+			}
+			inPara := within(func(name string) bool { return name == "p" }) > 0
+			switch {
+			case lintHeadings[name] && inPara:
+				report(lintHeadingInPara, offset)
+			case name == "p" && inPara:
+				report(lintNestedPara, offset)
+			case lintBlocks[name] && within(func(name string) bool { return lintInlines[name] }) > 0:
+				report(lintBlockInInline, offset)
+			case name == "table" && within(func(name string) bool { return name == "table" }) >= 2:
+				report(lintNestedTable, offset)
+			}
+			if name == "br" {
+				if lineBreaks++; lineBreaks == 2 {
+					report(lintLineBreakRun, offset)
+				}
+			} else {
+				lineBreaks = 0
+			}
+			stack = append(stack, lintElement{name: name, empty: name == "p"})
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return
+			}
+			element := stack[len(stack)-1]
+			if element.name != strings.ToLower(token.Name.Local) {
+				return // RawToken does not match the end tags
+			}
+			stack = stack[:len(stack)-1]
+			if element.name == "p" && element.empty {
+				report(lintEmptyParagraph, offset)
+			}
+			if element.name != "br" {
+				lineBreaks = 0
+			}
+		case xml.CharData:
+			if strings.TrimSpace(string(token)) == "" {
+				continue
+			}
+			if len(stack) > 0 {
+				stack[len(stack)-1].empty = false
+			}
+			lineBreaks = 0
+		}
+	}
+}
+
+// report warns about each finding, in the order of the rules and then of the sections.
+func (l *contentLint) report(c *Context) {
+	sort.SliceStable(l.findings, func(i, j int) bool { return l.findings[i].rule.ID < l.findings[j].rule.ID })
+	if len(l.findings) > 0 {
+		fmt.Fprintln(c.out)
+	}
+	for _, finding := range l.findings {
+		location := fmt.Sprintf("%s (%s)", finding.section.ID, finding.section.Heading)
+		if finding.line > 0 {
+			location = fmt.Sprintf("line %d in %s", finding.line, location)
+		}
+		c.warn("%s %s at %s: %s", finding.rule.ID, finding.rule.Name, location, finding.rule.Advice)
+	}
+}
+
+// ReportLint warns about the findings of the content lint if it was enabled.
+func (b *InputBuffer) ReportLint() {
+	if b.lint != nil {
+		b.lint.report(b.Context)
+	}
+}
@@ -0,0 +1,102 @@
+package gen
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lintFindings returns the findings of all the rules on the lines, numbered from 101, as "rule:line".
+func lintFindings(lines ...string) string {
+	lint := &contentLint{enabled: make(map[string]bool)}
+	for _, rule := range lintRules {
+		lint.enabled[rule.ID] = true
+	}
+	lineNos := make([]int, len(lines))
+	for i := range lines {
+		lineNos[i] = 101 + i
+	}
+	lint.scan(SectionData{ID: "section004", Heading: "Chapter 1"}, lines, lineNos)
+	findings := make([]string, len(lint.findings))
+	for i, finding := range lint.findings {
+		findings[i] = fmt.Sprintf("%s:%d", finding.rule.ID, finding.line)
+	}
+	return strings.Join(findings, " ")
+}
+
+func TestLintRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		// EP3L001
+		{"empty paragraph", []string{"<p>Text.</p>", "<p></p>"}, "EP3L001:102"},
+		{"paragraph of white space", []string{"<p>&#160;</p>"}, "EP3L001:101"},
+		{"paragraph of line breaks", []string{"<p><br/></p>"}, "EP3L001:101"},
+		{"paragraph with an image", []string{`<p><img src="a.png" alt=""/></p>`}, ""},
+		// EP3L002
+		{"line break run", []string{"<p>One<br/>", "<br/>Two</p>"}, "EP3L002:102"},
+		{"line breaks with text between", []string{"<p>One<br/>Two<br/>Three</p>"}, ""},
+		{"long line break run", []string{"<p>One<br/><br/><br/>Two</p>"}, "EP3L002:101"},
+		// EP3L003
+		{"heading in a paragraph", []string{"<p>Text", "<h2>Heading</h2></p>"}, "EP3L003:102"},
+		{"heading after a paragraph", []string{"<p>Text</p>", "<h2>Heading</h2>"}, ""},
+		// EP3L004
+		{"nested paragraph", []string{"<p>Outer <p>inner</p></p>"}, "EP3L004:101"},
+		{"paragraph in a div", []string{"<div><p>Text</p></div>"}, ""},
+		// EP3L005
+		{"block in an inline element", []string{"<span><div>Text</div></span>"}, "EP3L005:101"},
+		{"paragraph in emphasis", []string{"<div><em>", "<p>Text</p></em></div>"}, "EP3L005:102"},
+		{"inline in a block", []string{"<div><span>Text</span></div>"}, ""},
+		// EP3L006
+		{"id with a space", []string{`<p id="chapter one">Text</p>`}, "EP3L006:101"},
+		{"id starting with a digit", []string{`<p id="1st">Text</p>`}, "EP3L006:101"},
+		{"id with a colon", []string{`<p id="a:b">Text</p>`}, "EP3L006:101"},
+		{"valid ids", []string{`<p id="_x.1-é">Text</p>`, `<span id="Chapter_1">Text</span>`}, ""},
+		// EP3L007
+		{"table three deep", []string{"<table><tr><td>", "<table><tr><td>", "<table><tr><td>Text</td></tr></table>",
+			"</td></tr></table>", "</td></tr></table>"}, "EP3L007:103"},
+		{"table two deep", []string{"<table><tr><td>", "<table><tr><td>Text</td></tr></table>", "</td></tr></table>"}, ""},
+		// Several rules and content which is not well-formed.
+		{"several rules", []string{`<p id="a b"></p>`, "<p><br/><br/></p>"}, "EP3L006:101 EP3L001:101 EP3L002:102 EP3L001:102"},
+		{"not well-formed", []string{"<p>Text</div>", "<p></p>"}, ""},
+	}
+	for _, test := range tests {
+		if got := lintFindings(test.lines...); got != test.want {
+			t.Errorf("%s: findings %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStartLint(t *testing.T) {
+	tests := []struct {
+		disabled string
+		enabled  bool
+		err      string
+	}{
+		{"", true, ""},
+		{" ep3l001 , EP3L002,", true, ""},
+		{"EP3L001,EP3L002,EP3L003,EP3L004,EP3L005,EP3L006,EP3L007", false, ""},
+		{"EP3L001,EP3L099", false, "unknown lint rule 'EP3L099' to disable, expected one of EP3L001, EP3L002"},
+	}
+	for _, test := range tests {
+		b := &InputBuffer{Context: &Context{}}
+		err := b.StartLint(test.disabled)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("StartLint(%q) error = %v, want %q", test.disabled, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enabled := b.lint != nil; enabled != test.enabled {
+			t.Errorf("StartLint(%q) enabled the lint: %t, want %t", test.disabled, enabled, test.enabled)
+		}
+		if test.disabled != "" && test.enabled && (b.lint.enabled["EP3L001"] || b.lint.enabled["EP3L002"] || !b.lint.enabled["EP3L003"]) {
+			t.Errorf("StartLint(%q) enabled %v", test.disabled, b.lint.enabled)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 22-Nov-2023
+//
+// Lock file preventing two builds of the same book into the same target directory.
+
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// LockFileName is the name of the lock file in the generated book directory. It is kept when the
+// directory is cleared at the start of a build and is never listed in the package.
+const LockFileName = ".ep3gen.lock"
+
+// lockPollInterval is how often a build started with -wait checks whether the lock was released.
+const lockPollInterval = 500 * time.Millisecond
+
+// takeoverSuffix is added to the name of the lock file for the file held while taking over a stale lock,
+// see takeOverStaleLock.
+const takeoverSuffix = ".takeover"
+
+// staleTakeoverAge is the age after which a takeover file is deemed left behind, since a takeover only takes
+// the time to read and remove the lock file.
+const staleTakeoverAge = 10 * time.Second
+
+// releaseSignals are the signals ending the program on which the lock is released, see ReleaseOnSignal.
+// SIGPIPE is caught too, as when the output is piped into a program which exits early.
+var releaseSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGPIPE}
+
+// lockOwner is the content of the lock file.
+type lockOwner struct {
+	PID     int    `json:"pid"`
+	Started string `json:"started"`
+}
+
+// BuildLock is the lock held on the generated book directory for the duration of a build.
+type BuildLock struct {
+	fileSpec string
+	content  []byte         // the content of the lock file, telling it from one taken over by another build
+	out      io.Writer      // where the problems releasing the lock are printed
+	signals  chan os.Signal // the signals caught by ReleaseOnSignal, nil if none
+	released chan struct{}  // closed by Release
+}
+
+// AcquireLock creates the lock file in the given generated book directory. If another build holds the
+// lock, it returns an error naming the owning process, or waits for the lock to be released when wait
+// is true. A lock left behind by a process which no longer exists is removed with a warning, by one build
+// only when several find it at the same time, see takeOverStaleLock.
+func (c *Context) AcquireLock(targetDirSpec string, wait bool) (_ *BuildLock, err error) {
+	defer catch(&err)
+	check(os.MkdirAll(targetDirSpec, 0770))
+	fileSpec := filepath.Join(targetDirSpec, LockFileName)
+	content, err := json.Marshal(lockOwner{PID: os.Getpid(), Started: time.Now().UTC().Format(time.RFC3339)})
+	check(err)
+
+	waiting, unreadable := false, false
+	for {
+		file, err := os.OpenFile(fileSpec, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+		if err == nil {
+			_, err = file.Write(content)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			check(err)
+			return &BuildLock{fileSpec: fileSpec, content: content, out: c.out, released: make(chan struct{})}, nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed by the Release of the build waited for, as it was left empty.
+			check(os.MkdirAll(targetDirSpec, 0770))
+			continue
+		}
+		if !errors.Is(err, os.ErrExist) {
+			fail("cannot create lock file %s: %s", fileSpec, err.Error())
+		}
+
+		owner, found, ok := readLockOwner(fileSpec)
+		switch {
+		case !ok && !lockExists(fileSpec):
+			continue // released in the meantime
+		case !ok && !unreadable:
+			// Possibly still being written by its owner: look again after a while.
+			unreadable = true
+		case !ok || !processExists(owner.PID):
+			if takeOverStaleLock(fileSpec, found) {
+				c.warn("removed stale lock file %s of process %d (started %s)",
+					fileSpec, owner.PID, owner.Started)
+				unreadable = false
+				continue
+			}
+			// Being taken over by another build: look again after a while.
+		case !wait:
+			fail("%s is being built by process %d (started %s); use -wait to wait for it to finish",
+				targetDirSpec, owner.PID, owner.Started)
+		case !waiting:
+			waiting = true
+			fmt.Fprintf(c.out, "Waiting for process %d (started %s) to finish building %s ...\n", owner.PID, owner.Started, targetDirSpec)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// takeOverStaleLock removes the lock file found stale with the given content, and returns false if another
+// build is taking it over or has replaced it in the meantime. The builds finding the lock stale at the same
+// time take turns by the takeover file next to it, created exclusively like the lock file, and the lock file
+// is read again right before it is removed, so that a lock taken in the meantime is left alone.
+func takeOverStaleLock(fileSpec string, stale []byte) bool {
+	guardSpec := fileSpec + takeoverSuffix
+	guard, err := os.OpenFile(guardSpec, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		if info, err := os.Stat(guardSpec); err == nil && time.Since(info.ModTime()) > staleTakeoverAge {
+			// Left behind by a build which ended while taking over a lock: only one build may move it away.
+			moved := fmt.Sprintf("%s-%d-%d", guardSpec, os.Getpid(), time.Now().UnixNano())
+			if os.Rename(guardSpec, moved) == nil {
+				os.Remove(moved)
+			}
+		}
+		return false
+	}
+	guard.Close()
+	defer os.Remove(guardSpec)
+
+	content, err := os.ReadFile(fileSpec)
+	if err != nil || !bytes.Equal(content, stale) {
+		return false
+	}
+	return os.Remove(fileSpec) == nil
+}
+
+// Release removes the lock file, and the generated book directory if nothing else is left in it. A lock
+// file which is no longer this one, taken over by another build, is left alone. Safe to call more than once.
+func (l *BuildLock) Release() {
+	select {
+	case <-l.released:
+	default:
+		close(l.released)
+		if l.signals != nil {
+			signal.Stop(l.signals)
+		}
+	}
+	if content, err := os.ReadFile(l.fileSpec); err == nil && !bytes.Equal(content, l.content) {
+		return
+	}
+	if err := os.Remove(l.fileSpec); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(l.out, "epubgen: warning: cannot remove lock file %s: %s\n", l.fileSpec, err.Error())
+	}
+	os.Remove(filepath.Dir(l.fileSpec)) // fails harmlessly unless empty
+}
+
+// ReleaseOnSignal releases the lock and exits when the build is interrupted or its output closed by one of
+// the releaseSignals, since the deferred Release does not run on a signal. The signals are no longer caught
+// once the lock is released.
+func (l *BuildLock) ReleaseOnSignal() {
+	l.signals = make(chan os.Signal, 1)
+	signal.Notify(l.signals, releaseSignals...)
+	go func() {
+		select {
+		case sig := <-l.signals:
+			l.Release()
+			fmt.Fprintf(l.out, "\nepubgen: build interrupted (%s)\n", sig)
+			os.Exit(1)
+		case <-l.released:
+		}
+	}()
+}
+
+// readLockOwner returns the owner recorded in the lock file with the content of the file, or false if it
+// cannot be read.
+func readLockOwner(fileSpec string) (lockOwner, []byte, bool) {
+	var owner lockOwner
+	content, err := os.ReadFile(fileSpec)
+	if err != nil || json.Unmarshal(content, &owner) != nil || owner.PID == 0 {
+		return owner, content, false
+	}
+	return owner, content, true
+}
+
+// lockExists reports whether the lock file exists.
+func lockExists(fileSpec string) bool {
+	_, err := os.Stat(fileSpec)
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// processExists reports whether a process with the given pid is running.
+func processExists(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true // FindProcess already fails for a process which does not exist
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,154 @@
+package gen
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/roslamir/ep3gen/internal/parm"
+)
+
+// stalePID is the id of a process which does not exist, above the largest pid of Linux and macOS.
+const stalePID = 1 << 30
+
+// writeStaleLock writes a lock file left behind by a process which no longer exists into the directory.
+func writeStaleLock(t *testing.T, dirSpec string) {
+	t.Helper()
+	content, err := json.Marshal(lockOwner{PID: stalePID, Started: "2023-11-22T10:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dirSpec, LockFileName), content, 0660); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// acquireAll acquires the lock on the directory from n builds at the same time, and returns the locks acquired
+// with the contexts of all the builds.
+func acquireAll(t *testing.T, dirSpec string, n int) ([]*BuildLock, []*Context) {
+	t.Helper()
+	contexts := make([]*Context, n)
+	locks := make([]*BuildLock, n)
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range contexts {
+		contexts[i] = NewContext(parm.Defaults(), io.Discard)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			locks[i], errs[i] = contexts[i].AcquireLock(dirSpec, false)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	acquired := make([]*BuildLock, 0)
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			acquired = append(acquired, locks[i])
+		case !strings.Contains(err.Error(), "use -wait to wait for it to finish"):
+			t.Errorf("build %d: %v, want the lock held by another build", i, err)
+		}
+	}
+	return acquired, contexts
+}
+
+func TestAcquireLockContention(t *testing.T) {
+	dirSpec := t.TempDir()
+	acquired, _ := acquireAll(t, dirSpec, 8)
+	if len(acquired) != 1 {
+		t.Fatalf("%d builds acquired the lock, want 1", len(acquired))
+	}
+
+	// A waiting build gets the lock once it is released.
+	got := make(chan error, 1)
+	go func() {
+		lock, err := NewContext(parm.Defaults(), io.Discard).AcquireLock(dirSpec, true)
+		if err == nil {
+			lock.Release()
+		}
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		t.Fatalf("the waiting build did not wait for the lock: %v", err)
+	case <-time.After(2 * lockPollInterval):
+	}
+	acquired[0].Release()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * lockPollInterval):
+		t.Fatal("the waiting build did not get the released lock")
+	}
+	if _, err := os.Stat(dirSpec); !os.IsNotExist(err) {
+		t.Errorf("the empty directory was left behind by Release: %v", err)
+	}
+}
+
+func TestAcquireLockStale(t *testing.T) {
+	dirSpec := t.TempDir()
+	writeStaleLock(t, dirSpec)
+	context := NewContext(parm.Defaults(), io.Discard)
+	lock, err := context.AcquireLock(dirSpec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+	if len(context.warnings) != 1 || !strings.Contains(context.warnings[0], "removed stale lock file") {
+		t.Errorf("warnings = %q, want the stale lock file removed", context.warnings)
+	}
+	if owner, _, ok := readLockOwner(filepath.Join(dirSpec, LockFileName)); !ok || owner.PID != os.Getpid() {
+		t.Errorf("lock owner = %+v, want this process", owner)
+	}
+}
+
+func TestAcquireLockStaleContention(t *testing.T) {
+	for run := 0; run < 5; run++ {
+		dirSpec := t.TempDir()
+		writeStaleLock(t, dirSpec)
+		acquired, contexts := acquireAll(t, dirSpec, 8)
+		if len(acquired) != 1 {
+			t.Fatalf("%d builds acquired the stale lock, want 1", len(acquired))
+		}
+		warned := 0
+		for _, context := range contexts {
+			warned += len(context.warnings)
+		}
+		if warned != 1 {
+			t.Errorf("the stale lock was removed %d times, want once", warned)
+		}
+		acquired[0].Release()
+		entries, _ := os.ReadDir(dirSpec)
+		for _, entry := range entries {
+			t.Errorf("%s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestReleaseTakenOverLock(t *testing.T) {
+	dirSpec := t.TempDir()
+	lock, err := NewContext(parm.Defaults(), io.Discard).AcquireLock(dirSpec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Taken over by another build, as when this one was deemed gone.
+	fileSpec := filepath.Join(dirSpec, LockFileName)
+	if err = os.WriteFile(fileSpec, []byte(`{"pid":1,"started":"2023-11-22T10:00:00Z"}`), 0660); err != nil {
+		t.Fatal(err)
+	}
+	lock.Release()
+	if _, err = os.Stat(fileSpec); err != nil {
+		t.Errorf("the lock of the other build was removed: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 13-Dec-2023
+//
+// The list of illustrations generated from the declared images.
+
+package gen
+
+import (
+	"fmt"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+// imageRef is the first reference to a declared image from the body of a section.
+type imageRef struct {
+	FileName string
+	Href     string // the section file name, with the id of the section when it shares the file
+}
+
+// loiEntry is a single illustration on the list of illustrations.
+type loiEntry struct {
+	Href  string // the section where the image is shown, empty if the image is never referenced
+	Label string // the caption of the image, or its file name without one
+}
+
+type loiTemplateData struct {
+	pageSetup
+	Title    string
+	ID       string
+	EpubType epubtype.Term
+	Heading  string
+	Entries  []loiEntry
+}
+
+// addImageRef records the reference to the declared image from the section, unless it is already
+// referenced from an earlier one. The cover image is not an illustration.
+func (b *InputBuffer) addImageRef(fileName string, section SectionData) {
+	if _, declared := b.images[fileName]; !declared {
+		return
+	}
+	for _, ref := range b.imageRefs {
+		if ref.FileName == fileName {
+			return
+		}
+	}
+	b.imageRefs = append(b.imageRefs, imageRef{FileName: fileName, Href: section.Href()})
+}
+
+// setCaption keeps the first caption given to the declared image by <!--figure-->.
+func (b *InputBuffer) setCaption(fileName, caption string) {
+	if image, declared := b.images[fileName]; declared && image.Caption == "" {
+		image.Caption = caption
+		b.images[fileName] = image
+	}
+}
+
+// AddLOISection adds the list of illustrations at the current position in the spine.
+// The file itself is generated by GenLOISection once all the sections are known.
+func (b *InputBuffer) AddLOISection() (err error) {
+	defer catch(&err)
+	if b.loi != nil {
+		fail("Directive <!--loi--> already specified")
+	}
+	section := SectionData{
+		ID:       "loi",
+		EpubType: epubtype.LOI,
+		Heading:  b.DefaultHeading("loi"),
+	}
+	b.sections = append(b.sections, section)
+	b.loi = &section
+	return nil
+}
+
+// GenLOISection generates the list of illustrations, if requested. It lists the declared images in the order
+// they are first shown, each linking to its section, followed by the images which are never shown.
+func (b *InputBuffer) GenLOISection() (err error) {
+	defer catch(&err)
+	if b.loi == nil {
+		return
+	}
+	if !b.hasTemplate(loiTemplate) {
+		fail("template %s not found in templates_dir", loiTemplate)
+	}
+	section := *b.loi
+
+	fileName := section.ID + ".xhtml"
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
+
+	outfile := b.createSectionFile(section)
+	defer outfile.Close()
+
+	entries := make([]loiEntry, 0, len(b.images))
+	referenced := make(map[string]bool, len(b.imageRefs))
+	for _, ref := range b.imageRefs {
+		entries = append(entries, loiEntry{Href: ref.Href, Label: b.imageLabel(ref.FileName)})
+		referenced[ref.FileName] = true
+	}
+	for _, image := range b.sortedImages() {
+		if !referenced[image.FileName] {
+			entries = append(entries, loiEntry{Label: b.imageLabel(image.FileName)})
+		}
+	}
+
+	// Struct to pass to the template
+	data := loiTemplateData{
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+		Heading:   section.Heading,
+		Entries:   entries,
+	}
+	b.render(outfile, fileName, loiTemplate, data)
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
+
+// imageLabel returns the caption of the declared image, or its file name if it has none.
+func (b *InputBuffer) imageLabel(fileName string) string {
+	if caption := b.images[fileName].Caption; caption != "" {
+		return caption
+	}
+	return fileName
+}
@@ -0,0 +1,207 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 15-Dec-2023
+//
+// Long descriptions of the complex figures, such as charts and maps, which need more than their alt text.
+
+package gen
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+const (
+	descriptionsSectionID = "descriptions"
+	descriptionsFile      = descriptionsSectionID + ".xhtml"
+
+	// longDescLabel is the text of the <summary> element and of the link to the description.
+	longDescLabel = "Image description"
+)
+
+// longDesc is the long description of a figure, either written inline after the figure with
+// <!--longdesc--> ... <!--endlongdesc--> or written elsewhere in the book and linked with longdesc="...".
+type longDesc struct {
+	ID       string   // the id of the description, longdesc-1, longdesc-2, ...
+	Label    string   // the caption of the figure, or the image file name without one
+	Line     int      // the source line of the <!--figure--> directive
+	Lines    []string // the body lines of an inline description
+	Href     string   // the link to a description written elsewhere, empty for an inline description
+	File     string   // the section file of the figure
+	Backlink string   // the href of the link to the description in the figure
+}
+
+type descriptionsTemplateData struct {
+	pageSetup
+	Title        string
+	ID           string
+	EpubType     epubtype.Term
+	Heading      string
+	Descriptions []longDesc
+}
+
+// readLongDesc reads the long description of the figure just read, from the longdesc argument of the directive
+// or from the <!--longdesc--> block on the current line, and leaves the current line after the block.
+// Returns false if the figure has no long description.
+func (b *InputBuffer) readLongDesc(directive Directive, imageFile, caption string) (longDesc, bool) {
+	href, linked := directive.Args["longdesc"]
+	block := b.directive()
+	switch {
+	case linked && block.Name == "longdesc":
+		failAt(directive.Line, "<!--figure--> has both the longdesc argument and a <!--longdesc--> block")
+	case linked && href == "":
+		failAt(directive.Line, "the longdesc argument of <!--figure--> must link to the description")
+	case !linked && block.Name != "longdesc":
+		return longDesc{}, false
+	}
+
+	section := b.sections[len(b.sections)-1]
+	desc := longDesc{
+		ID:    fmt.Sprintf("longdesc-%d", len(b.longDescs)+1),
+		Label: caption,
+		Line:  directive.Line,
+		Href:  href,
+		File:  section.FileName(),
+	}
+	if desc.Label == "" {
+		desc.Label = imageFile
+	}
+	desc.Backlink = desc.File + "#" + desc.ID + "-link"
+
+	if !linked {
+		closed := false
+		for b.Next() {
+			if closed = b.directive().Name == "endlongdesc"; closed || isDirective(b.CurrLine) {
+				break
+			}
+			if line, ok := b.bodyText(); ok && b.CurrLine != "" {
+				desc.Lines = append(desc.Lines, line)
+			}
+		}
+		switch {
+		case !closed:
+			failAt(block.Line, "<!--longdesc--> is not closed by <!--endlongdesc-->")
+		case len(desc.Lines) == 0:
+			failAt(block.Line, "<!--longdesc--> has no content")
+		}
+		b.Next()
+	}
+	b.longDescs = append(b.longDescs, desc)
+	return desc, true
+}
+
+// genDescribedFigure generates the <figure> element of an image with a long description. The image refers to
+// the description with aria-details: an inline description is rendered as a <details> element in the figure,
+// unless the longdesc config parameter is "appendix", in which case the figure links to its entry in the
+// generated image descriptions section. A description written elsewhere is linked the same way.
+func (c *Context) genDescribedFigure(imageFile, caption string, desc longDesc) []string {
+	img := `<img src="` + c.imageHref(imageFile) + `" alt="` + caption + `" aria-details="`
+	if desc.Href == "" && c.parms.LongDesc != "appendix" {
+		lines := make([]string, 0, len(desc.Lines)+3)
+		lines = append(lines, `<figure>`+img+desc.ID+`" />`)
+		lines = append(lines, `<details id="`+desc.ID+`" class="longdesc"><summary>`+longDescLabel+`</summary>`)
+		lines = append(lines, desc.Lines...)
+		return append(lines, `</details></figure>`)
+	}
+	href := desc.Href
+	if href == "" {
+		href = descriptionsFile + "#" + desc.ID
+	}
+	linkID := desc.ID + "-link"
+	return []string{
+		`<figure>` + img + linkID + `" />`,
+		`<a id="` + linkID + `" class="longdesc" href="` + href + `">` + longDescLabel + `</a></figure>`,
+	}
+}
+
+// GenDescriptionsSection generates the image descriptions section from the inline long descriptions of all the
+// figures, if the longdesc config parameter is "appendix". It must be called after all the other sections
+// are generated but before GenNotesSection, so that the note references in the descriptions are checked.
+// Each description links back to its figure.
+func (b *InputBuffer) GenDescriptionsSection() (err error) {
+	defer catch(&err)
+	if b.parms.LongDesc != "appendix" {
+		return nil
+	}
+	descriptions := make([]longDesc, 0, len(b.longDescs))
+	for _, desc := range b.longDescs {
+		if desc.Href == "" {
+			descriptions = append(descriptions, desc)
+		}
+	}
+	if len(descriptions) == 0 {
+		return nil
+	}
+	if !b.hasTemplate(descriptionsTemplate) {
+		fail("template %s not found in templates_dir", descriptionsTemplate)
+	}
+	section := SectionData{
+		ID:       descriptionsSectionID,
+		EpubType: epubtype.Appendix,
+		Heading:  b.DefaultHeading("longdesc"),
+	}
+
+	// Process the lines of all the descriptions at once, then hand each description its own part of the result.
+	lines := make([]string, 0, 10*len(descriptions))
+	for _, desc := range descriptions {
+		lines = append(lines, desc.Lines...)
+	}
+	b.processSection(section, lines)
+	start := 0
+	for i := range descriptions {
+		end := start + len(descriptions[i].Lines)
+		descriptions[i].Lines = joinPreformatted(lines[start:end])
+		start = end
+	}
+
+	b.sections = append(b.sections, section)
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", descriptionsFile, section.Heading)
+
+	outfile := b.createSectionFile(section)
+	defer outfile.Close()
+
+	// Struct to pass to the template
+	data := descriptionsTemplateData{
+		pageSetup:    b.page,
+		Title:        b.attributes.get("title"),
+		ID:           section.ID,
+		EpubType:     section.EpubType,
+		Heading:      section.Heading,
+		Descriptions: descriptions,
+	}
+	b.render(outfile, descriptionsFile, descriptionsTemplate, data)
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
+
+// CheckLongDescs checks that every description linked with longdesc="..." resolves to a generated section file
+// and, when the link has a fragment, to an element with that id in the file. A link with only a fragment
+// refers to the section file of the figure.
+func (b *InputBuffer) CheckLongDescs() (err error) {
+	defer catch(&err)
+	ids := make(map[string]map[string]bool) // the ids in each target file, scanned once
+	for _, desc := range b.longDescs {
+		if desc.Href == "" {
+			continue
+		}
+		file, fragment, _ := strings.Cut(desc.Href, "#")
+		if file == "" {
+			file = desc.File
+		}
+		fileIDs, scanned := ids[file]
+		if !scanned {
+			fileIDs = scanIDs(filepath.Join(b.textDirSpec, filepath.FromSlash(file)))
+			ids[file] = fileIDs
+		}
+		switch {
+		case fileIDs == nil:
+			failAt(desc.Line, "longdesc %s links to %s which is not a section file of the book", desc.Href, file)
+		case fragment != "" && !fileIDs[fragment]:
+			failAt(desc.Line, "longdesc %s links to %s but it has no element with id \"%s\"", desc.Href, file, fragment)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 23-Jan-2024
+//
+// The audio and video files of the book, from the attribute "media".
+
+package gen
+
+import (
+	"path"
+	"strings"
+)
+
+// mediaFolder is the conventional folder of the audio and video files in the book directory.
+const mediaFolder = "Media"
+
+// mediaTypes maps the lowercase file extensions of the audio and video files to their media types.
+var mediaTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg; codecs=opus",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+}
+
+// CheckMediaFiles checks for the presence of the optional attribute "media", the comma-separated audio and
+// video files played by the <audio> and <video> elements of the sections. Each file is looked for like an
+// image, see fileLocations, and is packaged in the media directory with the files referenced from the
+// stylesheet. Fails if a file is missing or is not an MP3, MP4, Ogg or WebM file.
+func (b *InputBuffer) CheckMediaFiles() (err error) {
+	defer catch(&err)
+	value := b.attributes.get("media")
+	if value == "" {
+		return
+	}
+	for _, mediaFile := range strings.Split(value, ",") {
+		mediaFile = strings.TrimSpace(mediaFile)
+		fileName := path.Base(mediaFile)
+		mediaType, known := mediaTypes[strings.ToLower(path.Ext(fileName))]
+		if !known {
+			fail("%s in attribute 'media' is not an MP3, MP4, Ogg or WebM file", mediaFile)
+		}
+		source, found := b.locateFile(mediaFile, mediaFolder)
+		if !found {
+			fail("media file %s not found in %s (looked for %s)",
+				mediaFile, b.sourceDirSpec, strings.Join(fileLocations(mediaFile, mediaFolder), ", "))
+		}
+		if packaged, exists := b.packagedMedia(fileName); exists {
+			if packaged.source != source {
+				fail("media files %s and %s have the same name, which must be unique in the %s directory of the package",
+					packaged.source, source, b.layout.MediaDir)
+			}
+			b.warn("%s is listed more than once in attribute 'media'; the repeated declaration is unnecessary", mediaFile)
+			continue
+		}
+		b.resources = append(b.resources, ResourceData{
+			ID:        "media-" + fileName,
+			Href:      b.layout.mediaHref(fileName),
+			MediaType: mediaType,
+			source:    source,
+		})
+	}
+	return nil
+}
+
+// packagedMedia returns the audio or video file of the attribute "media" with the file name, if any.
+func (b *InputBuffer) packagedMedia(fileName string) (ResourceData, bool) {
+	for _, resource := range b.resources {
+		if resource.source != "" && resource.Href == b.layout.mediaHref(fileName) {
+			return resource, true
+		}
+	}
+	return ResourceData{}, false
+}
+
+// mediaAtSource returns the packaged audio or video file which is at the path in the book directory, such as
+// Media/theme.mp3, if the path is not a bare file name.
+func (b *InputBuffer) mediaAtSource(source string) (ResourceData, bool) {
+	if !strings.Contains(source, "/") {
+		return ResourceData{}, false
+	}
+	for _, resource := range b.resources {
+		if resource.source != "" && resource.source == source {
+			return resource, true
+		}
+	}
+	return ResourceData{}, false
+}
+
+// mediaHref returns the href of the audio or video file relative to the section files, such as
+// ../Media/theme.mp3.
+func (c *Context) mediaHref(fileName string) string {
+	return path.Join("..", c.layout.mediaHref(fileName))
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 28-Nov-2023
+//
+// Heuristic check for chapters merged into one because of a missing <!--chapter--> directive.
+
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// romanNumeralPattern matches a Roman numeral from I to MMMCMXCIX written by the usual rules, such as XIV, and
+// neither the empty string nor words made of the same letters, such as "Civil". Each alternative starts with
+// a non-empty thousands, hundreds, tens or units digit, followed by the optional lower digits.
+const romanNumeralPattern = `(?:m{1,3}` + romanHundreds + romanTens + romanUnits +
+	`|(?:cm|cd|dc{0,3}|c{1,3})` + romanTens + romanUnits +
+	`|(?:xc|xl|lx{0,3}|x{1,3})` + romanUnits +
+	`|(?:ix|iv|vi{0,3}|i{1,3}))`
+
+// The digits of a Roman numeral, each of which may be empty.
+const (
+	romanHundreds = `(?:cm|cd|d?c{0,3})`
+	romanTens     = `(?:xc|xl|l?x{0,3})`
+	romanUnits    = `(?:ix|iv|v?i{0,3})`
+)
+
+// defaultChapterHeadingPattern matches the <h1> and <h2> headings which usually start a chapter: those
+// starting with "Chapter" or "Part", and those holding just a number such as "12" or "XIV.".
+const defaultChapterHeadingPattern = `(?i)^<h[12]\b[^>]*>\s*(chapter\b|part\b|[0-9]+\.?\s*<|` + romanNumeralPattern + `\.?\s*<)`
+
+// StartMergedChapterCheck enables the warning for a chapter heading found in the middle of the body of a
+// part or chapter, using the given regular expression or the default one if empty. The book can turn the
+// check off with the attribute "chapter-check" set to "off".
+func (b *InputBuffer) StartMergedChapterCheck(pattern string) (err error) {
+	defer catch(&err)
+	if strings.EqualFold(b.attributes.get("chapter-check"), "off") {
+		b.RegisterFeature("merged chapter check", false, "turned off by the 'chapter-check' attribute")
+		return
+	}
+	if pattern == "" {
+		pattern = defaultChapterHeadingPattern
+	}
+	chapterHeading, err := regexp.Compile(pattern)
+	if err != nil {
+		fail("config parameter 'chapter_heading_pattern' is not a valid regular expression: %s", err.Error())
+	}
+	b.chapterHeading = chapterHeading
+	b.RegisterFeature("merged chapter check", true, "")
+	return nil
+}
+
+// checkMergedChapter warns if the current line, in the body of the given section, is a heading which looks
+// like the start of another chapter. Headings placed right after a <!--tocentry--> marker are subheadings
+// meant to be there and are not checked.
+func (b *InputBuffer) checkMergedChapter(section SectionData, afterTocEntry bool) {
+	if b.chapterHeading == nil || afterTocEntry || !b.chapterHeading.MatchString(b.CurrLine) {
+		return
+	}
+	fmt.Fprintln(b.out)
+	b.warn("line %d: %s inside %s (%s) looks like the start of a chapter; is a <!--chapter--> directive missing before it?",
+		b.LineNo(), b.CurrLine, section.ID, section.Heading)
+}
@@ -0,0 +1,44 @@
+package gen
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestDefaultChapterHeadingPattern(t *testing.T) {
+	chapterHeading := regexp.MustCompile(defaultChapterHeadingPattern)
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"<h2>Chapter 3</h2>", true},
+		{`<h1 class="chapter">Part Two</h1>`, true},
+		{"<h2>12</h2>", true},
+		{"<h2>12.</h2>", true},
+		{"<h2>XIV</h2>", true},
+		{"<h2>xiv.</h2>", true},
+		{"<h2> IV </h2>", true},
+		{"<h1>V</h1>", true},
+		{"<h2>XL</h2>", true},
+		{"<h2>XCIX</h2>", true},
+		{"<h2>CD</h2>", true},
+		{"<h2>MCMLXXXIV</h2>", true},
+		{"<h2>Civil</h2>", false},
+		{"<h2>Mild</h2>", false},
+		{"<h2>Vivid</h2>", false},
+		{"<h2>IIII</h2>", false},
+		{"<h2>VV</h2>", false},
+		{"<h2>IC</h2>", false},
+		{"<h2>XIV and more</h2>", false},
+		{"<h2></h2>", false},
+		{"<h2><i>Interlude</i></h2>", false},
+		{"<h2>Chapters of a Life</h2>", false},
+		{"<h3>Chapter 1</h3>", false},
+		{"<p>Chapter 1</p>", false},
+	}
+	for _, test := range tests {
+		if got := chapterHeading.MatchString(test.line); got != test.want {
+			t.Errorf("%s matched = %t, want %t", test.line, got, test.want)
+		}
+	}
+}
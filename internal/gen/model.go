@@ -0,0 +1,86 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 07-Nov-2023
+//
+// Export of the parsed book model.
+
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+	"github.com/roslamir/ep3gen/model"
+)
+
+// NewModel returns the parsed book model. Must be called after all the sections have been generated.
+func (b *InputBuffer) NewModel() model.Book {
+	book := model.Book{
+		SchemaVersion: model.SchemaVersion,
+		Attributes:    b.attributes.values,
+		Sections:      make([]model.Section, 0, len(b.sections)),
+		CoverImage:    model.Image{FileName: b.coverImage.FileName, MediaType: b.coverImage.MediaType},
+		Images:        make([]model.Image, 0, len(b.images)),
+		Guides:        make([]string, 0, len(b.guides)),
+		Structure:     make([]model.Node, 0, len(b.sections)),
+	}
+
+	for _, section := range b.sections {
+		lines := b.bodies[section.ID]
+		if lines == nil {
+			lines = []string{} // generated sections, such as the cover, have no source lines
+		}
+		book.Sections = append(book.Sections, model.Section{
+			ID:      section.ID,
+			Kind:    string(section.EpubType),
+			Heading: section.Heading,
+			Lines:   lines,
+			Assets:  section.Assets,
+		})
+	}
+
+	if len(b.styleAssets) > 0 {
+		book.StyleAssets = sortedAssets(b.styleAssets)
+	}
+
+	for _, image := range b.sortedImages() {
+		book.Images = append(book.Images, model.Image{FileName: image.FileName, MediaType: image.MediaType})
+	}
+
+	for _, guide := range b.guides {
+		book.Guides = append(book.Guides, guide.ID)
+	}
+
+	// Chapters following a part are nested under it until the next part or a section which is not a chapter.
+	currPart := -1
+	for _, section := range b.sections {
+		node := model.Node{ID: section.ID}
+		switch {
+		case section.EpubType == epubtype.Part:
+			book.Structure = append(book.Structure, node)
+			currPart = len(book.Structure) - 1
+		case section.EpubType == epubtype.Chapter && currPart >= 0:
+			book.Structure[currPart].Children = append(book.Structure[currPart].Children, node)
+		default:
+			book.Structure = append(book.Structure, node)
+			if section.EpubType != epubtype.Chapter {
+				currPart = -1
+			}
+		}
+	}
+	return book
+}
+
+// WriteModel writes the book model as JSON to the given file.
+func (c *Context) WriteModel(book model.Book, fileSpec string) (err error) {
+	defer catch(&err)
+	fmt.Fprintf(c.out, "Generating file %s (MODEL) ... ", fileSpec)
+
+	content, err := json.MarshalIndent(book, "", "  ")
+	check(err)
+	check(os.WriteFile(fileSpec, append(content, '\n'), 0660))
+
+	fmt.Fprintln(c.out, "done")
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 18-Oct-2023
+//
+// Summary of the generated TOC and the check that its links resolve.
+
+package gen
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+var (
+	// navTokenRegexp matches the tokens of nav.xhtml that make up the TOC tree: the <nav> and <ol> tags,
+	// the <a> elements with their label, and the <span> labels of the entries with no link.
+	navTokenRegexp = regexp.MustCompile(`(?s)<(/?)(nav|ol)\b([^>]*)>|<a\b([^>]*)>(.*?)</a>|<span\b[^>]*>(.*?)</span>`)
+
+	// ncxSrcRegexp matches the link target of a navPoint in toc.ncx.
+	ncxSrcRegexp = regexp.MustCompile(`<content\s+src="([^"]*)"`)
+
+	// hrefRegexp and idRegexp match the href and id attributes of an element.
+	hrefRegexp = regexp.MustCompile(`\bhref="([^"]*)"`)
+	idRegexp   = regexp.MustCompile(`\sid="([^"]*)"`)
+
+	// markupRegexp matches the tags inside a label.
+	markupRegexp = regexp.MustCompile(`<[^>]*>`)
+)
+
+// navLink is a link found in nav.xhtml or toc.ncx.
+type navLink struct {
+	Depth int    // the nesting level in the TOC, 0 for the top level
+	Label string // the text of the link, without markup
+	Href  string // the link target, relative to the OEBPS directory
+	Bare  bool   // a label with no link, nesting the entries below it
+}
+
+// scanNavLinks returns the links in the given nav (with the given epub:type) of the generated nav.xhtml.
+func (c *Context) scanNavLinks(content string, navType epubtype.Term) []navLink {
+	links := make([]navLink, 0, 50)
+	inNav, depth := false, 0
+	for _, token := range navTokenRegexp.FindAllStringSubmatch(content, -1) {
+		switch {
+		case token[2] == "nav" && token[1] == "":
+			inNav = strings.Contains(token[3], `epub:type="`+string(navType)+`"`)
+			depth = -1
+		case token[2] == "nav":
+			inNav = false
+		case !inNav:
+		case token[2] == "ol" && token[1] == "":
+			depth++
+		case token[2] == "ol":
+			depth--
+		case strings.HasPrefix(token[0], "<span"):
+			label := strings.TrimSpace(markupRegexp.ReplaceAllString(token[6], ""))
+			links = append(links, navLink{Depth: depth, Label: label, Bare: true})
+		default:
+			href := ""
+			if match := hrefRegexp.FindStringSubmatch(token[4]); match != nil {
+				href = path.Join(c.layout.TextDir, match[1])
+			}
+			label := strings.TrimSpace(markupRegexp.ReplaceAllString(token[5], ""))
+			links = append(links, navLink{Depth: depth, Label: label, Href: href})
+		}
+	}
+	return links
+}
+
+// PrintNavTree prints the TOC of the generated nav.xhtml as an indented tree with the link targets.
+func (c *Context) PrintNavTree() (err error) {
+	defer catch(&err)
+	content := readGenerated(filepath.Join(c.textDirSpec, "nav.xhtml"))
+	fmt.Fprintln(c.out, "\nTable of contents:")
+	for _, link := range c.scanNavLinks(content, epubtype.TOC) {
+		if link.Bare {
+			fmt.Fprintf(c.out, "  %s%s\n", strings.Repeat("  ", link.Depth), link.Label)
+			continue
+		}
+		fmt.Fprintf(c.out, "  %s%s -> %s\n", strings.Repeat("  ", link.Depth), link.Label, link.Href)
+	}
+	return nil
+}
+
+// CheckNavTargets checks that every link in nav.xhtml and toc.ncx points to a file in the OEBPS
+// directory and, when it has a fragment, to an element with that id in the file.
+// Catches broken template edits and anchors early with a message naming the link.
+func (c *Context) CheckNavTargets() (err error) {
+	defer catch(&err)
+	navFile := filepath.Join(c.textDirSpec, "nav.xhtml")
+	ncxFile := filepath.Join(c.packageDirSpec, "toc.ncx")
+
+	type source struct {
+		name  string
+		links []navLink
+	}
+	content := readGenerated(navFile)
+	sources := []source{
+		{"nav.xhtml", append(c.scanNavLinks(content, epubtype.TOC), c.scanNavLinks(content, epubtype.Landmarks)...)},
+		{"toc.ncx", nil},
+	}
+	for _, match := range ncxSrcRegexp.FindAllStringSubmatch(readGenerated(ncxFile), -1) {
+		sources[1].links = append(sources[1].links, navLink{Href: match[1]})
+	}
+
+	ids := make(map[string]map[string]bool) // the ids in each target file, scanned once
+	failures := make([]string, 0)
+	for _, source := range sources {
+		for _, link := range source.links {
+			if link.Bare {
+				continue
+			}
+			file, fragment, _ := strings.Cut(link.Href, "#")
+			if file == "" {
+				failures = append(failures, fmt.Sprintf("%s has a link without a target (%s)", source.name, link.Label))
+				continue
+			}
+			fileIDs, scanned := ids[file]
+			if !scanned {
+				fileIDs = scanIDs(filepath.Join(c.packageDirSpec, filepath.FromSlash(file)))
+				ids[file] = fileIDs
+			}
+			switch {
+			case fileIDs == nil:
+				failures = append(failures, fmt.Sprintf("%s links to %s which does not exist", source.name, link.Href))
+			case fragment != "" && !fileIDs[fragment]:
+				failures = append(failures, fmt.Sprintf("%s links to %s but %s has no element with id \"%s\"",
+					source.name, link.Href, file, fragment))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		fail("unresolved TOC links:\n  %s", strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// scanIDs returns the set of id attribute values in the given XHTML file, or nil if the file does not exist.
+func scanIDs(fileSpec string) map[string]bool {
+	content, err := os.ReadFile(fileSpec)
+	if err != nil {
+		return nil
+	}
+	ids := make(map[string]bool)
+	for _, match := range idRegexp.FindAllStringSubmatch(string(content), -1) {
+		ids[match[1]] = true
+	}
+	return ids
+}
+
+// readGenerated returns the content of the given generated file.
+func readGenerated(fileSpec string) string {
+	content, err := os.ReadFile(fileSpec)
+	if err != nil {
+		fail("cannot read generated file %s: %s", fileSpec, err.Error())
+	}
+	return string(content)
+}
@@ -0,0 +1,201 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 10-Dec-2023
+//
+// Notes written inline with <!--footnote--> and collected into the generated endnotes section.
+
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+const (
+	notesSectionID = "notes"
+	notesFile      = notesSectionID + ".xhtml"
+)
+
+var (
+	// noteRefRegexp matches the start tag of a note reference, an <a> element with the class noteref.
+	noteRefRegexp = regexp.MustCompile(`<a\s[^>]*\bclass="(?:[^"]*\s)?noteref(?:\s[^"]*)?"[^>]*>`)
+
+	// noteHrefRegexp matches the href attribute of a note reference pointing to a note by its fragment.
+	noteHrefRegexp = regexp.MustCompile(`\shref="#([^"]+)"`)
+
+	// idAttrRegexp matches the id attribute of a start tag.
+	idAttrRegexp = regexp.MustCompile(`\sid="([^"]+)"`)
+)
+
+// noteData is a note read from a <!--footnote--> block.
+type noteData struct {
+	ID       string
+	Line     int      // the source line of the directive
+	Lines    []string // the body lines of the note
+	Backlink string   // the href of the first reference to the note, empty if there is none
+}
+
+// noteRef is a reference to a note from the text of a section.
+type noteRef struct {
+	NoteID string
+	Href   string // the section file name with the id of the reference
+	Line   int    // the source line of the reference, 0 if not found
+}
+
+type notesTemplateData struct {
+	pageSetup
+	Title    string
+	ID       string
+	EpubType epubtype.Term
+	Heading  string
+	Notes    []noteData
+}
+
+// readFootnote reads the note started by the <!--footnote id="..."--> directive on the current line, up to the
+// next directive or the end of the file, and leaves the current line there. A note ID must be unique in the book.
+func (b *InputBuffer) readFootnote(directive Directive) {
+	id := directive.Args["id"]
+	if id == notesSectionID {
+		failAt(directive.Line, "note id %s is reserved for the notes section", id)
+	}
+	for _, note := range b.notes {
+		if note.ID == id {
+			failAt(directive.Line, "note id %s already defined on line %d", id, note.Line)
+		}
+	}
+
+	lines := make([]string, 0, 5)
+	for b.Next() && !isDirective(b.CurrLine) {
+		if line, ok := b.bodyText(); ok && b.CurrLine != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		failAt(directive.Line, "<!--footnote id=\"%s\"--> has no content", id)
+	}
+	b.notes = append(b.notes, noteData{ID: id, Line: directive.Line, Lines: lines})
+}
+
+// rewriteNoteRefs turns the note references <a class="noteref" href="#id"> in the section lines into
+// epub:type="noteref" links to the note in the notes section, and gives each one an id for the backlink.
+func (b *InputBuffer) rewriteNoteRefs(section SectionData, lines []string) {
+	for i, line := range lines {
+		if !strings.Contains(line, "noteref") {
+			continue
+		}
+		sourceLine := b.sourceLineOf(strings.TrimSpace(line))
+		lines[i] = noteRefRegexp.ReplaceAllStringFunc(line, func(tag string) string {
+			match := noteHrefRegexp.FindStringSubmatch(tag)
+			if match == nil {
+				return tag // not a reference by fragment, e.g. already pointing to the notes section
+			}
+			noteID := match[1]
+			tag = strings.Replace(tag, match[0], ` href="`+notesFile+`#`+noteID+`"`, 1)
+
+			// Each attribute is added in front of the others, so the last one added comes first.
+			if !strings.Contains(tag, "role=") {
+				tag = strings.Replace(tag, "<a ", `<a role="`+epubtype.Noteref.Role()+`" `, 1)
+			}
+			if !strings.Contains(tag, "epub:type=") {
+				tag = strings.Replace(tag, "<a ", `<a epub:type="`+string(epubtype.Noteref)+`" `, 1)
+			}
+			var refID string
+			if id := idAttrRegexp.FindStringSubmatch(tag); id != nil {
+				refID = id[1]
+			} else {
+				refID = b.noteRefID(noteID)
+				tag = strings.Replace(tag, "<a ", `<a id="`+refID+`" `, 1)
+			}
+			b.noteRefs = append(b.noteRefs, noteRef{NoteID: noteID, Href: section.FileName() + "#" + refID, Line: sourceLine})
+			return tag
+		})
+	}
+}
+
+// noteRefID returns the id of the next reference to the note, numbered from the second reference on
+// so that a note referenced more than once still gets distinct ids.
+func (b *InputBuffer) noteRefID(noteID string) string {
+	count := 1
+	for _, ref := range b.noteRefs {
+		if ref.NoteID == noteID {
+			count++
+		}
+	}
+	if count == 1 {
+		return "noteref-" + noteID
+	}
+	return fmt.Sprintf("noteref-%s-%d", noteID, count)
+}
+
+// GenNotesSection generates the endnotes section from the notes of all the sections, if there are any.
+// It must be called after all the sections are generated, and fails on a reference to an undefined note.
+// Each note links back to its first reference.
+func (b *InputBuffer) GenNotesSection() (err error) {
+	defer catch(&err)
+	if len(b.notes) == 0 && len(b.noteRefs) == 0 {
+		return nil
+	}
+	section := SectionData{
+		ID:       notesSectionID,
+		EpubType: epubtype.Endnotes,
+		Heading:  b.DefaultHeading("footnote"),
+	}
+
+	// Process the lines of all the notes at once, then hand each note its own part of the result.
+	// The references from one note to another are rewritten here, so they are checked with the others below.
+	lines := make([]string, 0, 10*len(b.notes))
+	for _, note := range b.notes {
+		lines = append(lines, note.Lines...)
+	}
+	b.processSection(section, lines)
+	start := 0
+	for i := range b.notes {
+		end := start + len(b.notes[i].Lines)
+		b.notes[i].Lines = joinPreformatted(lines[start:end])
+		start = end
+	}
+
+	notes := make(map[string]*noteData, len(b.notes))
+	for i := range b.notes {
+		notes[b.notes[i].ID] = &b.notes[i]
+	}
+	for _, ref := range b.noteRefs {
+		note, found := notes[ref.NoteID]
+		if !found {
+			failAt(ref.Line, "reference to undefined note %s", ref.NoteID)
+		}
+		if note.Backlink == "" {
+			note.Backlink = ref.Href
+		}
+	}
+	for _, note := range b.notes {
+		if note.Backlink == "" {
+			b.warn("note %s on line %d is never referenced", note.ID, note.Line)
+		}
+	}
+	if !b.hasTemplate(notesTemplate) {
+		fail("template %s not found in templates_dir", notesTemplate)
+	}
+
+	b.sections = append(b.sections, section)
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", notesFile, section.Heading)
+
+	outfile := b.createSectionFile(section)
+	defer outfile.Close()
+
+	// Struct to pass to the template
+	data := notesTemplateData{
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+		Heading:   section.Heading,
+		Notes:     b.notes,
+	}
+	b.render(outfile, notesFile, notesTemplate, data)
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
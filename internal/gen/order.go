@@ -0,0 +1,119 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 27-Dec-2023
+//
+// Re-ordering of the bodymatter sections by the order.yaml file in the book directory.
+
+package gen
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+const orderFile = "order.yaml"
+
+// ReorderBodymatter re-orders the part and chapter sections by order.yaml in the book directory, if there is one.
+// The file is a list of the sections in the desired spine order, each given by its ID or by its heading, e.g.
+// "- section004" or "- The Black Spot". Every part and chapter must be listed exactly once, and a book with
+// parts must start with a part. The frontmatter and backmatter sections keep their places. Must be called
+// once all the bodymatter sections are read and before the backmatter.
+func (b *InputBuffer) ReorderBodymatter() (err error) {
+	defer catch(&err)
+	content, err := fs.ReadFile(b.sourceFS, orderFile)
+	if os.IsNotExist(err) {
+		b.RegisterFeature("section order", false, "no "+orderFile+" in the book directory")
+		return nil
+	}
+	check(err)
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		fail("error parsing %s: %s", orderFile, err.Error())
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.SequenceNode {
+		fail("%s must be a list of the part and chapter sections by ID or heading, such as '- section004'", orderFile)
+	}
+
+	// The bodymatter is the run of parts and chapters following the frontmatter.
+	start := 0
+	for start < len(b.sections) && !isBodymatter(b.sections[start]) {
+		start++
+	}
+	end := start
+	for end < len(b.sections) && isBodymatter(b.sections[end]) {
+		end++
+	}
+	bodymatter := b.sections[start:end]
+
+	ordered := make([]SectionData, 0, len(bodymatter))
+	listedOn := make(map[string]int) // the line of order.yaml listing each section
+	for _, entry := range root.Content[0].Content {
+		name := strings.TrimSpace(entry.Value)
+		if entry.Kind != yaml.ScalarNode || name == "" {
+			fail("%s line %d: each entry must be the ID or the heading of a section", orderFile, entry.Line)
+		}
+		index := -1
+		for i, section := range bodymatter {
+			if section.ID == name {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			for i, section := range bodymatter {
+				if section.Heading != name {
+					continue
+				}
+				if index != -1 {
+					fail("%s line %d: the heading '%s' is that of both %s and %s; use the ID instead",
+						orderFile, entry.Line, name, bodymatter[index].ID, section.ID)
+				}
+				index = i
+			}
+		}
+		if index == -1 {
+			fail("%s line %d: there is no part or chapter with the ID or heading '%s'", orderFile, entry.Line, name)
+		}
+		section := bodymatter[index]
+		if line, listed := listedOn[section.ID]; listed {
+			fail("%s line %d: %s (%s) is already listed on line %d", orderFile, entry.Line, section.ID, section.Heading, line)
+		}
+		listedOn[section.ID] = entry.Line
+		ordered = append(ordered, section)
+	}
+
+	missing := make([]string, 0)
+	for _, section := range bodymatter {
+		if _, listed := listedOn[section.ID]; !listed {
+			missing = append(missing, fmt.Sprintf("%s (%s)", section.ID, section.Heading))
+		}
+	}
+	if len(missing) > 0 {
+		fail("%s does not list the bodymatter sections %s", orderFile, strings.Join(missing, ", "))
+	}
+	if bodymatter[0].EpubType == epubtype.Part && ordered[0].EpubType != epubtype.Part {
+		fail("%s line %d: the book has parts, so the first section must be a part, not %s (%s)",
+			orderFile, listedOn[ordered[0].ID], ordered[0].ID, ordered[0].Heading)
+	}
+
+	// The start of the bodymatter in the landmarks follows the first section.
+	for i := range b.guides {
+		if b.guides[i].ID == bodymatter[0].ID {
+			b.guides[i] = ordered[0]
+		}
+	}
+	copy(bodymatter, ordered)
+	b.RegisterFeature("section order", true, "")
+	return nil
+}
+
+// isBodymatter returns true if the section is a part or a chapter.
+func isBodymatter(section SectionData) bool {
+	return section.EpubType == epubtype.Part || section.EpubType == epubtype.Chapter
+}
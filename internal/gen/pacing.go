@@ -0,0 +1,220 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 30-Sep-2023
+//
+// Word counts and the chapter pacing report.
+
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+const (
+	defaultTermWidth = 80 // used when the terminal width is unknown
+	pacingLabelWidth = 28 // width of the chapter label column
+	pacingCountWidth = 16 // width of the word count and percentage columns
+)
+
+// ChapterPacing holds the pacing figures for a single chapter.
+type ChapterPacing struct {
+	ID      string  `json:"id"`
+	Heading string  `json:"heading"`
+	Part    string  `json:"part,omitempty"`
+	Words   int     `json:"words"`
+	Percent float64 `json:"percent"`
+	Outlier bool    `json:"outlier"`
+}
+
+// PartPacing holds the word count subtotal of a part and the cumulative count at its end.
+type PartPacing struct {
+	ID         string `json:"id"`
+	Heading    string `json:"heading"`
+	Words      int    `json:"words"`
+	Cumulative int    `json:"cumulative"`
+}
+
+// Pacing holds the chapter pacing report.
+type Pacing struct {
+	TotalWords int             `json:"totalWords"`
+	Median     int             `json:"median"`
+	Factor     float64         `json:"factor"`
+	Chapters   []ChapterPacing `json:"chapters"`
+	Parts      []PartPacing    `json:"parts,omitempty"`
+}
+
+// countWords returns the number of words in the text content of the lines, ignoring the markup.
+func countWords(lines []string) int {
+	count := 0
+	for _, line := range lines {
+		count += len(strings.Fields(html.UnescapeString(stripTags(line))))
+	}
+	return count
+}
+
+// WordCount returns the total number of words in all the sections.
+func (b *InputBuffer) WordCount() int {
+	total := 0
+	for _, count := range b.wordCounts {
+		total += count
+	}
+	return total
+}
+
+// CheckWordCount stops the build when the sections hold fewer words than the min_words config key, as a
+// truncated source or a bad merge still builds without an error. It warns when the number of words dropped
+// by more than the max_word_drop config key, in percent, since the last build recorded in the state file.
+func (b *InputBuffer) CheckWordCount(stateFileSpec string) (err error) {
+	defer catch(&err)
+	words := b.WordCount()
+	if words < b.parms.MinWords {
+		fail("the book has only %d words, fewer than the %d of config key 'min_words'; check that the source is complete",
+			words, b.parms.MinWords)
+	}
+	var state buildState
+	content, err := os.ReadFile(stateFileSpec)
+	if err == nil {
+		err = json.Unmarshal(content, &state)
+	}
+	if err != nil || state.Words == 0 {
+		return nil // no word count from a previous build
+	}
+	if drop := float64(state.Words-words) * 100 / float64(state.Words); drop > b.parms.MaxWordDrop {
+		b.warn("the book has %d words, %.0f%% fewer than the %d of the last build; check that the source is complete",
+			words, drop, state.Words)
+	}
+	return nil
+}
+
+// NewPacing computes the pacing figures for the chapters. A chapter is an outlier when its length
+// is more than factor times the median or less than the median divided by factor.
+func (b *InputBuffer) NewPacing(factor float64) Pacing {
+	pacing := Pacing{Factor: factor}
+	var currPart *PartPacing
+	cumulative := 0
+	for _, section := range b.sections {
+		switch section.EpubType {
+		case epubtype.Part:
+			pacing.Parts = append(pacing.Parts, PartPacing{ID: section.ID, Heading: section.Heading, Cumulative: cumulative})
+			currPart = &pacing.Parts[len(pacing.Parts)-1]
+		case epubtype.Chapter:
+			words := b.wordCounts[section.ID]
+			chapter := ChapterPacing{ID: section.ID, Heading: section.Heading, Words: words}
+			if currPart != nil {
+				chapter.Part = currPart.ID
+				currPart.Words += words
+			}
+			cumulative += words
+			if currPart != nil {
+				currPart.Cumulative = cumulative
+			}
+			pacing.Chapters = append(pacing.Chapters, chapter)
+		}
+	}
+	pacing.TotalWords = cumulative
+	if len(pacing.Chapters) == 0 {
+		return pacing
+	}
+
+	counts := make([]int, len(pacing.Chapters))
+	for i, chapter := range pacing.Chapters {
+		counts[i] = chapter.Words
+	}
+	sort.Ints(counts)
+	if n := len(counts); n%2 == 1 {
+		pacing.Median = counts[n/2]
+	} else {
+		pacing.Median = (counts[n/2-1] + counts[n/2]) / 2
+	}
+
+	for i := range pacing.Chapters {
+		chapter := &pacing.Chapters[i]
+		if pacing.TotalWords > 0 {
+			chapter.Percent = float64(chapter.Words) * 100 / float64(pacing.TotalWords)
+		}
+		median := float64(pacing.Median)
+		words := float64(chapter.Words)
+		chapter.Outlier = words > median*factor || words < median/factor
+	}
+	return pacing
+}
+
+// PrintPacing prints the pacing report as a bar chart scaled to the terminal width.
+func (c *Context) PrintPacing(pacing Pacing) {
+	fmt.Fprintf(c.out, "\nChapter pacing: %d words in %d chapters, median %d words (outliers marked * deviate more than %gx)\n",
+		pacing.TotalWords, len(pacing.Chapters), pacing.Median, pacing.Factor)
+	if len(pacing.Chapters) == 0 {
+		return
+	}
+
+	longest := 0
+	for _, chapter := range pacing.Chapters {
+		if chapter.Words > longest {
+			longest = chapter.Words
+		}
+	}
+	barWidth := terminalWidth() - pacingLabelWidth - pacingCountWidth - 4
+	if barWidth < 10 {
+		barWidth = 10
+	}
+
+	partIndex := -1
+	for _, chapter := range pacing.Chapters {
+		// Print the subtotal of the previous part whenever a new part starts.
+		if chapter.Part != "" && (partIndex == -1 || pacing.Parts[partIndex].ID != chapter.Part) {
+			if partIndex >= 0 {
+				c.printPartSubtotal(pacing.Parts[partIndex])
+			}
+			for partIndex++; pacing.Parts[partIndex].ID != chapter.Part; partIndex++ {
+				c.printPartSubtotal(pacing.Parts[partIndex]) // a part without chapters
+			}
+			fmt.Fprintf(c.out, "%s\n", pacing.Parts[partIndex].Heading)
+		}
+
+		bar := 0
+		if longest > 0 {
+			bar = chapter.Words * barWidth / longest
+		}
+		marker := " "
+		if chapter.Outlier {
+			marker = "*"
+		}
+		fmt.Fprintf(c.out, "%s %s %s%s %7d %5.1f%%\n", marker, padLabel(chapter.Heading, pacingLabelWidth),
+			strings.Repeat("#", bar), strings.Repeat(" ", barWidth-bar), chapter.Words, chapter.Percent)
+	}
+	if partIndex >= 0 {
+		for ; partIndex < len(pacing.Parts); partIndex++ {
+			c.printPartSubtotal(pacing.Parts[partIndex])
+		}
+	}
+}
+
+// printPartSubtotal prints the word count of a part and the cumulative count at its end.
+func (c *Context) printPartSubtotal(part PartPacing) {
+	fmt.Fprintf(c.out, "  -- %s: %d words, %d cumulative\n", part.Heading, part.Words, part.Cumulative)
+}
+
+// padLabel shortens or pads the label to exactly width runes.
+func padLabel(label string, width int) string {
+	count := utf8.RuneCountInString(label)
+	if count > width {
+		return string([]rune(label)[:width-1]) + "…"
+	}
+	return label + strings.Repeat(" ", width-count)
+}
+
+// terminalWidth returns the terminal width from the COLUMNS environment variable, if set.
+func terminalWidth() int {
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return defaultTermWidth
+}
@@ -0,0 +1,121 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+	"github.com/roslamir/ep3gen/internal/parm"
+)
+
+// pacingBuffer returns the buffer of a synthetic book with two parts of two chapters each of the given
+// lengths, and a last part without chapters.
+func pacingBuffer(t *testing.T, out io.Writer, words ...int) *InputBuffer {
+	t.Helper()
+	b := testBuffer(t)
+	b.Context = NewContext(parm.Defaults(), out)
+	b.sections = testSections(epubtype.Part, epubtype.Chapter, epubtype.Chapter, epubtype.Part, epubtype.Chapter,
+		epubtype.Chapter, epubtype.Part)
+	chapter := 0
+	for i := range b.sections {
+		id := b.sections[i].ID
+		b.sections[i].Heading = strings.ToUpper(id[:1]) + id[1:]
+		if b.sections[i].EpubType == epubtype.Chapter {
+			b.wordCounts[b.sections[i].ID] = words[chapter]
+			chapter++
+		}
+	}
+	return b
+}
+
+func TestNewPacing(t *testing.T) {
+	pacing := pacingBuffer(t, io.Discard, 100, 200, 300, 1000).NewPacing(2)
+	if pacing.TotalWords != 1600 || pacing.Median != 250 || pacing.Factor != 2 {
+		t.Errorf("total %d, median %d, factor %g, want 1600, 250 and 2", pacing.TotalWords, pacing.Median, pacing.Factor)
+	}
+	wantChapters := []ChapterPacing{
+		{ID: "chapter2", Heading: "Chapter2", Part: "part1", Words: 100, Percent: 6.25, Outlier: true},
+		{ID: "chapter3", Heading: "Chapter3", Part: "part1", Words: 200, Percent: 12.5},
+		{ID: "chapter5", Heading: "Chapter5", Part: "part4", Words: 300, Percent: 18.75},
+		{ID: "chapter6", Heading: "Chapter6", Part: "part4", Words: 1000, Percent: 62.5, Outlier: true},
+	}
+	if len(pacing.Chapters) != len(wantChapters) {
+		t.Fatalf("chapters = %+v, want %+v", pacing.Chapters, wantChapters)
+	}
+	for i, want := range wantChapters {
+		if pacing.Chapters[i] != want {
+			t.Errorf("chapter %d = %+v, want %+v", i+1, pacing.Chapters[i], want)
+		}
+	}
+	wantParts := []PartPacing{
+		{ID: "part1", Heading: "Part1", Words: 300, Cumulative: 300},
+		{ID: "part4", Heading: "Part4", Words: 1300, Cumulative: 1600},
+		{ID: "part7", Heading: "Part7", Words: 0, Cumulative: 1600},
+	}
+	if len(pacing.Parts) != len(wantParts) {
+		t.Fatalf("parts = %+v, want %+v", pacing.Parts, wantParts)
+	}
+	for i, want := range wantParts {
+		if pacing.Parts[i] != want {
+			t.Errorf("part %d = %+v, want %+v", i+1, pacing.Parts[i], want)
+		}
+	}
+}
+
+func TestNewPacingMedian(t *testing.T) {
+	tests := []struct {
+		words  []int
+		median int
+	}{
+		{[]int{100, 200, 300, 1000}, 250},
+		{[]int{1000, 300, 100, 200}, 250},
+		{[]int{500, 500, 500, 500}, 500},
+	}
+	for _, test := range tests {
+		pacing := pacingBuffer(t, io.Discard, test.words...).NewPacing(1.5)
+		if pacing.Median != test.median {
+			t.Errorf("median of %v = %d, want %d", test.words, pacing.Median, test.median)
+		}
+	}
+}
+
+func TestPrintPacing(t *testing.T) {
+	t.Setenv("COLUMNS", "80")
+	var out bytes.Buffer
+	b := pacingBuffer(t, &out, 100, 200, 300, 1000)
+	b.PrintPacing(b.NewPacing(2))
+
+	// The bars are scaled to the longest chapter, 1000 words for 80-28-16-4 = 32 columns.
+	bar := func(n int) string { return strings.Repeat("#", n) + strings.Repeat(" ", 32-n) }
+	label := func(heading string) string { return heading + strings.Repeat(" ", pacingLabelWidth-len(heading)) }
+	want := strings.Join([]string{
+		"",
+		"Chapter pacing: 1600 words in 4 chapters, median 250 words (outliers marked * deviate more than 2x)",
+		"Part1",
+		"* " + label("Chapter2") + " " + bar(3) + "     100   6.2%",
+		"  " + label("Chapter3") + " " + bar(6) + "     200  12.5%",
+		"  -- Part1: 300 words, 300 cumulative",
+		"Part4",
+		"  " + label("Chapter5") + " " + bar(9) + "     300  18.8%",
+		"* " + label("Chapter6") + " " + bar(32) + "    1000  62.5%",
+		"  -- Part4: 1300 words, 1600 cumulative",
+		"  -- Part7: 0 words, 1600 cumulative",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("PrintPacing printed:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestCountWords(t *testing.T) {
+	lines := []string{
+		`<p class="first">The <i>Hispaniola</i> sails&#160;today.</p>`,
+		`<p>Rock &amp; roll — <a href="#x">twice</a></p>`,
+		`<img src="map.png" alt="A map of the island"/>`,
+	}
+	if got := countWords(lines); got != 9 {
+		t.Errorf("countWords = %d, want 9", got)
+	}
+}
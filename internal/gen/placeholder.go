@@ -0,0 +1,201 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 22-Dec-2023
+//
+// Placeholder images standing in for the images not drawn yet, for the draft builds made with -placeholders.
+
+package gen
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The nominal size of the placeholder images in pixels.
+const (
+	placeholderWidth  = 600
+	placeholderHeight = 400
+)
+
+// placeholderPalette holds the background and the ink of the placeholder images.
+var placeholderPalette = color.Palette{
+	color.RGBA{0xC8, 0xC8, 0xC8, 0xFF},
+	color.RGBA{0x50, 0x50, 0x50, 0xFF},
+}
+
+// placeholderFont is a 5x7 pixel font for the file names written on the placeholder images: each row of
+// a glyph is 5 bits, the leftmost pixel in the highest bit. The letters are drawn in upper case, and
+// the characters without a glyph are drawn as '?'.
+var placeholderFont = map[rune][7]uint8{
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'A': {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'B': {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C': {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D': {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G': {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H': {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I': {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M': {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P': {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q': {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R': {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S': {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T': {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X': {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04},
+	'Z': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	'-': {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'_': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1F},
+	' ': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	'?': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+}
+
+// checkImageSource checks that the image file is in the book directory, and returns the image with the path of
+// the file, see locateImage. With the -placeholders flag, a missing image is recorded to be replaced by a
+// placeholder image when the images are copied, see CopyStaticFiles.
+func (b *InputBuffer) checkImageSource(image ImageData) ImageData {
+	if located, found := b.locateImage(image); found {
+		return located
+	}
+	if !b.parms.Placeholders {
+		fail("image file %s not found in the book directory as %s (use -placeholders to build a draft with a placeholder image)",
+			image.Source, imageLocationList(image))
+	}
+	if b.placeholders == nil {
+		b.placeholders = make(map[string]bool)
+	}
+	if !b.placeholders[image.FileName] {
+		b.warn("image file %s not found, a placeholder image is used instead", image.FileName)
+		b.placeholders[image.FileName] = true
+	}
+	return image
+}
+
+// Placeholders returns the sorted file names of the images replaced by a placeholder image.
+func (b *InputBuffer) Placeholders() []string {
+	names := make([]string, 0, len(b.placeholders))
+	for name := range b.placeholders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReportPlaceholders prints the images replaced by a placeholder image, so that a draft is not mistaken for the
+// finished e-book.
+func (b *InputBuffer) ReportPlaceholders() {
+	if len(b.placeholders) == 0 {
+		b.RegisterFeature("image placeholders", false, "no missing images")
+		return
+	}
+	b.RegisterFeature("image placeholders", true, "")
+	rule := strings.Repeat("*", 72)
+	fmt.Fprintf(b.out, "\n%s\n* DRAFT: %d image(s) replaced by a placeholder image:\n", rule, len(b.placeholders))
+	for _, name := range b.Placeholders() {
+		fmt.Fprintf(b.out, "*   %s\n", name)
+	}
+	fmt.Fprintln(b.out, rule)
+}
+
+// CheckPlaceholders refuses to package an e-book with placeholder images unless the -allow-placeholders flag
+// is given. The generated book directory is left in place for review.
+func (b *InputBuffer) CheckPlaceholders() (err error) {
+	defer catch(&err)
+	if len(b.placeholders) > 0 && !b.parms.AllowPlaceholders {
+		fail("not packaging the e-book, since %d image(s) are placeholders: %s (use -allow-placeholders to package the draft)",
+			len(b.placeholders), strings.Join(b.Placeholders(), ", "))
+	}
+	return nil
+}
+
+// writePlaceholder writes the placeholder image for the image file in the format given by its extension.
+func writePlaceholder(w io.Writer, image ImageData) error {
+	if image.MediaType == "image/svg+xml" {
+		_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">
+<rect width="100%%" height="100%%" fill="#C8C8C8" stroke="#505050" stroke-width="8"/>
+<text x="50%%" y="50%%" fill="#505050" font-family="sans-serif" font-size="24" text-anchor="middle">%s</text>
+</svg>
+`, placeholderWidth, placeholderHeight, placeholderWidth, placeholderHeight, html.EscapeString(image.FileName))
+		return err
+	}
+	img := placeholderImage(image.FileName)
+	switch image.MediaType {
+	case "image/jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	case "image/gif":
+		return gif.Encode(w, img, nil)
+	}
+	return png.Encode(w, img)
+}
+
+// placeholderImage draws the placeholder image: a grey rectangle with a border, and the file name centred
+// in it, scaled up as far as it fits.
+func placeholderImage(fileName string) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, placeholderWidth, placeholderHeight), placeholderPalette)
+	fill := func(x0, y0, x1, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	const border = 8
+	fill(0, 0, placeholderWidth, border)
+	fill(0, placeholderHeight-border, placeholderWidth, placeholderHeight)
+	fill(0, 0, border, placeholderHeight)
+	fill(placeholderWidth-border, 0, placeholderWidth, placeholderHeight)
+
+	text := []rune(strings.ToUpper(fileName))
+	scale := (placeholderWidth - 4*border) / (6 * len(text)) // each glyph takes 5 pixels and 1 of spacing
+	if scale > 6 {
+		scale = 6
+	}
+	if scale < 1 {
+		scale = 1
+		text = text[:(placeholderWidth-4*border)/6]
+	}
+	x := (placeholderWidth - (6*len(text)-1)*scale) / 2
+	y := (placeholderHeight - 7*scale) / 2
+	for _, r := range text {
+		glyph, found := placeholderFont[r]
+		if !found {
+			glyph = placeholderFont['?']
+		}
+		for row, bits := range glyph {
+			for col := 0; col < 5; col++ {
+				if bits&(0x10>>col) != 0 {
+					fill(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
+				}
+			}
+		}
+		x += 6 * scale
+	}
+	return img
+}
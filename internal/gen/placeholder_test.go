@@ -0,0 +1,67 @@
+package gen
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+	"testing"
+)
+
+func TestWritePlaceholder(t *testing.T) {
+	for _, test := range []struct {
+		fileName, mediaType, format string
+	}{
+		{"figure.png", "image/png", "png"},
+		{"photo.jpg", "image/jpeg", "jpeg"},
+		{"anim.gif", "image/gif", "gif"},
+	} {
+		var first, second bytes.Buffer
+		image1 := ImageData{FileName: test.fileName, MediaType: test.mediaType}
+		if err := writePlaceholder(&first, image1); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePlaceholder(&second, image1); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Errorf("%s: the placeholder differs between two writes", test.fileName)
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(first.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", test.fileName, err)
+		}
+		if format != test.format || config.Width != placeholderWidth || config.Height != placeholderHeight {
+			t.Errorf("%s: placeholder is a %dx%d %s image, want a %dx%d %s image", test.fileName,
+				config.Width, config.Height, format, placeholderWidth, placeholderHeight, test.format)
+		}
+	}
+
+	var svg bytes.Buffer
+	if err := writePlaceholder(&svg, ImageData{FileName: "map<1>.svg", MediaType: "image/svg+xml"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`width="600" height="400"`, ">map&lt;1&gt;.svg</text>"} {
+		if !strings.Contains(svg.String(), want) {
+			t.Errorf("no %s in the SVG placeholder:\n%s", want, svg.String())
+		}
+	}
+}
+
+func TestPlaceholderImage(t *testing.T) {
+	// The file names are drawn, and differ in the pixels.
+	if bytes.Equal(placeholderImage("a.png").Pix, placeholderImage("b.png").Pix) {
+		t.Error("the placeholders of two file names are identical")
+	}
+	// A file name too long to fit is cut, not drawn past the border.
+	img := placeholderImage(strings.Repeat("long-name-", 20) + ".png")
+	if bounds := img.Bounds(); bounds.Dx() != placeholderWidth || bounds.Dy() != placeholderHeight {
+		t.Errorf("placeholder bounds %v, want %dx%d", bounds, placeholderWidth, placeholderHeight)
+	}
+	// The centre of the background, above the text, keeps the background colour.
+	if index := img.ColorIndexAt(placeholderWidth/2, placeholderHeight/4); index != 0 {
+		t.Errorf("background pixel has colour index %d, want 0", index)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 17-Nov-2023
+//
+// The start of reading landmark, used by retailers as the start of the preview.
+
+package gen
+
+// generatedPages are the sections without content from the source, which are never the start of reading.
+var generatedPages = map[string]bool{"abbreviations": true, "halftitle": true, "loi": true, "quicknav": true, "warnings": true}
+
+// SetPreview records the preview="skip" argument of a frontmatter directive.
+func (b *InputBuffer) SetPreview(section SectionData, directive Directive) {
+	if directive.Args["preview"] == "skip" {
+		b.previewSkipped[section.ID] = true
+	}
+}
+
+// StartSection returns the section where reading starts: the first section after the copyright page
+// which is not marked preview="skip", even if it is a frontmatter section. The generated abbreviations,
+// half-title, list of illustrations and quick navigation pages are always skipped. Returns nil if there is none.
+func (b *InputBuffer) StartSection() *SectionData {
+	afterCopyright := false
+	for i, section := range b.sections {
+		if section.ID == "copyright" {
+			afterCopyright = true
+			continue
+		}
+		if afterCopyright && !b.previewSkipped[section.ID] && !generatedPages[section.ID] {
+			return &b.sections[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 28-Oct-2023
+//
+// Quick navigation page for devices without a landmarks UI.
+
+package gen
+
+import (
+	"fmt"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+// tocHeading is the label of the link to the table of contents, matching the heading in nav.gohtml.
+const tocHeading = "Table of Contents"
+
+// quickNavLink is a single link on the quick navigation page.
+type quickNavLink struct {
+	Href  string
+	Label string
+}
+
+type quicknavTemplateData struct {
+	pageSetup
+	Title    string
+	ID       string
+	EpubType epubtype.Term
+	Heading  string
+	Links    []quickNavLink
+}
+
+// AddQuickNavSection adds the quick navigation section at the current position in the spine.
+// The file itself is generated by GenQuickNavSection once all the sections are known.
+func (b *InputBuffer) AddQuickNavSection() (err error) {
+	defer catch(&err)
+	if b.quickNav != nil {
+		fail("Directive <!--quicknav--> already specified")
+	}
+	section := SectionData{
+		ID:       "quicknav",
+		EpubType: epubtype.FrontMatter,
+		Heading:  b.DefaultHeading("quicknav"),
+	}
+	b.sections = append(b.sections, section)
+	b.quickNav = &section
+	return nil
+}
+
+// InsertQuickNavSection adds the quick navigation section right after the copyright section, unless the
+// source already placed it with the <!--quicknav--> directive.
+func (b *InputBuffer) InsertQuickNavSection() {
+	if b.quickNav != nil {
+		return
+	}
+	section := SectionData{
+		ID:       "quicknav",
+		EpubType: epubtype.FrontMatter,
+		Heading:  b.DefaultHeading("quicknav"),
+	}
+	for index := range b.sections {
+		if b.sections[index].ID == "copyright" {
+			b.sections = append(b.sections[:index+1], append([]SectionData{section}, b.sections[index+1:]...)...)
+			break
+		}
+	}
+	b.quickNav = &section
+}
+
+// GenQuickNavSection generates the quick navigation page from the landmarks, if requested.
+// It must be called after all the sections are generated so that the links use the final file names.
+// The page itself is not a landmark.
+func (b *InputBuffer) GenQuickNavSection() (err error) {
+	defer catch(&err)
+	if b.quickNav == nil {
+		return
+	}
+	if !b.hasTemplate(quicknavTemplate) {
+		fail("template %s not found in templates_dir", quicknavTemplate)
+	}
+	section := *b.quickNav
+
+	fileName := section.ID + ".xhtml"
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
+
+	outfile := b.createSectionFile(section)
+	defer outfile.Close()
+
+	links := []quickNavLink{{Href: "nav.xhtml", Label: tocHeading}}
+	for _, guide := range b.guides {
+		if guide.EpubType == epubtype.Cover {
+			continue
+		}
+		links = append(links, quickNavLink{Href: guide.Href(), Label: guide.Heading})
+	}
+
+	// Struct to pass to the template
+	data := quicknavTemplateData{
+		pageSetup: b.page,
+		Title:     b.attributes.get("title"),
+		ID:        section.ID,
+		EpubType:  section.EpubType,
+		Heading:   section.Heading,
+		Links:     links,
+	}
+	b.render(outfile, fileName, quicknavTemplate, data)
+
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
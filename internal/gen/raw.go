@@ -0,0 +1,138 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 03-Jan-2024
+//
+// Hand-crafted XHTML pages copied verbatim into the spine by the <!--raw--> directive.
+
+package gen
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+)
+
+const rawPageExt = ".xhtml"
+
+var (
+	// rawAssetRegexp matches the attributes of a raw page referring to a file: src, href and xlink:href.
+	rawAssetRegexp = regexp.MustCompile(`\b(?:src|href|xlink:href)=("[^"]*"|'[^']*')`)
+
+	// scriptRegexp matches the start of a script element or an event handler attribute.
+	scriptRegexp = regexp.MustCompile(`<script\b|\son[a-z]+=`)
+)
+
+// rawPageID returns the section ID of the raw page in the file, its file name without the extension.
+func rawPageID(fileName string) string {
+	return strings.TrimSuffix(fileName, rawPageExt)
+}
+
+// checkRawFileName fails unless the file name of the <!--raw--> directive is a plain file name in the book
+// directory ending with .xhtml, whose name is a valid ID.
+func checkRawFileName(directive Directive) {
+	fileName := directive.File
+	switch {
+	case strings.ContainsAny(fileName, `/\`):
+		failAt(directive.Line, "the file %s of <!--raw--> must be in the book directory, without a path", fileName)
+	case !strings.HasSuffix(fileName, rawPageExt):
+		failAt(directive.Line, "the file %s of <!--raw--> must be an XHTML file ending with %s", fileName, rawPageExt)
+	case !identifierRegexp.MatchString(rawPageID(fileName)):
+		failAt(directive.Line, "the file name %s of <!--raw--> must be a valid ID followed by %s, such as family-tree%s",
+			fileName, rawPageExt, rawPageExt)
+	}
+}
+
+// GenRawSection copies the hand-crafted XHTML page named by the <!--raw--> directive from the book directory
+// into the Text directory as it is, with no template. The page must be well-formed, and the files it refers to
+// must be packaged images, written with their path in the package such as ../Images/tree.png; other links are
+// left alone. The page is listed in the spine, the TOC and the manifest at the place of the directive, with
+// the toc argument as its label, and with the type argument, or else the given epub:type, as its epub:type.
+// The directive takes no content lines.
+func (b *InputBuffer) GenRawSection(directive Directive, epubType epubtype.Term) (err error) {
+	defer catch(&err)
+	checkRawFileName(directive)
+	if value := directive.Args["type"]; value != "" {
+		term := epubtype.Term(value)
+		if area := term.Area(); area != epubtype.AnyArea && area != areaOf(epubType) {
+			b.warn("line %d: the epub:type %s of <!--raw--> %s belongs to the %s, but the page is placed in the %s",
+				directive.Line, term, directive.File, area, areaOf(epubType))
+		}
+		epubType = term
+	}
+	fileName := directive.File
+	content, err := fs.ReadFile(b.sourceFS, fileName)
+	if os.IsNotExist(err) {
+		failAt(directive.Line, "file %s of <!--raw--> not found in the book directory", fileName)
+	}
+	check(err)
+
+	b.currSectionNo++
+	section := SectionData{
+		ID:       rawPageID(fileName),
+		EpubType: epubType,
+		Heading:  directive.Args["toc"],
+
+		SpineProperties: spinePropertiesOf(directive),
+	}
+	if strings.Contains(string(content), "<svg") {
+		section.Properties = withProperty(section.Properties, "svg")
+	}
+	if scriptRegexp.Match(content) {
+		section.Properties = withProperty(section.Properties, "scripted")
+	}
+	b.sections = append(b.sections, section)
+	b.TraceSection(directive, section)
+
+	fmt.Fprintf(b.out, "Generating file %s (%s) ... ", fileName, section.Heading)
+	if problem := findUnbalanced(content); problem != nil && !b.parms.NoValidate {
+		failAt(directive.Line, "%s of <!--raw--> is not well-formed: line %d: %s", fileName, problem.Line, problem.Msg)
+	}
+	b.registerRawAssets(section, content)
+
+	if !b.reuseSections {
+		check(b.copySourceToPackage(fileName, filepath.Join(b.textDirSpec, fileName)))
+	}
+	b.rendered = append(b.rendered, RenderRecord{
+		File:     fileName,
+		Template: "(raw)",
+		Source:   filepath.Join(b.sourceDirSpec, fileName),
+	})
+	fmt.Fprintln(b.out, "done")
+	return nil
+}
+
+// areaOf returns the area of the book of a raw page with the given default epub:type, which tells where it is placed.
+func areaOf(epubType epubtype.Term) epubtype.Area {
+	switch epubType {
+	case epubtype.FrontMatter:
+		return epubtype.FrontArea
+	case epubtype.BackMatter:
+		return epubtype.BackArea
+	}
+	return epubtype.BodyArea
+}
+
+// registerRawAssets registers the images the raw page refers to for the list of illustrations, and fails if
+// it refers to a file in the images directory which is not packaged, or to a bare file name, which does not
+// resolve from the Text directory. Links to URLs, fragments and other pages are left alone.
+func (b *InputBuffer) registerRawAssets(section SectionData, content []byte) {
+	for _, match := range rawAssetRegexp.FindAllSubmatch(content, -1) {
+		value := string(match[1][1 : len(match[1])-1])
+		switch {
+		case value == "" || strings.ContainsAny(value, ":#"):
+			continue // a URL, a data URI or a fragment
+		case strings.HasSuffix(value, rawPageExt):
+			continue // another page of the book
+		case value == b.imageHref(filepath.Base(value)) && b.isPackagedImage(filepath.Base(value)):
+			b.addImageRef(filepath.Base(value), section)
+			b.addAssetRef(section.ID, b.layout.imagesHref(filepath.Base(value)))
+		default:
+			fail("raw page %s refers to %s which is not packaged; refer to the images declared in the 'images' attribute as %s",
+				section.FileName(), value, b.imageHref("name.png"))
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 13-Jan-2024
+//
+// The renditions of the book packaged in the same container after the default one.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/fileutil"
+	"github.com/roslamir/ep3gen/internal/parm"
+)
+
+var (
+	// headTagRegexp matches the <head> start tag of a page, where the viewport of a pre-paginated rendition goes.
+	headTagRegexp = regexp.MustCompile(`(?i)<head\b[^>]*>`)
+
+	// viewportMetaRegexp matches the viewport <meta> element of a page which already has one, such as a raw page.
+	viewportMetaRegexp = regexp.MustCompile(`(?i)<meta\s[^>]*name="viewport"`)
+)
+
+// GenRenditions generates the renditions listed after the default one by the renditions config key, once
+// the default rendition is complete. Each rendition shares the images and the resources of the default one,
+// and gets its own package file <name>.opf and NCX file <name>.ncx in the package directory, next to
+// package.opf, with a copy of the section files in the text directory suffixed by its name, such as
+// Text-fixed. The copies of a pre-paginated rendition get the viewport of its pages, and those of a rendition
+// with a stylesheet of its own link to it instead of stylesheet.css.
+func (b *InputBuffer) GenRenditions() (err error) {
+	defer catch(&err)
+	for i, rendition := range b.parms.Renditions {
+		if i > 0 {
+			b.genRendition(rendition)
+		}
+	}
+	return nil
+}
+
+// genRendition generates the files of the rendition.
+func (b *InputBuffer) genRendition(rendition parm.Rendition) {
+	fmt.Fprintf(b.out, "Generating rendition %s (%s) ... ", rendition.Name, rendition.Layout)
+	renditionLayout := b.layout
+	renditionLayout.TextDir = b.layout.TextDir + "-" + rendition.Name
+
+	stylesheet := stylesheetFile
+	if rendition.Stylesheet != "" {
+		stylesheet = rendition.Stylesheet
+		sourceFileSpec := b.findResourceFile(stylesheet)
+		if sourceFileSpec == "" {
+			fail("stylesheet %s of the rendition '%s' not found in %s or %s", stylesheet, rendition.Name,
+				b.sourceDirSpec, b.parms.ResourceDir)
+		}
+		check(copyToPackage(sourceFileSpec, filepath.Join(b.packageDirSpec, b.layout.StylesDir, stylesheet)))
+		b.rendered = append(b.rendered, RenderRecord{
+			File:     stylesheet,
+			Template: "(stylesheet)",
+			Source:   sourceFileSpec,
+		})
+	}
+	b.copyRenditionPages(rendition, renditionLayout.TextDir, stylesheet)
+
+	ncxFile := rendition.Name + ".ncx"
+	ncx := b.ncxData()
+	ncx.packageLayout = renditionLayout
+	b.renderRenditionFile(ncxFile, ncxTemplate, ncx)
+
+	opf := b.opfData()
+	opf.packageLayout = renditionLayout
+	opf.Stylesheet = stylesheet
+	opf.NCX = ncxFile
+	opf.RenditionLayout = rendition.Layout
+	b.renderRenditionFile(rendition.Name+".opf", opfTemplate, opf)
+
+	fmt.Fprintln(b.out, "done")
+}
+
+// renderRenditionFile renders the package or NCX file of a rendition into the package directory.
+func (b *InputBuffer) renderRenditionFile(fileName, templateName string, data any) {
+	outfile, err := fileutil.CreateFile(filepath.Join(b.packageDirSpec, fileName))
+	check(err)
+	defer outfile.Close()
+	b.render(outfile, fileName, templateName, data)
+}
+
+// copyRenditionPages copies the files of the text directory of the default rendition, including nav.xhtml
+// and the raw pages, into the text directory of the rendition, adapting the pages to the rendition.
+func (c *Context) copyRenditionPages(rendition parm.Rendition, textDir, stylesheet string) {
+	entries, err := os.ReadDir(c.textDirSpec)
+	check(err)
+	stylesheetHref := `"` + path.Join("..", c.layout.StylesDir, stylesheetFile) + `"`
+	renditionHref := `"` + path.Join("..", c.layout.StylesDir, stylesheet) + `"`
+	for _, entry := range entries {
+		if entry.IsDir() || isExcludedFile(entry.Name()) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(c.textDirSpec, entry.Name()))
+		check(err)
+		if strings.HasSuffix(entry.Name(), ".xhtml") {
+			if stylesheet != stylesheetFile {
+				content = bytes.ReplaceAll(content, []byte(stylesheetHref), []byte(renditionHref))
+			}
+			if rendition.Layout == "pre-paginated" && !viewportMetaRegexp.Match(content) {
+				content = addViewport(entry.Name(), content, rendition)
+			}
+		}
+		check(fileutil.WriteFile(filepath.Join(c.packageDirSpec, textDir, entry.Name()), bytes.NewReader(content)))
+	}
+}
+
+// addViewport returns the page with the viewport of the pre-paginated rendition added as the first element
+// of its <head>, as every page of a pre-paginated rendition needs one.
+func addViewport(fileName string, content []byte, rendition parm.Rendition) []byte {
+	loc := headTagRegexp.FindIndex(content)
+	if loc == nil {
+		fail("%s has no <head> to hold the viewport of the rendition '%s'", fileName, rendition.Name)
+	}
+	viewport := fmt.Sprintf("\n    <meta name=\"viewport\" content=\"width=%d, height=%d\" />", rendition.Width, rendition.Height)
+	adapted := make([]byte, 0, len(content)+len(viewport))
+	adapted = append(adapted, content[:loc[1]]...)
+	adapted = append(adapted, viewport...)
+	return append(adapted, content[loc[1]:]...)
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 09-Sep-2023
+//
+// JSON report describing what a build produced.
+
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// reportFileName is the name of the report file written into the target directory.
+const reportFileName = "report.json"
+
+// RenderRecord records which template produced an output file and where the template was loaded from.
+type RenderRecord struct {
+	File     string `json:"file"`     // output file name
+	Template string `json:"template"` // template name
+	Source   string `json:"source"`   // resolved template file
+}
+
+// Report holds the details of a build for the JSON report.
+type Report struct {
+	Book     string          `json:"book"`
+	Title    string          `json:"title"`
+	UUID     string          `json:"uuid"`
+	Inputs   string          `json:"inputs"` // the hash of the inputs, as recorded in package.opf
+	Files    []RenderRecord  `json:"files"`
+	Features []FeatureStatus `json:"features"`
+	Pacing   *Pacing         `json:"pacing,omitempty"`
+	Slugs    []SlugRecord    `json:"slugs,omitempty"` // the section IDs derived from the headings
+
+	Assets []AssetDependency `json:"assets,omitempty"` // the asset files each section and the stylesheet refer to
+
+	Placeholders   []string        `json:"placeholders,omitempty"`   // the missing images replaced by a placeholder image
+	HeadingChanges []HeadingChange `json:"headingChanges,omitempty"` // the sections added, removed or renamed since the last build
+	Checksums      []FileChecksum  `json:"checksums,omitempty"`      // the files in the .epub file, then the .epub file itself
+}
+
+// NewReport returns the report for the current build.
+func (b *InputBuffer) NewReport(bookName, uuid string) Report {
+	return Report{
+		Book:     bookName,
+		Title:    b.attributes.get("title"),
+		UUID:     uuid,
+		Inputs:   "sha256:" + b.inputHash,
+		Files:    b.rendered,
+		Features: b.features,
+		Slugs:    b.slugs.records,
+
+		Assets: b.AssetDependencies(),
+
+		Placeholders:   b.Placeholders(),
+		HeadingChanges: b.headingChanges,
+		Checksums:      b.packageChecksums,
+	}
+}
+
+// WriteReport writes the report as JSON into the target directory.
+func (c *Context) WriteReport(report Report) (err error) {
+	defer catch(&err)
+	fileName := reportFileName
+	fmt.Fprintf(c.out, "Generating file %s (REPORT) ... ", fileName)
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	check(err)
+	check(os.WriteFile(filepath.Join(c.targetDirSpec, fileName), append(content, '\n'), 0660))
+
+	fmt.Fprintln(c.out, "done")
+	return nil
+}
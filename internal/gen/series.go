@@ -0,0 +1,42 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 22-Jan-2024
+//
+// The series of the book as an EPUB3 collection in the package file.
+
+package gen
+
+import (
+	"regexp"
+	"strings"
+)
+
+// seriesIndexRegexp matches the position of the book in its series, a decimal number such as 2 or 2.5.
+var seriesIndexRegexp = regexp.MustCompile(`^[0-9]+(?:\.[0-9]+)?$`)
+
+// collectionData holds the collection the book belongs to, emitted in the package file as
+// belongs-to-collection.
+type collectionData struct {
+	Title    string // the name of the collection
+	Type     string // the collection-type, "series"
+	Position string // the group-position of the book in the collection, "" if not given
+}
+
+// CheckSeries checks the optional attributes "series" and "series-index", which must be a decimal number such
+// as 2 or 2.5 and requires the series, and sets the collection of the book for the package file.
+func (b *InputBuffer) CheckSeries() (err error) {
+	defer catch(&err)
+	series := strings.TrimSpace(b.attributes.get("series"))
+	index, hasIndex := b.attributes.lookup("series-index")
+	if hasIndex {
+		if series == "" {
+			fail("attribute 'series-index' requires the attribute 'series'")
+		}
+		if !seriesIndexRegexp.MatchString(index) {
+			fail("attribute 'series-index' must be a decimal number such as 2 or 2.5, got '%s'", index)
+		}
+	}
+	if series != "" {
+		b.collection = &collectionData{Title: series, Type: "series", Position: index}
+	}
+	return nil
+}
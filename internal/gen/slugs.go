@@ -0,0 +1,124 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 02-Dec-2023
+//
+// Section IDs derived from the headings and the guard keeping them unique.
+
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/epubtype"
+	"github.com/roslamir/ep3gen/internal/textutil"
+)
+
+// reservedIDs are the fixed IDs of the generated sections and the manifest items, which always win
+// over an ID derived from a heading.
+var reservedIDs = []string{"cover", "titlepage", "copyright", "quicknav", "frontmatter", "notes", "halftitle", "loi", "descriptions", "abbreviations", "content-warnings", "cover-image", "css", "nav", "ncx"}
+
+// numberedIDRegexp matches the numbered section IDs, which cannot be given with the id argument of a directive.
+var numberedIDRegexp = regexp.MustCompile(`^section[0-9]{3,}$`)
+
+// SlugRecord records the ID given to a section whose ID is derived from its heading. Slug and ID differ
+// when the slug was already taken, so that links written against the expected slug can be checked.
+type SlugRecord struct {
+	Heading string `json:"heading"`
+	Slug    string `json:"slug"`
+	ID      string `json:"id"`
+}
+
+// slugRegistry holds the IDs in use and the slugs given out so far.
+type slugRegistry struct {
+	owners  map[string]string // maps each ID in use to a description of its owner
+	records []SlugRecord
+}
+
+// newSlugRegistry returns a registry holding the reserved IDs.
+func newSlugRegistry() *slugRegistry {
+	r := &slugRegistry{owners: make(map[string]string)}
+	for _, id := range reservedIDs {
+		r.reserve(id, "the generated "+id)
+	}
+	return r
+}
+
+// reserve claims an explicit ID for the given owner. Explicit IDs must be reserved before any slug is
+// given out, so that a slug never takes an ID written by the author. Fails if the ID is already taken.
+func (r *slugRegistry) reserve(id, owner string) {
+	if other, taken := r.owners[id]; taken {
+		fail("the id '%s' of %s is already used by %s", id, owner, other)
+	}
+	r.owners[id] = owner
+}
+
+// unique returns the slug of the heading, or of the fallback if the heading has none, made unique by
+// appending "-2", "-3" and so on. The result is claimed for the given owner and recorded.
+func (r *slugRegistry) unique(heading, fallback, owner string) string {
+	slug := textutil.Slug(heading)
+	if slug == "" {
+		slug = textutil.Slug(fallback)
+	}
+	id := r.claim(slug, owner)
+	r.records = append(r.records, SlugRecord{Heading: heading, Slug: slug, ID: id})
+	return id
+}
+
+// claim returns the ID made unique by appending "-2", "-3" and so on, claimed for the given owner.
+func (r *slugRegistry) claim(id, owner string) string {
+	unique := id
+	for n := 2; r.owners[unique] != ""; n++ {
+		unique = id + "-" + strconv.Itoa(n)
+	}
+	r.owners[unique] = owner
+	return unique
+}
+
+// sectionID returns the ID of the next section: "sectionNNN" numbered in order, or the unique slug of the
+// heading when the config parameter 'section_ids' is "slug".
+func (b *InputBuffer) sectionID(epubType epubtype.Term, heading string) string {
+	if b.parms.SectionIDs != "slug" {
+		return fmt.Sprintf("section%03d", b.currSectionNo)
+	}
+	return b.slugs.unique(heading, string(epubType), fmt.Sprintf("the %s \"%s\"", epubType, heading))
+}
+
+// ReserveSectionIDs reserves the IDs given to the sections with the id argument of their directive before any
+// section is generated, so that neither a numbered ID nor a slug can take them and links written against them
+// keep working when sections are inserted. Fails if an ID is given twice or is the ID of a generated file.
+func (b *InputBuffer) ReserveSectionIDs() (err error) {
+	defer catch(&err)
+	for index, line := range b.lines {
+		directive, ok, err := parseDirective(strings.TrimSpace(line))
+		if !ok || err != nil || !isDirective(strings.TrimSpace(line)) {
+			continue // reported when the line is reached
+		}
+		lineNo := index + 1
+		if index < len(b.lineNos) {
+			lineNo = b.lineNos[index]
+		}
+		spec := lookupDirective(directive.Name)
+		id, explicit := directive.Args["id"]
+		if directive.Name == "raw" && directive.File != "" {
+			directive.Line = lineNo
+			checkRawFileName(directive)
+			id, explicit = rawPageID(directive.File), true // the file name of a raw page is its ID
+		}
+		if spec == nil || !explicit || spec.lookupArg("toc") == nil {
+			continue // not a section directive, e.g. the id of a <!--footnote-->
+		}
+		if err = spec.validate(directive); err != nil {
+			failAt(lineNo, "%s", err.Error())
+		}
+		if b.parms.SectionIDs != "slug" && numberedIDRegexp.MatchString(id) {
+			failAt(lineNo, "the id '%s' of <!--%s--> has the form of the numbered section IDs", id, directive.Name)
+		}
+		if other, taken := b.slugs.owners[id]; taken {
+			failAt(lineNo, "the id '%s' of <!--%s--> is already used by %s", id, directive.Name, other)
+		}
+		b.slugs.reserve(id, fmt.Sprintf("the <!--%s--> directive on line %d", directive.Name, lineNo))
+	}
+	return nil
+}
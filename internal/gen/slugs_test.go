@@ -0,0 +1,72 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+// reserveError returns the error of reserving the ID, or nil.
+func reserveError(r *slugRegistry, id, owner string) (err error) {
+	defer catch(&err)
+	r.reserve(id, owner)
+	return nil
+}
+
+func TestSlugRegistry(t *testing.T) {
+	r := newSlugRegistry()
+	r.reserve("the-long-night", "the <!--chapter--> directive on line 12")
+	tests := []struct {
+		heading  string
+		fallback string
+		want     string
+	}{
+		{"Interlude", "chapter", "interlude"},
+		{"Interlude", "chapter", "interlude-2"},
+		{"INTERLUDE", "chapter", "interlude-3"},
+		{"Copyright", "chapter", "copyright-2"}, // a reserved ID of a generated file
+		{"Notes", "backmatter", "notes-2"},
+		{"The Long Night", "chapter", "the-long-night-2"}, // the explicit ID always wins
+		{"Café Müller", "chapter", "café-müller"},
+		{"Café Müller", "chapter", "café-müller-2"},
+		{"宝島", "chapter", "宝島"},
+		{"???", "chapter", "chapter"},
+		{"", "chapter", "chapter-2"},
+	}
+	for _, test := range tests {
+		if got := r.unique(test.heading, test.fallback, "the chapter "+test.heading); got != test.want {
+			t.Errorf("unique(%q) = %q, want %q", test.heading, got, test.want)
+		}
+	}
+	if len(r.records) != len(tests) || r.records[1] != (SlugRecord{Heading: "Interlude", Slug: "interlude", ID: "interlude-2"}) {
+		t.Errorf("records = %+v, want one per slug with the slug and the ID given", r.records)
+	}
+
+	// The anchors are claimed in the same registry.
+	if got := r.claim("interlude", "an anchor"); got != "interlude-4" {
+		t.Errorf("claim(interlude) = %q, want interlude-4", got)
+	}
+	if got := r.claim("section004-toc1", "an anchor"); got != "section004-toc1" {
+		t.Errorf("claim(section004-toc1) = %q, want it unchanged", got)
+	}
+}
+
+func TestSlugRegistryExplicitIDs(t *testing.T) {
+	r := newSlugRegistry()
+	if err := reserveError(r, "the-long-night", "the <!--chapter--> directive on line 12"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"the-long-night", "the id 'the-long-night' of the <!--chapter--> directive on line 30 is already used by the <!--chapter--> directive on line 12"},
+		{"nav", "is already used by the generated nav"},
+		{"cover", "is already used by the generated cover"},
+	}
+	for _, test := range tests {
+		err := reserveError(r, test.id, "the <!--chapter--> directive on line 30")
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("reserve(%q) error = %v, want one containing %q", test.id, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 08-Jan-2024
+//
+// The properties of the sections in the spine, given by the spine-properties argument of the directives.
+
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// spineProperties are the known properties of a spine itemref: those of EPUB 3 and of the rendition
+// vocabulary, which may override the rendering of a single section, and the proprietary hints honoured
+// by some reading systems. Other tokens are only accepted with the -allow-unknown-properties flag.
+var spineProperties = map[string]bool{
+	"page-spread-left":                   true,
+	"page-spread-right":                  true,
+	"rendition:page-spread-center":       true,
+	"rendition:layout-pre-paginated":     true,
+	"rendition:layout-reflowable":        true,
+	"rendition:orientation-auto":         true,
+	"rendition:orientation-landscape":    true,
+	"rendition:orientation-portrait":     true,
+	"rendition:spread-auto":              true,
+	"rendition:spread-both":              true,
+	"rendition:spread-landscape":         true,
+	"rendition:spread-none":              true,
+	"rendition:flow-auto":                true,
+	"rendition:flow-paginated":           true,
+	"rendition:flow-scrolled-continuous": true,
+	"rendition:flow-scrolled-doc":        true,
+	"rendition:align-x-center":           true,
+	"exclude-from-search":                true, // proprietary: keeps the section out of the search of the reader
+}
+
+// propertyTokenRegexp matches a single property token, with an optional prefix such as "rendition:".
+var propertyTokenRegexp = regexp.MustCompile(`^(?:[A-Za-z_][A-Za-z0-9_.-]*:)?[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// spinePropertiesOf returns the spine properties given by the spine-properties argument of the directive,
+// separated by single spaces, or "" if it has none.
+func spinePropertiesOf(directive Directive) string {
+	return strings.Join(strings.Fields(directive.Args["spine-properties"]), " ")
+}
+
+// checkSpineProperties returns an error unless the value is a space-separated list of well-formed spine
+// property tokens. Whether they are known is checked by checkKnownSpineProperties.
+func checkSpineProperties(value string) error {
+	tokens := strings.Fields(value)
+	if len(tokens) == 0 {
+		return fmt.Errorf("expects spine properties such as page-spread-left, got '%s'", value)
+	}
+	for _, token := range tokens {
+		if !propertyTokenRegexp.MatchString(token) {
+			return fmt.Errorf("expects spine properties such as page-spread-left, got '%s'", token)
+		}
+	}
+	return nil
+}
+
+// checkKnownSpineProperties fails unless the spine properties of the directive are all known ones, or the
+// -allow-unknown-properties flag is given.
+func (b *InputBuffer) checkKnownSpineProperties(directive Directive) {
+	if b.parms.AllowUnknownProperties {
+		return
+	}
+	for _, token := range strings.Fields(directive.Args["spine-properties"]) {
+		if !spineProperties[token] {
+			failAt(directive.Line, "argument 'spine-properties' of directive <!--%s-->: unknown spine property '%s'; use -allow-unknown-properties to accept it",
+				directive.Name, token)
+		}
+	}
+}
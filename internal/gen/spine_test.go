@@ -0,0 +1,21 @@
+package gen
+
+import "testing"
+
+func TestSpinePropertiesWellFormed(t *testing.T) {
+	for property := range spineProperties {
+		if err := checkSpineProperties(property); err != nil {
+			t.Errorf("known spine property %s: %v", property, err)
+		}
+	}
+}
+
+func TestSpinePropertiesOf(t *testing.T) {
+	directive := Directive{Name: "chapter", Args: map[string]string{"spine-properties": "  page-spread-left\texclude-from-search "}}
+	if got, want := spinePropertiesOf(directive), "page-spread-left exclude-from-search"; got != want {
+		t.Errorf("spinePropertiesOf = %q, want %q", got, want)
+	}
+	if got := spinePropertiesOf(Directive{Name: "chapter"}); got != "" {
+		t.Errorf("spinePropertiesOf without the argument = %q, want none", got)
+	}
+}
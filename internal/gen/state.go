@@ -0,0 +1,263 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 12-Nov-2023
+//
+// Up-to-date check against the state recorded by the last successful build.
+
+package gen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/roslamir/ep3gen/internal/fileutil"
+	"github.com/roslamir/ep3gen/internal/opf"
+	"github.com/roslamir/ep3gen/internal/parm"
+)
+
+// stateFileSuffix is appended to the book name to form the state file next to the generated book directory,
+// so that it survives the removal of the book directory at the start of each build.
+const stateFileSuffix = ".state.json"
+
+// metadataOnlyAttrs lists the attributes which only appear in the package, NAV or NCX files, so that
+// changing them does not require regenerating the section files. Attributes starting with "a11y-" and
+// the default heading overrides are included as well.
+var metadataOnlyAttrs = map[string]bool{
+	"description": true,
+	"subject":     true,
+	"title-sort":  true,
+	"author-sort": true,
+	"created":     true,
+	"a11y":        true,
+}
+
+// metaNameRegexp extracts the name of a <meta> element.
+var metaNameRegexp = regexp.MustCompile(`name="([^"]*)"`)
+
+// buildState is the content of the state file.
+type buildState struct {
+	InputHash    string `json:"inputHash"`
+	SectionsHash string `json:"sectionsHash"` // the hash of the inputs of the section files, see SectionsHash
+	Created      string `json:"created"`
+	Built        string `json:"built"`
+	Words        int    `json:"words,omitempty"` // the number of words in the sections, see CheckWordCount
+
+	Sections []SectionRecord `json:"sections,omitempty"` // the sections read from the source file, see CompareHeadings
+}
+
+// StateFileSpec returns the state file of the book.
+func StateFileSpec(targetDir, bookName string) string {
+	return filepath.Join(targetDir, bookName+stateFileSuffix)
+}
+
+// InputHash returns a hash of everything that affects the output of the book: the files in the book's
+// source directory, the templates, the resource files, the config file or the settings given in code, the
+// command line flags and SOURCE_DATE_EPOCH.
+func (c *Context) InputHash(sourceDir string) (_ string, err error) {
+	defer catch(&err)
+	hash := sha256.New()
+	fmt.Fprintf(hash, "flags glyphs=%t report=%t pacing=%t permissive=%t emit-model=%s target=%s placeholders=%t strict=%t\n",
+		c.parms.AuditGlyphs, c.parms.WriteReport, c.parms.Pacing, c.parms.Permissive, c.parms.EmitModel, c.parms.Target, c.parms.Placeholders, c.parms.Strict)
+	fmt.Fprintf(hash, "flags exploded=%t allow-placeholders=%t allow-unknown-properties=%t lint=%t disable=%s\n",
+		c.parms.KeepExploded, c.parms.AllowPlaceholders, c.parms.AllowUnknownProperties, c.parms.Lint, c.parms.LintDisable)
+	fmt.Fprintf(hash, "env SOURCE_DATE_EPOCH=%s\n", c.parms.SourceDateEpoch)
+	if c.parms.ConfigFile != "" {
+		hashFile(hash, "config", c.parms.ConfigFile)
+	} else {
+		hashSettings(hash, c.parms) // generating through the epub package, with the settings given in code
+	}
+	for _, dir := range []string{sourceDir, c.parms.TemplatesDir, c.parms.ResourceDir} {
+		hashDir(hash, dir, "", false)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashSettings adds the parameters which may affect the output of the book to the hash, for a build without
+// a config file. The paths of the build, whose files are hashed by name and content, and the flags which only
+// affect what is printed are left out.
+func hashSettings(hash io.Writer, parms *parm.Parms) {
+	settings := *parms
+	settings.BookName, settings.SourceDir, settings.TargetDir = "", "", ""
+	settings.ResourceDir, settings.TemplatesDir = "", ""
+	settings.Verbose, settings.Directives, settings.Force, settings.Wait = false, false, false, false
+	settings.Debug, settings.Trace, settings.VerifyDeterminism = false, false, false
+	settings.Warnings = nil
+	fmt.Fprintf(hash, "settings %+v\n", settings) // the maps are printed in key order
+}
+
+// SectionsHash returns a hash of the inputs of the section files: the same as InputHash, except that
+// the attributes which only appear in the package, NAV and NCX files (see metadataOnlyAttrs) and the
+// flags which only affect the reports are left out. The images count by their pixel size and the fonts
+// by their name only, so that a retouched image is only copied again by a metadata-only build.
+func (c *Context) SectionsHash(sourceDir, sourceFileSpec string) (_ string, err error) {
+	defer catch(&err)
+	hash := sha256.New()
+	fmt.Fprintf(hash, "flags permissive=%t\n", c.parms.Permissive)
+	if c.parms.ConfigFile != "" {
+		hashFile(hash, "config", c.parms.ConfigFile)
+	}
+	for _, dir := range []string{sourceDir, c.parms.TemplatesDir, c.parms.ResourceDir} {
+		hashDir(hash, dir, sourceFileSpec, true)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashDir adds the names and contents of all the files under the directory to the hash, in a stable order.
+// Only the part after the </head> line of the file headless counts, if given. With assetSizes, the images
+// and the fonts count as hashAsset adds them.
+func hashDir(hash io.Writer, dir, headless string, assetSizes bool) {
+	fileSpecs := make([]string, 0, 20)
+	err := filepath.Walk(dir, func(fileSpec string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			fileSpecs = append(fileSpecs, fileSpec)
+		}
+		return nil
+	})
+	check(err)
+	sort.Strings(fileSpecs)
+	for _, fileSpec := range fileSpecs {
+		relSpec, _ := filepath.Rel(dir, fileSpec)
+		_, isAsset := resourceMediaTypes[strings.ToLower(filepath.Ext(fileSpec))]
+		switch {
+		case fileSpec == headless:
+			hashBody(hash, filepath.ToSlash(relSpec), fileSpec)
+		case assetSizes && isAsset:
+			hashAsset(hash, filepath.ToSlash(relSpec), fileSpec)
+		default:
+			hashFile(hash, filepath.ToSlash(relSpec), fileSpec)
+		}
+	}
+}
+
+// hashBody adds the name of the source file and its lines to the hash, leaving out the <meta> lines in
+// the head which set one of the metadataOnlyAttrs.
+func hashBody(hash io.Writer, name, fileSpec string) {
+	fmt.Fprintf(hash, "body %s\n", name)
+	inHead := true
+	lines, err := fileutil.ReadFileLines(fileSpec)
+	check(err)
+	for _, line := range lines {
+		if IsEndTag(strings.TrimSpace(line), "head") {
+			inHead = false
+		}
+		if inHead && strings.HasPrefix(strings.TrimSpace(line), "<meta") {
+			if match := metaNameRegexp.FindStringSubmatch(line); match != nil && isMetadataOnly(match[1]) {
+				continue
+			}
+		}
+		fmt.Fprintln(hash, line)
+	}
+}
+
+// isMetadataOnly returns true if the attribute only appears in the package, NAV or NCX files.
+func isMetadataOnly(name string) bool {
+	return metadataOnlyAttrs[name] || strings.HasPrefix(name, headingAttrPrefix) || strings.HasPrefix(name, "a11y-")
+}
+
+// hashAsset adds the name of the image or font file to the hash, with the pixel size of a raster image,
+// which the section files give as the width and height of its <img> elements, see addImageSizes. The
+// content of an image which cannot be read counts instead.
+func hashAsset(hash io.Writer, name, fileSpec string) {
+	if imageMediaTypes[strings.ToLower(filepath.Ext(fileSpec))] != "" && !strings.EqualFold(filepath.Ext(fileSpec), ".svg") {
+		file, err := fileutil.OpenFile(fileSpec)
+		check(err)
+		defer file.Close()
+		config, _, err := image.DecodeConfig(file)
+		if err != nil {
+			hashFile(hash, name, fileSpec)
+			return
+		}
+		fmt.Fprintf(hash, "image %s %dx%d\n", name, config.Width, config.Height)
+		return
+	}
+	fmt.Fprintf(hash, "asset %s\n", name)
+}
+
+// hashFile adds the name and the contents of the file to the hash.
+func hashFile(hash io.Writer, name, fileSpec string) {
+	file, err := fileutil.OpenFile(fileSpec)
+	check(err)
+	defer file.Close()
+	fmt.Fprintf(hash, "file %s\n", name)
+	_, err = io.Copy(hash, file)
+	check(err)
+}
+
+// IsUpToDate returns true if the state file records the same input hash and the .epub file exists.
+func IsUpToDate(stateFileSpec, epubFileSpec, inputHash string) bool {
+	if info, err := os.Stat(epubFileSpec); err != nil || info.IsDir() {
+		return false
+	}
+	content, err := os.ReadFile(stateFileSpec)
+	if err != nil {
+		return false
+	}
+	var state buildState
+	if err = json.Unmarshal(content, &state); err != nil {
+		return false // rebuild when the state file is damaged
+	}
+	return state.InputHash == inputHash
+}
+
+// CheckSectionsUnchanged returns an error unless the state file records the same sections hash, meaning
+// that the section files of the last build can be reused by a metadata-only build.
+// Returns the creation timestamp recorded by the last build.
+func (c *Context) CheckSectionsUnchanged(stateFileSpec, targetDir, sectionsHash string) (string, error) {
+	var state buildState
+	content, err := os.ReadFile(stateFileSpec)
+	if err == nil {
+		err = json.Unmarshal(content, &state)
+	}
+	if err != nil {
+		return "", fmt.Errorf("-metadata-only needs a previous build but %s cannot be read; run a full build", stateFileSpec)
+	}
+	if info, err := os.Stat(filepath.Join(targetDir, c.parms.PackageDir)); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("-metadata-only needs the files of the previous build in %s, which are only kept with -exploded; run a full build", targetDir)
+	}
+	if state.SectionsHash != sectionsHash {
+		return "", errors.New("the sections, image sizes, templates or config have changed since the last build; run a full build without -metadata-only")
+	}
+	return state.Created, nil
+}
+
+// PreviousCreated returns the creation date recorded in the package file of the last build, so that a rebuilt
+// book keeps it: the package file left in the generated book directory by -exploded, or else the one in the
+// .epub file. Returns "" if there is no previous build or its package file holds no RFC3339 creation date.
+func (c *Context) PreviousCreated(targetDir, epubFileSpec string) string {
+	metadata, err := opf.ReadFile(filepath.Join(targetDir, c.parms.PackageDir, "package.opf"))
+	if err != nil {
+		metadata, err = opf.ReadEpub(epubFileSpec, path.Join(c.parms.PackageDir, "package.opf"))
+	}
+	if err != nil {
+		return ""
+	}
+	if _, err = time.Parse(time.RFC3339, metadata.Created); err != nil {
+		return ""
+	}
+	return metadata.Created
+}
+
+// WriteState records the hashes, the word count and the section inventory of a successful build in the state file.
+func WriteState(stateFileSpec, inputHash, sectionsHash, created, built string, words int, sections []SectionRecord) (err error) {
+	defer catch(&err)
+	state := buildState{InputHash: inputHash, SectionsHash: sectionsHash, Created: created, Built: built, Words: words,
+		Sections: sections}
+	content, err := json.MarshalIndent(state, "", "  ")
+	check(err)
+	check(os.WriteFile(stateFileSpec, append(content, '\n'), 0660))
+	return nil
+}
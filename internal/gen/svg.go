@@ -0,0 +1,106 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 04-Dec-2023
+//
+// Inline SVG drawings pasted into the section bodies.
+
+package gen
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+)
+
+var (
+	// svgXmlnsRegexp and xlinkXmlnsRegexp match the namespace declarations in the root <svg> tag.
+	svgXmlnsRegexp   = regexp.MustCompile(`\sxmlns\s*=`)
+	xlinkXmlnsRegexp = regexp.MustCompile(`\sxmlns:xlink\s*=`)
+
+	// svgTitleRegexp matches the <title> element giving the drawing its text alternative.
+	svgTitleRegexp = regexp.MustCompile(`<title[\s>]`)
+)
+
+// isInlineSVG returns true if the line starts an inline <svg> drawing.
+func isInlineSVG(line string) bool {
+	return strings.HasPrefix(line, "<svg") && len(line) > len("<svg") && strings.ContainsRune(" \t>/", rune(line[len("<svg")]))
+}
+
+// readInlineSVG reads the inline <svg> drawing starting at the current line up to its closing </svg> tag
+// and returns it as a single body line. The lines of the drawing are taken as they are, so a comment or a
+// line starting with <!-- inside it is not a directive. The drawing must be well-formed XML; the SVG
+// namespace, and the XLink namespace if used, are declared on the root tag when missing. The section is
+// flagged with the manifest property "svg". On return the current line is the closing line.
+func (b *InputBuffer) readInlineSVG(section SectionData) string {
+	startLine := b.LineNo()
+	lines := make([]string, 0, 10)
+	depth := 0
+	for {
+		lines = append(lines, b.bodyLine())
+		depth += strings.Count(b.CurrLine, "<svg") - strings.Count(b.CurrLine, "</svg>")
+		if depth <= 0 {
+			break
+		}
+		if !b.Next() {
+			failAt(startLine, "inline <svg> is not closed with </svg>")
+		}
+	}
+	block := strings.Join(lines, "\n")
+
+	end := tagEnd(block, 0)
+	if end == -1 {
+		failAt(startLine, "inline <svg> has an unterminated start tag")
+	}
+	rootTag, rest := block[:end], block[end:]
+	if strings.HasSuffix(rootTag, "/") {
+		rootTag, rest = rootTag[:len(rootTag)-1], block[end-1:] // an empty <svg ... />
+	}
+	if !svgXmlnsRegexp.MatchString(rootTag) {
+		rootTag += ` xmlns="` + svgNamespace + `"`
+	}
+	if strings.Contains(block, "xlink:") && !xlinkXmlnsRegexp.MatchString(rootTag) {
+		rootTag += ` xmlns:xlink="` + xlinkNamespace + `"`
+	}
+	block = rootTag + rest
+
+	if err := checkWellFormed([]byte(block)); err != nil {
+		failAt(startLine, "inline <svg> is not well-formed: %s", err.Error())
+	}
+	b.addProperty(section.ID, "svg")
+	return block
+}
+
+// addProperty adds the manifest item property, such as "svg", to the section with the given ID.
+func (b *InputBuffer) addProperty(id, property string) {
+	for i := range b.sections {
+		if b.sections[i].ID != id {
+			continue
+		}
+		b.sections[i].Properties = withProperty(b.sections[i].Properties, property)
+		return
+	}
+}
+
+// withProperty returns the space-separated manifest item properties with the property added, if missing.
+func withProperty(properties, property string) string {
+	for _, existing := range strings.Fields(properties) {
+		if existing == property {
+			return properties
+		}
+	}
+	return strings.TrimSpace(properties + " " + property)
+}
+
+// untitledSVGs returns the number of inline <svg> drawings in the lines without a <title> element.
+func untitledSVGs(lines []string) int {
+	count := 0
+	for _, line := range lines {
+		if isInlineSVG(line) && !svgTitleRegexp.MatchString(line) {
+			count++
+		}
+	}
+	return count
+}
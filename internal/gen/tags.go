@@ -0,0 +1,122 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 18-Nov-2023
+//
+// Tolerant matching of the document structure tags and normalisation of the head lines.
+
+package gen
+
+import (
+	"regexp"
+	"strings"
+)
+
+// preTagRegexp matches the start and end tags of a <pre> element and captures the slash of an end tag.
+var preTagRegexp = regexp.MustCompile(`(?i)<(/?)pre(?:\s[^>]*)?>`)
+
+// IsStartTag returns true if the line is the start tag of the named element, in any letter case and
+// with or without attributes, such as <BODY> or <body lang="en" class="x">.
+func IsStartTag(line, name string) bool {
+	if len(line) < len(name)+2 || line[0] != '<' || !strings.EqualFold(line[1:len(name)+1], name) {
+		return false
+	}
+	rest := line[len(name)+1:]
+	return strings.HasSuffix(rest, ">") && (rest == ">" || rest[0] == ' ' || rest[0] == '\t')
+}
+
+// IsEndTag returns true if the line is the end tag of the named element, in any letter case and with
+// optional whitespace before the closing bracket, such as </HEAD> or </head >.
+func IsEndTag(line, name string) bool {
+	if len(line) < len(name)+3 || !strings.HasPrefix(line, "</") || !strings.EqualFold(line[2:len(name)+2], name) {
+		return false
+	}
+	return strings.TrimSpace(line[len(name)+2:]) == ">"
+}
+
+// normaliseHead rearranges the lines up to the <body> start tag so that each tag is on a line of
+// its own: a tag split across lines is joined and adjacent tags sharing a line are split, and the
+// surrounding whitespace is trimmed. The lines after the <body> start tag are left alone. Returns the lines together with the original
+// 1-based line number of each line.
+func normaliseHead(source []string) ([]string, []int) {
+	lines := make([]string, 0, len(source)+20)
+	lineNos := make([]int, 0, len(source)+20)
+	i := 0
+	for ; i < len(source); i++ {
+		lineNo := i + 1
+		parts, open := splitTags(strings.TrimSpace(source[i]))
+		// Join a tag continued on the following lines, such as <body\n class="x">.
+		for line := strings.TrimSpace(source[i]); open && i+1 < len(source); {
+			i++
+			line += " " + strings.TrimSpace(source[i])
+			parts, open = splitTags(line)
+		}
+
+		inBody := false
+		for _, part := range parts {
+			lines = append(lines, part)
+			lineNos = append(lineNos, lineNo)
+			if IsStartTag(part, "body") {
+				inBody = true
+			}
+		}
+		if inBody {
+			i++
+			break
+		}
+	}
+	for ; i < len(source); i++ {
+		lines = append(lines, source[i])
+		lineNos = append(lineNos, i+1)
+	}
+	return lines, lineNos
+}
+
+// splitTags splits the line at the boundaries between adjacent tags, keeping any text with the tag before
+// it. For example "<head><title>X</title><meta a/>" becomes "<head>", "<title>X</title>", "<meta a/>".
+// Brackets inside quoted attribute values are not boundaries. Also reports whether the line ends
+// inside a tag.
+func splitTags(line string) ([]string, bool) {
+	parts := make([]string, 0, 1)
+	inTag := false
+	var quote byte
+	start, lastTagEnd := 0, -1
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case inTag && (c == '"' || c == '\''):
+			quote = c
+		case inTag && c == '>':
+			inTag = false
+			lastTagEnd = i
+		case !inTag && c == '<':
+			inTag = true
+			if lastTagEnd >= start && strings.TrimSpace(line[lastTagEnd+1:i]) == "" {
+				parts = append(parts, line[start:lastTagEnd+1])
+				start = i
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(line[start:])), inTag
+}
+
+// joinPreformatted returns the body lines with each <pre> element spanning several lines joined into a single
+// line, so that the indentation the templates write before each body line does not end up in the
+// preformatted text, which is then written exactly as it is in the source file.
+func joinPreformatted(lines []string) []string {
+	joined := make([]string, 0, len(lines))
+	inPre := false
+	for _, line := range lines {
+		if inPre {
+			joined[len(joined)-1] += "\n" + line
+		} else {
+			joined = append(joined, line)
+		}
+		for _, match := range preTagRegexp.FindAllStringSubmatch(line, -1) {
+			inPre = match[1] == ""
+		}
+	}
+	return joined
+}
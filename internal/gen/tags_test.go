@@ -0,0 +1,100 @@
+package gen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsStartTag(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"<body>", true},
+		{"<BODY>", true},
+		{`<body lang="en" class="x">`, true},
+		{"<body\tclass=\"calibre\">", true},
+		{"<body lang=EN-GB style='word-wrap:break-word'>", true},
+		{"<bodyx>", false},
+		{"<body", false},
+		{"<bod>", false},
+		{"</body>", false},
+		{" <body>", false},
+	}
+	for _, test := range tests {
+		if got := IsStartTag(test.line, "body"); got != test.want {
+			t.Errorf("IsStartTag(%q) = %v, want %v", test.line, got, test.want)
+		}
+	}
+}
+
+func TestIsEndTag(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"</head>", true},
+		{"</HEAD>", true},
+		{"</head >", true},
+		{"</header>", false},
+		{"<head>", false},
+		{"</head", false},
+		{"</hea>", false},
+	}
+	for _, test := range tests {
+		if got := IsEndTag(test.line, "head"); got != test.want {
+			t.Errorf("IsEndTag(%q) = %v, want %v", test.line, got, test.want)
+		}
+	}
+}
+
+func TestSplitTags(t *testing.T) {
+	tests := []struct {
+		line  string
+		parts []string
+		open  bool
+	}{
+		{"<head>", []string{"<head>"}, false},
+		{`<head><meta http-equiv="Content-Type" content="text/html; charset=utf-8"/><title>X</title>`,
+			[]string{"<head>", `<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>`, "<title>X</title>"}, false},
+		{`<meta name="title" content="a > b"> <meta name="author" content="<anon>">`,
+			[]string{`<meta name="title" content="a > b">`, `<meta name="author" content="<anon>">`}, false},
+		{"<body lang=EN-GB link=\"#0563C1\"", []string{"<body lang=EN-GB link=\"#0563C1\""}, true},
+		{"<title>The Title</title> text", []string{"<title>The Title</title> text"}, false},
+	}
+	for _, test := range tests {
+		parts, open := splitTags(test.line)
+		if !reflect.DeepEqual(parts, test.parts) || open != test.open {
+			t.Errorf("splitTags(%q) = %q, %v, want %q, %v", test.line, parts, open, test.parts, test.open)
+		}
+	}
+}
+
+func TestNormaliseHead(t *testing.T) {
+	source := []string{
+		"<html>",
+		"<HEAD><title>X</title>",
+		`  <meta name="title" content="X"><meta name="author" content="Y">`,
+		"</HEAD>",
+		`<body lang=EN-GB link="#0563C1"`,
+		"style='word-wrap:break-word'>",
+		"  <p>Kept <b>as</b> <i>it is</i></p>",
+	}
+	lines, lineNos := normaliseHead(source)
+	wantLines := []string{
+		"<html>",
+		"<HEAD>",
+		"<title>X</title>",
+		`<meta name="title" content="X">`,
+		`<meta name="author" content="Y">`,
+		"</HEAD>",
+		`<body lang=EN-GB link="#0563C1" style='word-wrap:break-word'>`,
+		"  <p>Kept <b>as</b> <i>it is</i></p>",
+	}
+	if !reflect.DeepEqual(lines, wantLines) {
+		t.Errorf("lines = %q, want %q", lines, wantLines)
+	}
+	if wantNos := []int{1, 2, 2, 3, 3, 4, 5, 7}; !reflect.DeepEqual(lineNos, wantNos) {
+		t.Errorf("line numbers = %v, want %v", lineNos, wantNos)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 08-Nov-2023
+//
+// TOC entries pointing into the middle of a section.
+
+package gen
+
+import (
+	"fmt"
+	"html"
+)
+
+// TocEntry is a table of contents entry pointing to an anchor inside a section,
+// created by the <!--tocentry "Label"--> marker.
+type TocEntry struct {
+	ID    string // the anchor id, unique in the book
+	Href  string // the section file name with the anchor, relative to the Text directory
+	Label string // the label shown in the table of contents
+}
+
+// genTocEntry replaces the <!--tocentry "Label"--> marker on the current line by an anchor and adds
+// the entry to the enclosing section, which must be the last section added. The anchor is claimed in the
+// registry of the section IDs, so that it never takes the ID of a section or of another anchor: it is the
+// slug of the label when the section IDs are derived from the headings, else numbered within the section.
+// Returns the anchor HTML line.
+func (b *InputBuffer) genTocEntry(section SectionData, directive Directive) string {
+	if directive.Label == "" {
+		failAt(directive.Line, "<!--tocentry--> requires a quoted label, e.g. <!--tocentry \"The Letter\"-->")
+	}
+	current := &b.sections[len(b.sections)-1]
+	if current.ID != section.ID {
+		failAt(directive.Line, "<!--tocentry--> is only allowed inside the body of a section")
+	}
+
+	owner := fmt.Sprintf("the <!--tocentry--> \"%s\" on line %d", directive.Label, directive.Line)
+	var anchor string
+	if b.parms.SectionIDs == "slug" {
+		anchor = b.slugs.unique(directive.Label, section.ID+"-toc", owner)
+	} else {
+		// Number the anchors within the section so that duplicate labels still get distinct anchors.
+		anchor = b.slugs.claim(fmt.Sprintf("%s-toc%d", section.ID, len(current.Entries)+1), owner)
+	}
+	current.Entries = append(current.Entries, TocEntry{
+		ID:    anchor,
+		Href:  current.FileName() + "#" + anchor,
+		Label: html.EscapeString(directive.Label),
+	})
+	return `<a id="` + anchor + `"></a>`
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 09-Dec-2023
+//
+// Trace of the phases of the parse and the directives dispatched in each, for bug reports.
+
+package gen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseTrace holds the current phase of the parse and the number of sections generated in each phase.
+type parseTrace struct {
+	phase  string
+	phases []string // the phases in the order they were entered
+	counts map[string]int
+}
+
+// StartTrace enables the trace. Each line of the trace starts with "trace: " and gives the source line
+// of the directive, so that it can be pasted into a bug report as it is.
+func (b *InputBuffer) StartTrace() {
+	b.trace = &parseTrace{counts: make(map[string]int)}
+}
+
+// TracePhase traces the transition to the given phase, such as "bodymatter", at the current line.
+func (b *InputBuffer) TracePhase(phase string) {
+	if b.trace == nil {
+		return
+	}
+	fmt.Fprintf(b.out, "trace: line %d: %s → entering %s phase\n", b.LineNo(), strings.TrimSpace(b.CurrLine), phase)
+	b.trace.phase = phase
+	b.trace.phases = append(b.trace.phases, phase)
+}
+
+// TraceSection traces the dispatch of the directive to the section generated for it.
+func (b *InputBuffer) TraceSection(directive Directive, section SectionData) {
+	b.traceSection(fmt.Sprintf("line %d: <!--%s-->", directive.Line, directive.Name), section)
+}
+
+// traceSection traces the section generated for the given source, which is "generated" for the sections
+// such as the cover page which have no directive.
+func (b *InputBuffer) traceSection(source string, section SectionData) {
+	if b.trace == nil {
+		return
+	}
+	fmt.Fprintf(b.out, "trace: %s → %s \"%s\" (%s)\n", source, section.ID, section.Heading, section.EpubType)
+	b.trace.counts[b.trace.phase]++
+}
+
+// TraceDirective traces a directive which does not generate a section, with what it does.
+func (b *InputBuffer) TraceDirective(directive Directive, action string) {
+	if b.trace == nil {
+		return
+	}
+	fmt.Fprintf(b.out, "trace: line %d: <!--%s--> → %s\n", directive.Line, directive.Name, action)
+}
+
+// TraceFinish traces the end of the parse at the current line and the number of sections in each phase.
+func (b *InputBuffer) TraceFinish() {
+	if b.trace == nil {
+		return
+	}
+	fmt.Fprintf(b.out, "trace: line %d: %s → finishing\n", b.LineNo(), strings.TrimSpace(b.CurrLine))
+	counts := make([]string, 0, len(b.trace.phases))
+	for _, phase := range b.trace.phases {
+		counts = append(counts, fmt.Sprintf("%s %d", phase, b.trace.counts[phase]))
+	}
+	fmt.Fprintf(b.out, "trace: sections per phase: %s\n", strings.Join(counts, ", "))
+}
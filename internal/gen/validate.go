@@ -0,0 +1,157 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 08-Dec-2023
+//
+// Well-formedness check of the generated section files.
+
+package gen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// wellFormedError is a well-formedness error at a line of the generated file.
+type wellFormedError struct {
+	Line int // the line of the generated file
+	Msg  string
+}
+
+// Error returns the error message.
+func (e *wellFormedError) Error() string {
+	return e.Msg
+}
+
+// openElement is an element whose end tag has not been read yet.
+type openElement struct {
+	Name string
+	Line int
+}
+
+// findUnbalanced returns the first well-formedness error of the XHTML content, or nil. Unlike
+// checkWellFormed, an element which is not closed is reported at the line of its start tag rather
+// than at the end tag of its parent, since that is where it has to be fixed.
+func findUnbalanced(content []byte) *wellFormedError {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Entity = xml.HTMLEntity
+	lineAt := func(offset int64) int {
+		return bytes.Count(content[:offset], []byte("\n")) + 1
+	}
+
+	stack := make([]openElement, 0, 20)
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return &wellFormedError{Line: syntaxErr.Line, Msg: syntaxErr.Msg}
+			}
+			return &wellFormedError{Line: lineAt(offset), Msg: err.Error()}
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, openElement{Name: qualifiedName(token.Name), Line: lineAt(offset)})
+		case xml.EndElement:
+			name := qualifiedName(token.Name)
+			if len(stack) == 0 {
+				return &wellFormedError{Line: lineAt(offset), Msg: fmt.Sprintf("unexpected end tag </%s>", name)}
+			}
+			top := stack[len(stack)-1]
+			if top.Name != name {
+				return &wellFormedError{Line: top.Line, Msg: fmt.Sprintf("element <%s> is not closed before </%s>", top.Name, name)}
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return &wellFormedError{Line: top.Line, Msg: fmt.Sprintf("element <%s> is not closed", top.Name)}
+	}
+	return nil
+}
+
+// qualifiedName returns the element name with its namespace prefix as written, such as epub:switch.
+func qualifiedName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// validateSection fails if the generated section file is not well-formed XHTML, naming the section and the
+// offending line, which a reading system like Kobo may otherwise render as a blank or truncated page.
+// The line is looked up in the source file, so the error points at the line to fix when it is found there.
+// Skipped with -novalidate.
+func (b *InputBuffer) validateSection(fileName string, content []byte) {
+	if b.parms.NoValidate || isControlFile(fileName) {
+		return
+	}
+	problem := findUnbalanced(content)
+	if problem == nil {
+		return
+	}
+
+	name := fileName
+	if section, found := b.sectionByFile(fileName); found {
+		name = fmt.Sprintf("%s (%s)", fileName, section.Heading)
+	}
+	lines := strings.Split(string(content), "\n")
+	if problem.Line < 1 || problem.Line > len(lines) {
+		fail("%s is not well-formed: %s", name, problem.Msg)
+	}
+	offending := strings.TrimSpace(lines[problem.Line-1])
+	failAt(b.sourceLineOf(offending), "%s is not well-formed: %s: %s", name, problem.Msg, offending)
+}
+
+// sourceLineOf returns the number of the first source line with the given text, or 0 if there is none,
+// such as when the line was produced by a template or rewritten before it was rendered.
+func (b *InputBuffer) sourceLineOf(text string) int {
+	if text == "" {
+		return 0
+	}
+	for i, line := range b.lines {
+		if strings.TrimSpace(line) == text {
+			if i < len(b.lineNos) {
+				return b.lineNos[i]
+			}
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// sourceLinesBefore returns the number of the source line of each of the lines of a section, or 0 for a line
+// which is not found, such as one rewritten before. The lines are looked up backwards from the current line,
+// as the section was read just before it, so that a line repeated in the source, such as an empty paragraph,
+// gets the number of its own occurrence.
+func (b *InputBuffer) sourceLinesBefore(lines []string) []int {
+	lineNos := make([]int, len(lines))
+	cursor := b.lineIndex
+	if cursor > len(b.lines) {
+		cursor = len(b.lines)
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		text := strings.TrimSpace(lines[i])
+		if text == "" {
+			continue
+		}
+		for j := cursor - 1; j >= 0; j-- {
+			if strings.TrimSpace(b.lines[j]) != text {
+				continue
+			}
+			lineNos[i], cursor = j+1, j
+			if j < len(b.lineNos) {
+				lineNos[i] = b.lineNos[j]
+			}
+			break
+		}
+	}
+	return lineNos
+}
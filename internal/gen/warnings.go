@@ -0,0 +1,76 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 29-Dec-2023
+//
+// Warnings of a build, kept in a sidecar file next to the .epub file for later triage.
+
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// warningsFileName is the name of the warnings file written into the generated book directory.
+const warningsFileName = "warnings.json"
+
+// excludedFiles are the diagnostic and bookkeeping files of a build, which are never copied into the package
+// nor packaged into the .epub file, wherever they are found, see isExcludedFile.
+var excludedFiles = map[string]bool{
+	LockFileName:         true,
+	reportFileName:       true,
+	warningsFileName:     true,
+	checksumsFileName:    true,
+	failedFileName:       true,
+	"build.log":          true,
+	"sourcemap.json":     true,
+	".ep3gen-state.yaml": true,
+}
+
+// warningsData is the content of the warnings file.
+type warningsData struct {
+	Book     string   `json:"book"`
+	Warnings []string `json:"warnings"`
+}
+
+// warn prints the warning and keeps it for the warnings file.
+func (c *Context) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	c.warnings = append(c.warnings, msg)
+	fmt.Fprintf(c.out, "epubgen: warning: %s\n", msg)
+}
+
+// isExcludedFile returns true if the file is a diagnostic or bookkeeping file of a build, by its name: one
+// of the excludedFiles, a state file or a lock file, also one being taken over as stale.
+func isExcludedFile(fileSpec string) bool {
+	name := filepath.Base(fileSpec)
+	return excludedFiles[name] || strings.HasSuffix(name, stateFileSuffix) || strings.HasSuffix(name, ".lock") ||
+		strings.HasPrefix(name, LockFileName) || strings.HasSuffix(name, failedTemplateDataSuffix)
+}
+
+// IsBookkeepingFile returns true if the file is a diagnostic or bookkeeping file of a build rather than a part
+// of the generated book, see isExcludedFile.
+func IsBookkeepingFile(fileSpec string) bool {
+	return isExcludedFile(fileSpec)
+}
+
+// WriteWarnings writes the warnings of the build, including those about the config file, into the generated
+// book directory, next to the build report. The file is written even when there are no warnings, so that
+// a stale one never outlives the build it came from.
+func (c *Context) WriteWarnings(bookName string) (err error) {
+	defer catch(&err)
+	fileName := warningsFileName
+	fmt.Fprintf(c.out, "Generating file %s (WARNINGS) ... ", fileName)
+
+	data := warningsData{Book: bookName, Warnings: make([]string, 0, len(c.parms.Warnings)+len(c.warnings))}
+	data.Warnings = append(data.Warnings, c.parms.Warnings...)
+	data.Warnings = append(data.Warnings, c.warnings...)
+	content, err := json.MarshalIndent(data, "", "  ")
+	check(err)
+	check(os.WriteFile(filepath.Join(c.targetDirSpec, fileName), append(content, '\n'), 0660))
+
+	fmt.Fprintln(c.out, "done")
+	return nil
+}
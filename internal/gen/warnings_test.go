@@ -0,0 +1,31 @@
+package gen
+
+import "testing"
+
+func TestIsExcludedFile(t *testing.T) {
+	for _, test := range []struct {
+		fileSpec string
+		want     bool
+	}{
+		{"build.log", true},
+		{"OEBPS/warnings.json", true},
+		{"OEBPS/Text/report.json", true},
+		{"META-INF/sourcemap.json", true},
+		{".ep3gen-state.yaml", true},
+		{"checksums.txt", true},
+		{"failed.json", true},
+		{".ep3gen.lock", true},
+		{".ep3gen.lock.stale", true},
+		{"book.lock", true},
+		{"example.state.json", true},
+		{"OEBPS/Text/section004.xhtml.data.json", true},
+		{"OEBPS/Text/section004.xhtml", false},
+		{"OEBPS/Images/report.png", false},
+		{"OEBPS/Media/data.json", false},
+		{"OEBPS/Styles/build.log.css", false},
+	} {
+		if got := isExcludedFile(test.fileSpec); got != test.want {
+			t.Errorf("isExcludedFile(%q) = %t, want %t", test.fileSpec, got, test.want)
+		}
+	}
+}
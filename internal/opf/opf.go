@@ -0,0 +1,87 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 05-Jan-2024
+//
+// Reader for the metadata of a package file (package.opf) written by an earlier build.
+
+package opf
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// Metadata holds the dates recorded in the <metadata> element of a package file.
+type Metadata struct {
+	Created  string // dcterms:created, or else the first dc:date
+	Modified string // dcterms:modified
+}
+
+type metaElement struct {
+	Property string `xml:"property,attr"`
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type packageDocument struct {
+	Dates []string      `xml:"metadata>date"`
+	Metas []metaElement `xml:"metadata>meta"`
+}
+
+// Read parses the package file and returns its dates. Fails if the file is not well-formed XML or has no
+// creation date.
+func Read(reader io.Reader) (Metadata, error) {
+	var doc packageDocument
+	if err := xml.NewDecoder(reader).Decode(&doc); err != nil {
+		return Metadata{}, err
+	}
+
+	var metadata Metadata
+	for _, meta := range doc.Metas {
+		switch {
+		case meta.Property == "dcterms:created" && metadata.Created == "":
+			metadata.Created = strings.TrimSpace(meta.Value)
+		case meta.Name == "dcterms:created" && metadata.Created == "":
+			metadata.Created = strings.TrimSpace(meta.Content) // the EPUB2 form
+		case meta.Property == "dcterms:modified":
+			metadata.Modified = strings.TrimSpace(meta.Value)
+		}
+	}
+	if metadata.Created == "" && len(doc.Dates) > 0 {
+		metadata.Created = strings.TrimSpace(doc.Dates[0])
+	}
+	if metadata.Created == "" {
+		return Metadata{}, errors.New("package file has no creation date")
+	}
+	return metadata, nil
+}
+
+// ReadFile reads the metadata of the package file at the given path.
+func ReadFile(fileSpec string) (Metadata, error) {
+	file, err := os.Open(fileSpec)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// ReadEpub reads the metadata of the package file stored under the given entry name, such as
+// OEBPS/package.opf, in the .epub file.
+func ReadEpub(epubFileSpec, entryName string) (Metadata, error) {
+	archive, err := zip.OpenReader(epubFileSpec)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer archive.Close()
+	file, err := archive.Open(entryName)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer file.Close()
+	return Read(file)
+}
@@ -0,0 +1,113 @@
+package opf
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPackageFile is a package file generated from the example book with the created attribute
+// 2023-06-15T08:30:00Z.
+var testPackageFile = filepath.Join("testdata", "package.opf")
+
+func TestReadFile(t *testing.T) {
+	metadata, err := ReadFile(testPackageFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Metadata{Created: "2023-06-15T08:30:00Z", Modified: "2024-01-01T00:00:00Z"}); metadata != want {
+		t.Errorf("ReadFile = %+v, want %+v", metadata, want)
+	}
+	if _, err = ReadFile(filepath.Join("testdata", "missing.opf")); !os.IsNotExist(err) {
+		t.Errorf("ReadFile of a missing file error = %v, want not exist", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	const header = `<?xml version="1.0" encoding="UTF-8"?>
+<package version="3.0" xmlns="http://www.idpf.org/2007/opf">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`
+	const footer = `  </metadata>
+</package>
+`
+	tests := []struct {
+		name     string
+		metadata string
+		want     Metadata
+		err      string
+	}{
+		{"dcterms:created before dc:date", `    <dc:date>2020-01-01T00:00:00Z</dc:date>
+    <meta property="dcterms:created"> 2019-05-05T10:00:00Z </meta>
+    <meta property="dcterms:modified">2024-02-02T00:00:00Z</meta>
+`, Metadata{Created: "2019-05-05T10:00:00Z", Modified: "2024-02-02T00:00:00Z"}, ""},
+		{"EPUB2 form", `    <meta name="dcterms:created" content="2018-03-03T00:00:00Z"/>
+`, Metadata{Created: "2018-03-03T00:00:00Z"}, ""},
+		{"first dc:date", `    <dc:date>2017-07-07T00:00:00Z</dc:date>
+    <dc:date>2021-01-01T00:00:00Z</dc:date>
+`, Metadata{Created: "2017-07-07T00:00:00Z"}, ""},
+		{"no creation date", `    <meta property="dcterms:modified">2024-02-02T00:00:00Z</meta>
+`, Metadata{}, "package file has no creation date"},
+		{"not well-formed", `    <dc:date>2017-07-07T00:00:00Z</dc:title>
+`, Metadata{}, "XML syntax error"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metadata, err := Read(strings.NewReader(header + test.metadata + footer))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("Read error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metadata != test.want {
+				t.Errorf("Read = %+v, want %+v", metadata, test.want)
+			}
+		})
+	}
+}
+
+func TestReadEpub(t *testing.T) {
+	content, err := os.ReadFile(testPackageFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	epubFileSpec := filepath.Join(t.TempDir(), "example.epub")
+	file, err := os.Create(epubFileSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	entry, err := archive.Create("OEBPS/package.opf")
+	if err == nil {
+		_, err = entry.Write(content)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := ReadEpub(epubFileSpec, "OEBPS/package.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Created != "2023-06-15T08:30:00Z" {
+		t.Errorf("ReadEpub created = %q, want 2023-06-15T08:30:00Z", metadata.Created)
+	}
+	if _, err = ReadEpub(epubFileSpec, "EPUB/package.opf"); err == nil {
+		t.Error("ReadEpub of a missing entry succeeded")
+	}
+	if _, err = ReadEpub(testPackageFile, "OEBPS/package.opf"); err == nil {
+		t.Error("ReadEpub of a file which is not a zip file succeeded")
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 21-Oct-2023
+//
+// Typed configuration loaded from config.yaml
+
+package parm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/roslamir/ep3gen/internal/textutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds all the known configuration parameters. The yaml tag is the key in config.yaml and
+// the required tag marks the parameters which must be present.
+type Config struct {
+	SourceDir             string              `yaml:"source_dir" required:"true"`
+	TargetDir             string              `yaml:"target_dir" required:"true"`
+	ResourceDir           string              `yaml:"resource_dir" required:"true"`
+	TemplatesDir          string              `yaml:"templates_dir" required:"true"`
+	GlyphRanges           string              `yaml:"glyph_ranges"`
+	PacingFactor          float64             `yaml:"pacing_factor"`
+	DefaultHeadings       map[string]string   `yaml:"default_headings"`
+	QuickNav              bool                `yaml:"quicknav"`
+	MaxLabelLength        int                 `yaml:"max_label_length"`
+	TOCCase               string              `yaml:"toc_case"`
+	TOCCaseProtected      string              `yaml:"toc_case_protected"`
+	MinCoverSize          int                 `yaml:"min_cover_size"`
+	MinWords              int                 `yaml:"min_words"`
+	MaxWordDrop           float64             `yaml:"max_word_drop"`
+	GroupAppendices       bool                `yaml:"group_appendices"`
+	LetterAppendices      bool                `yaml:"letter_appendices"`
+	StripStyles           bool                `yaml:"strip_styles"`
+	KeepStyles            string              `yaml:"keep_styles"`
+	Lint                  bool                `yaml:"lint"`
+	LintDisable           string              `yaml:"lint_disable"`
+	ChapterHeadingPattern string              `yaml:"chapter_heading_pattern"`
+	SectionIDs            string              `yaml:"section_ids"`
+	FrontMatter           string              `yaml:"frontmatter"`
+	LongDesc              string              `yaml:"longdesc"`
+	Comments              string              `yaml:"comments"`
+	PackageDir            string              `yaml:"package_dir"`
+	TextDir               string              `yaml:"text_dir"`
+	ImagesDir             string              `yaml:"images_dir"`
+	StylesDir             string              `yaml:"styles_dir"`
+	MediaDir              string              `yaml:"media_dir"`
+	Renditions            []map[string]string `yaml:"renditions"`
+}
+
+// loadConfig parses the config file contents into a Config. Unknown keys are printed and returned as
+// warnings with the closest known key as a suggestion. Values of the wrong type and missing required keys
+// return an error naming the key and the offending value.
+func loadConfig(configFile string, content []byte) (Config, []string, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return Config{}, nil, fmt.Errorf("error parsing config file %s: %s", configFile, err.Error())
+	}
+
+	var cfg Config
+	if len(root.Content) == 0 {
+		return cfg, nil, checkRequired(configFile, cfg, nil) // empty file
+	}
+	mapping := root.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return cfg, nil, fmt.Errorf("config file %s must contain a mapping of keys to values", configFile)
+	}
+
+	cfgValue := reflect.ValueOf(&cfg).Elem()
+	cfgType := cfgValue.Type()
+	knownKeys := make([]string, cfgType.NumField())
+	for i := range knownKeys {
+		knownKeys[i] = cfgType.Field(i).Tag.Get("yaml")
+	}
+
+	var warnings []string
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i].Value, mapping.Content[i+1]
+		index := indexOf(knownKeys, key)
+		if index == -1 {
+			msg := fmt.Sprintf("unknown config key '%s' in %s is ignored", key, configFile)
+			if suggestion := textutil.Suggest(key, knownKeys); suggestion != "" {
+				msg += fmt.Sprintf(" (did you mean '%s'?)", suggestion)
+			}
+			fmt.Println("epubgen: warning: " + msg)
+			warnings = append(warnings, msg)
+			continue
+		}
+		if err := decodeValue(value, cfgValue.Field(index)); err != "" {
+			return cfg, nil, fmt.Errorf("config key '%s' %s (line %d of %s)", key, err, value.Line, configFile)
+		}
+		seen[key] = true
+	}
+
+	return cfg, warnings, checkRequired(configFile, cfg, seen)
+}
+
+// checkRequired returns an error with the list of all required keys missing from the config file.
+func checkRequired(configFile string, cfg Config, seen map[string]bool) error {
+	cfgType := reflect.TypeOf(cfg)
+	missing := make([]string, 0)
+	for i := 0; i < cfgType.NumField(); i++ {
+		field := cfgType.Field(i)
+		if key := field.Tag.Get("yaml"); field.Tag.Get("required") == "true" && !seen[key] {
+			missing = append(missing, "'"+key+"'")
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("config parameter %s required in %s", strings.Join(missing, ", "), configFile)
+	}
+	return nil
+}
+
+// decodeValue decodes the YAML node into the field, returning a human-readable description of the
+// problem if the node does not match the field type, or "" on success.
+func decodeValue(node *yaml.Node, field reflect.Value) string {
+	switch field.Kind() {
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+			return "expects a string, got " + describeNode(node)
+		}
+		field.SetString(node.Value)
+
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			return "expects true/false, got " + describeNode(node)
+		}
+		var value bool
+		if err := node.Decode(&value); err != nil {
+			return "expects true/false, got " + describeNode(node)
+		}
+		field.SetBool(value)
+
+	case reflect.Int:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			return "expects a whole number, got " + describeNode(node)
+		}
+		var value int
+		if err := node.Decode(&value); err != nil {
+			return "expects a whole number, got " + describeNode(node)
+		}
+		field.SetInt(int64(value))
+
+	case reflect.Float64:
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!int" && node.Tag != "!!float") {
+			return "expects a number, got " + describeNode(node)
+		}
+		var value float64
+		if err := node.Decode(&value); err != nil {
+			return "expects a number, got " + describeNode(node)
+		}
+		field.SetFloat(value)
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return "expects a mapping of names to values, got " + describeNode(node)
+		}
+		values := make(map[string]string, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i].Value, node.Content[i+1]
+			if value.Kind != yaml.ScalarNode {
+				return fmt.Sprintf("expects a string for '%s', got %s", name, describeNode(value))
+			}
+			values[name] = value.Value
+		}
+		field.Set(reflect.ValueOf(values))
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return "expects a list, got " + describeNode(node)
+		}
+		items := make([]map[string]string, len(node.Content))
+		for i, item := range node.Content {
+			if err := decodeValue(item, reflect.ValueOf(&items[i]).Elem()); err != "" {
+				return fmt.Sprintf("item %d %s", i+1, err)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	}
+	return ""
+}
+
+// describeNode describes the YAML node for error messages, quoting scalar values.
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	if node.Tag == "!!null" {
+		return "an empty value"
+	}
+	return "'" + node.Value + "'"
+}
+
+// indexOf returns the index of the string in the slice, or -1 if not found.
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
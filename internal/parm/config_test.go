@@ -0,0 +1,156 @@
+package parm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// requiredKeys are the lines of the config keys every config file must have.
+const requiredKeys = "source_dir: books\ntarget_dir: out\nresource_dir: etc\ntemplates_dir: templates\n"
+
+// writeConfig writes the content into a config file in a new temporary directory and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configFile
+}
+
+func TestLoadConfigFull(t *testing.T) {
+	const content = requiredKeys + `glyph_ranges: U+0020-U+007E
+pacing_factor: 1.5
+default_headings:
+  preamble: Author's Note
+quicknav: true
+max_label_length: 40
+toc_case: title
+toc_case_protected: NASA, iPhone
+min_cover_size: 1400
+min_words: 1000
+max_word_drop: 25
+group_appendices: true
+letter_appendices: true
+strip_styles: true
+keep_styles: text-align
+lint: true
+lint_disable: EP3L001
+chapter_heading_pattern: ^Chapter
+section_ids: slug
+frontmatter: combined
+longdesc: appendix
+comments: keep
+package_dir: OPS
+text_dir: xhtml
+images_dir: img
+styles_dir: css
+media_dir: audio
+renditions:
+  - name: default
+  - name: fixed
+    label: Fixed Layout
+    layout: pre-paginated
+    viewport: 1200x1600
+`
+	// Every known key is in the content, so a key added to Config is added to this test too.
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if key := configType.Field(i).Tag.Get("yaml"); !strings.Contains(content, "\n"+key+":") && !strings.HasPrefix(content, key+":") {
+			t.Errorf("config key '%s' is missing from the test", key)
+		}
+	}
+
+	p := Defaults()
+	if err := p.LoadConfigFile(writeConfig(t, content)); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Warnings) != 0 {
+		t.Errorf("warnings = %q, want none", p.Warnings)
+	}
+	got := []any{
+		p.SourceDir, p.TargetDir, p.ResourceDir, p.TemplatesDir, p.GlyphRanges, p.PacingFactor,
+		p.DefaultHeadings["preamble"], p.QuickNav, p.MaxLabel, p.TOCCase, p.TOCCaseProtected["nasa"],
+		p.TOCCaseProtected["iphone"], p.MinCoverSize, p.MinWords, p.MaxWordDrop, p.GroupAppendices,
+		p.LetterAppendices, p.StripStyles, p.KeepStyles, p.Lint, p.ChapterHeadingPattern, p.SectionIDs, p.FrontMatter,
+		p.LongDesc, p.Comments, p.PackageDir, p.TextDir, p.ImagesDir, p.StylesDir, p.MediaDir, len(p.Renditions),
+	}
+	want := []any{
+		"books", "out", "etc", "templates", "U+0020-U+007E", 1.5,
+		"Author's Note", true, 40, "title", "NASA",
+		"iPhone", 1400, 1000, 25.0, true,
+		true, true, "text-align", true, "^Chapter", "slug", "combined",
+		"appendix", "keep", "OPS", "xhtml", "img", "css", "audio", 2,
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parameter %d = %v, want %v", i+1, got[i], want[i])
+		}
+	}
+	if !strings.HasPrefix(p.LintDisable, "EP3L001") {
+		t.Errorf("LintDisable = %q, want EP3L001 first", p.LintDisable)
+	}
+	if fixed := p.Renditions[1]; fixed.Name != "fixed" || fixed.Label != "Fixed Layout" || fixed.Layout != "pre-paginated" {
+		t.Errorf("rendition = %+v, want the fixed layout one", fixed)
+	}
+}
+
+func TestLoadConfigUnknownKeys(t *testing.T) {
+	p := Defaults()
+	content := requiredKeys + "taget_dir: out\nkepub: true\n"
+	if err := p.LoadConfigFile(writeConfig(t, content)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"unknown config key 'taget_dir'", "(did you mean 'target_dir'?)", "unknown config key 'kepub'"}
+	warnings := strings.Join(p.Warnings, "\n")
+	for _, text := range want {
+		if !strings.Contains(warnings, text) {
+			t.Errorf("warnings = %q, want one containing %q", p.Warnings, text)
+		}
+	}
+	if len(p.Warnings) != 2 {
+		t.Errorf("%d warnings, want 2", len(p.Warnings))
+	}
+	if strings.Contains(p.Warnings[1], "did you mean") {
+		t.Errorf("warning %q suggests a key unlike 'kepub'", p.Warnings[1])
+	}
+}
+
+func TestLoadConfigWrongTypes(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"quicknav: yes\n", "config key 'quicknav' expects true/false, got 'yes' (line 5 of"},
+		{"quicknav:\n", "config key 'quicknav' expects true/false, got an empty value"},
+		{"max_label_length: 12.5\n", "config key 'max_label_length' expects a whole number, got '12.5'"},
+		{"pacing_factor: fast\n", "config key 'pacing_factor' expects a number, got 'fast'"},
+		{"glyph_ranges: [a, b]\n", "config key 'glyph_ranges' expects a string, got a list"},
+		{"default_headings: Preface\n", "config key 'default_headings' expects a mapping of names to values, got 'Preface'"},
+		{"default_headings:\n  preamble: [a]\n", "config key 'default_headings' expects a string for 'preamble', got a list"},
+		{"renditions:\n  name: fixed\n", "config key 'renditions' expects a list, got a mapping"},
+		{"renditions:\n  - fixed\n", "config key 'renditions' item 1 expects a mapping of names to values, got 'fixed'"},
+	}
+	for _, test := range tests {
+		t.Run(strings.SplitN(test.content, ":", 2)[0], func(t *testing.T) {
+			err := Defaults().LoadConfigFile(writeConfig(t, requiredKeys+test.content))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("LoadConfigFile error = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRequiredKeys(t *testing.T) {
+	err := Defaults().LoadConfigFile(writeConfig(t, "source_dir: books\ntemplates_dir: templates\n"))
+	if err == nil || !strings.Contains(err.Error(), "config parameter 'target_dir', 'resource_dir' required in") {
+		t.Errorf("LoadConfigFile error = %v, want the missing keys", err)
+	}
+	err = Defaults().LoadConfigFile(writeConfig(t, "- source_dir\n"))
+	if err == nil || !strings.Contains(err.Error(), "must contain a mapping of keys to values") {
+		t.Errorf("LoadConfigFile error = %v, want the mapping required", err)
+	}
+}
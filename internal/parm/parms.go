@@ -6,92 +6,378 @@
 package parm
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
-
-	"github.com/google/uuid"
-	"gopkg.in/yaml.v3"
 )
 
 const (
-	usage = `usage: epubgen [-c path_to_config_file] BookName
+	usage = `usage: epubgen [-allow-placeholders] [-allow-unknown-properties] [-c path_to_config_file] [-debug]
+               [-disable rules] [-emit-model path] [-exploded] [-force] [-glyphs] [-keep-failed] [-lint]
+               [-metadata-only] [-novalidate] [-pacing] [-permissive] [-placeholders] [-report]
+               [-strict] [-styles] [-target kindle] [-trace] [-v] [-verify-determinism] [-wait] BookName
+       epubgen -directives
+       epubgen selftest [-c path_to_config_file] [-novalidate]
+
+Generates EPUB3 e-book from the source artifacts under the directory ./source/<BookName>.
+The selftest command builds a small example book carried by the program into a temporary directory,
+to check that the templates, the resources and the packaging of the installation work.
 
-Generates EPUB3 e-book from the source artifacts under the directory ./source/<BookName>.`
+Options:
+  -allow-placeholders
+              package the e-book even if some images are placeholders (see -placeholders)
+  -allow-unknown-properties
+              accept spine-properties tokens of directives which are not in the list of known ones
+  -c path     use the given config file instead of ./config.yaml
+  -debug      show the stack trace of the code where the build failed, for debugging the program
+  -directives list the known directives and their arguments
+  -disable rules
+              turn off the given content lint rules (see -lint), a comma-separated list of rule IDs such as
+              EP3L001,EP3L002, in addition to those of the config key lint_disable
+  -emit-model path
+              write the parsed book model as JSON to the given file
+  -exploded   keep the generated book directory next to the .epub file, for debugging
+  -force      rebuild the book even if its inputs have not changed since the last build
+  -glyphs     report characters that may render as missing glyphs on reading devices
+  -keep-failed
+              when a template fails, keep its partial output, the data passed to it as JSON next to it, and
+              the list of the files rendered before in failed.json, in the generated book directory
+  -lint       check the section content for markup which renders badly or differently from one reader to
+              another, such as empty paragraphs used for spacing, as does the config key lint
+  -metadata-only
+              only regenerate package.opf, nav.xhtml and toc.ncx, reusing the section files of the
+              last build (kept with -exploded); refused if anything but the metadata attributes has changed
+  -novalidate skip the check that each generated section file is well-formed XHTML, for speed
+  -pacing     report chapter lengths as a bar chart and flag chapters far from the median
+  -permissive tolerate a missing section heading line by synthesising a numbered heading
+  -placeholders
+              replace the missing images other than the cover image by grey placeholder images with the
+              file name, for drafts; the e-book is not packaged unless -allow-placeholders is also given
+  -report     write a JSON report of the build into the target directory
+  -strict     stop the build instead of warning when the copyright template renders attributes which are
+              not set, an <!--image--> has no alt text or the cover image is under min_cover_size
+  -styles     report the inline style attributes in each section with their most common properties
+  -target kindle
+              report the constructs which degrade or disappear when the e-book is converted for Kindle
+              (KF8, Enhanced Typesetting), with their section and line; the e-book is not changed
+  -trace      trace the phases of the parse and the directive dispatched on each line, for bug reports
+  -v          verbose output, such as which template produced each file, the TOC tree and
+              the check that all the TOC links resolve
+  -verify-determinism
+              generate the book twice into temporary directories with the same pinned build time and
+              stop at the first file which differs, showing a hex dump of the difference
+  -wait       wait for another build of the same book to finish instead of stopping`
 )
 
-var (
-	BookUUID     string = strings.ToUpper(uuid.New().String()) // Always create a new UUID for this e-book
+// Parms holds the parameters of the generation of a book: the settings of the config file and the flags of the
+// command line. Each generation reads its own copy, so that several books can be generated at the same time
+// with different parameters.
+type Parms struct {
 	BookName     string
 	SourceDir    string
 	TargetDir    string
 	ResourceDir  string
 	TemplatesDir string
-)
+	GlyphRanges  string  // optional comma-separated list of allowed code point ranges for the glyph audit
+	AuditGlyphs  bool    // set by the -glyphs flag
+	WriteReport  bool    // set by the -report flag
+	Pacing       bool    // set by the -pacing flag
+	PacingFactor float64 // chapters longer or shorter than the median by this factor are flagged
+	Verbose      bool    // set by the -v flag
+	Directives   bool    // set by the -directives flag
+	SelfTest     bool    // set by the selftest command
+	QuickNav     bool    // generate the quick navigation page even without the <!--quicknav--> directive
+	EmitModel    string  // set by the -emit-model flag, the file to write the parsed book model to
+	Force        bool    // set by the -force flag
+	ConfigFile   string  // the config file in use, set by the -c flag
+	MaxLabel     int     // the maximum length of the NAV and NCX labels, 0 for no limit
+	TOCCase      string  // "title" or "sentence" to recase the NAV and NCX labels, see textutil.CaseLabel
+	Permissive   bool    // set by the -permissive flag
+	MetadataOnly bool    // set by the -metadata-only flag
+	Wait         bool    // set by the -wait flag
+	Styles       bool    // set by the -styles flag
+	Target       string  // set by the -target flag, the reading system to check the content against
+	KeepExploded bool    // set by the -exploded flag
+	Debug        bool    // set by the -debug flag
+	NoValidate   bool    // set by the -novalidate flag
+	Trace        bool    // set by the -trace flag
+	Strict       bool    // set by the -strict flag
+	KeepFailed   bool    // set by the -keep-failed flag
+	Lint         bool    // set by the -lint flag or the config key lint
 
-// checkArgs checks the input arguments and acts accordingly.
-func CheckArgsAndParms(args []string) {
-	var configFile string
-	if len(args) == 1 {
-		// Show usage information if no arguments are given
-		fmt.Println(usage)
+	Placeholders           bool // set by the -placeholders flag
+	AllowPlaceholders      bool // set by the -allow-placeholders flag
+	AllowUnknownProperties bool // set by the -allow-unknown-properties flag
+	VerifyDeterminism      bool // set by the -verify-determinism flag
+
+	Warnings []string // the warnings about the config file, kept for the warnings file of the build
+
+	// SourceDateEpoch pins the build timestamp to this number of seconds since 1970, for reproducible builds.
+	// It is taken from the environment variable SOURCE_DATE_EPOCH; "" builds at the current time.
+	SourceDateEpoch string
+
+	MinCoverSize int     // the minimum long edge of the cover image in pixels, below which retailers reject the book
+	MinWords     int     // the minimum number of words in the sections, below which the build stops, 0 for no minimum
+	MaxWordDrop  float64 // the drop in the number of words since the last build, in percent, above which the build warns
+
+	GroupAppendices  bool // nest all the appendices under a single "Appendices" entry in the TOC
+	LetterAppendices bool // prefix the appendix headings with "Appendix A", "Appendix B", ...
+
+	StripStyles bool   // remove the inline style attributes from the body content
+	KeepStyles  string // comma-separated list of the style properties kept when stripping, e.g. "text-align"
+	LintDisable string // comma-separated list of the lint rules turned off, e.g. "EP3L001,EP3L002", from -disable and lint_disable
+
+	ChapterHeadingPattern string // the regular expression matching the headings starting a chapter
+	SectionIDs            string // "slug" to derive the section IDs from the headings instead of numbering them
+	FrontMatter           string // "combined" to render the frontmatter sections into a single file
+	LongDesc              string // "appendix" to move the long descriptions of the figures into a generated backmatter section
+	Comments              string // "keep" to pass the ordinary HTML comments of the body through instead of dropping them
+
+	// The directory layout of the package: the package directory holding package.opf, and the directories
+	// of the section files, images, stylesheet and audio and video files inside it.
+	PackageDir string
+	TextDir    string
+	ImagesDir  string
+	StylesDir  string
+	MediaDir   string
+
+	// DefaultHeadings maps directive names to the heading used when the section heading is empty.
+	DefaultHeadings map[string]string
+
+	// TOCCaseProtected maps the lower case of the words of toc_case_protected to the way they are always
+	// written in the recased labels, such as "nasa" to "NASA".
+	TOCCaseProtected map[string]string
+
+	// Renditions are the renditions of the book listed by the renditions config key, the default one first.
+	// The book is generated as a single rendition when the key is absent.
+	Renditions []Rendition
+}
+
+// layoutDirRegexp matches a directory name of the package layout, a single path segment.
+var layoutDirRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// Defaults returns the parameters as they are before the config file and the flags are applied, with the
+// build timestamp pinned by the environment, if any.
+func Defaults() *Parms {
+	return &Parms{
+		SourceDateEpoch:  os.Getenv("SOURCE_DATE_EPOCH"),
+		PacingFactor:     2.0,
+		MinCoverSize:     1600,
+		MaxWordDrop:      25.0,
+		PackageDir:       "OEBPS",
+		TextDir:          "Text",
+		ImagesDir:        "Images",
+		StylesDir:        "Styles",
+		MediaDir:         "Media",
+		DefaultHeadings:  make(map[string]string),
+		TOCCaseProtected: make(map[string]string),
+	}
+}
+
+// Clone returns a copy of the parameters which shares nothing with them, for a generation to change freely.
+func (p *Parms) Clone() *Parms {
+	clone := *p
+	clone.Warnings = append([]string(nil), p.Warnings...)
+	clone.Renditions = append([]Rendition(nil), p.Renditions...)
+	clone.DefaultHeadings = make(map[string]string, len(p.DefaultHeadings))
+	for directive, heading := range p.DefaultHeadings {
+		clone.DefaultHeadings[directive] = heading
+	}
+	clone.TOCCaseProtected = make(map[string]string, len(p.TOCCaseProtected))
+	for word, protected := range p.TOCCaseProtected {
+		clone.TOCCaseProtected[word] = protected
+	}
+	return &clone
+}
+
+// CheckArgsAndParms checks the input arguments and returns the parameters they give, with those of the config
+// file. Returns an error if the config file cannot be read or has an invalid value.
+func CheckArgsAndParms(args []string) (*Parms, error) {
+	p := Defaults()
+	flags := flag.NewFlagSet("epubgen", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() { fmt.Println(usage) }
+	flags.StringVar(&p.ConfigFile, "c", "./config.yaml", "path to the config file")
+	flags.BoolVar(&p.AuditGlyphs, "glyphs", false, "report characters that may render as missing glyphs")
+	flags.BoolVar(&p.WriteReport, "report", false, "write a JSON report of the build")
+	flags.BoolVar(&p.Pacing, "pacing", false, "report chapter lengths")
+	flags.BoolVar(&p.Verbose, "v", false, "verbose output")
+	flags.BoolVar(&p.Lint, "lint", false, "check the section content for markup which renders badly")
+	flags.StringVar(&p.LintDisable, "disable", "", "turn off the given lint rules")
+	flags.BoolVar(&p.Directives, "directives", false, "list the known directives")
+	flags.StringVar(&p.EmitModel, "emit-model", "", "write the parsed book model as JSON")
+	flags.BoolVar(&p.Force, "force", false, "rebuild even if up to date")
+	flags.BoolVar(&p.Permissive, "permissive", false, "tolerate missing heading lines")
+	flags.BoolVar(&p.MetadataOnly, "metadata-only", false, "only regenerate the metadata files")
+	flags.BoolVar(&p.Wait, "wait", false, "wait for another build of the same book")
+	flags.BoolVar(&p.Styles, "styles", false, "report the inline style attributes")
+	flags.StringVar(&p.Target, "target", "", "report the constructs which degrade on the given reading system")
+	flags.BoolVar(&p.KeepExploded, "exploded", false, "keep the generated book directory")
+	flags.BoolVar(&p.Debug, "debug", false, "show the stack trace of a failed build")
+	flags.BoolVar(&p.NoValidate, "novalidate", false, "skip the well-formedness check of the section files")
+	flags.BoolVar(&p.Trace, "trace", false, "trace the phases of the parse and the directives")
+	flags.BoolVar(&p.Placeholders, "placeholders", false, "replace the missing images by placeholder images")
+	flags.BoolVar(&p.AllowPlaceholders, "allow-placeholders", false, "package the e-book with placeholder images")
+	flags.BoolVar(&p.KeepFailed, "keep-failed", false, "keep the partial output of a failed template")
+	flags.BoolVar(&p.Strict, "strict", false, "stop on the missing attributes, alt texts and cover size instead of warning")
+	flags.BoolVar(&p.AllowUnknownProperties, "allow-unknown-properties", false, "accept unknown spine-properties tokens")
+	flags.BoolVar(&p.VerifyDeterminism, "verify-determinism", false, "generate the book twice and compare the files")
+	if len(args) > 1 && args[1] == "selftest" {
+		p.SelfTest = true
+		args = args[1:]
+	}
+	if err := flags.Parse(args[1:]); err != nil {
 		os.Exit(1)
-	} else if len(args) == 2 {
-		// Assume only the 'BookName' is given
-		BookName = args[1]
-	} else if len(args) == 4 {
-		if args[1] == "-c" {
-			configFile = args[2]
-			BookName = args[3]
-		} else {
-			fmt.Println(usage)
-			os.Exit(1)
-		}
-	} else {
-		// Show usage information if extraneous arguments are given
+	}
+	if p.Directives && flags.NArg() == 0 {
+		return p, nil // no book and no config needed
+	}
+	if p.SelfTest != (flags.NArg() == 0) || flags.NArg() > 1 {
+		// Show usage information if no book name or extraneous arguments are given
 		fmt.Println(usage)
 		os.Exit(1)
 	}
-
-	// Use default config file
-	if configFile == "" {
-		configFile = "./config.yaml"
+	p.BookName = flags.Arg(0)
+	if p.Target != "" && p.Target != "kindle" {
+		return nil, fmt.Errorf("unknown target '%s' for -target, expected 'kindle'", p.Target)
+	}
+	if p.AllowPlaceholders && !p.Placeholders {
+		return nil, fmt.Errorf("-allow-placeholders requires -placeholders")
 	}
+	if err := p.LoadConfigFile(p.ConfigFile); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
-	// Read in the configuration values
-	if cfgfile, err := os.ReadFile(configFile); err == nil {
-		cfgMap := make(map[string]string)
-		err = yaml.Unmarshal(cfgfile, &cfgMap)
-		if err != nil {
-			msg := fmt.Sprintf("epubgen: error unmarshalling config file %s: %s", configFile, err.Error())
-			panic(msg)
+// LoadConfigFile reads the config file and sets the parameters it gives. The lint rules it turns off are
+// added to those already turned off. Returns an error if the config file cannot be read or has an invalid value.
+func (p *Parms) LoadConfigFile(configFile string) error {
+	cfgfile, err := os.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("cannot read config file %s: %s", configFile, err.Error())
+	}
+	cfg, warnings, err := loadConfig(configFile, cfgfile)
+	if err != nil {
+		return err
+	}
+	p.ConfigFile = configFile
+	p.Warnings = append(p.Warnings, warnings...)
+	p.SourceDir = cfg.SourceDir
+	p.TargetDir = cfg.TargetDir
+	p.ResourceDir = cfg.ResourceDir
+	p.TemplatesDir = cfg.TemplatesDir
+	p.GlyphRanges = cfg.GlyphRanges
+	p.QuickNav = cfg.QuickNav
+	p.GroupAppendices = cfg.GroupAppendices
+	p.LetterAppendices = cfg.LetterAppendices
+	p.StripStyles = cfg.StripStyles
+	p.KeepStyles = cfg.KeepStyles
+	p.Lint = p.Lint || cfg.Lint // either the flag or the config key
+	if cfg.LintDisable != "" {
+		p.LintDisable = strings.Join([]string{cfg.LintDisable, p.LintDisable}, ",") // both lists apply
+	}
+	p.ChapterHeadingPattern = cfg.ChapterHeadingPattern
+	if cfg.SectionIDs != "" {
+		if cfg.SectionIDs != "numbered" && cfg.SectionIDs != "slug" {
+			return fmt.Errorf("config key '%s' must be 'numbered' or 'slug', got '%s'", "section_ids", cfg.SectionIDs)
 		}
-		if value, exists := cfgMap["source_dir"]; exists {
-			SourceDir = value
-		} else {
-			msg := fmt.Sprintf("epubgen: config parameter '%s' required", "source_dir")
-			panic(msg)
+		p.SectionIDs = cfg.SectionIDs
+	}
+	if cfg.FrontMatter != "" {
+		if cfg.FrontMatter != "separate" && cfg.FrontMatter != "combined" {
+			return fmt.Errorf("config key '%s' must be 'separate' or 'combined', got '%s'", "frontmatter", cfg.FrontMatter)
 		}
-		if value, exists := cfgMap["target_dir"]; exists {
-			TargetDir = value
-		} else {
-			msg := fmt.Sprintf("epubgen: config parameter '%s' required", "target_dir")
-			panic(msg)
+		p.FrontMatter = cfg.FrontMatter
+	}
+	if cfg.LongDesc != "" {
+		if cfg.LongDesc != "inline" && cfg.LongDesc != "appendix" {
+			return fmt.Errorf("config key '%s' must be 'inline' or 'appendix', got '%s'", "longdesc", cfg.LongDesc)
 		}
-		if value, exists := cfgMap["resource_dir"]; exists {
-			ResourceDir = value
-		} else {
-			msg := fmt.Sprintf("epubgen: config parameter '%s' required", "resource_dir")
-			panic(msg)
+		p.LongDesc = cfg.LongDesc
+	}
+	if cfg.Comments != "" {
+		if cfg.Comments != "keep" && cfg.Comments != "drop" {
+			return fmt.Errorf("config key '%s' must be 'keep' or 'drop', got '%s'", "comments", cfg.Comments)
 		}
-		if value, exists := cfgMap["templates_dir"]; exists {
-			TemplatesDir = value
-		} else {
-			msg := fmt.Sprintf("epubgen: config parameter '%s' required", "templates_dir")
-			panic(msg)
+		p.Comments = cfg.Comments
+	}
+	layout := []struct {
+		key   string
+		value string
+		dir   *string
+	}{
+		{"package_dir", cfg.PackageDir, &p.PackageDir},
+		{"text_dir", cfg.TextDir, &p.TextDir},
+		{"images_dir", cfg.ImagesDir, &p.ImagesDir},
+		{"styles_dir", cfg.StylesDir, &p.StylesDir},
+		{"media_dir", cfg.MediaDir, &p.MediaDir},
+	}
+	for _, entry := range layout {
+		if entry.value == "" {
+			continue
+		}
+		if !layoutDirRegexp.MatchString(entry.value) || strings.EqualFold(entry.value, "META-INF") {
+			return fmt.Errorf("config key '%s' must be a single directory name such as 'OEBPS', got '%s'", entry.key, entry.value)
+		}
+		*entry.dir = entry.value
+	}
+	dirs := map[string]bool{p.TextDir: true, p.ImagesDir: true, p.StylesDir: true, p.MediaDir: true}
+	if len(dirs) != 4 {
+		return fmt.Errorf("config keys 'text_dir', 'images_dir', 'styles_dir' and 'media_dir' must name different directories")
+	}
+	if p.Renditions, err = parseRenditions(cfg.Renditions); err != nil {
+		return err
+	}
+	if cfg.PacingFactor != 0 {
+		if cfg.PacingFactor <= 1 {
+			return fmt.Errorf("config key '%s' must be greater than 1", "pacing_factor")
 		}
-	} else {
-		msg := fmt.Sprintf("epubgen: cannot read config file %s: %s", configFile, err.Error())
-		panic(msg)
+		p.PacingFactor = cfg.PacingFactor
+	}
+	if cfg.TOCCase != "" {
+		if cfg.TOCCase != "preserve" && cfg.TOCCase != "title" && cfg.TOCCase != "sentence" {
+			return fmt.Errorf("config key '%s' must be 'preserve', 'title' or 'sentence', got '%s'", "toc_case", cfg.TOCCase)
+		}
+		p.TOCCase = cfg.TOCCase
+	}
+	if p.TOCCaseProtected == nil {
+		p.TOCCaseProtected = make(map[string]string)
+	}
+	for _, word := range strings.Split(cfg.TOCCaseProtected, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			p.TOCCaseProtected[strings.ToLower(word)] = word
+		}
+	}
+	if cfg.MaxLabelLength != 0 {
+		if cfg.MaxLabelLength < 2 {
+			return fmt.Errorf("config key '%s' must be at least 2", "max_label_length")
+		}
+		p.MaxLabel = cfg.MaxLabelLength
+	}
+	if cfg.MinCoverSize != 0 {
+		if cfg.MinCoverSize < 1 {
+			return fmt.Errorf("config key '%s' must be at least 1", "min_cover_size")
+		}
+		p.MinCoverSize = cfg.MinCoverSize
+	}
+	if cfg.MinWords < 0 {
+		return fmt.Errorf("config key '%s' must not be negative", "min_words")
+	}
+	p.MinWords = cfg.MinWords
+	if cfg.MaxWordDrop != 0 {
+		if cfg.MaxWordDrop < 0 || cfg.MaxWordDrop > 100 {
+			return fmt.Errorf("config key '%s' must be a percentage greater than 0 and at most 100", "max_word_drop")
+		}
+		p.MaxWordDrop = cfg.MaxWordDrop
+	}
+	if p.DefaultHeadings == nil {
+		p.DefaultHeadings = make(map[string]string)
+	}
+	for directive, heading := range cfg.DefaultHeadings {
+		p.DefaultHeadings[directive] = heading
 	}
+	return nil
 }
@@ -0,0 +1,107 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 13-Jan-2024
+//
+// The renditions of the book packaged together in one container, from the renditions config key.
+
+package parm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Rendition is a rendition of the book listed in META-INF/container.xml, see Parms.Renditions.
+type Rendition struct {
+	Name       string // the name of the rendition, used for the names of its package file and text directory
+	Label      string // the name of the rendition shown by the reading systems offering a choice
+	Layout     string // "reflowable" or "pre-paginated"
+	Width      int    // the width of the pages of a pre-paginated rendition, in CSS pixels
+	Height     int    // the height of the pages of a pre-paginated rendition, in CSS pixels
+	Stylesheet string // the stylesheet of the rendition in place of stylesheet.css, found like the images
+}
+
+var (
+	// renditionNameRegexp matches the name of a rendition, which is used in file names.
+	renditionNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+	// viewportRegexp matches the page size of a pre-paginated rendition, such as 1200x1600.
+	viewportRegexp = regexp.MustCompile(`^([1-9][0-9]*)x([1-9][0-9]*)$`)
+)
+
+// renditionKeys are the keys of a rendition in the renditions config key.
+var renditionKeys = map[string]bool{"name": true, "label": true, "layout": true, "viewport": true, "stylesheet": true}
+
+// parseRenditions returns the renditions listed by the renditions config key. The first one is the default
+// rendition, which is the book as generated without the key, so it must be reflowable and takes only a name
+// and a label. The others name a layout, a viewport when pre-paginated, and optionally a stylesheet.
+func parseRenditions(items []map[string]string) ([]Rendition, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	if len(items) == 1 {
+		return nil, fmt.Errorf("config key 'renditions' must list at least two renditions, the default one first")
+	}
+	renditions := make([]Rendition, 0, len(items))
+	names := make(map[string]bool)
+	for i, item := range items {
+		keys := make([]string, 0, len(item))
+		for key := range item {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !renditionKeys[key] {
+				return nil, fmt.Errorf("config key 'renditions' item %d has the unknown key '%s'", i+1, key)
+			}
+		}
+
+		rendition := Rendition{Name: item["name"], Label: item["label"], Layout: item["layout"], Stylesheet: item["stylesheet"]}
+		if !renditionNameRegexp.MatchString(rendition.Name) {
+			return nil, fmt.Errorf("config key 'renditions' item %d must have a name such as 'fixed', got '%s'", i+1, rendition.Name)
+		}
+		if names[strings.ToLower(rendition.Name)] {
+			return nil, fmt.Errorf("config key 'renditions' lists the rendition '%s' twice", rendition.Name)
+		}
+		names[strings.ToLower(rendition.Name)] = true
+		if i > 0 && (strings.EqualFold(rendition.Name, "package") || strings.EqualFold(rendition.Name, "toc")) {
+			return nil, fmt.Errorf("config key 'renditions' name '%s' is taken by the files of the default rendition", rendition.Name)
+		}
+		if rendition.Label == "" {
+			rendition.Label = rendition.Name
+		}
+		if rendition.Layout == "" {
+			rendition.Layout = "reflowable"
+		}
+		if rendition.Layout != "reflowable" && rendition.Layout != "pre-paginated" {
+			return nil, fmt.Errorf("config key 'renditions' layout of '%s' must be 'reflowable' or 'pre-paginated', got '%s'",
+				rendition.Name, rendition.Layout)
+		}
+
+		viewport, hasViewport := item["viewport"]
+		switch {
+		case i == 0 && (rendition.Layout != "reflowable" || hasViewport || rendition.Stylesheet != ""):
+			return nil, fmt.Errorf("config key 'renditions' default rendition '%s' must be reflowable, with no viewport or stylesheet",
+				rendition.Name)
+		case rendition.Layout == "pre-paginated":
+			match := viewportRegexp.FindStringSubmatch(viewport)
+			if match == nil {
+				return nil, fmt.Errorf("config key 'renditions' viewport of '%s' must be the page size such as '1200x1600', got '%s'",
+					rendition.Name, viewport)
+			}
+			rendition.Width, _ = strconv.Atoi(match[1])
+			rendition.Height, _ = strconv.Atoi(match[2])
+		case hasViewport:
+			return nil, fmt.Errorf("config key 'renditions' viewport of '%s' is only for a pre-paginated rendition", rendition.Name)
+		}
+		if rendition.Stylesheet != "" && (!layoutDirRegexp.MatchString(rendition.Stylesheet) ||
+			!strings.HasSuffix(rendition.Stylesheet, ".css") || rendition.Stylesheet == "stylesheet.css") {
+			return nil, fmt.Errorf("config key 'renditions' stylesheet of '%s' must be a .css file name other than stylesheet.css, got '%s'",
+				rendition.Name, rendition.Stylesheet)
+		}
+		renditions = append(renditions, rendition)
+	}
+	return renditions, nil
+}
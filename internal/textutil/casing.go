@@ -0,0 +1,154 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 17-Jan-2024
+//
+// Title case and sentence case of the TOC labels.
+
+package textutil
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// labelWordRegexp matches a word of a label: a run of characters other than spaces, with tags kept whole
+	// even when they hold spaces, such as <span class="x">.
+	labelWordRegexp = regexp.MustCompile(`(?:<[^>]*>|[^\s<])+`)
+
+	// romanRegexp matches a Roman numeral in upper case, such as XIV.
+	romanRegexp = regexp.MustCompile(`^M{0,3}(?:CM|CD|D?C{0,3})(?:XC|XL|L?X{0,3})(?:IX|IV|V?I{0,3})$`)
+)
+
+// smallWords are the articles, conjunctions and short prepositions kept in lower case by title case,
+// except as the first or the last word or after a colon.
+var smallWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true, "by": true, "en": true, "for": true,
+	"if": true, "in": true, "nor": true, "of": true, "off": true, "on": true, "or": true, "per": true, "so": true,
+	"the": true, "to": true, "up": true, "via": true, "vs": true, "yet": true,
+}
+
+// noCaseLanguages are the languages whose capitals follow the grammar rather than the position of the word,
+// such as German, where every noun is capitalised. Their labels are never recased.
+var noCaseLanguages = map[string]bool{"de": true}
+
+// CaseLabel returns the label in title case, as in "The Old Sea-Dog at the Admiral Benbow", for the mode
+// "title", or in sentence case, as in "The old sea-dog at the admiral benbow", for the mode "sentence". Any
+// other mode, or a language in noCaseLanguages such as "de-AT", returns the label as it is.
+//
+// The protected words map the lower case of a word to the way it is always written, such as "nasa" to "NASA"
+// or "mcgregor" to "McGregor"; proper nouns must be listed for sentence case. Unless the whole label is in
+// capitals, the words written in capitals, such as acronyms, and those with a capital inside, such as
+// "iPhone", are kept as they are. Roman numerals in capitals, such as "XIV", are always kept. The tags and
+// the character references of the label are never changed.
+func CaseLabel(label, mode, lang string, protected map[string]string) string {
+	base, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	if (mode != "title" && mode != "sentence") || noCaseLanguages[base] {
+		return label
+	}
+	labelCase := labelCase{mode: mode, english: base == "en", allCaps: strings.IndexFunc(plainText(label), unicode.IsLower) < 0,
+		protected: protected}
+	locs := labelWordRegexp.FindAllStringIndex(label, -1)
+	var sb strings.Builder
+	prev := 0
+	startOfSentence := true
+	for i, loc := range locs {
+		sb.WriteString(label[prev:loc[0]])
+		word := label[loc[0]:loc[1]]
+		sb.WriteString(labelCase.word(word, startOfSentence, i == len(locs)-1))
+		plain := strings.TrimRight(plainText(word), "”’\"')»")
+		startOfSentence = strings.HasSuffix(plain, ":") || strings.HasSuffix(plain, ".") || strings.HasSuffix(plain, "?") ||
+			strings.HasSuffix(plain, "!") || (mode == "title" && strings.ContainsAny(plain, "—–") && strings.Trim(plain, "—–") == "")
+		prev = loc[1]
+	}
+	sb.WriteString(label[prev:])
+	return sb.String()
+}
+
+// labelCase holds the settings of CaseLabel for the words of a label.
+type labelCase struct {
+	mode      string
+	english   bool // the pronoun "I" is always a capital
+	allCaps   bool // the whole label is in capitals, so capitals say nothing of acronyms
+	protected map[string]string
+}
+
+// word returns the word of a label in the case of the mode. The word is the first of a sentence or the
+// last of the label, which title case always capitalises.
+func (c labelCase) word(word string, first, last bool) string {
+	core := strings.TrimFunc(plainText(word), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if core == "" {
+		return word
+	}
+	stem := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(core, "'s"), "'S"), "’s") // possessive, as in McGregor's
+	if written, ok := c.protected[strings.ToLower(stem)]; ok {
+		return strings.Replace(word, core, written+strings.ToLower(core[len(stem):]), 1) // left alone when split by a tag
+	}
+	hasUpper := strings.IndexFunc(core, unicode.IsUpper) >= 0
+	hasLower := strings.IndexFunc(core, unicode.IsLower) >= 0
+	switch {
+	case c.english && strings.EqualFold(core, "i"):
+		return strings.Replace(word, core, "I", 1)
+	case hasUpper && !hasLower && romanRegexp.MatchString(core):
+		return word
+	case !c.allCaps && hasUpper && !hasLower && len([]rune(core)) > 1:
+		return word // an acronym
+	case !c.allCaps && hasLower && strings.IndexFunc(string([]rune(core)[1:]), unicode.IsUpper) >= 0:
+		return word // written with a capital inside on purpose, such as iPhone or McGregor
+	}
+	switch {
+	case c.mode == "title" && !first && !last && smallWords[strings.ToLower(core)]:
+		return recase(word, false, false)
+	case c.mode == "title":
+		return recase(word, true, true)
+	default:
+		return recase(word, first, false)
+	}
+}
+
+// recase returns the word in lower case, with the first letter in upper case if capitalise is true, and also
+// the first letter after each hyphen if hyphenParts is true. A word starting with a digit, such as "19th",
+// gets no capital. The tags and the character references are copied as they are.
+func recase(word string, capitalise, hyphenParts bool) string {
+	var sb strings.Builder
+	atStart := true
+	for len(word) > 0 {
+		if size := len(entityRegexp.FindString(word)); size > 0 {
+			sb.WriteString(word[:size])
+			word = word[size:]
+			continue
+		}
+		if word[0] == '<' {
+			end := strings.IndexByte(word, '>') + 1
+			if end == 0 {
+				end = len(word)
+			}
+			sb.WriteString(word[:end])
+			word = word[end:]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(word)
+		switch {
+		case unicode.IsLetter(r) && atStart && capitalise:
+			sb.WriteRune(unicode.ToTitle(r))
+			atStart = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			sb.WriteRune(unicode.ToLower(r))
+			atStart = false
+		default:
+			sb.WriteRune(r)
+			if r == '-' && hyphenParts {
+				atStart = true
+			}
+		}
+		word = word[size:]
+	}
+	return sb.String()
+}
+
+// plainText returns the label without its tags and with its character references replaced by the characters.
+func plainText(label string) string {
+	return html.UnescapeString(tagRegexp.ReplaceAllString(label, ""))
+}
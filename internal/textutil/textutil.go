@@ -0,0 +1,190 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 21-Oct-2023
+//
+// Collection of text utility functions.
+
+package textutil
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// entityRegexp matches an HTML character or entity reference at the start of a string.
+var entityRegexp = regexp.MustCompile(`^&(?:#[0-9]+|#[xX][0-9A-Fa-f]+|[A-Za-z][A-Za-z0-9]*);`)
+
+// EditDistance returns the Levenshtein distance between the two strings.
+func EditDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// Suggest returns the candidate closest to name within an edit distance of 2, or "" if there is none.
+func Suggest(name string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		if distance := EditDistance(name, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// TruncateLabel shortens the text of the label to at most max characters including the trailing ellipsis.
+// It cuts at the last space if that keeps at least half of the text, otherwise between two characters.
+// A character reference such as &amp; counts as one character and a character followed by combining
+// marks counts as one, so neither is ever split. The markup of the label, such as <i>, does not count: the
+// elements open at the cut are closed before the ellipsis. Labels within the limit are returned unchanged.
+func TruncateLabel(label string, max int) string {
+	units := labelUnits(label)
+	chars := 0
+	for _, unit := range units {
+		if !isTag(unit) {
+			chars++
+		}
+	}
+	if max <= 0 || chars <= max {
+		return label
+	}
+
+	// Keep the first max-1 characters with the markup between them.
+	end := 0
+	for chars = 0; chars < max-1; end++ {
+		if !isTag(units[end]) {
+			chars++
+		}
+	}
+	keep := units[:end]
+	for i := len(keep) - 1; i > 0; i-- {
+		if isTag(keep[i]) {
+			continue
+		}
+		if chars--; chars < (max-1)/2 || chars == 0 {
+			break
+		}
+		if keep[i] == " " {
+			keep = keep[:i]
+			break
+		}
+	}
+	for len(keep) > 0 && (keep[len(keep)-1] == " " || isStartTag(keep[len(keep)-1])) {
+		keep = keep[:len(keep)-1] // no trailing space, nor an element left empty
+	}
+	return strings.Join(keep, "") + closeTags(keep) + "…"
+}
+
+// tagNameRegexp matches the name of the element of a start or end tag.
+var tagNameRegexp = regexp.MustCompile(`^</?([A-Za-z][A-Za-z0-9:-]*)`)
+
+// isTag returns true if the unit of a label is a tag, see labelUnits.
+func isTag(unit string) bool {
+	return strings.HasPrefix(unit, "<")
+}
+
+// isStartTag returns true if the unit of a label is a start tag which is not self-closing.
+func isStartTag(unit string) bool {
+	return isTag(unit) && !strings.HasPrefix(unit, "</") && !strings.HasSuffix(unit, "/>")
+}
+
+// closeTags returns the end tags of the elements left open by the units of a label, innermost first.
+func closeTags(units []string) string {
+	open := make([]string, 0)
+	for _, unit := range units {
+		match := tagNameRegexp.FindStringSubmatch(unit)
+		switch {
+		case match == nil:
+		case isStartTag(unit):
+			open = append(open, match[1])
+		case strings.HasPrefix(unit, "</") && len(open) > 0 && open[len(open)-1] == match[1]:
+			open = open[:len(open)-1]
+		}
+	}
+	var sb strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		sb.WriteString("</" + open[i] + ">")
+	}
+	return sb.String()
+}
+
+// labelUnits splits the label into the units which must not be split: tags, character references and
+// characters together with their combining marks.
+func labelUnits(label string) []string {
+	units := make([]string, 0, len(label))
+	for len(label) > 0 {
+		size := len(entityRegexp.FindString(label))
+		if strings.HasPrefix(label, "<") {
+			size = strings.IndexByte(label, '>') + 1 // a tag, or the rest of the label if it is not closed
+			if size == 0 {
+				size = len(label)
+			}
+		}
+		if size == 0 {
+			_, size = utf8.DecodeRuneInString(label)
+			for size < len(label) {
+				r, next := utf8.DecodeRuneInString(label[size:])
+				if !unicode.In(r, unicode.Mn, unicode.Mc, unicode.Me) {
+					break
+				}
+				size += next
+			}
+		}
+		units = append(units, label[:size])
+		label = label[size:]
+	}
+	return units
+}
+
+// minInt returns the smaller of the two integers.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// tagRegexp matches an HTML tag.
+var tagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// Slug returns the heading as an identifier usable as an XML id and a file name: the text without markup,
+// lowercased, with runs of anything but letters and digits replaced by a single hyphen. Letters outside
+// ASCII are kept, so "Ørsted's Café" becomes "ørsted-s-café". A slug starting with a digit gets the prefix
+// "s-" since XML ids cannot start with one. Returns "" if the heading has no letters or digits.
+func Slug(heading string) string {
+	text := html.UnescapeString(tagRegexp.ReplaceAllString(heading, ""))
+	var slug strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if pendingHyphen && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			pendingHyphen = false
+			slug.WriteRune(r)
+		} else {
+			pendingHyphen = true
+		}
+	}
+	result := slug.String()
+	if first, _ := utf8.DecodeRuneInString(result); unicode.IsDigit(first) {
+		result = "s-" + result
+	}
+	return result
+}
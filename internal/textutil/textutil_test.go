@@ -0,0 +1,44 @@
+package textutil
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateLabel(t *testing.T) {
+	tests := []struct {
+		name  string
+		label string
+		max   int
+		want  string
+	}{
+		{"no limit", "The Hispaniola sails away today", 0, "The Hispaniola sails away today"},
+		{"within the limit", "Treasure Island", 15, "Treasure Island"},
+		{"between two characters", "The Hispaniola sails away today", 10, "The Hispa…"},
+		{"at the last space", "Chapter One: The Voyage Begins", 20, "Chapter One: The…"},
+		{"markup does not count", "The <i>Hispaniola</i>", 14, "The <i>Hispaniola</i>"},
+		{"markup closed", "The <i>Hispaniola</i> sails away today", 10, "The <i>Hispa</i>…"},
+		{"markup closed at a space", "Chapter <b>One: The Voyage</b> Begins", 20, "Chapter <b>One: The</b>…"},
+		{"nested markup closed", "<b>Part <i>One and Two</i></b>", 10, "<b>Part <i>One</i></b>…"},
+		{"no empty element", "Chapter One <i>Voyage</i>", 13, "Chapter One…"},
+		{"self-closing tag", "Line<br/>break here and more", 8, "Line<br/>bre…"},
+		{"CJK", "宝島への航海と冒険の物語", 6, "宝島への航…"},
+		{"CJK with markup", "宝島への<em>航海と冒険</em>の物語", 6, "宝島への<em>航</em>…"},
+		{"combining marks", "ééééé", 4, "ééé…"},
+		{"combining marks at the cut", "Cafés of Paris", 5, "Café…"},
+		{"entity at the cut", "AB&amp;CDEFG", 4, "AB&amp;…"},
+		{"entity before the space", "Tom &amp; Jerry &amp; Friends", 7, "Tom &amp;…"},
+		{"numeric entity", "&#8220;Ahoy&#8221; and more", 7, "&#8220;Ahoy&#8221;…"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := TruncateLabel(test.label, test.max)
+			if got != test.want {
+				t.Errorf("TruncateLabel(%q, %d) = %q, want %q", test.label, test.max, got, test.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("TruncateLabel(%q, %d) = %q is not valid UTF-8", test.label, test.max, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2022-2023, Roslan Amir. All rights reserved.
+// Created on: 07-Nov-2023
+//
+// The parsed book model as written by the -emit-model option.
+
+// Package model defines the JSON form of the parsed book model written by epubgen -emit-model, so that
+// other tools can render alternative outputs from the same source. The schema is versioned by the
+// SchemaVersion field; fields are only added within a version, never renamed or removed.
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SchemaVersion is the version of the model schema written by this release.
+const SchemaVersion = 1
+
+// Book is the parsed book model.
+type Book struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Attributes    map[string]string `json:"attributes"` // the metadata attributes from the <meta> tags
+	Sections      []Section         `json:"sections"`   // all the sections in spine order
+	CoverImage    Image             `json:"coverImage"`
+	Images        []Image           `json:"images"`                // the images other than the cover image, sorted by file name
+	Guides        []string          `json:"guides"`                // the IDs of the sections listed as landmarks
+	Structure     []Node            `json:"structure"`             // the section tree, with the chapters nested under their parts
+	StyleAssets   []string          `json:"styleAssets,omitempty"` // the files referenced from the stylesheet, see Section.Assets
+}
+
+// Section is a single section of the book.
+type Section struct {
+	ID      string   `json:"id"`               // the section ID, also the base name of its file
+	Kind    string   `json:"kind"`             // the epub:type of the section, such as "chapter" or "part"
+	Heading string   `json:"heading"`          // the heading shown in the table of contents
+	Lines   []string `json:"lines"`            // the body lines from the source, with figures and asset references resolved
+	Assets  []string `json:"assets,omitempty"` // the asset files the section refers to, relative to the package directory
+}
+
+// Image is an image file packaged in the book.
+type Image struct {
+	FileName  string `json:"fileName"`
+	MediaType string `json:"mediaType"`
+}
+
+// Node is a node of the section tree.
+type Node struct {
+	ID       string `json:"id"` // the ID of the section
+	Children []Node `json:"children,omitempty"`
+}
+
+// Read decodes a book model and checks that its schema version is supported.
+func Read(r io.Reader) (*Book, error) {
+	var book Book
+	if err := json.NewDecoder(r).Decode(&book); err != nil {
+		return nil, err
+	}
+	if book.SchemaVersion != SchemaVersion {
+		return nil, fmt.Errorf("model: unsupported schema version %d, expected %d", book.SchemaVersion, SchemaVersion)
+	}
+	return &book, nil
+}
+
+// ReadFile decodes the book model from the given file.
+func ReadFile(fileSpec string) (*Book, error) {
+	file, err := os.Open(fileSpec)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// Section returns the section with the given ID, or nil if there is none.
+func (book *Book) Section(id string) *Section {
+	for i := range book.Sections {
+		if book.Sections[i].ID == id {
+			return &book.Sections[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	book, err := Read(strings.NewReader(`{"schemaVersion": 1, "attributes": {"title": "The Book"},
+		"sections": [{"id": "section001", "kind": "chapter", "heading": "Chapter 1", "lines": ["<p>One</p>"]}],
+		"structure": [{"id": "section001"}], "futureField": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.Attributes["title"] != "The Book" || len(book.Structure) != 1 {
+		t.Errorf("book = %+v, want the title and the structure", book)
+	}
+	if section := book.Section("section001"); section == nil || section.Heading != "Chapter 1" || section.Lines[0] != "<p>One</p>" {
+		t.Errorf("Section(section001) = %+v, want the chapter", section)
+	}
+	if section := book.Section("section002"); section != nil {
+		t.Errorf("Section(section002) = %+v, want nil", section)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"other version", `{"schemaVersion": 2}`, "model: unsupported schema version 2, expected 1"},
+		{"no version", `{"sections": []}`, "model: unsupported schema version 0, expected 1"},
+		{"not JSON", `schemaVersion: 1`, "invalid character"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(test.content)); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Read error = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}